@@ -0,0 +1,4 @@
+// Package crudv1 содержит сгенерированный код gRPC API; определения - в *.proto этого каталога.
+package crudv1
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative crud/v1/auth.proto crud/v1/customers.proto crud/v1/products.proto crud/v1/sales.proto
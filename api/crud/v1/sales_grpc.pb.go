@@ -0,0 +1,145 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: crud/v1/sales.proto
+
+package crudv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// SalesServiceClient is the client API for SalesService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SalesServiceClient interface {
+	// CreateSale учитывает метаданные idempotency-key так же, как заголовок Idempotency-Key в HTTP API.
+	CreateSale(ctx context.Context, in *CreateSaleRequest, opts ...grpc.CallOption) (*Sale, error)
+	// GetSalesTotal возвращает сумму продаж менеджера.
+	GetSalesTotal(ctx context.Context, in *GetSalesTotalRequest, opts ...grpc.CallOption) (*SalesTotal, error)
+}
+
+type salesServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSalesServiceClient(cc grpc.ClientConnInterface) SalesServiceClient {
+	return &salesServiceClient{cc}
+}
+
+func (c *salesServiceClient) CreateSale(ctx context.Context, in *CreateSaleRequest, opts ...grpc.CallOption) (*Sale, error) {
+	out := new(Sale)
+	err := c.cc.Invoke(ctx, "/crud.v1.SalesService/CreateSale", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *salesServiceClient) GetSalesTotal(ctx context.Context, in *GetSalesTotalRequest, opts ...grpc.CallOption) (*SalesTotal, error) {
+	out := new(SalesTotal)
+	err := c.cc.Invoke(ctx, "/crud.v1.SalesService/GetSalesTotal", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SalesServiceServer is the server API for SalesService service.
+// All implementations must embed UnimplementedSalesServiceServer
+// for forward compatibility
+type SalesServiceServer interface {
+	// CreateSale учитывает метаданные idempotency-key так же, как заголовок Idempotency-Key в HTTP API.
+	CreateSale(context.Context, *CreateSaleRequest) (*Sale, error)
+	// GetSalesTotal возвращает сумму продаж менеджера.
+	GetSalesTotal(context.Context, *GetSalesTotalRequest) (*SalesTotal, error)
+	mustEmbedUnimplementedSalesServiceServer()
+}
+
+// UnimplementedSalesServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedSalesServiceServer struct {
+}
+
+func (UnimplementedSalesServiceServer) CreateSale(context.Context, *CreateSaleRequest) (*Sale, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateSale not implemented")
+}
+func (UnimplementedSalesServiceServer) GetSalesTotal(context.Context, *GetSalesTotalRequest) (*SalesTotal, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSalesTotal not implemented")
+}
+func (UnimplementedSalesServiceServer) mustEmbedUnimplementedSalesServiceServer() {}
+
+// UnsafeSalesServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SalesServiceServer will
+// result in compilation errors.
+type UnsafeSalesServiceServer interface {
+	mustEmbedUnimplementedSalesServiceServer()
+}
+
+func RegisterSalesServiceServer(s grpc.ServiceRegistrar, srv SalesServiceServer) {
+	s.RegisterService(&SalesService_ServiceDesc, srv)
+}
+
+func _SalesService_CreateSale_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateSaleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SalesServiceServer).CreateSale(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/crud.v1.SalesService/CreateSale",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SalesServiceServer).CreateSale(ctx, req.(*CreateSaleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SalesService_GetSalesTotal_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSalesTotalRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SalesServiceServer).GetSalesTotal(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/crud.v1.SalesService/GetSalesTotal",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SalesServiceServer).GetSalesTotal(ctx, req.(*GetSalesTotalRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// SalesService_ServiceDesc is the grpc.ServiceDesc for SalesService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SalesService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "crud.v1.SalesService",
+	HandlerType: (*SalesServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateSale",
+			Handler:    _SalesService_CreateSale_Handler,
+		},
+		{
+			MethodName: "GetSalesTotal",
+			Handler:    _SalesService_GetSalesTotal_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "crud/v1/sales.proto",
+}
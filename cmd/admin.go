@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/shohinsherov/crud/pkg/config"
+	"github.com/shohinsherov/crud/pkg/customers"
+	"github.com/shohinsherov/crud/pkg/managers"
+	"github.com/shohinsherov/crud/pkg/migrations"
+	"go.uber.org/zap"
+)
+
+// admin - зависимости административных подкоманд.
+type admin struct {
+	customersSvc *customers.Service
+	managersSvc  *managers.Service
+}
+
+// adminCommands - подкоманды вида "crud <группа> <действие>".
+var adminCommands = map[string]map[string]func(ctx context.Context, a *admin, args []string) error{
+	"admin": {
+		"create": adminCreate,
+	},
+	"manager": {
+		"reset-password": managerResetPassword,
+	},
+	"tokens": {
+		"purge-expired": tokensPurgeExpired,
+	},
+	"customer": {
+		"block": customerBlock,
+	},
+	"product": {
+		"import": productImport,
+	},
+}
+
+// runAdmin выполняет административную подкоманду напрямую против базы из конфигурации.
+func runAdmin(cfg *config.Config, logger *zap.Logger, group string, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	command, ok := adminCommands[group][args[0]]
+	if !ok {
+		return errUsage
+	}
+
+	pool, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	ctx := context.Background()
+	migrator, err := migrations.NewMigrator(pool, logger)
+	if err != nil {
+		return err
+	}
+	_, err = migrator.Up(ctx)
+	if err != nil {
+		return err
+	}
+
+	a := &admin{
+		customersSvc: customers.NewService(customers.NewPgxRepo(pool), &cfg.Auth, logger),
+		managersSvc:  managers.NewService(managers.NewPgxRepo(pool), &cfg.Auth, logger),
+	}
+	return command(ctx, a, args[1:])
+}
+
+func adminCreate(ctx context.Context, a *admin, args []string) error {
+	fs := flag.NewFlagSet("admin create", flag.ContinueOnError)
+	name := fs.String("name", "", "manager name")
+	phone := fs.String("phone", "", "manager phone (login)")
+	password := fs.String("password", "", "password (read from stdin if empty)")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *name == "" || *phone == "" || fs.NArg() != 0 {
+		return errUsage
+	}
+	err = readPassword(password)
+	if err != nil {
+		return err
+	}
+
+	reg, err := a.managersSvc.Create(ctx, &managers.Registration{
+		Name:  *name,
+		Phone: *phone,
+		Roles: []string{managers.ADMIN},
+	}, *password)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("admin %d created\n", reg.ID)
+	return nil
+}
+
+func managerResetPassword(ctx context.Context, a *admin, args []string) error {
+	fs := flag.NewFlagSet("manager reset-password", flag.ContinueOnError)
+	phone := fs.String("phone", "", "manager phone (login)")
+	password := fs.String("password", "", "new password (read from stdin if empty)")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *phone == "" || fs.NArg() != 0 {
+		return errUsage
+	}
+	err = readPassword(password)
+	if err != nil {
+		return err
+	}
+
+	err = a.managersSvc.ResetPassword(ctx, *phone, *password)
+	if err != nil {
+		return err
+	}
+	fmt.Println("password changed, active tokens revoked")
+	return nil
+}
+
+func tokensPurgeExpired(ctx context.Context, a *admin, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	managersCount, err := a.managersSvc.PurgeExpiredTokens(ctx)
+	if err != nil {
+		return err
+	}
+	customersCount, err := a.customersSvc.PurgeExpiredTokens(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("purged %d manager and %d customer token(s)\n", managersCount, customersCount)
+	return nil
+}
+
+func customerBlock(ctx context.Context, a *admin, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return errUsage
+	}
+
+	customer, err := a.customersSvc.BlockByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("customer %d (%s) blocked\n", customer.ID, customer.Phone)
+	return nil
+}
+
+// productImport загружает товары из CSV с заголовком.
+// Обязательные колонки: name, price; необязательные: sku, qty, category_id, attributes (JSON-объект).
+// Товары с уже существующим SKU обновляются; отсутствующие колонки и пустые ячейки сохраняют прежние значения.
+func productImport(ctx context.Context, a *admin, args []string) error {
+	fs := flag.NewFlagSet("product import", flag.ContinueOnError)
+	managerID := fs.Int64("manager", 0, "manager id recorded in price history")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+
+	var input io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+
+	reader := csv.NewReader(input)
+	header, err := reader.Read()
+	if err != nil {
+		return err
+	}
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[strings.TrimSpace(strings.ToLower(column))] = i
+	}
+	for _, required := range []string{"name", "price"} {
+		if _, ok := columns[required]; !ok {
+			return fmt.Errorf("column %q is required", required)
+		}
+	}
+
+	created, updated := 0, 0
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		product, fields, err := parseProduct(columns, record)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		isNew, err := a.managersSvc.ImportProduct(ctx, *managerID, product, fields)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if isNew {
+			created++
+		} else {
+			updated++
+		}
+	}
+	fmt.Printf("imported %d product(s): %d created, %d updated\n", created+updated, created, updated)
+	return nil
+}
+
+func parseProduct(columns map[string]int, record []string) (*managers.Product, managers.ImportedFields, error) {
+	field := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	product := &managers.Product{Name: field("name"), SKU: field("sku")}
+	fields := managers.ImportedFields{SKU: product.SKU != ""}
+	if product.Name == "" {
+		return nil, fields, errors.New("name is empty")
+	}
+
+	var err error
+	product.Price, err = strconv.Atoi(field("price"))
+	if err != nil || product.Price <= 0 {
+		return nil, fields, managers.ErrInvalidPrice
+	}
+	if value := field("qty"); value != "" {
+		fields.Qty = true
+		product.Qty, err = strconv.Atoi(value)
+		if err != nil || product.Qty < 0 {
+			return nil, fields, fmt.Errorf("invalid qty %q", value)
+		}
+	}
+	if value := field("category_id"); value != "" {
+		fields.CategoryID = true
+		product.CategoryID, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fields, fmt.Errorf("invalid category_id %q", value)
+		}
+	}
+	if value := field("attributes"); value != "" {
+		fields.Attributes = true
+		err = json.Unmarshal([]byte(value), &product.Attributes)
+		if err != nil {
+			return nil, fields, fmt.Errorf("invalid attributes: %w", err)
+		}
+	}
+	return product, fields, nil
+}
+
+// readPassword читает пароль из первой строки stdin, если он не передан флагом.
+func readPassword(password *string) error {
+	if *password != "" {
+		return nil
+	}
+	fmt.Fprint(os.Stderr, "password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	*password = strings.TrimRight(line, "\r\n")
+	if *password == "" {
+		return errors.New("password is required")
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/shohinsherov/crud/cmd/app/middleware"
+	"github.com/shohinsherov/crud/pkg/managers"
+	"go.uber.org/zap"
+)
+
+// attributeParamPrefix - префикс параметров запроса для фильтра по атрибутам (?attr.colour=red).
+const attributeParamPrefix = "attr."
+
+// parseProductFilter читает из запроса category_id и атрибуты товара.
+func parseProductFilter(request *http.Request) (categoryID int64, attributes map[string]string, err error) {
+	query := request.URL.Query()
+	if value := query.Get("category_id"); value != "" {
+		categoryID, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	attributes = make(map[string]string)
+	for key, values := range query {
+		if strings.HasPrefix(key, attributeParamPrefix) && len(values) > 0 {
+			attributes[strings.TrimPrefix(key, attributeParamPrefix)] = values[0]
+		}
+	}
+	return categoryID, attributes, nil
+}
+
+func (s *Server) handleCustomerGetCategories(writer http.ResponseWriter, request *http.Request) {
+	items, err := s.customersSvc.Categories(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("customer get categories failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(writer, request, items)
+}
+
+func (s *Server) handleManagerGetCategories(writer http.ResponseWriter, request *http.Request) {
+	id, err := middleware.Authentication(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("get categories: authentication failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	items, err := s.managersSvc.Categories(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("get categories failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(writer, request, items)
+}
+
+func (s *Server) handleManagerChangeCategory(writer http.ResponseWriter, request *http.Request) {
+	id, err := middleware.Authentication(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("change category: authentication failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	category := &managers.Category{}
+	err = json.NewDecoder(request.Body).Decode(&category)
+	if err != nil {
+		s.log(request.Context()).Warn("can't decode category", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	category, err = s.managersSvc.SaveCategory(request.Context(), category)
+	if errors.Is(err, managers.ErrNotFound) {
+		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.log(request.Context()).Error("change category failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(writer, request, category)
+}
+
+func (s *Server) handleManagerChangeVariant(writer http.ResponseWriter, request *http.Request) {
+	id, err := middleware.Authentication(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("change variant: authentication failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	productID, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		s.log(request.Context()).Warn("change variant: invalid id", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	variant := &managers.Variant{}
+	err = json.NewDecoder(request.Body).Decode(&variant)
+	if err != nil {
+		s.log(request.Context()).Warn("can't decode variant", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	variant.ProductID = productID
+
+	variant, err = s.managersSvc.SaveVariant(request.Context(), variant)
+	if errors.Is(err, managers.ErrNotFound) {
+		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.log(request.Context()).Error("change variant failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(writer, request, variant)
+}
+
+func (s *Server) handleManagerLookupProduct(writer http.ResponseWriter, request *http.Request) {
+	id, err := middleware.Authentication(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("lookup product: authentication failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	code := request.URL.Query().Get("barcode")
+	sku := request.URL.Query().Get("sku")
+	if code == "" && sku == "" {
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.managersSvc.Lookup(request.Context(), code, sku)
+	if err != nil {
+		s.log(request.Context()).Error("lookup product failed", zap.Error(err))
+		writeManagerError(writer, err)
+		return
+	}
+
+	s.writeJSON(writer, request, result)
+}
+
+func (s *Server) handleManagerAddBarcode(writer http.ResponseWriter, request *http.Request) {
+	id, err := middleware.Authentication(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("add barcode: authentication failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	productID, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		s.log(request.Context()).Warn("add barcode: invalid id", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	item := &managers.Barcode{}
+	err = json.NewDecoder(request.Body).Decode(&item)
+	if err != nil {
+		s.log(request.Context()).Warn("can't decode barcode", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	item.ProductID = productID
+
+	item, err = s.managersSvc.AddBarcode(request.Context(), item)
+	if err != nil {
+		s.log(request.Context()).Error("add barcode failed", zap.Error(err))
+		writeManagerError(writer, err)
+		return
+	}
+
+	s.writeJSON(writer, request, item)
+}
+
+func (s *Server) handleManagerRemoveBarcode(writer http.ResponseWriter, request *http.Request) {
+	id, err := middleware.Authentication(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("remove barcode: authentication failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	productID, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		s.log(request.Context()).Warn("remove barcode: invalid id", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	err = s.managersSvc.RemoveBarcode(request.Context(), productID, mux.Vars(request)["barcode"])
+	if err != nil {
+		s.log(request.Context()).Error("remove barcode failed", zap.Error(err))
+		writeManagerError(writer, err)
+		return
+	}
+}
@@ -2,12 +2,12 @@ package app
 
 import (
 	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/shohinsherov/crud/pkg/customers"
-	
+	"go.uber.org/zap"
 )
 
 func (s *Server) handleCustomerRegistration(writer http.ResponseWriter, request *http.Request) {
@@ -37,17 +37,16 @@ func (s *Server) handleCustomerRegistration(writer http.ResponseWriter, request
 func (s *Server) handleCustomerGetToken(writer http.ResponseWriter, request *http.Request) {
 	var auth *customers.Auth
 	err := json.NewDecoder(request.Body).Decode(&auth)
-	fmt.Print(auth)
 	if err != nil {
-		log.Print("Can't Decode login and password")
+		s.log(request.Context()).Warn("can't decode login and password", zap.Error(err))
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
-	log.Print("Login: ", auth.Login, "Password: ", auth.Password)
 
 	token, err := s.customersSvc.Token(request.Context(), auth.Login, auth.Password)
+	s.recordLogin("customer", err, customers.ErrInvalidPassword)
 	if err != nil {
-		log.Print(err)
+		s.log(request.Context()).Error("customer get token failed", zap.Error(err))
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
@@ -66,26 +65,63 @@ func (s *Server) handleCustomerGetToken(writer http.ResponseWriter, request *htt
 }
 
 func (s *Server) handleCustomerGetProducts(writer http.ResponseWriter, request *http.Request) {
-	items, err := s.customersSvc.Products(request.Context())
+	categoryID, attributes, err := parseProductFilter(request)
 	if err != nil {
-		log.Print(err)
-		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.log(request.Context()).Warn("customer get products: invalid filter", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
-	data, err := json.Marshal(items)
+	items, err := s.customersSvc.Products(request.Context(), &customers.ProductFilter{CategoryID: categoryID, Attributes: attributes})
 	if err != nil {
-		log.Print(err)
+		s.log(request.Context()).Error("customer get products failed", zap.Error(err))
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	writer.Header().Set("Content-Type", "application/json")
-	_, err = writer.Write(data)
+	s.writeCacheable(writer, request, items)
+}
+
+func (s *Server) handleCustomerSearchProducts(writer http.ResponseWriter, request *http.Request) {
+	params := request.URL.Query()
+	query := &customers.SearchQuery{Query: strings.TrimSpace(params.Get("q"))}
+	if query.Query == "" {
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	for name, value := range map[string]*int{
+		"min_price": &query.MinPrice,
+		"max_price": &query.MaxPrice,
+		"limit":     &query.Limit,
+		"offset":    &query.Offset,
+	} {
+		if params.Get(name) == "" {
+			continue
+		}
+		*value, err = strconv.Atoi(params.Get(name))
+		if err != nil || *value < 0 {
+			s.log(request.Context()).Warn("invalid query parameter", zap.String("name", name))
+			http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+	}
+	if params.Get("in_stock") != "" {
+		query.InStock, err = strconv.ParseBool(params.Get("in_stock"))
+		if err != nil {
+			s.log(request.Context()).Warn("invalid query parameter", zap.String("name", "in_stock"))
+			http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+	}
+
+	items, err := s.customersSvc.Search(request.Context(), query)
 	if err != nil {
+		s.log(request.Context()).Error("customer search products failed", zap.Error(err))
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
-}
-
 
+	s.writeJSON(writer, request, items)
+}
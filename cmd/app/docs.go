@@ -0,0 +1,57 @@
+package app
+
+import (
+	_ "embed"
+	"net/http"
+
+	swaggerFiles "github.com/swaggo/files"
+	"go.uber.org/zap"
+)
+
+// openAPISpec - спецификация OpenAPI 3 всех маршрутов Init.
+// Новый маршрут нужно описать в openapi.json, иначе упадёт TestOpenAPI_Routes.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// swaggerInitializer заменяет демонстрационную настройку Swagger UI: интерфейс открывает нашу спецификацию.
+const swaggerInitializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "/api/openapi.json",
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    presets: [
+      SwaggerUIBundle.presets.apis,
+      SwaggerUIStandalonePreset
+    ],
+    plugins: [
+      SwaggerUIBundle.plugins.DownloadUrl
+    ],
+    layout: "StandaloneLayout"
+  });
+};
+`
+
+// initDocs регистрирует спецификацию и Swagger UI по адресу /api/docs/.
+func (s *Server) initDocs() {
+	s.mux.HandleFunc("/api/openapi.json", s.handleOpenAPI).Methods(GET)
+	s.mux.Handle("/api/docs", http.RedirectHandler("/api/docs/", http.StatusMovedPermanently)).Methods(GET)
+	s.mux.HandleFunc("/api/docs/swagger-initializer.js", s.handleSwaggerInitializer).Methods(GET)
+	s.mux.PathPrefix("/api/docs/").Handler(http.StripPrefix("/api/docs", http.FileServer(swaggerFiles.HTTP))).Methods(GET)
+}
+
+func (s *Server) handleOpenAPI(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+	_, err := writer.Write(openAPISpec)
+	if err != nil {
+		s.log(request.Context()).Error("can't write response", zap.Error(err))
+	}
+}
+
+func (s *Server) handleSwaggerInitializer(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/javascript")
+	_, err := writer.Write([]byte(swaggerInitializer))
+	if err != nil {
+		s.log(request.Context()).Error("can't write response", zap.Error(err))
+	}
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/shohinsherov/crud/pkg/customers"
+	"github.com/shohinsherov/crud/pkg/idempotency"
+	"github.com/shohinsherov/crud/pkg/managers"
+	"github.com/shohinsherov/crud/pkg/webhooks"
+	"google.golang.org/grpc/codes"
+)
+
+var errForbidden = errors.New("forbidden")
+
+// serviceErrors - ответы на ошибки сервисов для HTTP и gRPC. Обработчики обоих транспортов
+// берут код отсюда, поэтому на одну и ту же ошибку клиенты получают одинаковый ответ.
+var serviceErrors = []struct {
+	err    error
+	status int
+	code   codes.Code
+}{
+	{managers.ErrInvalidBarcode, http.StatusBadRequest, codes.InvalidArgument},
+	{managers.ErrInvalidPrice, http.StatusBadRequest, codes.InvalidArgument},
+	{managers.ErrInvalidCustomer, http.StatusBadRequest, codes.InvalidArgument},
+	{managers.ErrInvalidPeriod, http.StatusBadRequest, codes.InvalidArgument},
+	{managers.ErrInvalidCategory, http.StatusBadRequest, codes.InvalidArgument},
+	{errInvalidBody, http.StatusBadRequest, codes.InvalidArgument},
+	{idempotency.ErrInvalidKey, http.StatusBadRequest, codes.InvalidArgument},
+	{webhooks.ErrInvalidWebhook, http.StatusBadRequest, codes.InvalidArgument},
+	{managers.ErrInvalidPassword, http.StatusUnauthorized, codes.Unauthenticated},
+	{customers.ErrInvalidPassword, http.StatusUnauthorized, codes.Unauthenticated},
+	{customers.ErrNoSuchUser, http.StatusUnauthorized, codes.Unauthenticated},
+	{errForbidden, http.StatusForbidden, codes.PermissionDenied},
+	{managers.ErrNotFound, http.StatusNotFound, codes.NotFound},
+	{webhooks.ErrNotFound, http.StatusNotFound, codes.NotFound},
+	{managers.ErrBarcodeUsed, http.StatusConflict, codes.AlreadyExists},
+	{managers.ErrPhoneUsed, http.StatusConflict, codes.AlreadyExists},
+	{customers.ErrPhoneUsed, http.StatusConflict, codes.AlreadyExists},
+	{managers.ErrOutOfStock, http.StatusConflict, codes.FailedPrecondition},
+	{idempotency.ErrInProgress, http.StatusConflict, codes.Aborted},
+	{managers.ErrVersionMismatch, http.StatusPreconditionFailed, codes.Aborted},
+	{errUnsupportedPatch, http.StatusUnsupportedMediaType, codes.InvalidArgument},
+	{idempotency.ErrKeyReused, http.StatusUnprocessableEntity, codes.InvalidArgument},
+	{errPreconditionRequired, http.StatusPreconditionRequired, codes.FailedPrecondition},
+}
+
+// errorStatus возвращает HTTP-код ответа на err; неизвестные ошибки - 500.
+func errorStatus(err error) int {
+	for _, item := range serviceErrors {
+		if errors.Is(err, item.err) {
+			return item.status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// errorCode возвращает код gRPC для err; неизвестные ошибки - Internal.
+func errorCode(err error) codes.Code {
+	for _, item := range serviceErrors {
+		if errors.Is(err, item.err) {
+			return item.code
+		}
+	}
+	return codes.Internal
+}
+
+func writeManagerError(writer http.ResponseWriter, err error) {
+	status := errorStatus(err)
+	http.Error(writer, http.StatusText(status), status)
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/shohinsherov/crud/pkg/managers"
+	"go.uber.org/zap"
+)
+
+var errPreconditionRequired = errors.New("if-match required")
+
+// versionETag возвращает сильный ETag записи с версией version.
+func versionETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ifMatchVersion возвращает версию из заголовка If-Match: 0 для "*" (любая версия),
+// errPreconditionRequired, если заголовка нет, и managers.ErrVersionMismatch,
+// если значение не может совпасть ни с одной версией (список, слабый или чужой ETag).
+func ifMatchVersion(request *http.Request) (int64, error) {
+	value := strings.TrimSpace(request.Header.Get("If-Match"))
+	if value == "" {
+		return 0, errPreconditionRequired
+	}
+	if value == "*" {
+		return 0, nil
+	}
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return 0, managers.ErrVersionMismatch
+	}
+	version, err := strconv.ParseInt(value[1:len(value)-1], 10, 64)
+	if err != nil || version <= 0 {
+		return 0, managers.ErrVersionMismatch
+	}
+	return version, nil
+}
+
+// notModified сообщает, что If-None-Match содержит etag; W/ при сравнении не учитывается.
+func notModified(request *http.Request, etag string) bool {
+	for _, value := range strings.Split(request.Header.Get("If-None-Match"), ",") {
+		value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+		if value == "*" || value == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeTagged отправляет item с заголовком ETag; GET с совпавшим If-None-Match получает 304 без тела.
+func (s *Server) writeTagged(writer http.ResponseWriter, request *http.Request, etag string, item interface{}) {
+	writer.Header().Set("ETag", etag)
+	if request.Method == http.MethodGet && notModified(request, etag) {
+		writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+	s.writeJSON(writer, request, item)
+}
+
+// writeCacheable отправляет item с ETag по хешу тела: так помечаются списки, у которых нет общей версии.
+func (s *Server) writeCacheable(writer http.ResponseWriter, request *http.Request, item interface{}) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		s.log(request.Context()).Error("can't write response", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	writer.Header().Set("ETag", etag)
+	if notModified(request, etag) {
+		writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	_, err = writer.Write(data)
+	if err != nil {
+		s.log(request.Context()).Error("can't write response", zap.Error(err))
+	}
+}
@@ -0,0 +1,236 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/shohinsherov/crud/cmd/app/middleware"
+	"github.com/shohinsherov/crud/pkg/hub"
+	"github.com/shohinsherov/crud/pkg/managers"
+	"go.uber.org/zap"
+)
+
+// eventTypes - типы событий, на которые можно подписаться через параметр types.
+var eventTypes = map[string]bool{
+	managers.EventStockChanged: true,
+	managers.EventPriceChanged: true,
+	managers.EventSaleCreated:  true,
+}
+
+// eventsWriteWait - сколько ждать записи одного сообщения в WebSocket.
+const eventsWriteWait = 10 * time.Second
+
+// eventsRetry - через сколько миллисекунд клиент Server-Sent Events переподключается после конца ответа.
+const eventsRetry = 1000
+
+var eventsUpgrader = websocket.Upgrader{}
+
+// handleManagerEvents отправляет поток событий об остатках, ценах и продажах: по WebSocket, если клиент
+// просит Upgrade, иначе как Server-Sent Events. Администратор получает все события, менеджер - изменения
+// остатков и цен и только свои продажи. Поток продолжается с события после Last-Event-ID.
+func (s *Server) handleManagerEvents(writer http.ResponseWriter, request *http.Request) {
+	id, err := middleware.Authentication(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("stream events: authentication failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	types, lastID, err := parseEventsRequest(request)
+	if err != nil {
+		s.log(request.Context()).Warn("invalid events request", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	filter := eventFilter(id, s.managersSvc.IsAdmin(request.Context(), id), types)
+
+	if websocket.IsWebSocketUpgrade(request) {
+		s.streamWebSocket(writer, request, lastID, filter)
+		return
+	}
+	s.streamSSE(writer, request, lastID, filter)
+}
+
+// parseEventsRequest читает типы событий из types (через запятую; пусто - все типы) и номер последнего
+// полученного события из заголовка Last-Event-ID или параметра lastEventId.
+func parseEventsRequest(request *http.Request) (types map[string]bool, lastID int64, err error) {
+	types = make(map[string]bool)
+	if value := request.URL.Query().Get("types"); value != "" {
+		for _, typ := range strings.Split(value, ",") {
+			if !eventTypes[typ] {
+				return nil, 0, fmt.Errorf("unknown event type %q", typ)
+			}
+			types[typ] = true
+		}
+	}
+
+	value := request.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = request.URL.Query().Get("lastEventId")
+	}
+	if value != "" {
+		lastID, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || lastID < 0 {
+			return nil, 0, fmt.Errorf("invalid last event id %q", value)
+		}
+	}
+	return types, lastID, nil
+}
+
+// eventFilter пропускает события из types (пустой - все) и продажи, доступные менеджеру managerID.
+func eventFilter(managerID int64, admin bool, types map[string]bool) func(event *hub.Event) bool {
+	return func(event *hub.Event) bool {
+		if len(types) != 0 && !types[event.Type] {
+			return false
+		}
+		return admin || event.Audience == 0 || event.Audience == managerID
+	}
+}
+
+// streamSSE отправляет события как Server-Sent Events. Ответ длится не дольше events.stream_timeout,
+// чтобы не упереться в write-timeout сервера: затем клиент переподключается с Last-Event-ID.
+func (s *Server) streamSSE(writer http.ResponseWriter, request *http.Request, lastID int64, filter func(event *hub.Event) bool) {
+	ctx := request.Context()
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		s.log(ctx).Error("stream events: streaming is not supported")
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	subscription, missed := s.events.Subscribe(lastID, filter)
+	defer subscription.Close()
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+	_, err := fmt.Fprintf(writer, "retry: %d\n\n", eventsRetry)
+	for _, event := range missed {
+		if err == nil {
+			err = writeSSE(writer, event)
+		}
+	}
+	if err != nil {
+		s.log(ctx).Warn("can't write event", zap.Error(err))
+		return
+	}
+	flusher.Flush()
+
+	timeout := time.NewTimer(s.eventsConfig.StreamTimeout.Duration())
+	defer timeout.Stop()
+	heartbeat := time.NewTicker(s.eventsConfig.Heartbeat.Duration())
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timeout.C:
+			return
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(writer, ": heartbeat\n\n")
+		case event, ok := <-subscription.Events():
+			if !ok {
+				s.log(ctx).Warn("events subscriber is too slow")
+				return
+			}
+			err = writeSSE(writer, event)
+		}
+		if err != nil {
+			s.log(ctx).Warn("can't write event", zap.Error(err))
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeSSE пишет событие целиком в поле data; id и event дублируют его номер и тип.
+func writeSSE(writer http.ResponseWriter, event *hub.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// streamWebSocket отправляет события JSON-сообщениями по WebSocket, пока клиент не закроет соединение.
+// Сообщения клиента не читаются, кроме служебных; отстающий клиент отключается с кодом 1013 и может
+// переподключиться с lastEventId.
+func (s *Server) streamWebSocket(writer http.ResponseWriter, request *http.Request, lastID int64, filter func(event *hub.Event) bool) {
+	// Подписка до рукопожатия: события, отправленные сразу после него, не теряются.
+	subscription, missed := s.events.Subscribe(lastID, filter)
+	defer subscription.Close()
+
+	conn, err := eventsUpgrader.Upgrade(writer, request, nil)
+	if err != nil {
+		// Upgrade уже отправил клиенту ответ с ошибкой.
+		s.log(request.Context()).Warn("can't upgrade to websocket", zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	// После захвата соединения контекст запроса не отменяется, когда клиент уходит: об этом говорит чтение.
+	ctx, cancel := context.WithCancel(request.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			_, _, err := conn.NextReader()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for _, event := range missed {
+		err = writeWebSocket(conn, event)
+		if err != nil {
+			s.log(ctx).Warn("can't write event", zap.Error(err))
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(s.eventsConfig.Heartbeat.Duration())
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventsWriteWait))
+		case event, ok := <-subscription.Events():
+			if !ok {
+				s.log(ctx).Warn("events subscriber is too slow")
+				message := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow")
+				_ = conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(eventsWriteWait))
+				return
+			}
+			err = writeWebSocket(conn, event)
+		}
+		if err != nil {
+			s.log(ctx).Warn("can't write event", zap.Error(err))
+			return
+		}
+	}
+}
+
+func writeWebSocket(conn *websocket.Conn, event *hub.Event) error {
+	err := conn.SetWriteDeadline(time.Now().Add(eventsWriteWait))
+	if err != nil {
+		return err
+	}
+	return conn.WriteJSON(event)
+}
@@ -0,0 +1,147 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/shohinsherov/crud/pkg/config"
+	"github.com/shohinsherov/crud/pkg/hub"
+	"github.com/shohinsherov/crud/pkg/managers"
+)
+
+// sseEvent - событие из ответа text/event-stream.
+type sseEvent struct {
+	id  int64
+	typ string
+}
+
+func readSSE(t *testing.T, recorder *httptest.ResponseRecorder) []sseEvent {
+	t.Helper()
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("got status %d, content type %q: %s", recorder.Code, recorder.Header().Get("Content-Type"), recorder.Body.String())
+	}
+	events := make([]sseEvent, 0)
+	for _, block := range strings.Split(recorder.Body.String(), "\n\n") {
+		event := sseEvent{}
+		for _, line := range strings.Split(block, "\n") {
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				event.id, _ = strconv.ParseInt(strings.TrimPrefix(line, "id: "), 10, 64)
+			case strings.HasPrefix(line, "event: "):
+				event.typ = strings.TrimPrefix(line, "event: ")
+			}
+		}
+		if event.typ != "" {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// testSales создаёт товар и по продаже от каждого менеджера. Номера событий: 1 и 2 - цена и остаток
+// нового товара, 3 и 4 - продажа first и остаток, 5 и 6 - продажа second и остаток.
+func testSales(t *testing.T, server *Server, first int64, second int64) {
+	t.Helper()
+	ctx := context.Background()
+	product, err := server.managersSvc.CreateProduct(ctx, first, &managers.Product{Name: "Хлеб", Price: 5, Qty: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, managerID := range []int64{first, second} {
+		_, err = server.managersSvc.MakeSale(ctx, &managers.Sale{ManagerID: managerID, Positions: []*managers.SalePosition{{ProductID: product.ID, Qty: 1, Price: 5}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEvents_ServerSentEvents(t *testing.T) {
+	server := newTestServer()
+	server.eventsConfig.StreamTimeout = config.Duration(50 * time.Millisecond)
+	managerToken := testManagerToken(t, server)
+	adminToken := testAdminToken(t, server)
+	ctx := context.Background()
+	managerID, _ := server.managersSvc.IDByToken(ctx, managerToken)
+	adminID, _ := server.managersSvc.IDByToken(ctx, adminToken)
+	testSales(t, server, adminID, managerID)
+
+	resume := http.Header{}
+	resume.Set("Last-Event-ID", "1")
+	for _, item := range []struct {
+		name  string
+		token string
+		path  string
+		want  []sseEvent
+	}{
+		{"manager", managerToken, "/api/managers/events", []sseEvent{{2, managers.EventStockChanged}, {4, managers.EventStockChanged}, {5, managers.EventSaleCreated}, {6, managers.EventStockChanged}}},
+		{"admin sales", adminToken, "/api/v1/managers/events?types=sale.created", []sseEvent{{3, managers.EventSaleCreated}, {5, managers.EventSaleCreated}}},
+		{"lost history", managerToken, "/api/v1/managers/events?lastEventId=100", []sseEvent{{6, hub.Reset}}},
+	} {
+		header := resume
+		if strings.Contains(item.path, "lastEventId") {
+			header = nil
+		}
+		got := readSSE(t, managerRequest(t, server, item.token, GET, item.path, header, nil))
+		if len(got) != len(item.want) {
+			t.Errorf("%s: got %+v, want %+v", item.name, got, item.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != item.want[i] {
+				t.Errorf("%s: got %+v, want %+v", item.name, got, item.want)
+				break
+			}
+		}
+	}
+
+	recorder := managerRequest(t, server, "", GET, "/api/v1/managers/events", nil, nil)
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("without token: got status %d, want 403", recorder.Code)
+	}
+	recorder = managerRequest(t, server, managerToken, GET, "/api/v1/managers/events?types=customer.created", nil, nil)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("unknown type: got status %d, want 400", recorder.Code)
+	}
+}
+
+func TestEvents_WebSocket(t *testing.T) {
+	server := newTestServer()
+	managerToken := testManagerToken(t, server)
+	adminToken := testAdminToken(t, server)
+	ctx := context.Background()
+	managerID, _ := server.managersSvc.IDByToken(ctx, managerToken)
+	adminID, _ := server.managersSvc.IDByToken(ctx, adminToken)
+
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/api/v1/managers/events?types=sale.created"
+	conn, response, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {managerToken}})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("got status %d, want 101", response.StatusCode)
+	}
+
+	testSales(t, server, adminID, managerID)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var event struct {
+		ID   int64
+		Type string
+		Data managers.Sale
+	}
+	err = conn.ReadJSON(&event)
+	if err != nil {
+		t.Fatalf("read event: %v", err)
+	}
+	if event.ID != 5 || event.Type != managers.EventSaleCreated || event.Data.ManagerID != managerID {
+		t.Errorf("got %+v, want own sale with id 5", event)
+	}
+}
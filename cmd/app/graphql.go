@@ -0,0 +1,193 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/shohinsherov/crud/cmd/app/middleware"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+)
+
+// graphQLPath - адрес GraphQL API для back-office.
+const graphQLPath = "/graphql"
+
+// graphQLRequest - запрос к /graphql: тело POST или параметры GET с теми же именами.
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// graphQLViewer - менеджер, выполняющий запрос.
+type graphQLViewer struct {
+	id    int64
+	admin bool
+}
+
+// salesManagerID возвращает менеджера, продажи которого видны viewer; администратору видны все (0).
+func (v *graphQLViewer) salesManagerID() int64 {
+	if v.admin {
+		return 0
+	}
+	return v.id
+}
+
+// graphQLSession - состояние одного запроса к /graphql, доступное резолверам через контекст.
+type graphQLSession struct {
+	viewer  *graphQLViewer
+	loaders *graphQLLoaders
+}
+
+type graphQLSessionKey struct{}
+
+func graphQLSessionFrom(ctx context.Context) *graphQLSession {
+	session, _ := ctx.Value(graphQLSessionKey{}).(*graphQLSession)
+	return session
+}
+
+// graphQLError - ошибка поля; extensions.code - код из serviceErrors, как статус в gRPC.
+type graphQLError struct {
+	code    codes.Code
+	message string
+}
+
+func (e *graphQLError) Error() string {
+	return e.message
+}
+
+// Extensions реализует gqlerrors.ExtendedError.
+func (e *graphQLError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.code.String()}
+}
+
+// graphQLError пишет ошибку в лог с сообщением msg и возвращает её клиенту; текст неизвестных ошибок
+// не отдаётся, как и в gRPC.
+func (s *Server) graphQLError(ctx context.Context, msg string, err error) error {
+	st := rpcStatus(err)
+	if st.Code() == codes.Internal {
+		s.log(ctx).Error(msg, zap.Error(err))
+	} else {
+		s.log(ctx).Warn(msg, zap.Error(err))
+	}
+	return &graphQLError{code: st.Code(), message: st.Message()}
+}
+
+// initGraphQL собирает схему и регистрирует /graphql; запросы принимаются только с токеном менеджера.
+func (s *Server) initGraphQL() {
+	schema, err := s.newGraphQLSchema()
+	if err != nil {
+		// Схема задаётся в коде: ошибка в ней - ошибка программы.
+		panic(err)
+	}
+	s.graphQLSchema = schema
+
+	handler := middleware.Authenticate(s.managersSvc.IDByToken, s.logger)(http.HandlerFunc(s.handleGraphQL))
+	s.mux.Handle(graphQLPath, handler).Methods(GET, POST)
+}
+
+// handleGraphQL выполняет запрос GraphQL. Ошибки запроса и полей возвращаются в errors с кодом 200,
+// как принято в GraphQL; GET выполняет только запросы на чтение.
+func (s *Server) handleGraphQL(writer http.ResponseWriter, request *http.Request) {
+	id, err := middleware.Authentication(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("graphql failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	query := &graphQLRequest{}
+	if request.Method == GET {
+		values := request.URL.Query()
+		query.Query = values.Get("query")
+		query.OperationName = values.Get("operationName")
+		if variables := values.Get("variables"); variables != "" {
+			err = json.Unmarshal([]byte(variables), &query.Variables)
+		}
+	} else {
+		err = json.NewDecoder(request.Body).Decode(query)
+	}
+	if err != nil || query.Query == "" {
+		s.log(request.Context()).Warn("can't decode graphql request", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	viewer := &graphQLViewer{id: id, admin: s.managersSvc.IsAdmin(request.Context(), id)}
+	ctx := context.WithValue(request.Context(), graphQLSessionKey{}, &graphQLSession{
+		viewer:  viewer,
+		loaders: s.newGraphQLLoaders(viewer),
+	})
+	s.writeJSON(writer, request, s.executeGraphQL(ctx, query, request.Method == GET))
+}
+
+// executeGraphQL разбирает и проверяет запрос, сверяет его с ограничениями из настроек и выполняет.
+func (s *Server) executeGraphQL(ctx context.Context, query *graphQLRequest, readOnly bool) *graphql.Result {
+	document, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(query.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+	validation := graphql.ValidateDocument(&s.graphQLSchema, document, nil)
+	if !validation.IsValid {
+		return &graphql.Result{Errors: validation.Errors}
+	}
+
+	operation := findOperation(document, query.OperationName)
+	if operation == nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(errors.New("unknown operation"))}
+	}
+	if readOnly && operation.Operation != ast.OperationTypeQuery {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(errors.New("only queries are allowed over GET"))}
+	}
+	cost := newGraphQLMeasure(&s.graphQLSchema, document, query.Variables).operation(operation)
+	err = cost.check(s.graphQL.MaxDepth, s.graphQL.MaxComplexity)
+	if err != nil {
+		s.log(ctx).Warn("graphql query rejected", zap.Error(err))
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        s.graphQLSchema,
+		AST:           document,
+		OperationName: query.OperationName,
+		Args:          query.Variables,
+		Context:       ctx,
+	})
+}
+
+// findOperation возвращает операцию с именем name или единственную операцию документа.
+func findOperation(document *ast.Document, name string) *ast.OperationDefinition {
+	var found *ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if name == "" {
+			if found != nil {
+				return nil
+			}
+			found = operation
+			continue
+		}
+		if operation.Name != nil && operation.Name.Value == name {
+			return operation
+		}
+	}
+	return found
+}
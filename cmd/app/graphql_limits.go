@@ -0,0 +1,145 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// graphQLListSize - оценка размера списка без аргумента limit при подсчёте сложности запроса.
+const graphQLListSize = 10
+
+// graphQLCost - вложенность и сложность запроса.
+type graphQLCost struct {
+	depth      int
+	complexity int
+}
+
+// graphQLMeasure считает вложенность и сложность операции. Каждое поле стоит 1; поле списка умножает
+// стоимость вложенных полей на свой аргумент limit, у списков без limit - на graphQLListSize. Служебные поля (__schema,
+// __typename и т. п.) не учитываются: их размер ограничен самой схемой.
+// Документ должен быть проверен graphql.ValidateDocument: циклы фрагментов в нём недопустимы.
+type graphQLMeasure struct {
+	schema    *graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+func newGraphQLMeasure(schema *graphql.Schema, document *ast.Document, variables map[string]interface{}) *graphQLMeasure {
+	measure := &graphQLMeasure{schema: schema, fragments: make(map[string]*ast.FragmentDefinition), variables: variables}
+	for _, definition := range document.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			measure.fragments[fragment.Name.Value] = fragment
+		}
+	}
+	return measure
+}
+
+func (m *graphQLMeasure) operation(operation *ast.OperationDefinition) graphQLCost {
+	root := m.schema.QueryType()
+	if operation.Operation == ast.OperationTypeMutation {
+		root = m.schema.MutationType()
+	}
+	return m.selections(root, operation.SelectionSet)
+}
+
+// selections возвращает наибольшую вложенность и суммарную сложность полей набора.
+func (m *graphQLMeasure) selections(parent graphql.Type, set *ast.SelectionSet) graphQLCost {
+	total := graphQLCost{}
+	if set == nil {
+		return total
+	}
+	for _, selection := range set.Selections {
+		var cost graphQLCost
+		switch selection := selection.(type) {
+		case *ast.Field:
+			cost = m.field(parent, selection)
+		case *ast.InlineFragment:
+			typ := parent
+			if selection.TypeCondition != nil {
+				typ = m.schema.Type(selection.TypeCondition.Name.Value)
+			}
+			cost = m.selections(typ, selection.SelectionSet)
+		case *ast.FragmentSpread:
+			fragment, ok := m.fragments[selection.Name.Value]
+			if !ok {
+				continue
+			}
+			cost = m.selections(m.schema.Type(fragment.TypeCondition.Name.Value), fragment.SelectionSet)
+		}
+		if cost.depth > total.depth {
+			total.depth = cost.depth
+		}
+		total.complexity += cost.complexity
+	}
+	return total
+}
+
+func (m *graphQLMeasure) field(parent graphql.Type, field *ast.Field) graphQLCost {
+	if strings.HasPrefix(field.Name.Value, "__") {
+		return graphQLCost{}
+	}
+	var definition *graphql.FieldDefinition
+	if object, ok := parent.(*graphql.Object); ok {
+		definition = object.Fields()[field.Name.Value]
+	}
+	if definition == nil {
+		return graphQLCost{depth: 1, complexity: 1}
+	}
+
+	typ := definition.Type
+	if nonNull, ok := typ.(*graphql.NonNull); ok {
+		typ = nonNull.OfType
+	}
+	multiplier := 1
+	if list, ok := typ.(*graphql.List); ok {
+		multiplier = m.limit(definition, field)
+		typ = list.OfType
+		if nonNull, ok := typ.(*graphql.NonNull); ok {
+			typ = nonNull.OfType
+		}
+	}
+	children := m.selections(typ, field.SelectionSet)
+	return graphQLCost{depth: children.depth + 1, complexity: 1 + multiplier*children.complexity}
+}
+
+// limit возвращает аргумент limit поля списка: из запроса, из переменной или значение по умолчанию.
+// Для списков без аргумента limit - graphQLListSize.
+func (m *graphQLMeasure) limit(definition *graphql.FieldDefinition, field *ast.Field) int {
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != "limit" {
+			continue
+		}
+		switch value := argument.Value.(type) {
+		case *ast.IntValue:
+			limit, err := strconv.Atoi(value.Value)
+			if err == nil && limit > 0 {
+				return limit
+			}
+		case *ast.Variable:
+			if limit, ok := m.variables[value.Name.Value].(float64); ok && limit > 0 {
+				return int(limit)
+			}
+		}
+	}
+	for _, argument := range definition.Args {
+		if limit, ok := argument.DefaultValue.(int); ok && argument.Name() == "limit" {
+			return limit
+		}
+	}
+	return graphQLListSize
+}
+
+// check возвращает ошибку, если операция превышает ограничения из настроек.
+func (c graphQLCost) check(maxDepth int, maxComplexity int) error {
+	if c.depth > maxDepth {
+		return fmt.Errorf("query depth %d exceeds the limit of %d", c.depth, maxDepth)
+	}
+	if c.complexity > maxComplexity {
+		return fmt.Errorf("query complexity %d exceeds the limit of %d", c.complexity, maxComplexity)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package app
+
+import (
+	"context"
+
+	"github.com/shohinsherov/crud/pkg/managers"
+)
+
+// batchLoader откладывает загрузку по ключам: резолверы одного уровня запроса получают отложенные
+// значения, а первое обращение к любому из них загружает все накопленные ключи одним вызовом fetch.
+// graphql-go раскрывает отложенные значения запроса в ширину, поэтому, например, товары всех позиций
+// всех продаж загружаются одним запросом к хранилищу. Результаты запоминаются до конца запроса.
+//
+// Загрузчик не потокобезопасен: graphql-go вызывает резолверы одного запроса последовательно.
+type batchLoader struct {
+	fetch   func(ctx context.Context, keys []int64) (map[int64]interface{}, error)
+	pending []int64
+	results map[int64]*batchResult
+}
+
+type batchResult struct {
+	value interface{}
+	err   error
+}
+
+func newBatchLoader(fetch func(ctx context.Context, keys []int64) (map[int64]interface{}, error)) *batchLoader {
+	return &batchLoader{fetch: fetch, results: make(map[int64]*batchResult)}
+}
+
+// load ставит key в очередь и возвращает отложенное значение для резолвера; ключ без значения даёт nil.
+func (l *batchLoader) load(ctx context.Context, key int64) func() (interface{}, error) {
+	if _, ok := l.results[key]; !ok {
+		l.results[key] = nil
+		l.pending = append(l.pending, key)
+	}
+	return func() (interface{}, error) {
+		if l.results[key] == nil {
+			l.dispatch(ctx)
+		}
+		result := l.results[key]
+		return result.value, result.err
+	}
+}
+
+// dispatch загружает все ключи из очереди.
+func (l *batchLoader) dispatch(ctx context.Context) {
+	keys := l.pending
+	l.pending = nil
+	values, err := l.fetch(ctx, keys)
+	for _, key := range keys {
+		result := &batchResult{err: err}
+		if value, ok := values[key]; ok {
+			result.value = value
+		}
+		l.results[key] = result
+	}
+}
+
+// graphQLLoaders - загрузчики одного запроса к /graphql.
+type graphQLLoaders struct {
+	products  *batchLoader
+	customers *batchLoader
+	managers  *batchLoader
+	// customerSales - загрузчики продаж покупателей по лимиту: разные поля могут запросить разное число продаж.
+	customerSales map[int]*batchLoader
+}
+
+func (s *Server) newGraphQLLoaders(viewer *graphQLViewer) *graphQLLoaders {
+	return &graphQLLoaders{
+		products: newBatchLoader(func(ctx context.Context, keys []int64) (map[int64]interface{}, error) {
+			items, err := s.managersSvc.ProductsByIDs(ctx, keys)
+			if err != nil {
+				return nil, err
+			}
+			values := make(map[int64]interface{}, len(items))
+			for _, item := range items {
+				values[item.ID] = item
+			}
+			return values, nil
+		}),
+		customers: newBatchLoader(func(ctx context.Context, keys []int64) (map[int64]interface{}, error) {
+			items, err := s.managersSvc.CustomersByIDs(ctx, keys)
+			if err != nil {
+				return nil, err
+			}
+			values := make(map[int64]interface{}, len(items))
+			for _, item := range items {
+				values[item.ID] = item
+			}
+			return values, nil
+		}),
+		managers: newBatchLoader(func(ctx context.Context, keys []int64) (map[int64]interface{}, error) {
+			items, err := s.managersSvc.ManagersByIDs(ctx, keys)
+			if err != nil {
+				return nil, err
+			}
+			values := make(map[int64]interface{}, len(items))
+			for _, item := range items {
+				values[item.ID] = item
+			}
+			return values, nil
+		}),
+		customerSales: make(map[int]*batchLoader),
+	}
+}
+
+// customerSalesLoader возвращает загрузчик не более limit последних продаж каждого покупателя,
+// видимых менеджеру viewer.
+func (s *Server) customerSalesLoader(loaders *graphQLLoaders, viewer *graphQLViewer, limit int) *batchLoader {
+	loader, ok := loaders.customerSales[limit]
+	if ok {
+		return loader
+	}
+	loader = newBatchLoader(func(ctx context.Context, keys []int64) (map[int64]interface{}, error) {
+		items, err := s.managersSvc.Sales(ctx, &managers.SaleFilter{
+			ManagerID:   viewer.salesManagerID(),
+			CustomerIDs: keys,
+			Limit:       limit,
+			PerCustomer: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		values := make(map[int64]interface{}, len(keys))
+		for _, key := range keys {
+			values[key] = make([]*managers.Sale, 0)
+		}
+		for _, item := range items {
+			values[item.CustomerID] = append(values[item.CustomerID].([]*managers.Sale), item)
+		}
+		return values, nil
+	})
+	loaders.customerSales[limit] = loader
+	return loader
+}
@@ -0,0 +1,647 @@
+package app
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/shohinsherov/crud/pkg/managers"
+)
+
+// graphQLMaxLimit - наибольший аргумент limit, как у списков хранилища.
+const graphQLMaxLimit = 500
+
+// graphQLResolver - резолвер с доступом к состоянию запроса.
+type graphQLResolver func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error)
+
+// resolve превращает resolver в резолвер graphql-go: ошибки, в том числе ошибки отложенных значений,
+// пишутся в лог с сообщением msg и переводятся в graphQLError.
+func (s *Server) resolve(msg string, resolver graphQLResolver) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		session := graphQLSessionFrom(p.Context)
+		if session == nil {
+			return nil, s.graphQLError(p.Context, msg, errForbidden)
+		}
+		value, err := resolver(p, session)
+		if err != nil {
+			return nil, s.graphQLError(p.Context, msg, err)
+		}
+		if thunk, ok := value.(func() (interface{}, error)); ok {
+			return func() (interface{}, error) {
+				value, err := thunk()
+				if err != nil {
+					return nil, s.graphQLError(p.Context, msg, err)
+				}
+				return value, nil
+			}, nil
+		}
+		return value, nil
+	}
+}
+
+// adminOnly пропускает к resolver только администраторов.
+func adminOnly(resolver graphQLResolver) graphQLResolver {
+	return func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+		if !session.viewer.admin {
+			return nil, errForbidden
+		}
+		return resolver(p, session)
+	}
+}
+
+// idValue разбирает значение типа ID; отсутствующее значение даёт 0.
+func idValue(value interface{}) (int64, error) {
+	text, ok := value.(string)
+	if !ok {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || id < 0 {
+		return 0, errInvalidBody
+	}
+	return id, nil
+}
+
+// limitArgument возвращает аргумент limit, проверяя, что он от 1 до graphQLMaxLimit.
+func limitArgument(p graphql.ResolveParams) (int, error) {
+	limit, _ := p.Args["limit"].(int)
+	if limit < 1 || limit > graphQLMaxLimit {
+		return 0, errInvalidBody
+	}
+	return limit, nil
+}
+
+// optionalID отдаёт нулевой идентификатор как null.
+func optionalID(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// graphQLAttribute - атрибут товара или варианта; в GraphQL нет словарей, поэтому атрибуты - список пар.
+type graphQLAttribute struct {
+	Name  string
+	Value string
+}
+
+func attributeList(attributes map[string]string) []*graphQLAttribute {
+	items := make([]*graphQLAttribute, 0, len(attributes))
+	for name, value := range attributes {
+		items = append(items, &graphQLAttribute{Name: name, Value: value})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Name < items[j].Name
+	})
+	return items
+}
+
+func attributeMap(value interface{}) map[string]string {
+	attributes := make(map[string]string)
+	items, _ := value.([]interface{})
+	for _, item := range items {
+		fields, _ := item.(map[string]interface{})
+		name, _ := fields["name"].(string)
+		attributes[name], _ = fields["value"].(string)
+	}
+	return attributes
+}
+
+func (s *Server) newGraphQLSchema() (graphql.Schema, error) {
+	nonNull := graphql.NewNonNull
+	list := func(typ graphql.Type) graphql.Type {
+		return nonNull(graphql.NewList(nonNull(typ)))
+	}
+	limitArgs := func(limit int) graphql.FieldConfigArgument {
+		return graphql.FieldConfigArgument{
+			"limit": {Type: graphql.Int, DefaultValue: limit},
+		}
+	}
+
+	attributeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Attribute",
+		Fields: graphql.Fields{
+			"name":  {Type: nonNull(graphql.String)},
+			"value": {Type: nonNull(graphql.String)},
+		},
+	})
+	attributesField := &graphql.Field{
+		Type: list(attributeType),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			switch source := p.Source.(type) {
+			case *managers.Product:
+				return attributeList(source.Attributes), nil
+			case *managers.Variant:
+				return attributeList(source.Attributes), nil
+			}
+			return nil, nil
+		},
+	}
+	variantType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Variant",
+		Fields: graphql.Fields{
+			"id":         {Type: nonNull(graphql.ID)},
+			"sku":        {Type: nonNull(graphql.String)},
+			"attributes": attributesField,
+			"qty":        {Type: nonNull(graphql.Int)},
+			"active":     {Type: nonNull(graphql.Boolean)},
+		},
+	})
+	barcodeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Barcode",
+		Fields: graphql.Fields{
+			"code": {Type: nonNull(graphql.String)},
+			"variantId": {Type: graphql.ID, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return optionalID(p.Source.(*managers.Barcode).VariantID), nil
+			}},
+		},
+	})
+	productType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Product",
+		Fields: graphql.Fields{
+			"id":    {Type: nonNull(graphql.ID)},
+			"name":  {Type: nonNull(graphql.String)},
+			"sku":   {Type: nonNull(graphql.String)},
+			"price": {Type: nonNull(graphql.Int)},
+			"qty":   {Type: nonNull(graphql.Int)},
+			"categoryId": {Type: graphql.ID, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return optionalID(p.Source.(*managers.Product).CategoryID), nil
+			}},
+			"attributes": attributesField,
+			"variants":   {Type: list(variantType)},
+			"barcodes":   {Type: list(barcodeType)},
+			"active":     {Type: nonNull(graphql.Boolean)},
+			"version":    {Type: nonNull(graphql.Int), Description: "Передаётся в updateProduct и removeProduct."},
+			"created":    {Type: nonNull(graphql.DateTime)},
+		},
+	})
+	managerType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Manager",
+		Fields: graphql.Fields{
+			"id":    {Type: nonNull(graphql.ID)},
+			"name":  {Type: nonNull(graphql.String)},
+			"phone": {Type: nonNull(graphql.String)},
+			"roles": {Type: list(graphql.String)},
+		},
+	})
+
+	var customerType, saleType *graphql.Object
+	positionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "SalePosition",
+		Fields: graphql.Fields{
+			"id": {Type: nonNull(graphql.ID)},
+			"product": {Type: productType, Resolve: s.resolve("graphql product failed", func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+				return session.loaders.products.load(p.Context, p.Source.(*managers.SalePosition).ProductID), nil
+			})},
+			"variantId": {Type: graphql.ID, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return optionalID(p.Source.(*managers.SalePosition).VariantID), nil
+			}},
+			"price":   {Type: nonNull(graphql.Int)},
+			"qty":     {Type: nonNull(graphql.Int)},
+			"created": {Type: nonNull(graphql.DateTime)},
+		},
+	})
+	saleType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Sale",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id": {Type: nonNull(graphql.ID)},
+				"manager": {Type: managerType, Resolve: s.resolve("graphql manager failed", func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+					return session.loaders.managers.load(p.Context, p.Source.(*managers.Sale).ManagerID), nil
+				})},
+				"customer": {Type: customerType, Resolve: s.resolve("graphql customer failed", func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+					id := p.Source.(*managers.Sale).CustomerID
+					if id == 0 {
+						return nil, nil
+					}
+					return session.loaders.customers.load(p.Context, id), nil
+				})},
+				"positions": {Type: list(positionType)},
+				"total": {Type: nonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					total := 0
+					for _, position := range p.Source.(*managers.Sale).Positions {
+						total += position.Price * position.Qty
+					}
+					return total, nil
+				}},
+				"created": {Type: nonNull(graphql.DateTime)},
+			}
+		}),
+	})
+	customerType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Customer",
+		Fields: graphql.Fields{
+			"id":      {Type: nonNull(graphql.ID)},
+			"name":    {Type: nonNull(graphql.String)},
+			"phone":   {Type: nonNull(graphql.String)},
+			"active":  {Type: nonNull(graphql.Boolean)},
+			"version": {Type: nonNull(graphql.Int), Description: "Передаётся в updateCustomer и removeCustomer."},
+			"created": {Type: nonNull(graphql.DateTime)},
+			"sales": {
+				Type:        list(saleType),
+				Description: "Последние продажи покупателя; менеджеру без роли ADMIN - только его собственные.",
+				Args:        limitArgs(10),
+				Resolve: s.resolve("graphql customer sales failed", func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+					limit, err := limitArgument(p)
+					if err != nil {
+						return nil, err
+					}
+					loader := s.customerSalesLoader(session.loaders, session.viewer, limit)
+					return loader.load(p.Context, p.Source.(*managers.Customer).ID), nil
+				}),
+			},
+		},
+	})
+
+	productSalesType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "ProductSales",
+		Fields: graphql.Fields{
+			"product": {Type: productType, Resolve: s.resolve("graphql product failed", func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+				return session.loaders.products.load(p.Context, p.Source.(*managers.ProductSales).ProductID), nil
+			})},
+			"units":   {Type: nonNull(graphql.Int)},
+			"revenue": {Type: nonNull(graphql.Int)},
+		},
+	})
+	managerSalesType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "ManagerSales",
+		Fields: graphql.Fields{
+			"manager": {Type: managerType, Resolve: s.resolve("graphql manager failed", func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+				return session.loaders.managers.load(p.Context, p.Source.(*managers.ManagerSales).ManagerID), nil
+			})},
+			"sales":   {Type: nonNull(graphql.Int)},
+			"revenue": {Type: nonNull(graphql.Int)},
+		},
+	})
+	reportType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "SalesReport",
+		Fields: graphql.Fields{
+			"from":     {Type: nonNull(graphql.DateTime)},
+			"to":       {Type: nonNull(graphql.DateTime)},
+			"sales":    {Type: nonNull(graphql.Int)},
+			"units":    {Type: nonNull(graphql.Int)},
+			"revenue":  {Type: nonNull(graphql.Int)},
+			"products": {Type: list(productSalesType)},
+			"managers": {Type: list(managerSalesType)},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"me": {
+				Type: nonNull(managerType),
+				Resolve: s.resolve("graphql me failed", func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+					return session.loaders.managers.load(p.Context, session.viewer.id), nil
+				}),
+			},
+			"products": {
+				Type: list(productType),
+				Args: graphql.FieldConfigArgument{
+					"categoryId": {Type: graphql.ID},
+					"limit":      {Type: graphql.Int, DefaultValue: 100},
+				},
+				Resolve: s.resolve("graphql products failed", func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+					categoryID, err := idValue(p.Args["categoryId"])
+					if err != nil {
+						return nil, err
+					}
+					limit, err := limitArgument(p)
+					if err != nil {
+						return nil, err
+					}
+					items, err := s.managersSvc.Products(p.Context, &managers.ProductFilter{CategoryID: categoryID})
+					if err != nil {
+						return nil, err
+					}
+					if len(items) > limit {
+						items = items[:limit]
+					}
+					return items, nil
+				}),
+			},
+			"product": {
+				Type: productType,
+				Args: graphql.FieldConfigArgument{"id": {Type: nonNull(graphql.ID)}},
+				Resolve: s.resolve("graphql product failed", func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+					id, err := idValue(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					return session.loaders.products.load(p.Context, id), nil
+				}),
+			},
+			"customers": {
+				Type: list(customerType),
+				Args: limitArgs(100),
+				Resolve: s.resolve("graphql customers failed", func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+					limit, err := limitArgument(p)
+					if err != nil {
+						return nil, err
+					}
+					items, err := s.managersSvc.Customers(p.Context)
+					if err != nil {
+						return nil, err
+					}
+					if len(items) > limit {
+						items = items[:limit]
+					}
+					return items, nil
+				}),
+			},
+			"customer": {
+				Type: customerType,
+				Args: graphql.FieldConfigArgument{"id": {Type: nonNull(graphql.ID)}},
+				Resolve: s.resolve("graphql customer failed", func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+					id, err := idValue(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					return session.loaders.customers.load(p.Context, id), nil
+				}),
+			},
+			"sales": {
+				Type:        list(saleType),
+				Description: "Продажи от новых к старым; менеджеру без роли ADMIN доступны только его собственные.",
+				Args: graphql.FieldConfigArgument{
+					"managerId":  {Type: graphql.ID},
+					"customerId": {Type: graphql.ID},
+					"from":       {Type: graphql.DateTime},
+					"to":         {Type: graphql.DateTime},
+					"limit":      {Type: graphql.Int, DefaultValue: managers.DefaultSalesLimit},
+				},
+				Resolve: s.resolve("graphql sales failed", func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+					filter := &managers.SaleFilter{}
+					var err error
+					filter.ManagerID, err = idValue(p.Args["managerId"])
+					if err != nil {
+						return nil, err
+					}
+					if !session.viewer.admin {
+						if filter.ManagerID != 0 && filter.ManagerID != session.viewer.id {
+							return nil, errForbidden
+						}
+						filter.ManagerID = session.viewer.id
+					}
+					customerID, err := idValue(p.Args["customerId"])
+					if err != nil {
+						return nil, err
+					}
+					if customerID != 0 {
+						filter.CustomerIDs = []int64{customerID}
+					}
+					filter.From, _ = p.Args["from"].(time.Time)
+					filter.To, _ = p.Args["to"].(time.Time)
+					filter.Limit, err = limitArgument(p)
+					if err != nil {
+						return nil, err
+					}
+					return s.managersSvc.Sales(p.Context, filter)
+				}),
+			},
+			"managers": {
+				Type:        list(managerType),
+				Description: "Только для роли ADMIN.",
+				Resolve: s.resolve("graphql managers failed", adminOnly(func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+					return s.managersSvc.Managers(p.Context)
+				})),
+			},
+			"salesReport": {
+				Type:        nonNull(reportType),
+				Description: "Итоги продаж с from включительно до to. Только для роли ADMIN.",
+				Args: graphql.FieldConfigArgument{
+					"from": {Type: nonNull(graphql.DateTime)},
+					"to":   {Type: nonNull(graphql.DateTime)},
+				},
+				Resolve: s.resolve("graphql sales report failed", adminOnly(func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+					from, _ := p.Args["from"].(time.Time)
+					to, _ := p.Args["to"].(time.Time)
+					return s.managersSvc.SalesReport(p.Context, from, to)
+				})),
+			},
+		},
+	})
+
+	attributeInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "AttributeInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":  {Type: nonNull(graphql.String)},
+			"value": {Type: nonNull(graphql.String)},
+		},
+	})
+	productInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "ProductInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":       {Type: nonNull(graphql.String)},
+			"sku":        {Type: graphql.String, DefaultValue: ""},
+			"price":      {Type: nonNull(graphql.Int)},
+			"qty":        {Type: nonNull(graphql.Int)},
+			"categoryId": {Type: graphql.ID},
+			"attributes": {Type: graphql.NewList(nonNull(attributeInput))},
+		},
+	})
+	customerInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "CustomerInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":   {Type: nonNull(graphql.String)},
+			"phone":  {Type: nonNull(graphql.String)},
+			"active": {Type: graphql.Boolean, DefaultValue: true},
+		},
+	})
+	positionInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:        "SalePositionInput",
+		Description: "Товар задаётся productId, variantId или barcode, как в POST /sales.",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"productId": {Type: graphql.ID},
+			"variantId": {Type: graphql.ID},
+			"barcode":   {Type: graphql.String},
+			"price":     {Type: graphql.Int},
+			"qty":       {Type: nonNull(graphql.Int)},
+		},
+	})
+	saleInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "SaleInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"customerId": {Type: graphql.ID},
+			"positions":  {Type: nonNull(graphql.NewList(nonNull(positionInput)))},
+		},
+	})
+	versionArgs := graphql.FieldConfigArgument{
+		"id":      {Type: nonNull(graphql.ID)},
+		"version": {Type: nonNull(graphql.Int)},
+	}
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createProduct": {
+				Type: nonNull(productType),
+				Args: graphql.FieldConfigArgument{"product": {Type: nonNull(productInput)}},
+				Resolve: s.resolve("graphql create product failed", func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+					product, err := productFromInput(p.Args["product"])
+					if err != nil {
+						return nil, err
+					}
+					product.Active = true
+					return s.managersSvc.CreateProduct(p.Context, session.viewer.id, product)
+				}),
+			},
+			"updateProduct": {
+				Type:        nonNull(productType),
+				Description: "Заменяет поля товара, если его версия равна version; варианты и штрихкоды не меняются.",
+				Args: graphql.FieldConfigArgument{
+					"id":      versionArgs["id"],
+					"version": versionArgs["version"],
+					"product": {Type: nonNull(productInput)},
+				},
+				Resolve: s.resolve("graphql update product failed", func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+					product, err := productFromInput(p.Args["product"])
+					if err != nil {
+						return nil, err
+					}
+					product.ID, product.Version, err = versionArguments(p)
+					if err != nil {
+						return nil, err
+					}
+					return s.managersSvc.UpdateProduct(p.Context, session.viewer.id, product)
+				}),
+			},
+			"removeProduct": {
+				Type: nonNull(graphql.Boolean),
+				Args: versionArgs,
+				Resolve: s.resolve("graphql remove product failed", func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+					id, version, err := versionArguments(p)
+					if err != nil {
+						return nil, err
+					}
+					err = s.managersSvc.RemoveProductById(p.Context, id, version)
+					return err == nil, err
+				}),
+			},
+			"createCustomer": {
+				Type: nonNull(customerType),
+				Args: graphql.FieldConfigArgument{
+					"name":     {Type: nonNull(graphql.String)},
+					"phone":    {Type: nonNull(graphql.String)},
+					"password": {Type: nonNull(graphql.String)},
+				},
+				Resolve: s.resolve("graphql create customer failed", func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+					customer := newCustomer()
+					customer.Name, _ = p.Args["name"].(string)
+					customer.Phone, _ = p.Args["phone"].(string)
+					password, _ := p.Args["password"].(string)
+					return s.managersSvc.CreateCustomer(p.Context, customer, password)
+				}),
+			},
+			"updateCustomer": {
+				Type:        nonNull(customerType),
+				Description: "Заменяет поля покупателя, если его версия равна version.",
+				Args: graphql.FieldConfigArgument{
+					"id":       versionArgs["id"],
+					"version":  versionArgs["version"],
+					"customer": {Type: nonNull(customerInput)},
+				},
+				Resolve: s.resolve("graphql update customer failed", func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+					fields, _ := p.Args["customer"].(map[string]interface{})
+					customer := &managers.Customer{}
+					customer.Name, _ = fields["name"].(string)
+					customer.Phone, _ = fields["phone"].(string)
+					customer.Active, _ = fields["active"].(bool)
+					var err error
+					customer.ID, customer.Version, err = versionArguments(p)
+					if err != nil {
+						return nil, err
+					}
+					return s.managersSvc.ChangeCustomer(p.Context, customer)
+				}),
+			},
+			"removeCustomer": {
+				Type: nonNull(graphql.Boolean),
+				Args: versionArgs,
+				Resolve: s.resolve("graphql remove customer failed", func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+					id, version, err := versionArguments(p)
+					if err != nil {
+						return nil, err
+					}
+					err = s.managersSvc.RemoveCustomerById(p.Context, id, version)
+					return err == nil, err
+				}),
+			},
+			"makeSale": {
+				Type: nonNull(saleType),
+				Args: graphql.FieldConfigArgument{"sale": {Type: nonNull(saleInput)}},
+				Resolve: s.resolve("graphql make sale failed", func(p graphql.ResolveParams, session *graphQLSession) (interface{}, error) {
+					sale, err := saleFromInput(p.Args["sale"])
+					if err != nil {
+						return nil, err
+					}
+					sale.ManagerID = session.viewer.id
+					return s.makeSale(p.Context, sale)
+				}),
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+// versionArguments возвращает аргументы id и version; нулевая версия означала бы запись без проверки,
+// поэтому она не принимается, как запрос без If-Match в HTTP.
+func versionArguments(p graphql.ResolveParams) (int64, int64, error) {
+	id, err := idValue(p.Args["id"])
+	if err != nil {
+		return 0, 0, err
+	}
+	version, _ := p.Args["version"].(int)
+	if version <= 0 {
+		return 0, 0, errPreconditionRequired
+	}
+	return id, int64(version), nil
+}
+
+func productFromInput(value interface{}) (*managers.Product, error) {
+	fields, _ := value.(map[string]interface{})
+	product := &managers.Product{Attributes: attributeMap(fields["attributes"])}
+	product.Name, _ = fields["name"].(string)
+	product.SKU, _ = fields["sku"].(string)
+	product.Price, _ = fields["price"].(int)
+	product.Qty, _ = fields["qty"].(int)
+	var err error
+	product.CategoryID, err = idValue(fields["categoryId"])
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+func saleFromInput(value interface{}) (*managers.Sale, error) {
+	fields, _ := value.(map[string]interface{})
+	sale := &managers.Sale{}
+	var err error
+	sale.CustomerID, err = idValue(fields["customerId"])
+	if err != nil {
+		return nil, err
+	}
+	positions, _ := fields["positions"].([]interface{})
+	if len(positions) == 0 {
+		return nil, errInvalidBody
+	}
+	for _, item := range positions {
+		fields, _ := item.(map[string]interface{})
+		position := &managers.SalePosition{}
+		position.ProductID, err = idValue(fields["productId"])
+		if err != nil {
+			return nil, err
+		}
+		position.VariantID, err = idValue(fields["variantId"])
+		if err != nil {
+			return nil, err
+		}
+		position.Barcode, _ = fields["barcode"].(string)
+		position.Price, _ = fields["price"].(int)
+		position.Qty, _ = fields["qty"].(int)
+		sale.Positions = append(sale.Positions, position)
+	}
+	return sale, nil
+}
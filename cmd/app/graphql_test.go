@@ -0,0 +1,239 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/shohinsherov/crud/pkg/managers"
+)
+
+type graphQLTestResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string `json:"message"`
+		Extensions struct {
+			Code string `json:"code"`
+		} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// graphQLQuery выполняет запрос к /graphql и раскладывает data в out, если out не nil.
+func graphQLQuery(t *testing.T, server *Server, token string, query string, variables map[string]interface{}, out interface{}) *graphQLTestResponse {
+	t.Helper()
+	recorder := managerRequest(t, server, token, POST, graphQLPath, nil, &graphQLRequest{Query: query, Variables: variables})
+	response := &graphQLTestResponse{}
+	decodeRecorder(t, recorder, http.StatusOK, response)
+	if out != nil {
+		if len(response.Errors) != 0 {
+			t.Fatalf("%s: %+v", query, response.Errors)
+		}
+		err := json.Unmarshal(response.Data, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return response
+}
+
+func expectGraphQLError(t *testing.T, name string, response *graphQLTestResponse, code string) {
+	t.Helper()
+	if len(response.Errors) == 0 || response.Errors[0].Extensions.Code != code {
+		t.Errorf("%s: got errors %+v, want code %s", name, response.Errors, code)
+	}
+}
+
+func testAdminToken(t *testing.T, server *Server) string {
+	t.Helper()
+	ctx := context.Background()
+	admin, err := server.managersSvc.Create(ctx, &managers.Registration{Name: "Admin", Phone: "+992000000009", Roles: []string{managers.ADMIN}}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := server.managersSvc.Token(ctx, admin.Phone, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestBatchLoader(t *testing.T) {
+	var calls [][]int64
+	loader := newBatchLoader(func(ctx context.Context, keys []int64) (map[int64]interface{}, error) {
+		calls = append(calls, keys)
+		values := make(map[int64]interface{})
+		for _, key := range keys {
+			if key != 3 {
+				values[key] = key * 10
+			}
+		}
+		return values, nil
+	})
+
+	ctx := context.Background()
+	first, second, missing := loader.load(ctx, 1), loader.load(ctx, 2), loader.load(ctx, 3)
+	again := loader.load(ctx, 1)
+	for _, item := range []struct {
+		thunk func() (interface{}, error)
+		want  interface{}
+	}{{first, int64(10)}, {second, int64(20)}, {missing, nil}, {again, int64(10)}} {
+		value, err := item.thunk()
+		if err != nil || value != item.want {
+			t.Errorf("got %v, %v, want %v", value, err, item.want)
+		}
+	}
+	_, err := loader.load(ctx, 2)()
+	if err != nil || len(calls) != 1 || len(calls[0]) != 3 {
+		t.Errorf("got fetch calls %v, want one call with keys 1, 2, 3", calls)
+	}
+}
+
+func TestGraphQL_NestedQuery(t *testing.T) {
+	server := newTestServer()
+	token := testManagerToken(t, server)
+	ctx := context.Background()
+
+	var created struct {
+		CreateProduct struct {
+			ID      string `json:"id"`
+			Version int64  `json:"version"`
+		} `json:"createProduct"`
+		CreateCustomer struct {
+			ID string `json:"id"`
+		} `json:"createCustomer"`
+	}
+	graphQLQuery(t, server, token, `mutation {
+		createProduct(product: {name: "Хлеб", price: 5, qty: 10, attributes: [{name: "вес", value: "400"}]}) { id version }
+		createCustomer(name: "Покупатель", phone: "+992000000100", password: "secret") { id }
+	}`, nil, &created)
+
+	var sale struct {
+		MakeSale struct {
+			ID    string `json:"id"`
+			Total int    `json:"total"`
+		} `json:"makeSale"`
+	}
+	graphQLQuery(t, server, token, `mutation ($sale: SaleInput!) { makeSale(sale: $sale) { id total } }`, map[string]interface{}{
+		"sale": map[string]interface{}{
+			"customerId": created.CreateCustomer.ID,
+			"positions":  []interface{}{map[string]interface{}{"productId": created.CreateProduct.ID, "qty": 3, "price": 5}},
+		},
+	}, &sale)
+	if sale.MakeSale.Total != 15 {
+		t.Errorf("sale total: got %d, want 15", sale.MakeSale.Total)
+	}
+	productID, _ := idValue(created.CreateProduct.ID)
+	product, err := server.managersSvc.ProductByID(ctx, productID)
+	if err != nil || product.Qty != 7 {
+		t.Errorf("stock after sale: got %+v, %v", product, err)
+	}
+
+	var data struct {
+		Sales []struct {
+			Manager  struct{ Name string }
+			Customer struct {
+				Name  string
+				Sales []struct{ ID string }
+			}
+			Positions []struct {
+				Product struct {
+					Name       string
+					Attributes []struct{ Name, Value string }
+				}
+			}
+		}
+	}
+	graphQLQuery(t, server, token, `{
+		sales { manager { name } customer { name sales(limit: 5) { id } } positions { product { name attributes { name value } } } }
+	}`, nil, &data)
+	if len(data.Sales) != 1 {
+		t.Fatalf("sales: got %+v", data.Sales)
+	}
+	got := data.Sales[0]
+	if got.Manager.Name != "Manager" || got.Customer.Name != "Покупатель" || len(got.Customer.Sales) != 1 || got.Customer.Sales[0].ID != sale.MakeSale.ID {
+		t.Errorf("sale: got %+v", got)
+	}
+	if len(got.Positions) != 1 || got.Positions[0].Product.Name != "Хлеб" || got.Positions[0].Product.Attributes[0].Value != "400" {
+		t.Errorf("positions: got %+v", got.Positions)
+	}
+
+	response := graphQLQuery(t, server, token, `mutation ($id: ID!) {
+		updateProduct(id: $id, version: 100, product: {name: "Хлеб", price: 6, qty: 7}) { id }
+	}`, map[string]interface{}{"id": created.CreateProduct.ID}, nil)
+	expectGraphQLError(t, "update with stale version", response, "Aborted")
+}
+
+func TestGraphQL_Authorization(t *testing.T) {
+	server := newTestServer()
+	managerToken := testManagerToken(t, server)
+	adminToken := testAdminToken(t, server)
+
+	recorder := managerRequest(t, server, "", POST, graphQLPath, nil, &graphQLRequest{Query: "{ me { id } }"})
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("without token: got status %d, want 403", recorder.Code)
+	}
+
+	var me struct {
+		Me struct{ Roles []string }
+	}
+	graphQLQuery(t, server, adminToken, `{ me { roles } }`, nil, &me)
+	if len(me.Me.Roles) != 1 || me.Me.Roles[0] != managers.ADMIN {
+		t.Errorf("admin roles: got %v", me.Me.Roles)
+	}
+
+	for _, query := range []string{
+		`{ managers { id } }`,
+		`{ salesReport(from: "2026-01-01T00:00:00Z", to: "2027-01-01T00:00:00Z") { revenue } }`,
+		`{ sales(managerId: 9) { id } }`,
+	} {
+		expectGraphQLError(t, query, graphQLQuery(t, server, managerToken, query, nil, nil), "PermissionDenied")
+	}
+
+	var report struct {
+		SalesReport struct{ Sales int }
+		Managers    []struct{ ID string }
+	}
+	graphQLQuery(t, server, adminToken, `{
+		salesReport(from: "2026-01-01T00:00:00Z", to: "2027-01-01T00:00:00Z") { sales }
+		managers { id }
+	}`, nil, &report)
+	if report.SalesReport.Sales != 0 || len(report.Managers) != 2 {
+		t.Errorf("admin report: got %+v", report)
+	}
+	response := graphQLQuery(t, server, adminToken, `{ salesReport(from: "2027-01-01T00:00:00Z", to: "2026-01-01T00:00:00Z") { sales } }`, nil, nil)
+	expectGraphQLError(t, "reversed period", response, "InvalidArgument")
+}
+
+func TestGraphQL_Limits(t *testing.T) {
+	server := newTestServer()
+	token := testManagerToken(t, server)
+
+	deep := `{ sales { customer { sales { customer { sales { customer { sales { customer { sales { customer { name } } } } } } } } } } }`
+	response := graphQLQuery(t, server, token, deep, nil, nil)
+	if len(response.Errors) == 0 {
+		t.Errorf("deep query: got no errors")
+	}
+
+	expensive := `query ($limit: Int) { sales(limit: $limit) { positions { product { variants { attributes { name } } } } } }`
+	response = graphQLQuery(t, server, token, expensive, map[string]interface{}{"limit": 500}, nil)
+	if len(response.Errors) == 0 {
+		t.Errorf("complex query: got no errors")
+	}
+	graphQLQuery(t, server, token, expensive, map[string]interface{}{"limit": 1}, &struct{}{})
+
+	query := url.Values{"query": {`mutation { removeProduct(id: 1, version: 1) }`}}
+	recorder := managerRequest(t, server, token, GET, graphQLPath+"?"+query.Encode(), nil, nil)
+	read := &graphQLTestResponse{}
+	decodeRecorder(t, recorder, http.StatusOK, read)
+	if len(read.Errors) == 0 {
+		t.Errorf("mutation over GET: got no errors")
+	}
+	query = url.Values{"query": {`{ me { name } }`}}
+	recorder = managerRequest(t, server, token, GET, graphQLPath+"?"+query.Encode(), nil, nil)
+	decodeRecorder(t, recorder, http.StatusOK, read)
+	if string(read.Data) != `{"me":{"name":"Manager"}}` {
+		t.Errorf("query over GET: got %s", read.Data)
+	}
+}
@@ -0,0 +1,348 @@
+package app
+
+import (
+	"context"
+	"strings"
+
+	crudv1 "github.com/shohinsherov/crud/api/crud/v1"
+	"github.com/shohinsherov/crud/cmd/app/middleware"
+	"github.com/shohinsherov/crud/pkg/customers"
+	"github.com/shohinsherov/crud/pkg/managers"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// NewGRPCServer создаёт gRPC-сервер с сервисами из api/crud/v1. Он работает поверх тех же сервисов,
+// что и HTTP API, токен передаётся в метаданных authorization, а ошибки переводятся в коды
+// по той же таблице serviceErrors, поэтому оба транспорта ведут себя одинаково.
+func NewGRPCServer(s *Server, opts ...grpc.ServerOption) *grpc.Server {
+	managerServices := map[string]middleware.IDFunc{
+		crudv1.CustomersService_ServiceDesc.ServiceName: s.managersSvc.IDByToken,
+		crudv1.ProductsService_ServiceDesc.ServiceName:  s.managersSvc.IDByToken,
+		crudv1.SalesService_ServiceDesc.ServiceName:     s.managersSvc.IDByToken,
+	}
+	opts = append(opts, grpc.ChainUnaryInterceptor(
+		middleware.UnaryRequestID,
+		middleware.UnaryAccessLog(s.logger),
+		middleware.UnaryAuthenticate(managerServices, s.logger),
+	))
+
+	server := grpc.NewServer(opts...)
+	crudv1.RegisterAuthServiceServer(server, &authRPC{Server: s})
+	crudv1.RegisterCustomersServiceServer(server, &customersRPC{Server: s})
+	crudv1.RegisterProductsServiceServer(server, &productsRPC{Server: s})
+	crudv1.RegisterSalesServiceServer(server, &salesRPC{Server: s})
+	reflection.Register(server)
+	return server
+}
+
+// managerID возвращает ID менеджера из контекста вызова, как проверка id == 0 в HTTP-обработчиках.
+func managerID(ctx context.Context) (int64, error) {
+	id, err := middleware.Authentication(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if id == 0 {
+		return 0, errForbidden
+	}
+	return id, nil
+}
+
+// rpcStatus возвращает статус gRPC для ошибки сервиса; текст неизвестных ошибок клиенту не отдаётся.
+func rpcStatus(err error) *status.Status {
+	if st, ok := status.FromError(err); ok {
+		return st
+	}
+	code := errorCode(err)
+	if code == codes.Internal {
+		return status.New(code, code.String())
+	}
+	return status.New(code, err.Error())
+}
+
+// rpcError пишет ошибку в лог с сообщением msg и возвращает её клиенту в виде статуса gRPC.
+func (s *Server) rpcError(ctx context.Context, msg string, err error) error {
+	st := rpcStatus(err)
+	if st.Code() == codes.Internal {
+		s.log(ctx).Error(msg, zap.Error(err))
+	} else {
+		s.log(ctx).Warn(msg, zap.Error(err))
+	}
+	return st.Err()
+}
+
+// authRPC реализует crudv1.AuthService.
+type authRPC struct {
+	crudv1.UnimplementedAuthServiceServer
+	*Server
+}
+
+func (r *authRPC) RegisterCustomer(ctx context.Context, request *crudv1.RegisterCustomerRequest) (*crudv1.Customer, error) {
+	item, err := r.customersSvc.Register(ctx, &customers.Registration{Name: request.Name, Phone: request.Phone, Password: request.Password})
+	if err != nil {
+		return nil, r.rpcError(ctx, "customer registration failed", err)
+	}
+	return &crudv1.Customer{Id: item.ID, Name: item.Name, Phone: item.Phone, Active: item.Active, Created: timestamp(item.Created)}, nil
+}
+
+func (r *authRPC) CustomerToken(ctx context.Context, request *crudv1.TokenRequest) (*crudv1.TokenResponse, error) {
+	token, err := r.customersSvc.Token(ctx, request.Login, request.Password)
+	r.recordLogin("customer", err, customers.ErrInvalidPassword)
+	if err != nil {
+		return nil, r.rpcError(ctx, "customer get token failed", err)
+	}
+	return &crudv1.TokenResponse{Token: token}, nil
+}
+
+func (r *authRPC) ManagerToken(ctx context.Context, request *crudv1.TokenRequest) (*crudv1.TokenResponse, error) {
+	token, err := r.managersSvc.Token(ctx, request.Login, request.Password)
+	r.recordLogin("manager", err, managers.ErrInvalidPassword)
+	if err != nil {
+		return nil, r.rpcError(ctx, "manager get token failed", err)
+	}
+	return &crudv1.TokenResponse{Token: token}, nil
+}
+
+// customersRPC реализует crudv1.CustomersService.
+type customersRPC struct {
+	crudv1.UnimplementedCustomersServiceServer
+	*Server
+}
+
+func (r *customersRPC) ListCustomers(ctx context.Context, request *crudv1.ListCustomersRequest) (*crudv1.ListCustomersResponse, error) {
+	_, err := managerID(ctx)
+	if err != nil {
+		return nil, r.rpcError(ctx, "manager get customers failed", err)
+	}
+	items, err := r.managersSvc.Customers(ctx)
+	if err != nil {
+		return nil, r.rpcError(ctx, "manager get customers failed", err)
+	}
+	response := &crudv1.ListCustomersResponse{}
+	for _, item := range items {
+		response.Customers = append(response.Customers, customerToProto(item))
+	}
+	return response, nil
+}
+
+func (r *customersRPC) GetCustomer(ctx context.Context, request *crudv1.GetCustomerRequest) (*crudv1.Customer, error) {
+	_, err := managerID(ctx)
+	if err != nil {
+		return nil, r.rpcError(ctx, "manager get customer failed", err)
+	}
+	item, err := r.managersSvc.CustomerByID(ctx, request.Id)
+	if err != nil {
+		return nil, r.rpcError(ctx, "manager get customer failed", err)
+	}
+	return customerToProto(item), nil
+}
+
+func (r *customersRPC) CreateCustomer(ctx context.Context, request *crudv1.CreateCustomerRequest) (*crudv1.Customer, error) {
+	_, err := managerID(ctx)
+	if err != nil {
+		return nil, r.rpcError(ctx, "manager create customer failed", err)
+	}
+	customer := newCustomer()
+	customer.Name = request.Name
+	customer.Phone = request.Phone
+	item, err := r.managersSvc.CreateCustomer(ctx, customer, request.Password)
+	if err != nil {
+		return nil, r.rpcError(ctx, "manager create customer failed", err)
+	}
+	return customerToProto(item), nil
+}
+
+func (r *customersRPC) UpdateCustomer(ctx context.Context, request *crudv1.UpdateCustomerRequest) (*crudv1.Customer, error) {
+	_, err := managerID(ctx)
+	if err != nil {
+		return nil, r.rpcError(ctx, "change customer failed", err)
+	}
+	if request.Customer == nil {
+		return nil, r.rpcError(ctx, "change customer failed", errInvalidBody)
+	}
+	if request.Customer.Version == 0 {
+		return nil, r.rpcError(ctx, "change customer failed", errPreconditionRequired)
+	}
+	item, err := r.managersSvc.ChangeCustomer(ctx, customerFromProto(request.Customer))
+	if err != nil {
+		return nil, r.rpcError(ctx, "change customer failed", err)
+	}
+	return customerToProto(item), nil
+}
+
+func (r *customersRPC) DeleteCustomer(ctx context.Context, request *crudv1.DeleteCustomerRequest) (*crudv1.DeleteCustomerResponse, error) {
+	_, err := managerID(ctx)
+	if err != nil {
+		return nil, r.rpcError(ctx, "manager remove customer by id failed", err)
+	}
+	if request.Version == 0 {
+		return nil, r.rpcError(ctx, "manager remove customer by id failed", errPreconditionRequired)
+	}
+	err = r.managersSvc.RemoveCustomerById(ctx, request.Id, request.Version)
+	if err != nil {
+		return nil, r.rpcError(ctx, "manager remove customer by id failed", err)
+	}
+	return &crudv1.DeleteCustomerResponse{}, nil
+}
+
+// productsRPC реализует crudv1.ProductsService.
+type productsRPC struct {
+	crudv1.UnimplementedProductsServiceServer
+	*Server
+}
+
+func (r *productsRPC) ListProducts(ctx context.Context, request *crudv1.ListProductsRequest) (*crudv1.ListProductsResponse, error) {
+	items, err := r.customersSvc.Products(ctx, &customers.ProductFilter{CategoryID: request.CategoryId, Attributes: request.Attributes})
+	if err != nil {
+		return nil, r.rpcError(ctx, "customer get products failed", err)
+	}
+	response := &crudv1.ListProductsResponse{}
+	for _, item := range items {
+		response.Products = append(response.Products, catalogueProductToProto(item))
+	}
+	return response, nil
+}
+
+func (r *productsRPC) SearchProducts(ctx context.Context, request *crudv1.SearchProductsRequest) (*crudv1.SearchProductsResponse, error) {
+	query := &customers.SearchQuery{
+		Query:    strings.TrimSpace(request.Query),
+		MinPrice: int(request.MinPrice),
+		MaxPrice: int(request.MaxPrice),
+		InStock:  request.InStock,
+		Limit:    int(request.Limit),
+		Offset:   int(request.Offset),
+	}
+	if query.Query == "" || query.MinPrice < 0 || query.MaxPrice < 0 || query.Limit < 0 || query.Offset < 0 {
+		return nil, r.rpcError(ctx, "customer search products failed", errInvalidBody)
+	}
+	items, err := r.customersSvc.Search(ctx, query)
+	if err != nil {
+		return nil, r.rpcError(ctx, "customer search products failed", err)
+	}
+	response := &crudv1.SearchProductsResponse{}
+	for _, item := range items {
+		response.Results = append(response.Results, &crudv1.SearchResult{
+			Product:   catalogueProductToProto(item.Product),
+			Rank:      item.Rank,
+			Highlight: item.Highlight,
+		})
+	}
+	return response, nil
+}
+
+func (r *productsRPC) ListCategories(ctx context.Context, request *crudv1.ListCategoriesRequest) (*crudv1.ListCategoriesResponse, error) {
+	items, err := r.customersSvc.Categories(ctx)
+	if err != nil {
+		return nil, r.rpcError(ctx, "customer get categories failed", err)
+	}
+	response := &crudv1.ListCategoriesResponse{}
+	for _, item := range items {
+		response.Categories = append(response.Categories, &crudv1.Category{Id: item.ID, Name: item.Name, ParentId: item.ParentID})
+	}
+	return response, nil
+}
+
+func (r *productsRPC) GetProduct(ctx context.Context, request *crudv1.GetProductRequest) (*crudv1.Product, error) {
+	_, err := managerID(ctx)
+	if err != nil {
+		return nil, r.rpcError(ctx, "manager get product failed", err)
+	}
+	item, err := r.managersSvc.ProductByID(ctx, request.Id)
+	if err != nil {
+		return nil, r.rpcError(ctx, "manager get product failed", err)
+	}
+	return productToProto(item), nil
+}
+
+func (r *productsRPC) CreateProduct(ctx context.Context, request *crudv1.CreateProductRequest) (*crudv1.Product, error) {
+	id, err := managerID(ctx)
+	if err != nil {
+		return nil, r.rpcError(ctx, "manager create product failed", err)
+	}
+	if request.Product == nil {
+		return nil, r.rpcError(ctx, "manager create product failed", errInvalidBody)
+	}
+	product := productFromProto(request.Product)
+	product.ID = 0
+	item, err := r.managersSvc.CreateProduct(ctx, id, product)
+	if err != nil {
+		return nil, r.rpcError(ctx, "manager create product failed", err)
+	}
+	return productToProto(item), nil
+}
+
+func (r *productsRPC) UpdateProduct(ctx context.Context, request *crudv1.UpdateProductRequest) (*crudv1.Product, error) {
+	id, err := managerID(ctx)
+	if err != nil {
+		return nil, r.rpcError(ctx, "change product failed", err)
+	}
+	if request.Product == nil {
+		return nil, r.rpcError(ctx, "change product failed", errInvalidBody)
+	}
+	if request.Product.Version == 0 {
+		return nil, r.rpcError(ctx, "change product failed", errPreconditionRequired)
+	}
+	item, err := r.managersSvc.UpdateProduct(ctx, id, productFromProto(request.Product))
+	if err != nil {
+		return nil, r.rpcError(ctx, "change product failed", err)
+	}
+	return productToProto(item), nil
+}
+
+func (r *productsRPC) DeleteProduct(ctx context.Context, request *crudv1.DeleteProductRequest) (*crudv1.DeleteProductResponse, error) {
+	_, err := managerID(ctx)
+	if err != nil {
+		return nil, r.rpcError(ctx, "manager remove product by id failed", err)
+	}
+	if request.Version == 0 {
+		return nil, r.rpcError(ctx, "manager remove product by id failed", errPreconditionRequired)
+	}
+	err = r.managersSvc.RemoveProductById(ctx, request.Id, request.Version)
+	if err != nil {
+		return nil, r.rpcError(ctx, "manager remove product by id failed", err)
+	}
+	return &crudv1.DeleteProductResponse{}, nil
+}
+
+// salesRPC реализует crudv1.SalesService.
+type salesRPC struct {
+	crudv1.UnimplementedSalesServiceServer
+	*Server
+}
+
+func (r *salesRPC) CreateSale(ctx context.Context, request *crudv1.CreateSaleRequest) (*crudv1.Sale, error) {
+	id, err := managerID(ctx)
+	if err != nil {
+		return nil, r.rpcError(ctx, "manager make sales failed", err)
+	}
+
+	response, err := r.idempotentRPC(ctx, "manager", id, request, &crudv1.Sale{}, func() (proto.Message, error) {
+		sale := saleFromProto(request)
+		sale.ManagerID = id
+		sale, err := r.makeSale(ctx, sale)
+		if err != nil {
+			return nil, err
+		}
+		return saleToProto(sale), nil
+	})
+	if err != nil {
+		return nil, r.rpcError(ctx, "manager make sales failed", err)
+	}
+	return response.(*crudv1.Sale), nil
+}
+
+func (r *salesRPC) GetSalesTotal(ctx context.Context, request *crudv1.GetSalesTotalRequest) (*crudv1.SalesTotal, error) {
+	id, err := managerID(ctx)
+	if err != nil {
+		return nil, r.rpcError(ctx, "manager get sales failed", err)
+	}
+	total, err := r.managersSvc.GetSales(ctx, id)
+	if err != nil {
+		return nil, r.rpcError(ctx, "manager get sales failed", err)
+	}
+	return &crudv1.SalesTotal{ManagerId: id, Total: int64(total)}, nil
+}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"time"
+
+	crudv1 "github.com/shohinsherov/crud/api/crud/v1"
+	"github.com/shohinsherov/crud/pkg/customers"
+	"github.com/shohinsherov/crud/pkg/managers"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// timestamp переводит время в protobuf; нулевое время не передаётся.
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func customerToProto(item *managers.Customer) *crudv1.Customer {
+	return &crudv1.Customer{
+		Id:      item.ID,
+		Name:    item.Name,
+		Phone:   item.Phone,
+		Active:  item.Active,
+		Version: item.Version,
+		Created: timestamp(item.Created),
+	}
+}
+
+func customerFromProto(item *crudv1.Customer) *managers.Customer {
+	return &managers.Customer{
+		ID:      item.Id,
+		Name:    item.Name,
+		Phone:   item.Phone,
+		Active:  item.Active,
+		Version: item.Version,
+	}
+}
+
+// catalogueProductToProto переводит товар каталога покупателя: у него нет SKU, штрихкодов и версии.
+func catalogueProductToProto(item *customers.Product) *crudv1.Product {
+	product := &crudv1.Product{
+		Id:         item.ID,
+		Name:       item.Name,
+		Price:      int64(item.Price),
+		Qty:        int64(item.Qty),
+		CategoryId: item.CategoryID,
+		Attributes: item.Attributes,
+		Active:     true,
+	}
+	for _, variant := range item.Variants {
+		product.Variants = append(product.Variants, &crudv1.Variant{
+			Id:         variant.ID,
+			ProductId:  item.ID,
+			Sku:        variant.SKU,
+			Attributes: variant.Attributes,
+			Qty:        int64(variant.Qty),
+			Active:     true,
+		})
+	}
+	return product
+}
+
+func productToProto(item *managers.Product) *crudv1.Product {
+	product := &crudv1.Product{
+		Id:         item.ID,
+		Name:       item.Name,
+		Sku:        item.SKU,
+		Price:      int64(item.Price),
+		Qty:        int64(item.Qty),
+		CategoryId: item.CategoryID,
+		Attributes: item.Attributes,
+		Active:     item.Active,
+		Version:    item.Version,
+		Created:    timestamp(item.Created),
+	}
+	for _, variant := range item.Variants {
+		product.Variants = append(product.Variants, &crudv1.Variant{
+			Id:         variant.ID,
+			ProductId:  variant.ProductID,
+			Sku:        variant.SKU,
+			Attributes: variant.Attributes,
+			Qty:        int64(variant.Qty),
+			Active:     variant.Active,
+		})
+	}
+	for _, barcode := range item.Barcodes {
+		product.Barcodes = append(product.Barcodes, &crudv1.Barcode{Code: barcode.Code, ProductId: barcode.ProductID, VariantId: barcode.VariantID})
+	}
+	return product
+}
+
+func productFromProto(item *crudv1.Product) *managers.Product {
+	product := &managers.Product{
+		ID:         item.Id,
+		Name:       item.Name,
+		SKU:        item.Sku,
+		Price:      int(item.Price),
+		Qty:        int(item.Qty),
+		CategoryID: item.CategoryId,
+		Attributes: item.Attributes,
+		Active:     item.Active,
+		Version:    item.Version,
+	}
+	for _, variant := range item.Variants {
+		product.Variants = append(product.Variants, &managers.Variant{
+			ID:         variant.Id,
+			ProductID:  item.Id,
+			SKU:        variant.Sku,
+			Attributes: variant.Attributes,
+			Qty:        int(variant.Qty),
+			Active:     variant.Active,
+		})
+	}
+	for _, barcode := range item.Barcodes {
+		product.Barcodes = append(product.Barcodes, &managers.Barcode{Code: barcode.Code, ProductID: item.Id, VariantID: barcode.VariantId})
+	}
+	return product
+}
+
+func saleToProto(item *managers.Sale) *crudv1.Sale {
+	sale := &crudv1.Sale{
+		Id:         item.ID,
+		ManagerId:  item.ManagerID,
+		CustomerId: item.CustomerID,
+		Created:    timestamp(item.Created),
+	}
+	for _, position := range item.Positions {
+		sale.Positions = append(sale.Positions, &crudv1.SalePosition{
+			Id:        position.ID,
+			ProductId: position.ProductID,
+			VariantId: position.VariantID,
+			Barcode:   position.Barcode,
+			SaleId:    position.SaleID,
+			Price:     int64(position.Price),
+			Qty:       int64(position.Qty),
+			Created:   timestamp(position.Created),
+		})
+	}
+	return sale
+}
+
+func saleFromProto(request *crudv1.CreateSaleRequest) *managers.Sale {
+	sale := &managers.Sale{CustomerID: request.CustomerId}
+	for _, position := range request.Positions {
+		sale.Positions = append(sale.Positions, &managers.SalePosition{
+			ProductID: position.ProductId,
+			VariantID: position.VariantId,
+			Barcode:   position.Barcode,
+			Price:     int(position.Price),
+			Qty:       int(position.Qty),
+		})
+	}
+	return sale
+}
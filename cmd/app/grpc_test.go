@@ -0,0 +1,173 @@
+package app
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	crudv1 "github.com/shohinsherov/crud/api/crud/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newGRPCClient запускает gRPC-сервер поверх server в памяти и возвращает подключение к нему.
+func newGRPCClient(t *testing.T, server *Server) *grpc.ClientConn {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := NewGRPCServer(server)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// withToken добавляет токен в метаданные authorization, как заголовок Authorization в HTTP.
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", token)
+}
+
+func expectCode(t *testing.T, name string, err error, code codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != code {
+		t.Errorf("%s: got code %s, want %s (%v)", name, got, code, err)
+	}
+}
+
+func TestGRPC_Authentication(t *testing.T) {
+	server := newTestServer()
+	conn := newGRPCClient(t, server)
+	testManagerToken(t, server)
+
+	auth := crudv1.NewAuthServiceClient(conn)
+	_, err := auth.ManagerToken(context.Background(), &crudv1.TokenRequest{Login: "+992000000001", Password: "wrong"})
+	expectCode(t, "wrong password", err, codes.Unauthenticated)
+	token, err := auth.ManagerToken(context.Background(), &crudv1.TokenRequest{Login: "+992000000001", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	customers := crudv1.NewCustomersServiceClient(conn)
+	_, err = customers.ListCustomers(context.Background(), &crudv1.ListCustomersRequest{})
+	expectCode(t, "without token", err, codes.PermissionDenied)
+	_, err = customers.ListCustomers(withToken("unknown"), &crudv1.ListCustomersRequest{})
+	expectCode(t, "unknown token", err, codes.PermissionDenied)
+	_, err = customers.ListCustomers(withToken(token.Token), &crudv1.ListCustomersRequest{})
+	expectCode(t, "manager token", err, codes.OK)
+
+	// Каталог доступен без токена, как в HTTP API.
+	_, err = crudv1.NewProductsServiceClient(conn).ListProducts(context.Background(), &crudv1.ListProductsRequest{})
+	expectCode(t, "catalogue", err, codes.OK)
+}
+
+func TestGRPC_ProductVersions(t *testing.T) {
+	server := newTestServer()
+	ctx := withToken(testManagerToken(t, server))
+	products := crudv1.NewProductsServiceClient(newGRPCClient(t, server))
+
+	product, err := products.CreateProduct(ctx, &crudv1.CreateProductRequest{Product: &crudv1.Product{Name: "Хлеб", Price: 5, Qty: 10, Active: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.Id == 0 || product.Version == 0 || product.Created == nil {
+		t.Fatalf("created product: %v", product)
+	}
+
+	product.Price = 6
+	product.Version = 0
+	_, err = products.UpdateProduct(ctx, &crudv1.UpdateProductRequest{Product: product})
+	expectCode(t, "update without version", err, codes.FailedPrecondition)
+
+	created, err := products.GetProduct(ctx, &crudv1.GetProductRequest{Id: product.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	product.Version = created.Version
+	updated, err := products.UpdateProduct(ctx, &crudv1.UpdateProductRequest{Product: product})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Price != 6 || updated.Version <= created.Version {
+		t.Errorf("updated product: got price %d, version %d after %d", updated.Price, updated.Version, created.Version)
+	}
+
+	_, err = products.UpdateProduct(ctx, &crudv1.UpdateProductRequest{Product: product})
+	expectCode(t, "update with stale version", err, codes.Aborted)
+	_, err = products.DeleteProduct(ctx, &crudv1.DeleteProductRequest{Id: product.Id, Version: created.Version})
+	expectCode(t, "delete with stale version", err, codes.Aborted)
+	_, err = products.DeleteProduct(ctx, &crudv1.DeleteProductRequest{Id: product.Id, Version: updated.Version})
+	expectCode(t, "delete", err, codes.OK)
+	_, err = products.GetProduct(ctx, &crudv1.GetProductRequest{Id: 100})
+	expectCode(t, "missing product", err, codes.NotFound)
+}
+
+func TestGRPC_SaleIdempotency(t *testing.T) {
+	server := newTestServer()
+	ctx := withToken(testManagerToken(t, server))
+	conn := newGRPCClient(t, server)
+	products := crudv1.NewProductsServiceClient(conn)
+	sales := crudv1.NewSalesServiceClient(conn)
+
+	product, err := products.CreateProduct(ctx, &crudv1.CreateProductRequest{Product: &crudv1.Product{Name: "Хлеб", Price: 5, Qty: 10, Active: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := &crudv1.CreateSaleRequest{Positions: []*crudv1.SalePosition{{ProductId: product.Id, Qty: 3, Price: 5}}}
+	keyed := metadata.AppendToOutgoingContext(ctx, "idempotency-key", "sale-1")
+
+	var header metadata.MD
+	first, err := sales.CreateSale(keyed, request, grpc.Header(&header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(header.Get(idempotentReplayedHeader)) != 0 {
+		t.Errorf("first call marked as replayed")
+	}
+	retry, err := sales.CreateSale(keyed, request, grpc.Header(&header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retry.Id != first.Id || len(header.Get(idempotentReplayedHeader)) == 0 {
+		t.Errorf("retry: got sale %d, metadata %v, want sale %d", retry.Id, header, first.Id)
+	}
+
+	found, err := products.GetProduct(ctx, &crudv1.GetProductRequest{Id: product.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Qty != 7 {
+		t.Errorf("stock after retry: got %d, want 7", found.Qty)
+	}
+
+	other := &crudv1.CreateSaleRequest{Positions: []*crudv1.SalePosition{{ProductId: product.Id, Qty: 1, Price: 5}}}
+	_, err = sales.CreateSale(keyed, other)
+	expectCode(t, "same key, other request", err, codes.InvalidArgument)
+
+	// Ошибка тоже повторяется: вторая попытка получает тот же код.
+	large := &crudv1.CreateSaleRequest{Positions: []*crudv1.SalePosition{{ProductId: product.Id, Qty: 100, Price: 5}}}
+	for i := 0; i < 2; i++ {
+		_, err = sales.CreateSale(metadata.AppendToOutgoingContext(ctx, "idempotency-key", "sale-2"), large)
+		expectCode(t, "out of stock", err, codes.FailedPrecondition)
+	}
+
+	total, err := sales.GetSalesTotal(ctx, &crudv1.GetSalesTotalRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total.Total != 15 {
+		t.Errorf("sales total: got %d, want 15", total.Total)
+	}
+}
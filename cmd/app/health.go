@@ -0,0 +1,51 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/shohinsherov/crud/pkg/health"
+	"github.com/shohinsherov/crud/pkg/version"
+	"go.uber.org/zap"
+)
+
+// BuildInfo - ответ /version.
+type BuildInfo struct {
+	Version               string `json:"version"`
+	Commit                string `json:"commit"`
+	BuildTime             string `json:"build_time"`
+	SchemaVersion         int64  `json:"schema_version"`
+	ExpectedSchemaVersion int64  `json:"expected_schema_version"`
+}
+
+// handleHealthz отвечает 200, пока процесс жив и обрабатывает запросы.
+func (s *Server) handleHealthz(writer http.ResponseWriter, request *http.Request) {
+	s.writeJSON(writer, request, &health.Result{Status: health.StatusOK, Checks: map[string]string{}})
+}
+
+// handleReadyz отвечает 200, только если база, схема и фоновые задачи готовы, иначе 503.
+func (s *Server) handleReadyz(writer http.ResponseWriter, request *http.Request) {
+	result := s.health.Run(request.Context())
+	if result.Status != health.StatusOK {
+		s.log(request.Context()).Warn("not ready", zap.Any("checks", result.Checks))
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}
+	s.writeJSON(writer, request, result)
+}
+
+func (s *Server) handleVersion(writer http.ResponseWriter, request *http.Request) {
+	info := &BuildInfo{
+		Version:               version.Version,
+		Commit:                version.Commit,
+		BuildTime:             version.BuildTime,
+		ExpectedSchemaVersion: s.migrator.Latest(),
+	}
+	schemaVersion, err := s.migrator.Version(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("handle version failed", zap.Error(err))
+		schemaVersion = -1
+	}
+	info.SchemaVersion = schemaVersion
+
+	s.writeJSON(writer, request, info)
+}
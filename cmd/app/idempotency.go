@@ -0,0 +1,196 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/shohinsherov/crud/cmd/app/middleware"
+	"github.com/shohinsherov/crud/pkg/idempotency"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Заголовки идемпотентных запросов; в gRPC те же имена используются в метаданных.
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader помечает ответ, повторённый из сохранённого.
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	// grpcCodeHeader и grpcMessageHeader хранят ошибку вызова gRPC, которую нужно повторить.
+	grpcCodeHeader    = "Grpc-Code"
+	grpcMessageHeader = "Grpc-Message"
+)
+
+// idempotentHeaders - заголовки ответа, которые сохраняются вместе с телом.
+var idempotentHeaders = []string{"Content-Type", "Location", "ETag"}
+
+// idempotent делает обработчик повторяемым: запрос с заголовком Idempotency-Key выполняется один раз,
+// повтор с тем же ключом и телом получает сохранённый ответ, с другим телом - 422.
+// Ключи принадлежат пользователю: к prefix вроде "manager" добавляется ID из токена.
+// Ответы 5xx не сохраняются, такой запрос можно повторить с тем же ключом.
+func (s *Server) idempotent(prefix string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		key := request.Header.Get(idempotencyKeyHeader)
+		id, err := middleware.Authentication(request.Context())
+		if key == "" || err != nil || id == 0 {
+			handler(writer, request)
+			return
+		}
+
+		body, err := ioutil.ReadAll(request.Body)
+		if err != nil {
+			s.log(request.Context()).Warn("can't read request body", zap.Error(err))
+			http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		scope := prefix + ":" + strconv.FormatInt(id, 10)
+		record, err := s.idempotencySvc.Begin(request.Context(), scope, key, requestHash(request, body))
+		if err != nil {
+			s.log(request.Context()).Warn("idempotency key rejected", zap.String("key", key), zap.Error(err))
+			writeManagerError(writer, err)
+			return
+		}
+		if record.Status != 0 {
+			for name, value := range record.Header {
+				writer.Header().Set(name, value)
+			}
+			writer.Header().Set(idempotentReplayedHeader, "true")
+			writer.WriteHeader(record.Status)
+			_, err = writer.Write(record.Body)
+			if err != nil {
+				s.log(request.Context()).Error("can't write response", zap.Error(err))
+			}
+			return
+		}
+
+		recorder := &responseRecorder{StatusRecorder: middleware.NewStatusRecorder(writer)}
+		handler(recorder, request)
+
+		// Запрос мог быть отменён клиентом, но ответ всё равно нужно сохранить.
+		ctx := context.Background()
+		if recorder.Status() >= http.StatusInternalServerError {
+			err = s.idempotencySvc.Release(ctx, record)
+		} else {
+			record.Status = recorder.Status()
+			record.Header = map[string]string{}
+			record.Body = recorder.body.Bytes()
+			for _, name := range idempotentHeaders {
+				if value := writer.Header().Get(name); value != "" {
+					record.Header[name] = value
+				}
+			}
+			err = s.idempotencySvc.Complete(ctx, record)
+		}
+		s.logIdempotencyError(request.Context(), key, err)
+	}
+}
+
+// logIdempotencyError логирует ошибку сохранения ответа. Истёкшая аренда - не сбой: запрос выполнялся
+// дольше lease, и ключ уже занял повтор.
+func (s *Server) logIdempotencyError(ctx context.Context, key string, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, idempotency.ErrLeaseExpired):
+		s.log(ctx).Warn("idempotency key lease expired, response not saved", zap.String("key", key))
+	default:
+		s.log(ctx).Error("can't save idempotency key", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// idempotentRPC - аналог idempotent для gRPC: ключ берётся из метаданных idempotency-key,
+// успешный ответ call сохраняется в protobuf и при повторе разбирается в replay, ошибка - кодом и текстом.
+// Как и в HTTP, ошибки с кодом 5xx по serviceErrors не сохраняются.
+func (s *Server) idempotentRPC(ctx context.Context, prefix string, id int64, request proto.Message, replay proto.Message, call func() (proto.Message, error)) (proto.Message, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	keys := md.Get(idempotencyKeyHeader)
+	if len(keys) == 0 || keys[0] == "" {
+		return call()
+	}
+	key := keys[0]
+
+	body, err := proto.MarshalOptions{Deterministic: true}.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	method, _ := grpc.Method(ctx)
+	hash := sha256.New()
+	hash.Write([]byte("RPC " + method + "\n"))
+	hash.Write(body)
+
+	scope := prefix + ":" + strconv.FormatInt(id, 10)
+	record, err := s.idempotencySvc.Begin(ctx, scope, key, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		s.log(ctx).Warn("idempotency key rejected", zap.String("key", key), zap.Error(err))
+		return nil, err
+	}
+	if record.Status != 0 {
+		_ = grpc.SetHeader(ctx, metadata.Pairs(idempotentReplayedHeader, "true"))
+		if value, ok := record.Header[grpcCodeHeader]; ok {
+			code, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			return nil, status.Error(codes.Code(code), record.Header[grpcMessageHeader])
+		}
+		err = proto.Unmarshal(record.Body, replay)
+		if err != nil {
+			return nil, err
+		}
+		return replay, nil
+	}
+
+	response, callErr := call()
+	// Вызов мог быть отменён клиентом, но ответ всё равно нужно сохранить.
+	background := context.Background()
+	switch {
+	case callErr != nil && errorStatus(callErr) >= http.StatusInternalServerError:
+		err = s.idempotencySvc.Release(background, record)
+	case callErr != nil:
+		st := rpcStatus(callErr)
+		record.Status = errorStatus(callErr)
+		record.Header = map[string]string{
+			grpcCodeHeader:    strconv.FormatUint(uint64(st.Code()), 10),
+			grpcMessageHeader: st.Message(),
+		}
+		err = s.idempotencySvc.Complete(background, record)
+	default:
+		record.Status = http.StatusOK
+		record.Header = map[string]string{}
+		record.Body, err = proto.Marshal(response)
+		if err == nil {
+			err = s.idempotencySvc.Complete(background, record)
+		}
+	}
+	s.logIdempotencyError(ctx, key, err)
+	return response, callErr
+}
+
+// requestHash - хеш метода, пути и тела запроса: повтор с тем же ключом должен совпадать с исходным запросом.
+func requestHash(request *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(request.Method + " " + request.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder передаёт ответ клиенту и, кроме кода, запоминает тело, чтобы сохранить его для повторов.
+type responseRecorder struct {
+	*middleware.StatusRecorder
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.StatusRecorder.Write(data)
+}
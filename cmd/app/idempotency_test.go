@@ -0,0 +1,68 @@
+package app
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/shohinsherov/crud/pkg/managers"
+)
+
+func TestIdempotent_Sales(t *testing.T) {
+	server := newTestServer()
+	token := testManagerToken(t, server)
+	const sales = "/api/v1/managers/sales"
+
+	product := &managers.Product{}
+	decodeRecorder(t, managerRequest(t, server, token, POST, "/api/v1/managers/products", nil, &managers.Product{Name: "Хлеб", Price: 5, Qty: 10}), http.StatusCreated, product)
+	sale := &managers.Sale{Positions: []*managers.SalePosition{{ProductID: product.ID, Qty: 3, Price: 5}}}
+	key := http.Header{idempotencyKeyHeader: {"sale-1"}}
+
+	first := &managers.Sale{}
+	recorder := managerRequest(t, server, token, POST, sales, key, sale)
+	decodeRecorder(t, recorder, http.StatusOK, first)
+	if recorder.Header().Get(idempotentReplayedHeader) != "" {
+		t.Errorf("first request marked as replayed")
+	}
+
+	retry := &managers.Sale{}
+	recorder = managerRequest(t, server, token, POST, sales, key, sale)
+	decodeRecorder(t, recorder, http.StatusOK, retry)
+	if retry.ID != first.ID || recorder.Header().Get(idempotentReplayedHeader) != "true" || recorder.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("retry: got sale %d, headers %v, want sale %d", retry.ID, recorder.Header(), first.ID)
+	}
+
+	found := &managers.Product{}
+	decodeRecorder(t, managerRequest(t, server, token, GET, "/api/v1/managers/products/"+jsonID(product.ID), nil, nil), http.StatusOK, found)
+	if found.Qty != 7 {
+		t.Errorf("stock after retry: got %d, want 7", found.Qty)
+	}
+
+	other := &managers.Sale{Positions: []*managers.SalePosition{{ProductID: product.ID, Qty: 1, Price: 5}}}
+	recorder = managerRequest(t, server, token, POST, sales, key, other)
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Errorf("same key, other body: got status %d", recorder.Code)
+	}
+	recorder = managerRequest(t, server, token, POST, "/api/managers/sales", key, sale)
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Errorf("same key, other path: got status %d", recorder.Code)
+	}
+	recorder = managerRequest(t, server, token, POST, sales, http.Header{idempotencyKeyHeader: {"ключ"}}, sale)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("invalid key: got status %d", recorder.Code)
+	}
+
+	// Ошибки 4xx тоже повторяются: вторая попытка не списывает товар.
+	large := &managers.Sale{Positions: []*managers.SalePosition{{ProductID: product.ID, Qty: 100, Price: 5}}}
+	for i := 0; i < 2; i++ {
+		recorder = managerRequest(t, server, token, POST, sales, http.Header{idempotencyKeyHeader: {"sale-2"}}, large)
+		if recorder.Code != http.StatusConflict {
+			t.Errorf("out of stock attempt %d: got status %d", i, recorder.Code)
+		}
+	}
+
+	second := &managers.Sale{}
+	decodeRecorder(t, managerRequest(t, server, token, POST, sales, nil, sale), http.StatusOK, second)
+	if second.ID == first.ID {
+		t.Errorf("request without key replayed sale %d", first.ID)
+	}
+}
@@ -1,32 +1,34 @@
 package app
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
-	"log"
+	"errors"
 	"net/http"
+	"path"
 	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/shohinsherov/crud/cmd/app/middleware"
 	"github.com/shohinsherov/crud/pkg/managers"
+	"go.uber.org/zap"
 )
 
 func (s *Server) handleManagerRegistration(writer http.ResponseWriter, request *http.Request) {
 	id, err := middleware.Authentication(request.Context())
 	if err != nil {
-		log.Print(err)
+		s.log(request.Context()).Error("register manager: authentication failed", zap.Error(err))
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 	if id == 0 {
-		log.Print("User by id:", id, "is not manager")
+		s.log(request.Context()).Warn("user is not manager")
 		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 		return
 	}
 
 	if !s.managersSvc.IsAdmin(request.Context(), id) {
-		log.Print("manager by id:", id, "is not admin")
+		s.log(request.Context()).Warn("manager is not admin", zap.Int64("manager_id", id))
 		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 		return
 	}
@@ -56,18 +58,22 @@ func (s *Server) handleManagerRegistration(writer http.ResponseWriter, request *
 func (s *Server) handleManagerGetToken(writer http.ResponseWriter, request *http.Request) {
 	var auth *managers.Auth
 	err := json.NewDecoder(request.Body).Decode(&auth)
-	fmt.Print(auth)
 	if err != nil {
-		log.Print("Can't Decode login and password")
+		s.log(request.Context()).Warn("can't decode login and password", zap.Error(err))
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
-	log.Print("Login: ", auth.Phone, "Password: ", auth.Password)
 
 	token, err := s.managersSvc.Token(request.Context(), auth.Phone, auth.Password)
+	s.recordLogin("manager", err, managers.ErrInvalidPassword)
+	if errors.Is(err, managers.ErrInvalidPassword) {
+		s.log(request.Context()).Warn("get manager token: invalid credentials")
+		writeManagerError(writer, err)
+		return
+	}
 	if err != nil {
-		log.Print(err)
-		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.log(request.Context()).Error("get manager token failed", zap.Error(err))
+		writeManagerError(writer, err)
 		return
 	}
 	data, err := json.Marshal(&Token{Token: token})
@@ -84,84 +90,184 @@ func (s *Server) handleManagerGetToken(writer http.ResponseWriter, request *http
 
 }
 
-func (s *Server) handleManagerChangeProducts(writer http.ResponseWriter, request *http.Request) {
+// handleManagerCreateProduct создаёт товар. Запрос с ненулевым id обновляет товар, как в прежнем API;
+// такой вариант устарел, замена - PUT /products/{id}, и так же требует If-Match.
+func (s *Server) handleManagerCreateProduct(writer http.ResponseWriter, request *http.Request) {
 	id, err := middleware.Authentication(request.Context())
 	if err != nil {
-		log.Print(err)
+		s.log(request.Context()).Error("create product: authentication failed", zap.Error(err))
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 	if id == 0 {
-		log.Print("User is not manager")
+		s.log(request.Context()).Warn("user is not manager")
 		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 		return
 	}
 	product := &managers.Product{}
 	err = json.NewDecoder(request.Body).Decode(&product)
-	fmt.Print(product)
 	if err != nil {
-		log.Print("Can't Decode product")
-		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.log(request.Context()).Warn("can't decode product", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
-	if product.ID == 0 {
-		product, err = s.managersSvc.CreateProduct(request.Context(), product)
+	if product.ID != 0 {
+		updateByPOSTDeprecation.Apply(writer.Header(), path.Join(request.URL.Path, strconv.FormatInt(product.ID, 10)))
+		product.Version, err = ifMatchVersion(request)
 		if err != nil {
-			log.Print(err)
-			http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			s.log(request.Context()).Warn("update product: precondition failed", zap.Error(err))
+			writeManagerError(writer, err)
 			return
 		}
-	} else {
-		product, err = s.managersSvc.UpdateProduct(request.Context(), product)
+		product, err = s.managersSvc.UpdateProduct(request.Context(), id, product)
 		if err != nil {
-			log.Print(err)
-			http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			s.log(request.Context()).Error("update product failed", zap.Error(err))
+			writeManagerError(writer, err)
 			return
 		}
+		s.writeJSON(writer, request, product)
+		return
 	}
 
-	data, err := json.Marshal(product)
+	product, err = s.managersSvc.CreateProduct(request.Context(), id, product)
 	if err != nil {
-		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.log(request.Context()).Error("create product failed", zap.Error(err))
+		writeManagerError(writer, err)
 		return
 	}
-	writer.Header().Set("Content-Type", "application/json")
-	_, err = writer.Write(data)
+	writer.Header().Set("ETag", versionETag(product.Version))
+	s.writeCreated(writer, request, product.ID, product)
+}
+
+func (s *Server) handleManagerGetProductByID(writer http.ResponseWriter, request *http.Request) {
+	s.changeProduct(writer, request, func(managerID int64, productID int64) (*managers.Product, error) {
+		return s.managersSvc.ProductByID(request.Context(), productID)
+	})
+}
+
+// handleManagerReplaceProduct заменяет товар целиком: не переданные поля получают нулевые значения.
+// If-Match обязателен, чтобы не затереть чужие изменения.
+func (s *Server) handleManagerReplaceProduct(writer http.ResponseWriter, request *http.Request) {
+	s.changeProduct(writer, request, func(managerID int64, productID int64) (*managers.Product, error) {
+		version, err := ifMatchVersion(request)
+		if err != nil {
+			return nil, err
+		}
+		product := &managers.Product{}
+		err = json.NewDecoder(request.Body).Decode(&product)
+		if err != nil {
+			return nil, errInvalidBody
+		}
+		product.ID = productID
+		product.Version = version
+		return s.managersSvc.UpdateProduct(request.Context(), managerID, product)
+	})
+}
+
+// handleManagerPatchProduct меняет только переданные поля товара (JSON Merge Patch); If-Match обязателен.
+func (s *Server) handleManagerPatchProduct(writer http.ResponseWriter, request *http.Request) {
+	s.changeProduct(writer, request, func(managerID int64, productID int64) (*managers.Product, error) {
+		version, err := ifMatchVersion(request)
+		if err != nil {
+			return nil, err
+		}
+		patch, err := readMergePatch(request)
+		if err != nil {
+			return nil, err
+		}
+		current, err := s.managersSvc.ProductByID(request.Context(), productID)
+		if err != nil {
+			return nil, err
+		}
+		if version != 0 && current.Version != version {
+			return nil, managers.ErrVersionMismatch
+		}
+		product := &managers.Product{}
+		err = mergePatch(current, patch, product)
+		if err != nil {
+			return nil, err
+		}
+		// Патч наложен на current: товар обновится, только если с тех пор его не изменили.
+		product.ID = productID
+		product.Version = current.Version
+		return s.managersSvc.UpdateProduct(request.Context(), managerID, product)
+	})
+}
+
+// changeProduct проверяет менеджера и ID товара из пути и отправляет товар, который вернул change, с ETag его версии.
+func (s *Server) changeProduct(writer http.ResponseWriter, request *http.Request, change func(managerID int64, productID int64) (*managers.Product, error)) {
+	id, err := middleware.Authentication(request.Context())
 	if err != nil {
+		s.log(request.Context()).Error("change product: authentication failed", zap.Error(err))
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	productID, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		s.log(request.Context()).Warn("change product: invalid id", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	product, err := change(id, productID)
+	if err != nil {
+		s.log(request.Context()).Error("change product failed", zap.Error(err))
+		writeManagerError(writer, err)
+		return
+	}
+
+	s.writeTagged(writer, request, versionETag(product.Version), product)
+}
 
+// makeSale оформляет продажу и учитывает её в метриках; общая часть HTTP, gRPC и GraphQL.
+func (s *Server) makeSale(ctx context.Context, sale *managers.Sale) (*managers.Sale, error) {
+	sale, err := s.managersSvc.MakeSale(ctx, sale)
+	if errors.Is(err, managers.ErrOutOfStock) {
+		s.metrics.OutOfStock.Inc()
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.metrics.SalesCreated.Inc()
+	for _, position := range sale.Positions {
+		s.metrics.UnitsSold.Add(float64(position.Qty))
+	}
+	return sale, nil
 }
 
 func (s *Server) handleManagerMakeSales(writer http.ResponseWriter, request *http.Request) {
 	id, err := middleware.Authentication(request.Context())
 	if err != nil {
-		log.Print(err)
+		s.log(request.Context()).Error("make sale: authentication failed", zap.Error(err))
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 	if id == 0 {
-		log.Print("User is not manager")
+		s.log(request.Context()).Warn("user is not manager")
 		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 		return
 	}
 	sale := &managers.Sale{}
-	sale.ManagerID = id
 	err = json.NewDecoder(request.Body).Decode(&sale)
-	fmt.Print(sale)
-	fmt.Print(sale.Positions)
 	if err != nil {
-		log.Print("Can't Decode product")
-		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.log(request.Context()).Warn("can't decode sale", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
+	// Продавец - всегда менеджер из токена, manager_id в теле игнорируется.
+	sale.ManagerID = id
 
-	sale, err = s.managersSvc.MakeSale(request.Context(), sale)
+	sale, err = s.makeSale(request.Context(), sale)
 	if err != nil {
-		log.Print(err)
-		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.log(request.Context()).Error("make sale failed", zap.Error(err))
+		writeManagerError(writer, err)
 		return
 	}
 	data, err := json.Marshal(sale)
@@ -181,18 +287,18 @@ func (s *Server) handleManagerMakeSales(writer http.ResponseWriter, request *htt
 func (s *Server) handleManagerGetSales(writer http.ResponseWriter, request *http.Request) {
 	id, err := middleware.Authentication(request.Context())
 	if err != nil {
-		log.Print(err)
+		s.log(request.Context()).Error("get sales: authentication failed", zap.Error(err))
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 	if id == 0 {
-		log.Print("User is not manager")
+		s.log(request.Context()).Warn("user is not manager")
 		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 		return
 	}
 	total, err := s.managersSvc.GetSales(request.Context(), id)
 	if err != nil {
-		log.Print(err)
+		s.log(request.Context()).Error("get sales failed", zap.Error(err))
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
@@ -211,119 +317,126 @@ func (s *Server) handleManagerGetSales(writer http.ResponseWriter, request *http
 }
 
 func (s *Server) handleManagerGetProducts(writer http.ResponseWriter, request *http.Request) {
-	items, err := s.managersSvc.Products(request.Context())
+	categoryID, attributes, err := parseProductFilter(request)
 	if err != nil {
-		log.Print(err)
-		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.log(request.Context()).Warn("get products: invalid filter", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
-	data, err := json.Marshal(items)
+	items, err := s.managersSvc.Products(request.Context(), &managers.ProductFilter{CategoryID: categoryID, Attributes: attributes})
 	if err != nil {
-		log.Print(err)
+		s.log(request.Context()).Error("get products failed", zap.Error(err))
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	writer.Header().Set("Content-Type", "application/json")
-	_, err = writer.Write(data)
-	if err != nil {
-		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
-	}
+	s.writeCacheable(writer, request, items)
 }
 
 func (s *Server) handleManagerRemoveProductByID(writer http.ResponseWriter, request *http.Request) {
 	id, err := middleware.Authentication(request.Context())
 	if err != nil {
-		log.Print(err)
+		s.log(request.Context()).Error("remove product: authentication failed", zap.Error(err))
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 	if id == 0 {
-		log.Print("User is not manager")
+		s.log(request.Context()).Warn("user is not manager")
 		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 		return
 	}
 
 	idParam, ok := mux.Vars(request)["id"]
 	if !ok {
-		log.Print("Missing id")
+		s.log(request.Context()).Warn("missing id")
 		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 	productID, err := strconv.ParseInt(idParam, 10, 64)
 	if err != nil {
-		log.Print(err)
-		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.log(request.Context()).Warn("remove product: invalid id", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
-	err = s.managersSvc.RemoveProductById(request.Context(), productID)
+	version, err := ifMatchVersion(request)
 	if err != nil {
-		log.Print(err)
-		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.log(request.Context()).Warn("remove product: precondition failed", zap.Error(err))
+		writeManagerError(writer, err)
 		return
 	}
-
+	err = s.managersSvc.RemoveProductById(request.Context(), productID, version)
+	if err != nil {
+		s.log(request.Context()).Error("remove product failed", zap.Error(err))
+		writeManagerError(writer, err)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
 }
 
 func (s *Server) handleManagerRemoveCustomerByID(writer http.ResponseWriter, request *http.Request) {
 	id, err := middleware.Authentication(request.Context())
 	if err != nil {
-		log.Print(err)
+		s.log(request.Context()).Error("remove customer: authentication failed", zap.Error(err))
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 	if id == 0 {
-		log.Print("User is not manager")
+		s.log(request.Context()).Warn("user is not manager")
 		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 		return
 	}
 
 	idParam, ok := mux.Vars(request)["id"]
 	if !ok {
-		log.Print("Missing id")
+		s.log(request.Context()).Warn("missing id")
 		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 	customerID, err := strconv.ParseInt(idParam, 10, 64)
 	if err != nil {
-		log.Print(err)
-		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.log(request.Context()).Warn("remove customer: invalid id", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
-	err = s.managersSvc.RemoveCustomerById(request.Context(), customerID)
+	version, err := ifMatchVersion(request)
 	if err != nil {
-		log.Print(err)
-		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.log(request.Context()).Warn("remove customer: precondition failed", zap.Error(err))
+		writeManagerError(writer, err)
 		return
 	}
-
+	err = s.managersSvc.RemoveCustomerById(request.Context(), customerID, version)
+	if err != nil {
+		s.log(request.Context()).Error("remove customer failed", zap.Error(err))
+		writeManagerError(writer, err)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
 }
 
 func (s *Server) handleManagerGetCustomers(writer http.ResponseWriter, request *http.Request) {
 	id, err := middleware.Authentication(request.Context())
 	if err != nil {
-		log.Print(err)
+		s.log(request.Context()).Error("get customers: authentication failed", zap.Error(err))
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 	if id == 0 {
-		log.Println("User is not manager")
+		s.log(request.Context()).Warn("user is not manager")
 		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 		return
 	}
 
 	items, err := s.managersSvc.Customers(request.Context())
 	if err != nil {
-		log.Print(err)
+		s.log(request.Context()).Error("get customers failed", zap.Error(err))
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
 	data, err := json.Marshal(items)
 	if err != nil {
-		log.Print(err)
+		s.log(request.Context()).Error("get customers: can't encode response", zap.Error(err))
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
@@ -336,45 +449,147 @@ func (s *Server) handleManagerGetCustomers(writer http.ResponseWriter, request *
 	}
 }
 
-func (s *Server) handleManagerChangeCustomer(writer http.ResponseWriter, request *http.Request) {
+// customerCreation - покупатель, которого заводит менеджер, вместе с паролем.
+type customerCreation struct {
+	managers.Customer
+	Password string `json:"password"`
+}
+
+// newCustomer возвращает покупателя для разбора тела запроса: без поля active покупатель активен.
+func newCustomer() *managers.Customer {
+	return &managers.Customer{Active: true}
+}
+
+// handleManagerCreateCustomer заводит покупателя. Запрос с ненулевым id обновляет покупателя, как в прежнем API;
+// такой вариант устарел, замена - PUT /customers/{id}, и так же требует If-Match.
+func (s *Server) handleManagerCreateCustomer(writer http.ResponseWriter, request *http.Request) {
 	id, err := middleware.Authentication(request.Context())
 	if err != nil {
-		log.Print(err)
+		s.log(request.Context()).Error("create customer: authentication failed", zap.Error(err))
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 	if id == 0 {
-		log.Print("User is not manager")
+		s.log(request.Context()).Warn("user is not manager")
 		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 		return
 	}
-	customer := &managers.Customer{}
-	err = json.NewDecoder(request.Body).Decode(&customer)
-	fmt.Println(customer)
+	creation := &customerCreation{Customer: *newCustomer()}
+	err = json.NewDecoder(request.Body).Decode(&creation)
 	if err != nil {
-		log.Print("Can't Decode customer")
-		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.log(request.Context()).Warn("can't decode customer", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if creation.ID != 0 {
+		updateByPOSTDeprecation.Apply(writer.Header(), path.Join(request.URL.Path, strconv.FormatInt(creation.ID, 10)))
+		creation.Version, err = ifMatchVersion(request)
+		if err != nil {
+			s.log(request.Context()).Warn("update customer: precondition failed", zap.Error(err))
+			writeManagerError(writer, err)
+			return
+		}
+		customer, err := s.managersSvc.ChangeCustomer(request.Context(), &creation.Customer)
+		if err != nil {
+			s.log(request.Context()).Error("change customer failed", zap.Error(err))
+			writeManagerError(writer, err)
+			return
+		}
+		s.writeJSON(writer, request, customer)
 		return
 	}
 
-	customer, err = s.managersSvc.ChangeCustomer(request.Context(), customer)
+	customer, err := s.managersSvc.CreateCustomer(request.Context(), &creation.Customer, creation.Password)
 	if err != nil {
-		log.Print(err)
-		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.log(request.Context()).Error("create customer failed", zap.Error(err))
+		writeManagerError(writer, err)
 		return
 	}
+	writer.Header().Set("ETag", versionETag(customer.Version))
+	s.writeCreated(writer, request, customer.ID, customer)
+}
 
-	data, err := json.Marshal(customer)
+func (s *Server) handleManagerGetCustomerByID(writer http.ResponseWriter, request *http.Request) {
+	s.changeCustomer(writer, request, func(customerID int64) (*managers.Customer, error) {
+		return s.managersSvc.CustomerByID(request.Context(), customerID)
+	})
+}
+
+// handleManagerReplaceCustomer заменяет покупателя целиком; пароль так не меняется. If-Match обязателен.
+func (s *Server) handleManagerReplaceCustomer(writer http.ResponseWriter, request *http.Request) {
+	s.changeCustomer(writer, request, func(customerID int64) (*managers.Customer, error) {
+		version, err := ifMatchVersion(request)
+		if err != nil {
+			return nil, err
+		}
+		customer := newCustomer()
+		err = json.NewDecoder(request.Body).Decode(&customer)
+		if err != nil {
+			return nil, errInvalidBody
+		}
+		customer.ID = customerID
+		customer.Version = version
+		return s.managersSvc.ChangeCustomer(request.Context(), customer)
+	})
+}
+
+// handleManagerPatchCustomer меняет только переданные поля покупателя (JSON Merge Patch); If-Match обязателен.
+func (s *Server) handleManagerPatchCustomer(writer http.ResponseWriter, request *http.Request) {
+	s.changeCustomer(writer, request, func(customerID int64) (*managers.Customer, error) {
+		version, err := ifMatchVersion(request)
+		if err != nil {
+			return nil, err
+		}
+		patch, err := readMergePatch(request)
+		if err != nil {
+			return nil, err
+		}
+		current, err := s.managersSvc.CustomerByID(request.Context(), customerID)
+		if err != nil {
+			return nil, err
+		}
+		if version != 0 && current.Version != version {
+			return nil, managers.ErrVersionMismatch
+		}
+		customer := &managers.Customer{}
+		err = mergePatch(current, patch, customer)
+		if err != nil {
+			return nil, err
+		}
+		customer.ID = customerID
+		customer.Version = current.Version
+		return s.managersSvc.ChangeCustomer(request.Context(), customer)
+	})
+}
+
+// changeCustomer проверяет менеджера и ID покупателя из пути и отправляет покупателя, которого вернул change, с ETag его версии.
+func (s *Server) changeCustomer(writer http.ResponseWriter, request *http.Request, change func(customerID int64) (*managers.Customer, error)) {
+	id, err := middleware.Authentication(request.Context())
 	if err != nil {
-		log.Print(err)
+		s.log(request.Context()).Error("change customer: authentication failed", zap.Error(err))
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
 
-	writer.Header().Set("Content-Type", "application/json")
-	_, err = writer.Write(data)
+	customerID, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
 	if err != nil {
-		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.log(request.Context()).Warn("change customer: invalid id", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	customer, err := change(customerID)
+	if err != nil {
+		s.log(request.Context()).Error("change customer failed", zap.Error(err))
+		writeManagerError(writer, err)
 		return
 	}
+
+	s.writeTagged(writer, request, versionETag(customer.Version), customer)
 }
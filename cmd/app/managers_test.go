@@ -0,0 +1,319 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shohinsherov/crud/pkg/managers"
+)
+
+// managerRequest выполняет запрос менеджера к server; body сериализуется в JSON,
+// Content-Type по умолчанию application/json.
+func managerRequest(t *testing.T, server *Server, token string, method string, path string, header http.Header, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	request := httptest.NewRequest(method, path, bytes.NewReader(data))
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	request.Header.Set("Authorization", token)
+	if body != nil && request.Header.Get("Content-Type") == "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// ifMatch возвращает заголовки условного запроса; для PATCH добавляется тип merge patch.
+func ifMatch(etag string, patch bool) http.Header {
+	header := http.Header{}
+	header.Set("If-Match", etag)
+	if patch {
+		header.Set("Content-Type", mergePatchType)
+	}
+	return header
+}
+
+func testManagerToken(t *testing.T, server *Server) string {
+	t.Helper()
+	ctx := context.Background()
+	_, err := server.managersSvc.Create(ctx, &managers.Registration{Name: "Manager", Phone: "+992000000001"}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := server.managersSvc.Token(ctx, "+992000000001", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func decodeRecorder(t *testing.T, recorder *httptest.ResponseRecorder, status int, out interface{}) {
+	t.Helper()
+	if recorder.Code != status {
+		t.Fatalf("got status %d, want %d: %s", recorder.Code, status, recorder.Body.String())
+	}
+	err := json.Unmarshal(recorder.Body.Bytes(), out)
+	if err != nil {
+		t.Fatalf("can't decode %s: %v", recorder.Body.String(), err)
+	}
+}
+
+func TestManagers_ProductResource(t *testing.T) {
+	server := newTestServer()
+	token := testManagerToken(t, server)
+	const products = "/api/v1/managers/products"
+
+	recorder := managerRequest(t, server, token, POST, products, nil,
+		&managers.Product{Name: "Футболка", SKU: "TSHIRT", Price: 100, Qty: 3, Attributes: map[string]string{"color": "red", "size": "M"}})
+	product := &managers.Product{}
+	decodeRecorder(t, recorder, http.StatusCreated, product)
+	location := recorder.Header().Get("Location")
+	if product.ID == 0 || location != products+"/"+jsonID(product.ID) {
+		t.Fatalf("create: got product %+v, location %q", product, location)
+	}
+	etag := recorder.Header().Get("ETag")
+	if etag != versionETag(product.Version) {
+		t.Errorf("create: got ETag %q for version %d", etag, product.Version)
+	}
+
+	recorder = managerRequest(t, server, token, GET, location, nil, nil)
+	found := &managers.Product{}
+	decodeRecorder(t, recorder, http.StatusOK, found)
+	if found.Name != "Футболка" || found.Price != 100 || recorder.Header().Get("ETag") != etag {
+		t.Errorf("get: got %+v, ETag %q", found, recorder.Header().Get("ETag"))
+	}
+	recorder = managerRequest(t, server, token, GET, location, http.Header{"If-None-Match": {etag}}, nil)
+	if recorder.Code != http.StatusNotModified || recorder.Body.Len() != 0 {
+		t.Errorf("get with If-None-Match: got status %d, %d bytes", recorder.Code, recorder.Body.Len())
+	}
+
+	recorder = managerRequest(t, server, token, PATCH, location, ifMatch(etag, true), map[string]interface{}{
+		"price":      120,
+		"attributes": map[string]interface{}{"size": nil},
+	})
+	patched := &managers.Product{}
+	decodeRecorder(t, recorder, http.StatusOK, patched)
+	if patched.Name != "Футболка" || patched.Price != 120 || patched.Qty != 3 || len(patched.Attributes) != 1 || patched.Attributes["color"] != "red" {
+		t.Errorf("patch: got %+v", patched)
+	}
+	if recorder.Header().Get("ETag") == etag {
+		t.Errorf("patch: ETag %q did not change", etag)
+	}
+
+	// Второй менеджер с устаревшей версией не затирает изменения первого.
+	for _, method := range []string{PUT, PATCH, DELETE} {
+		recorder = managerRequest(t, server, token, method, location, ifMatch(etag, method == PATCH), &managers.Product{Name: "Чужая", Price: 1})
+		if recorder.Code != http.StatusPreconditionFailed {
+			t.Errorf("%s with stale If-Match: got status %d", method, recorder.Code)
+		}
+		recorder = managerRequest(t, server, token, method, location, nil, &managers.Product{Name: "Чужая", Price: 1})
+		if recorder.Code != http.StatusPreconditionRequired {
+			t.Errorf("%s without If-Match: got status %d", method, recorder.Code)
+		}
+	}
+
+	etag = versionETag(patched.Version)
+	replaced := &managers.Product{}
+	decodeRecorder(t, managerRequest(t, server, token, PUT, location, ifMatch(etag, false), &managers.Product{Name: "Майка", Price: 90}), http.StatusOK, replaced)
+	if replaced.ID != product.ID || replaced.Name != "Майка" || replaced.SKU != "" || replaced.Qty != 0 || len(replaced.Attributes) != 0 {
+		t.Errorf("put: got %+v", replaced)
+	}
+
+	recorder = managerRequest(t, server, token, POST, products, nil, &managers.Product{ID: product.ID, Name: "Майка", Price: 95})
+	if recorder.Code != http.StatusPreconditionRequired {
+		t.Errorf("update by post without If-Match: got status %d", recorder.Code)
+	}
+	recorder = managerRequest(t, server, token, POST, products, ifMatch(etag, false), &managers.Product{ID: product.ID, Name: "Майка", Price: 95})
+	if recorder.Code != http.StatusPreconditionFailed {
+		t.Errorf("update by post with stale If-Match: got status %d", recorder.Code)
+	}
+	recorder = managerRequest(t, server, token, POST, products, ifMatch(versionETag(replaced.Version), false), &managers.Product{ID: product.ID, Name: "Майка", Price: 95})
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Deprecation") == "" {
+		t.Errorf("update by post: got status %d, headers %v", recorder.Code, recorder.Header())
+	}
+	if link := recorder.Header().Get("Link"); link != "<"+location+`>; rel="successor-version"` {
+		t.Errorf("update by post: got Link %q", link)
+	}
+
+	recorder = managerRequest(t, server, token, PATCH, location, http.Header{"If-Match": {"*"}, "Content-Type": {"text/plain"}}, map[string]interface{}{"price": 1})
+	if recorder.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("patch as text/plain: got status %d", recorder.Code)
+	}
+
+	missing := products + "/" + jsonID(product.ID+100)
+	for _, method := range []string{GET, PUT, PATCH, DELETE} {
+		recorder = managerRequest(t, server, token, method, missing, ifMatch("*", method == PATCH), &managers.Product{Name: "Нет", Price: 1})
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("%s unknown product: got status %d", method, recorder.Code)
+		}
+	}
+
+	recorder = managerRequest(t, server, token, DELETE, location, ifMatch("*", false), nil)
+	if recorder.Code != http.StatusNoContent {
+		t.Errorf("delete: got status %d", recorder.Code)
+	}
+}
+
+func TestManagers_CustomerResource(t *testing.T) {
+	server := newTestServer()
+	token := testManagerToken(t, server)
+	const customers = "/api/v1/managers/customers"
+
+	recorder := managerRequest(t, server, token, POST, customers, nil, map[string]string{"name": "Покупатель", "phone": "+992000000010", "password": "secret"})
+	customer := &managers.Customer{}
+	decodeRecorder(t, recorder, http.StatusCreated, customer)
+	location := recorder.Header().Get("Location")
+	if customer.ID == 0 || !customer.Active || location != customers+"/"+jsonID(customer.ID) {
+		t.Fatalf("create: got customer %+v, location %q", customer, location)
+	}
+	etag := recorder.Header().Get("ETag")
+
+	recorder = managerRequest(t, server, token, POST, customers, nil, map[string]string{"name": "Повтор", "phone": "+992000000010", "password": "secret"})
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("create same phone: got status %d", recorder.Code)
+	}
+	recorder = managerRequest(t, server, token, POST, customers, nil, map[string]string{"name": "Без пароля", "phone": "+992000000011"})
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("create without password: got status %d", recorder.Code)
+	}
+
+	recorder = managerRequest(t, server, token, PATCH, location, ifMatch(etag, true), map[string]interface{}{"active": false})
+	patched := &managers.Customer{}
+	decodeRecorder(t, recorder, http.StatusOK, patched)
+	if patched.Name != "Покупатель" || patched.Phone != "+992000000010" || patched.Active {
+		t.Errorf("patch: got %+v", patched)
+	}
+	recorder = managerRequest(t, server, token, PUT, location, ifMatch(etag, false), map[string]string{"name": "Чужое имя", "phone": "+992000000010"})
+	if recorder.Code != http.StatusPreconditionFailed {
+		t.Errorf("put with stale If-Match: got status %d", recorder.Code)
+	}
+	update := map[string]interface{}{"id": customer.ID, "name": "Чужое имя", "phone": "+992000000010"}
+	recorder = managerRequest(t, server, token, POST, customers, nil, update)
+	if recorder.Code != http.StatusPreconditionRequired {
+		t.Errorf("update by post without If-Match: got status %d", recorder.Code)
+	}
+	recorder = managerRequest(t, server, token, POST, customers, ifMatch(etag, false), update)
+	if recorder.Code != http.StatusPreconditionFailed {
+		t.Errorf("update by post with stale If-Match: got status %d", recorder.Code)
+	}
+
+	replaced := &managers.Customer{}
+	decodeRecorder(t, managerRequest(t, server, token, PUT, location, ifMatch(versionETag(patched.Version), false), map[string]string{"name": "Другое имя", "phone": "+992000000012"}), http.StatusOK, replaced)
+	if replaced.ID != customer.ID || replaced.Name != "Другое имя" || replaced.Phone != "+992000000012" || !replaced.Active {
+		t.Errorf("put: got %+v", replaced)
+	}
+
+	found := &managers.Customer{}
+	recorder = managerRequest(t, server, token, GET, location, nil, nil)
+	decodeRecorder(t, recorder, http.StatusOK, found)
+	if *found != *replaced || recorder.Header().Get("ETag") != versionETag(replaced.Version) {
+		t.Errorf("get: got %+v, ETag %q, want %+v", found, recorder.Header().Get("ETag"), replaced)
+	}
+
+	recorder = managerRequest(t, server, token, DELETE, location, ifMatch(etag, false), nil)
+	if recorder.Code != http.StatusPreconditionFailed {
+		t.Errorf("delete with stale If-Match: got status %d", recorder.Code)
+	}
+	recorder = managerRequest(t, server, token, DELETE, location, ifMatch(versionETag(replaced.Version), false), nil)
+	if recorder.Code != http.StatusNoContent {
+		t.Errorf("delete: got status %d", recorder.Code)
+	}
+	for _, method := range []string{GET, PUT, PATCH, DELETE} {
+		recorder = managerRequest(t, server, token, method, location, ifMatch("*", method == PATCH), map[string]string{"name": "Нет", "phone": "+992000000013"})
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("%s removed customer: got status %d", method, recorder.Code)
+		}
+	}
+}
+
+func TestManagers_CatalogueNotModified(t *testing.T) {
+	server := newTestServer()
+	token := testManagerToken(t, server)
+	const products = "/api/v1/managers/products"
+
+	recorder := managerRequest(t, server, token, POST, products, nil, &managers.Product{Name: "Хлеб", Price: 5, Qty: 10})
+	product := &managers.Product{}
+	decodeRecorder(t, recorder, http.StatusCreated, product)
+
+	for _, path := range []string{products, "/api/v1/customers/products"} {
+		recorder = managerRequest(t, server, token, GET, path, nil, nil)
+		etag := recorder.Header().Get("ETag")
+		if recorder.Code != http.StatusOK || etag == "" {
+			t.Fatalf("GET %s: got status %d, ETag %q", path, recorder.Code, etag)
+		}
+		recorder = managerRequest(t, server, token, GET, path, http.Header{"If-None-Match": {`"other", W/` + etag}}, nil)
+		if recorder.Code != http.StatusNotModified {
+			t.Errorf("GET %s with If-None-Match: got status %d", path, recorder.Code)
+		}
+
+		_, err := server.managersSvc.UpdateProduct(context.Background(), 1, &managers.Product{ID: product.ID, Name: "Хлеб", Price: product.Price + 1, Qty: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		product.Price++
+		recorder = managerRequest(t, server, token, GET, path, http.Header{"If-None-Match": {etag}}, nil)
+		if recorder.Code != http.StatusOK || recorder.Header().Get("ETag") == etag {
+			t.Errorf("GET %s after change: got status %d, ETag %q", path, recorder.Code, recorder.Header().Get("ETag"))
+		}
+	}
+}
+
+func jsonID(id int64) string {
+	data, _ := json.Marshal(id)
+	return string(data)
+}
+
+func TestManagers_BadRequests(t *testing.T) {
+	server := newTestServer()
+	token := testManagerToken(t, server)
+
+	recorder := managerRequest(t, server, "", POST, "/api/v1/managers/token", nil, &managers.Auth{Phone: "+992000000001", Password: "wrong"})
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: got status %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+	recorder = managerRequest(t, server, "", POST, "/api/v1/managers/token", nil, &managers.Auth{Phone: "+992000000009", Password: "secret"})
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("unknown phone: got status %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+
+	request := httptest.NewRequest(POST, "/api/v1/managers/sales", strings.NewReader(`{"positions": [`))
+	request.Header.Set("Authorization", token)
+	request.Header.Set("Content-Type", "application/json")
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("malformed sale: got status %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+}
+
+func TestManagers_SaleManagerFromToken(t *testing.T) {
+	server := newTestServer()
+	token := testManagerToken(t, server)
+
+	product := &managers.Product{}
+	decodeRecorder(t, managerRequest(t, server, token, POST, "/api/v1/managers/products", nil, &managers.Product{Name: "Хлеб", Price: 5, Qty: 10}), http.StatusCreated, product)
+	sale := &managers.Sale{}
+	recorder := managerRequest(t, server, token, POST, "/api/v1/managers/sales", nil,
+		&managers.Sale{ManagerID: 999, Positions: []*managers.SalePosition{{ProductID: product.ID, Qty: 2, Price: 5}}})
+	decodeRecorder(t, recorder, http.StatusOK, sale)
+
+	sales := &managers.Sales{}
+	decodeRecorder(t, managerRequest(t, server, token, GET, "/api/v1/managers/sales", nil, nil), http.StatusOK, sales)
+	if sale.ManagerID != sales.ManagerID || sales.Total != 10 {
+		t.Errorf("got sale by manager %d, sales %+v, want the token's manager", sale.ManagerID, sales)
+	}
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+)
+
+// mergePatchType - тип тела PATCH-запросов (RFC 7396); application/json тоже принимается.
+const mergePatchType = "application/merge-patch+json"
+
+var errInvalidBody = errors.New("invalid request body")
+var errUnsupportedPatch = errors.New("unsupported patch media type")
+
+// readMergePatch читает тело PATCH-запроса: JSON-объект с типом application/merge-patch+json или application/json.
+func readMergePatch(request *http.Request) ([]byte, error) {
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if err != nil || (mediaType != mergePatchType && mediaType != "application/json") {
+		return nil, errUnsupportedPatch
+	}
+	patch, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		return nil, errInvalidBody
+	}
+	return patch, nil
+}
+
+// mergePatch применяет patch к JSON-представлению current и записывает результат в result.
+// Поля со значением null удаляются, вложенные объекты объединяются, остальные значения заменяются.
+func mergePatch(current interface{}, patch []byte, result interface{}) error {
+	var changes map[string]interface{}
+	err := decodeJSON(patch, &changes)
+	if err != nil || changes == nil {
+		return errInvalidBody
+	}
+
+	data, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	var document map[string]interface{}
+	err = decodeJSON(data, &document)
+	if err != nil {
+		return err
+	}
+
+	data, err = json.Marshal(mergeValues(document, changes))
+	if err != nil {
+		return err
+	}
+	err = decodeJSON(data, result)
+	if err != nil {
+		return errInvalidBody
+	}
+	return nil
+}
+
+// mergeValues реализует алгоритм MergePatch из RFC 7396.
+func mergeValues(target interface{}, patch interface{}) interface{} {
+	changes, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	document, ok := target.(map[string]interface{})
+	if !ok {
+		document = make(map[string]interface{})
+	}
+	for key, value := range changes {
+		if value == nil {
+			delete(document, key)
+			continue
+		}
+		document[key] = mergeValues(document[key], value)
+	}
+	return document
+}
+
+// decodeJSON разбирает data, сохраняя числа как json.Number, чтобы не терять точность больших ID.
+func decodeJSON(data []byte, out interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(out)
+}
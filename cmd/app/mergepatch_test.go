@@ -0,0 +1,57 @@
+package app
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	// Примеры из приложения A RFC 7396, применимые к объектам.
+	tests := []struct {
+		current string
+		patch   string
+		want    string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{`{"id":9007199254740993}`, `{"name":"x"}`, `{"id":9007199254740993,"name":"x"}`},
+	}
+	for _, tt := range tests {
+		var current, result, want interface{}
+		err := decodeJSON([]byte(tt.current), &current)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = mergePatch(current, []byte(tt.patch), &result)
+		if err != nil {
+			t.Errorf("merge %s into %s: %v", tt.patch, tt.current, err)
+			continue
+		}
+		err = decodeJSON([]byte(tt.want), &want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := json.Marshal(result)
+		var got interface{}
+		_ = decodeJSON(data, &got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("merge %s into %s: got %s, want %s", tt.patch, tt.current, data, tt.want)
+		}
+	}
+
+	for _, patch := range []string{`[]`, `"a"`, `null`, `{`} {
+		var result interface{}
+		err := mergePatch(map[string]interface{}{}, []byte(patch), &result)
+		if err != errInvalidBody {
+			t.Errorf("patch %s: got %v, want %v", patch, err, errInvalidBody)
+		}
+	}
+}
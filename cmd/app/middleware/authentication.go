@@ -3,8 +3,10 @@ package middleware
 import (
 	"context"
 	"errors"
-	"log"
 	"net/http"
+
+	"github.com/shohinsherov/crud/pkg/logging"
+	"go.uber.org/zap"
 )
 
 const (
@@ -27,14 +29,14 @@ func (c *contextKey) String() string {
 
 type IDFunc func(ctx context.Context, token string) (int64, error)
 
-func Authenticate(idFunc IDFunc) func(http.Handler) http.Handler {
+func Authenticate(idFunc IDFunc, logger *zap.Logger) func(http.Handler) http.Handler {
 	return func(handler http.Handler) http.Handler {
 		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 			token := request.Header.Get("Authorization")
 
 			id, err := idFunc(request.Context(), token)
 			if err != nil {
-				log.Print(err, "Authhhththth")
+				logging.For(request.Context(), logger).Error("authentication failed", zap.Error(err))
 				http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 				return
 			}
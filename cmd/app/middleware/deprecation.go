@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Deprecation описывает маршруты, которые будут удалены.
+type Deprecation struct {
+	// Since - когда маршруты объявлены устаревшими.
+	Since time.Time
+	// Sunset - после этого момента маршруты могут перестать отвечать.
+	Sunset time.Time
+	// Successor возвращает адрес замены для запроса; nil или пустая строка - замены нет.
+	Successor func(request *http.Request) string
+}
+
+// Deprecated добавляет к ответам заголовки Deprecation (RFC 9745), Sunset (RFC 8594)
+// и ссылку на замену с rel="successor-version".
+func Deprecated(deprecation Deprecation) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			successor := ""
+			if deprecation.Successor != nil {
+				successor = deprecation.Successor(request)
+			}
+			deprecation.Apply(writer.Header(), successor)
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// Apply добавляет заголовки устаревания в header; обработчики вызывают его сами,
+// когда устарел не весь маршрут, а отдельный вариант запроса. Пустой successor - замены нет.
+func (d Deprecation) Apply(header http.Header, successor string) {
+	header.Set("Deprecation", "@"+strconv.FormatInt(d.Since.Unix(), 10))
+	header.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+	if successor != "" {
+		header.Set("Link", "<"+successor+`>; rel="successor-version"`)
+	}
+}
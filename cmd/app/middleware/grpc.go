@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/shohinsherov/crud/pkg/logging"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryRequestID - аналог RequestID для gRPC: идентификатор берётся из метаданных x-request-id
+// или создаётся новый и возвращается клиенту в заголовках ответа.
+func UnaryRequestID(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	id := incoming(ctx, strings.ToLower(RequestIDHeader))
+	if !validRequestID.MatchString(id) {
+		id = newRequestID()
+	}
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id))
+	return handler(logging.WithRequestID(ctx, id), req)
+}
+
+// UnaryAccessLog - аналог AccessLog для gRPC: пишет в лог метод, код ответа и время обработки.
+func UnaryAccessLog(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logging.For(ctx, logger).Info("rpc",
+			zap.String("method", info.FullMethod),
+			zap.String("code", status.Code(err).String()),
+			zap.Duration("latency", time.Since(start)),
+		)
+		return resp, err
+	}
+}
+
+// UnaryAuthenticate - аналог Authenticate для gRPC: токен берётся из метаданных authorization,
+// ID владельца кладётся в контекст, откуда его возвращает Authentication.
+// idFuncs задаёт проверку токена для сервисов по полному имени, например crud.v1.SalesService;
+// вызовы остальных сервисов проходят без проверки.
+func UnaryAuthenticate(idFuncs map[string]IDFunc, logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		service := strings.TrimPrefix(info.FullMethod, "/")
+		if i := strings.LastIndex(service, "/"); i >= 0 {
+			service = service[:i]
+		}
+		idFunc, ok := idFuncs[service]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		id, err := idFunc(ctx, incoming(ctx, "authorization"))
+		if err != nil {
+			logging.For(ctx, logger).Error("authentication failed", zap.Error(err))
+			return nil, status.Error(codes.Internal, codes.Internal.String())
+		}
+		return handler(context.WithValue(ctx, authenticationContextKey, id), req)
+	}
+}
+
+// incoming возвращает первое значение метаданных запроса name или пустую строку.
+func incoming(ctx context.Context, name string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(name)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
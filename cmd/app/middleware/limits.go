@@ -0,0 +1,17 @@
+package middleware
+
+import "net/http"
+
+// MaxBytes ограничивает размер тела запроса; при превышении чтение тела завершается ошибкой.
+func MaxBytes(limit int64) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if request.ContentLength > limit {
+				http.Error(writer, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			request.Body = http.MaxBytesReader(writer, request.Body, limit)
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
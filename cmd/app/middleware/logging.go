@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/shohinsherov/crud/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader - заголовок, в котором передаётся идентификатор запроса.
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID ограничивает входящие идентификаторы, чтобы клиент не мог подделать записи в логе.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID берёт идентификатор запроса из заголовка X-Request-ID или создаёт новый,
+// кладёт его в контекст и возвращает клиенту в ответе.
+func RequestID(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		id := request.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		writer.Header().Set(RequestIDHeader, id)
+		handler.ServeHTTP(writer, request.WithContext(logging.WithRequestID(request.Context(), id)))
+	})
+}
+
+func newRequestID() string {
+	buffer := make([]byte, 16)
+	_, err := rand.Read(buffer)
+	if err != nil {
+		return time.Now().UTC().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(buffer)
+}
+
+// AccessLog пишет в лог каждый запрос: метод, путь, статус, размер ответа и время обработки.
+// Должен стоять после RequestID, чтобы запись содержала идентификатор запроса.
+func AccessLog(logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			start := time.Now()
+			recorder := NewStatusRecorder(writer)
+			handler.ServeHTTP(recorder, request)
+
+			logging.For(request.Context(), logger).Info("request",
+				zap.String("method", request.Method),
+				zap.String("path", request.URL.Path),
+				zap.Int("status", recorder.Status()),
+				zap.Int("bytes", recorder.Bytes()),
+				zap.Duration("latency", time.Since(start)),
+				zap.String("remote", request.RemoteAddr),
+			)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// StatusRecorder запоминает код ответа и количество записанных байт.
+// Общий для журнала доступа, метрик и трассировки.
+type StatusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+// NewStatusRecorder оборачивает writer; пока обработчик не ответил явно, код считается 200.
+func NewStatusRecorder(writer http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: writer, status: http.StatusOK}
+}
+
+// Status возвращает код ответа.
+func (r *StatusRecorder) Status() int {
+	return r.status
+}
+
+// Bytes возвращает количество записанных байт тела ответа.
+func (r *StatusRecorder) Bytes() int {
+	return r.bytes
+}
+
+func (r *StatusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *StatusRecorder) Write(data []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += n
+	return n, err
+}
+
+// Flush пробрасывает Flush, если его поддерживает исходный writer.
+func (r *StatusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack пробрасывает Hijack для WebSocket; захваченное соединение учитывается с кодом 101.
+func (r *StatusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	conn, buffer, err := hijacker.Hijack()
+	if err == nil && !r.wroteHeader {
+		r.status = http.StatusSwitchingProtocols
+		r.wroteHeader = true
+	}
+	return conn, buffer, err
+}
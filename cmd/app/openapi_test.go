@@ -0,0 +1,256 @@
+package app
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/graphql-go/graphql"
+	"github.com/shohinsherov/crud/pkg/config"
+	"github.com/shohinsherov/crud/pkg/customers"
+	"github.com/shohinsherov/crud/pkg/events"
+	"github.com/shohinsherov/crud/pkg/health"
+	"github.com/shohinsherov/crud/pkg/hub"
+	"github.com/shohinsherov/crud/pkg/idempotency"
+	"github.com/shohinsherov/crud/pkg/managers"
+	"github.com/shohinsherov/crud/pkg/memstore"
+	"github.com/shohinsherov/crud/pkg/metrics"
+	"github.com/shohinsherov/crud/pkg/suppliers"
+	"github.com/shohinsherov/crud/pkg/webhooks"
+	"go.uber.org/zap"
+)
+
+// undocumented - маршруты Swagger UI, которые сами не входят в спецификацию.
+var undocumented = map[string]bool{
+	"GET /api/docs":                        true,
+	"GET /api/docs/":                       true,
+	"GET /api/docs/swagger-initializer.js": true,
+}
+
+type openAPIDocument struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+// newTestServer собирает сервер без базы: покупатели и менеджеры хранятся в памяти,
+// обработчики поставщиков в тестах не вызываются.
+func newTestServer() *Server {
+	store := memstore.New()
+	auth := config.Default().Auth
+	customersSvc := customers.NewService(customers.NewMemoryRepo(store), &auth, zap.NewNop())
+	managersSvc := managers.NewService(managers.NewMemoryRepo(store), &auth, zap.NewNop())
+	cfg := config.Default()
+	cfg.Idempotency.Lease = config.Duration(cfg.IdempotencyLease())
+	idempotencySvc := idempotency.NewService(idempotency.NewMemoryRepo(store), &cfg.Idempotency, zap.NewNop())
+	webhooksSvc := webhooks.NewService(webhooks.NewMemoryRepo(store), &config.Default().Webhooks, zap.NewNop())
+	events := hub.New(config.Default().Events.History)
+	managersSvc.SetPublisher(events)
+	server := NewServer(mux.NewRouter(), zap.NewNop(), metrics.New(), health.NewChecker(), nil, customersSvc, managersSvc, &suppliers.Service{}, idempotencySvc, webhooksSvc, &config.Default().GraphQL, events, &config.Default().Events)
+	server.Init()
+	return server
+}
+
+func loadSpec(t *testing.T) *openAPIDocument {
+	t.Helper()
+	spec := &openAPIDocument{}
+	err := json.Unmarshal(openAPISpec, spec)
+	if err != nil {
+		t.Fatalf("parse openapi.json: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Fatalf("openapi.json: got version %q, want 3.x", spec.OpenAPI)
+	}
+	return spec
+}
+
+func TestOpenAPI_Routes(t *testing.T) {
+	spec := loadSpec(t)
+	documented := make(map[string]bool)
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	routes := make(map[string]bool)
+	err := newTestServer().mux.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Префиксы подмаршрутизаторов без методов.
+			return nil
+		}
+		for _, method := range methods {
+			routes[method+" "+path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, route := range sortedKeys(routes) {
+		if !documented[v1Route(route)] && !undocumented[route] {
+			t.Errorf("route %s is not described in openapi.json", route)
+		}
+	}
+	for _, route := range sortedKeys(documented) {
+		if !routes[route] {
+			t.Errorf("openapi.json describes %s, but there is no such route", route)
+		}
+	}
+}
+
+func TestOpenAPI_Schemas(t *testing.T) {
+	spec := loadSpec(t)
+	types := map[string]interface{}{
+		"Token":                   Token{},
+		"HealthResult":            health.Result{},
+		"BuildInfo":               BuildInfo{},
+		"CustomerRegistration":    customers.Registration{},
+		"CustomerAuth":            customers.Auth{},
+		"Customer":                customers.Customer{},
+		"CustomerProduct":         customers.Product{},
+		"CustomerVariant":         customers.Variant{},
+		"CustomerCategory":        customers.Category{},
+		"SearchResult":            customers.SearchResult{},
+		"ManagerAuth":             managers.Auth{},
+		"ManagerRegistration":     managers.Registration{},
+		"ManagerCustomer":         managers.Customer{},
+		"ManagerCustomerCreation": customerCreation{},
+		"Product":                 managers.Product{},
+		"Variant":                 managers.Variant{},
+		"Barcode":                 managers.Barcode{},
+		"ScanResult":              managers.ScanResult{},
+		"Category":                managers.Category{},
+		"PriceChange":             managers.PriceChange{},
+		"ScheduledPrice":          managers.ScheduledPrice{},
+		"Sale":                    managers.Sale{},
+		"SalePosition":            managers.SalePosition{},
+		"Sales":                   managers.Sales{},
+		"StockChange":             managers.StockChange{},
+		"Event":                   hub.Event{},
+		"Supplier":                suppliers.Supplier{},
+		"PurchaseOrder":           suppliers.PurchaseOrder{},
+		"PurchaseOrderLine":       suppliers.PurchaseOrderLine{},
+		"Receipt":                 suppliers.Receipt{},
+		"Webhook":                 webhooks.Webhook{},
+		"WebhookDelivery":         webhooks.Delivery{},
+		"WebhookPayload":          webhooks.Payload{},
+		"CustomerRegisteredEvent": events.CustomerRegistered{},
+		"SaleCreatedEvent":        events.SaleCreated{},
+		"SalePositionEvent":       events.SalePosition{},
+		"CustomerStatusEvent":     events.CustomerBlocked{},
+		"ProductChangedEvent":     events.ProductChanged{},
+		"GraphQLRequest":          graphQLRequest{},
+		"GraphQLResponse":         graphql.Result{},
+	}
+
+	for name, value := range types {
+		schema, ok := spec.Components.Schemas[name]
+		if !ok {
+			t.Errorf("schema %s is missing", name)
+			continue
+		}
+		fields := jsonFields(reflect.TypeOf(value))
+		for _, field := range sortedKeys(fields) {
+			if _, ok := schema.Properties[field]; !ok {
+				t.Errorf("schema %s: field %s is not described", name, field)
+			}
+		}
+		for field := range schema.Properties {
+			if !fields[field] {
+				t.Errorf("schema %s: property %s does not exist in %T", name, field, value)
+			}
+		}
+	}
+}
+
+func TestOpenAPI_Handlers(t *testing.T) {
+	server := httptest.NewServer(newTestServer())
+	defer server.Close()
+
+	for path, contentType := range map[string]string{
+		"/api/openapi.json":                "application/json",
+		"/api/docs/":                       "text/html",
+		"/api/docs/swagger-initializer.js": "application/javascript",
+		"/api/docs/swagger-ui-bundle.js":   "",
+	} {
+		response, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.StatusCode != http.StatusOK || len(data) == 0 {
+			t.Errorf("GET %s: got status %d, %d bytes", path, response.StatusCode, len(data))
+		}
+		if got := response.Header.Get("Content-Type"); !strings.HasPrefix(got, contentType) {
+			t.Errorf("GET %s: got content type %q, want %s", path, got, contentType)
+		}
+	}
+}
+
+// v1Route возвращает для маршрута без версии соответствующий маршрут v1: в спецификации описан только он.
+func v1Route(route string) string {
+	parts := strings.SplitN(route, " ", 2)
+	for _, prefix := range []string{legacyPrefix + "/customers", legacyPrefix + "/managers"} {
+		if strings.HasPrefix(parts[1], prefix) {
+			return parts[0] + " " + v1Prefix + strings.TrimPrefix(parts[1], legacyPrefix)
+		}
+	}
+	return route
+}
+
+// jsonFields возвращает имена полей JSON типа, включая поля встроенных структур.
+func jsonFields(typ reflect.Type) map[string]bool {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	fields := make(map[string]bool)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		if field.Anonymous && tag == "" {
+			for name := range jsonFields(field.Type) {
+				fields[name] = true
+			}
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = true
+	}
+	return fields
+}
+
+func sortedKeys(items map[string]bool) []string {
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,148 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/shohinsherov/crud/cmd/app/middleware"
+	"github.com/shohinsherov/crud/pkg/managers"
+	"go.uber.org/zap"
+)
+
+func (s *Server) handleManagerGetPriceHistory(writer http.ResponseWriter, request *http.Request) {
+	id, err := middleware.Authentication(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("get price history: authentication failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	productID, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		s.log(request.Context()).Warn("get price history: invalid id", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	items, err := s.managersSvc.PriceHistory(request.Context(), productID)
+	if err != nil {
+		s.log(request.Context()).Error("get price history failed", zap.Error(err))
+		writeManagerError(writer, err)
+		return
+	}
+
+	s.writeJSON(writer, request, items)
+}
+
+func (s *Server) handleManagerGetScheduledPrices(writer http.ResponseWriter, request *http.Request) {
+	id, err := middleware.Authentication(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("get scheduled prices: authentication failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	productID, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		s.log(request.Context()).Warn("get scheduled prices: invalid id", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	items, err := s.managersSvc.ScheduledPrices(request.Context(), productID)
+	if err != nil {
+		s.log(request.Context()).Error("get scheduled prices failed", zap.Error(err))
+		writeManagerError(writer, err)
+		return
+	}
+
+	s.writeJSON(writer, request, items)
+}
+
+func (s *Server) handleManagerSchedulePrice(writer http.ResponseWriter, request *http.Request) {
+	id, err := middleware.Authentication(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("schedule price: authentication failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	productID, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		s.log(request.Context()).Warn("schedule price: invalid id", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	item := &managers.ScheduledPrice{}
+	err = json.NewDecoder(request.Body).Decode(&item)
+	if err != nil {
+		s.log(request.Context()).Warn("can't decode scheduled price", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	item.ProductID = productID
+	item.ManagerID = id
+
+	item, err = s.managersSvc.SchedulePrice(request.Context(), item)
+	if err != nil {
+		s.log(request.Context()).Error("schedule price failed", zap.Error(err))
+		writeManagerError(writer, err)
+		return
+	}
+
+	s.writeJSON(writer, request, item)
+}
+
+func (s *Server) handleManagerCancelScheduledPrice(writer http.ResponseWriter, request *http.Request) {
+	id, err := middleware.Authentication(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("cancel scheduled price: authentication failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	productID, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		s.log(request.Context()).Warn("cancel scheduled price: invalid id", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	scheduleID, err := strconv.ParseInt(mux.Vars(request)["scheduleID"], 10, 64)
+	if err != nil {
+		s.log(request.Context()).Warn("cancel scheduled price: invalid id", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	item, err := s.managersSvc.CancelScheduledPrice(request.Context(), productID, scheduleID)
+	if err != nil {
+		s.log(request.Context()).Error("cancel scheduled price failed", zap.Error(err))
+		writeManagerError(writer, err)
+		return
+	}
+
+	s.writeJSON(writer, request, item)
+}
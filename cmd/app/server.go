@@ -1,13 +1,29 @@
 package app
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"path"
+	"strconv"
 
 	"github.com/gorilla/mux"
-	"github.com/shohinsherov/crud/cmd/app/middleware"
+	"github.com/graphql-go/graphql"
+	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/shohinsherov/crud/pkg/config"
 	"github.com/shohinsherov/crud/pkg/customers"
+	"github.com/shohinsherov/crud/pkg/health"
+	"github.com/shohinsherov/crud/pkg/hub"
+	"github.com/shohinsherov/crud/pkg/idempotency"
+	"github.com/shohinsherov/crud/pkg/logging"
 	"github.com/shohinsherov/crud/pkg/managers"
-	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/shohinsherov/crud/pkg/metrics"
+	"github.com/shohinsherov/crud/pkg/migrations"
+	"github.com/shohinsherov/crud/pkg/suppliers"
+	"github.com/shohinsherov/crud/pkg/tracing"
+	"github.com/shohinsherov/crud/pkg/webhooks"
+	"go.uber.org/zap"
 )
 
 const (
@@ -15,15 +31,30 @@ const (
 	GET = "GET"
 	// POST ...
 	POST = "POST"
+	// PUT ...
+	PUT = "PUT"
+	// PATCH ...
+	PATCH = "PATCH"
 	// DELETE ...
 	DELETE = "DELETE"
 )
 
 // Server предостовляет собой логический сервер нашего приложения
 type Server struct {
-	mux          *mux.Router
-	customersSvc *customers.Service
-	managersSvc  *managers.Service
+	mux            *mux.Router
+	logger         *zap.Logger
+	metrics        *metrics.Metrics
+	health         *health.Checker
+	migrator       *migrations.Migrator
+	customersSvc   *customers.Service
+	managersSvc    *managers.Service
+	suppliersSvc   *suppliers.Service
+	idempotencySvc *idempotency.Service
+	webhooksSvc    *webhooks.Service
+	graphQL        *config.GraphQL
+	graphQLSchema  graphql.Schema
+	events         *hub.Hub
+	eventsConfig   *config.Events
 }
 
 // Token ...
@@ -32,8 +63,41 @@ type Token struct {
 }
 
 // NewServer - функция-конструктор для создания сервера.
-func NewServer(mux *mux.Router, customersSvc *customers.Service, managersSvc *managers.Service) *Server {
-	return &Server{mux: mux, customersSvc: customersSvc, managersSvc: managersSvc}
+func NewServer(
+	mux *mux.Router,
+	logger *zap.Logger,
+	metrics *metrics.Metrics,
+	health *health.Checker,
+	migrator *migrations.Migrator,
+	customersSvc *customers.Service,
+	managersSvc *managers.Service,
+	suppliersSvc *suppliers.Service,
+	idempotencySvc *idempotency.Service,
+	webhooksSvc *webhooks.Service,
+	graphQL *config.GraphQL,
+	events *hub.Hub,
+	eventsConfig *config.Events,
+) *Server {
+	return &Server{
+		mux:            mux,
+		logger:         logger,
+		metrics:        metrics,
+		health:         health,
+		migrator:       migrator,
+		customersSvc:   customersSvc,
+		managersSvc:    managersSvc,
+		suppliersSvc:   suppliersSvc,
+		idempotencySvc: idempotencySvc,
+		webhooksSvc:    webhooksSvc,
+		graphQL:        graphQL,
+		events:         events,
+		eventsConfig:   eventsConfig,
+	}
+}
+
+// log возвращает логгер с идентификатором запроса из ctx.
+func (s *Server) log(ctx context.Context) *zap.Logger {
+	return logging.For(ctx, s.logger)
 }
 
 func (s *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
@@ -42,26 +106,112 @@ func (s *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 
 // Init инициализирует сервер (регистрирует все Handler-ы)
 func (s *Server) Init() {
-	customersAuthenticateMd := middleware.Authenticate(s.customersSvc.IDByToken)
-	customersSubrouter := s.mux.PathPrefix("/api/customers").Subrouter()
-	customersSubrouter.Use(customersAuthenticateMd)
-
-	customersSubrouter.HandleFunc("", s.handleCustomerRegistration).Methods(POST)
-	customersSubrouter.HandleFunc("/token", s.handleCustomerGetToken).Methods(POST)
-	customersSubrouter.HandleFunc("/products", s.handleCustomerGetProducts).Methods(GET)
-
-	managersAuthenticateMd := middleware.Authenticate(s.managersSvc.IDByToken)
-	managersSubRouter := s.mux.PathPrefix("/api/managers").Subrouter()
-	managersSubRouter.Use(managersAuthenticateMd)
-	managersSubRouter.HandleFunc("", s.handleManagerRegistration).Methods(POST)
-	managersSubRouter.HandleFunc("/token", s.handleManagerGetToken).Methods(POST)
-	managersSubRouter.HandleFunc("/sales", s.handleManagerGetSales).Methods(GET)
-	managersSubRouter.HandleFunc("/sales", s.handleManagerMakeSales).Methods(POST)
-	managersSubRouter.HandleFunc("/products", s.handleManagerGetProducts).Methods(GET)
-	managersSubRouter.HandleFunc("/products", s.handleManagerChangeProducts).Methods(POST)
-	managersSubRouter.HandleFunc("/products/{id}", s.handleManagerRemoveProductByID).Methods(DELETE)
-	managersSubRouter.HandleFunc("/customers", s.handleManagerGetCustomers).Methods(GET)
-	managersSubRouter.HandleFunc("/customers", s.handleManagerChangeCustomer).Methods(POST)
-	managersSubRouter.HandleFunc("/customers/{id}", s.handleManagerRemoveCustomerByID).Methods(DELETE)
+	s.mux.Use(tracing.Middleware)
+	s.mux.Handle("/metrics", s.metrics.Handler()).Methods(GET)
+	s.mux.HandleFunc("/healthz", s.handleHealthz).Methods(GET)
+	s.mux.HandleFunc("/readyz", s.handleReadyz).Methods(GET)
+	s.mux.HandleFunc("/version", s.handleVersion).Methods(GET)
+	s.initDocs()
+	s.initGraphQL()
+
+	for _, version := range s.apiVersions() {
+		s.mount(version)
+	}
+}
+
+// routesV1 регистрирует маршруты v1 в маршрутизаторах покупателей и менеджеров.
+func (s *Server) routesV1(customersRouter *mux.Router, managersRouter *mux.Router) {
+	customersRouter.HandleFunc("", s.handleCustomerRegistration).Methods(POST)
+	customersRouter.HandleFunc("/token", s.handleCustomerGetToken).Methods(POST)
+	customersRouter.HandleFunc("/products", s.handleCustomerGetProducts).Methods(GET)
+	customersRouter.HandleFunc("/products/search", s.handleCustomerSearchProducts).Methods(GET)
+	customersRouter.HandleFunc("/categories", s.handleCustomerGetCategories).Methods(GET)
+
+	managersRouter.HandleFunc("", s.handleManagerRegistration).Methods(POST)
+	managersRouter.HandleFunc("/token", s.handleManagerGetToken).Methods(POST)
+	managersRouter.HandleFunc("/events", s.handleManagerEvents).Methods(GET)
+	managersRouter.HandleFunc("/sales", s.handleManagerGetSales).Methods(GET)
+	managersRouter.HandleFunc("/sales", s.idempotent("manager", s.handleManagerMakeSales)).Methods(POST)
+	managersRouter.HandleFunc("/products", s.handleManagerGetProducts).Methods(GET)
+	managersRouter.HandleFunc("/products/lookup", s.handleManagerLookupProduct).Methods(GET)
+	managersRouter.HandleFunc("/products", s.handleManagerCreateProduct).Methods(POST)
+	managersRouter.HandleFunc("/products/{id}", s.handleManagerGetProductByID).Methods(GET)
+	managersRouter.HandleFunc("/products/{id}", s.handleManagerReplaceProduct).Methods(PUT)
+	managersRouter.HandleFunc("/products/{id}", s.handleManagerPatchProduct).Methods(PATCH)
+	managersRouter.HandleFunc("/products/{id}", s.handleManagerRemoveProductByID).Methods(DELETE)
+	managersRouter.HandleFunc("/products/{id}/variants", s.handleManagerChangeVariant).Methods(POST)
+	managersRouter.HandleFunc("/products/{id}/barcodes", s.handleManagerAddBarcode).Methods(POST)
+	managersRouter.HandleFunc("/products/{id}/barcodes/{barcode}", s.handleManagerRemoveBarcode).Methods(DELETE)
+	managersRouter.HandleFunc("/products/{id}/prices", s.handleManagerGetPriceHistory).Methods(GET)
+	managersRouter.HandleFunc("/products/{id}/prices/scheduled", s.handleManagerGetScheduledPrices).Methods(GET)
+	managersRouter.HandleFunc("/products/{id}/prices/scheduled", s.handleManagerSchedulePrice).Methods(POST)
+	managersRouter.HandleFunc("/products/{id}/prices/scheduled/{scheduleID}", s.handleManagerCancelScheduledPrice).Methods(DELETE)
+	managersRouter.HandleFunc("/categories", s.handleManagerGetCategories).Methods(GET)
+	managersRouter.HandleFunc("/categories", s.handleManagerChangeCategory).Methods(POST)
+	managersRouter.HandleFunc("/customers", s.handleManagerGetCustomers).Methods(GET)
+	managersRouter.HandleFunc("/customers", s.handleManagerCreateCustomer).Methods(POST)
+	managersRouter.HandleFunc("/customers/{id}", s.handleManagerGetCustomerByID).Methods(GET)
+	managersRouter.HandleFunc("/customers/{id}", s.handleManagerReplaceCustomer).Methods(PUT)
+	managersRouter.HandleFunc("/customers/{id}", s.handleManagerPatchCustomer).Methods(PATCH)
+	managersRouter.HandleFunc("/customers/{id}", s.handleManagerRemoveCustomerByID).Methods(DELETE)
+	managersRouter.HandleFunc("/suppliers", s.handleManagerGetSuppliers).Methods(GET)
+	managersRouter.HandleFunc("/suppliers", s.handleManagerChangeSupplier).Methods(POST)
+	managersRouter.HandleFunc("/suppliers/{id}", s.handleManagerGetSupplierByID).Methods(GET)
+	managersRouter.HandleFunc("/purchase-orders", s.handleManagerGetPurchaseOrders).Methods(GET)
+	managersRouter.HandleFunc("/purchase-orders", s.handleManagerCreatePurchaseOrder).Methods(POST)
+	managersRouter.HandleFunc("/purchase-orders/{id}", s.handleManagerGetPurchaseOrderByID).Methods(GET)
+	managersRouter.HandleFunc("/purchase-orders/{id}/send", s.handleManagerSendPurchaseOrder).Methods(POST)
+	managersRouter.HandleFunc("/purchase-orders/{id}/cancel", s.handleManagerCancelPurchaseOrder).Methods(POST)
+	managersRouter.HandleFunc("/purchase-orders/{id}/receive", s.handleManagerReceivePurchaseOrder).Methods(POST)
+	managersRouter.HandleFunc("/webhooks", s.handleManagerGetWebhooks).Methods(GET)
+	managersRouter.HandleFunc("/webhooks", s.handleManagerCreateWebhook).Methods(POST)
+	managersRouter.HandleFunc("/webhooks/{id}", s.handleManagerGetWebhookByID).Methods(GET)
+	managersRouter.HandleFunc("/webhooks/{id}", s.handleManagerRemoveWebhook).Methods(DELETE)
+	managersRouter.HandleFunc("/webhooks/{id}/deliveries", s.handleManagerGetWebhookDeliveries).Methods(GET)
+}
+
+// recordLogin учитывает попытку входа: invalid - ошибка неверного логина или пароля для данной роли.
+func (s *Server) recordLogin(role string, err error, invalid error) {
+	result := metrics.LoginSuccess
+	switch {
+	case errors.Is(err, invalid):
+		result = metrics.LoginFailure
+	case err != nil:
+		result = metrics.LoginError
+	}
+	s.metrics.Logins.WithLabelValues(role, result).Inc()
+}
+
+// writeJSON сериализует item и отправляет его клиенту.
+func (s *Server) writeJSON(writer http.ResponseWriter, request *http.Request, item interface{}) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		s.log(request.Context()).Error("can't write response", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	_, err = writer.Write(data)
+	if err != nil {
+		s.log(request.Context()).Error("can't write response", zap.Error(err))
+	}
+}
+
+// writeCreated отправляет созданный ресурс с кодом 201 и адресом <путь запроса>/<id> в Location.
+func (s *Server) writeCreated(writer http.ResponseWriter, request *http.Request, id int64, item interface{}) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		s.log(request.Context()).Error("can't write response", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
 
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("Location", path.Join(request.URL.Path, strconv.FormatInt(id, 10)))
+	writer.WriteHeader(http.StatusCreated)
+	_, err = writer.Write(data)
+	if err != nil {
+		s.log(request.Context()).Error("can't write response", zap.Error(err))
+	}
 }
@@ -0,0 +1,254 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/shohinsherov/crud/cmd/app/middleware"
+	"github.com/shohinsherov/crud/pkg/suppliers"
+	"go.uber.org/zap"
+)
+
+func (s *Server) handleManagerGetSuppliers(writer http.ResponseWriter, request *http.Request) {
+	id, err := middleware.Authentication(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("get suppliers: authentication failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	items, err := s.suppliersSvc.Suppliers(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("get suppliers failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(writer, request, items)
+}
+
+func (s *Server) handleManagerGetSupplierByID(writer http.ResponseWriter, request *http.Request) {
+	id, err := middleware.Authentication(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("get supplier: authentication failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	supplierID, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		s.log(request.Context()).Warn("get supplier: invalid id", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	item, err := s.suppliersSvc.SupplierByID(request.Context(), supplierID)
+	if err != nil {
+		s.log(request.Context()).Error("get supplier failed", zap.Error(err))
+		writeSupplierError(writer, err)
+		return
+	}
+
+	s.writeJSON(writer, request, item)
+}
+
+func (s *Server) handleManagerChangeSupplier(writer http.ResponseWriter, request *http.Request) {
+	id, err := middleware.Authentication(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("change supplier: authentication failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	supplier := &suppliers.Supplier{}
+	err = json.NewDecoder(request.Body).Decode(&supplier)
+	if err != nil {
+		s.log(request.Context()).Warn("can't decode supplier", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if supplier.ID == 0 {
+		supplier, err = s.suppliersSvc.CreateSupplier(request.Context(), supplier)
+	} else {
+		supplier, err = s.suppliersSvc.UpdateSupplier(request.Context(), supplier)
+	}
+	if err != nil {
+		s.log(request.Context()).Error("change supplier failed", zap.Error(err))
+		writeSupplierError(writer, err)
+		return
+	}
+
+	s.writeJSON(writer, request, supplier)
+}
+
+func (s *Server) handleManagerGetPurchaseOrders(writer http.ResponseWriter, request *http.Request) {
+	id, err := middleware.Authentication(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("get purchase orders: authentication failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	items, err := s.suppliersSvc.PurchaseOrders(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("get purchase orders failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(writer, request, items)
+}
+
+func (s *Server) handleManagerGetPurchaseOrderByID(writer http.ResponseWriter, request *http.Request) {
+	id, err := middleware.Authentication(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("get purchase order: authentication failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	orderID, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		s.log(request.Context()).Warn("get purchase order: invalid id", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	order, err := s.suppliersSvc.PurchaseOrderByID(request.Context(), orderID)
+	if err != nil {
+		s.log(request.Context()).Error("get purchase order failed", zap.Error(err))
+		writeSupplierError(writer, err)
+		return
+	}
+
+	s.writeJSON(writer, request, order)
+}
+
+func (s *Server) handleManagerCreatePurchaseOrder(writer http.ResponseWriter, request *http.Request) {
+	id, err := middleware.Authentication(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("create purchase order: authentication failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	order := &suppliers.PurchaseOrder{}
+	err = json.NewDecoder(request.Body).Decode(&order)
+	if err != nil {
+		s.log(request.Context()).Warn("can't decode purchase order", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	order.ManagerID = id
+
+	order, err = s.suppliersSvc.CreatePurchaseOrder(request.Context(), order)
+	if err != nil {
+		s.log(request.Context()).Error("create purchase order failed", zap.Error(err))
+		writeSupplierError(writer, err)
+		return
+	}
+
+	s.writeJSON(writer, request, order)
+}
+
+func (s *Server) handleManagerSendPurchaseOrder(writer http.ResponseWriter, request *http.Request) {
+	s.changePurchaseOrder(writer, request, func(orderID int64) (*suppliers.PurchaseOrder, error) {
+		return s.suppliersSvc.Send(request.Context(), orderID)
+	})
+}
+
+func (s *Server) handleManagerCancelPurchaseOrder(writer http.ResponseWriter, request *http.Request) {
+	s.changePurchaseOrder(writer, request, func(orderID int64) (*suppliers.PurchaseOrder, error) {
+		return s.suppliersSvc.Cancel(request.Context(), orderID)
+	})
+}
+
+func (s *Server) handleManagerReceivePurchaseOrder(writer http.ResponseWriter, request *http.Request) {
+	s.changePurchaseOrder(writer, request, func(orderID int64) (*suppliers.PurchaseOrder, error) {
+		receipts := make([]*suppliers.Receipt, 0)
+		if request.ContentLength != 0 {
+			err := json.NewDecoder(request.Body).Decode(&receipts)
+			if err != nil {
+				return nil, suppliers.ErrInvalidQty
+			}
+		}
+		return s.suppliersSvc.Receive(request.Context(), orderID, receipts)
+	})
+}
+
+func (s *Server) changePurchaseOrder(writer http.ResponseWriter, request *http.Request, change func(orderID int64) (*suppliers.PurchaseOrder, error)) {
+	id, err := middleware.Authentication(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("change purchase order: authentication failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	orderID, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		s.log(request.Context()).Warn("change purchase order: invalid id", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	order, err := change(orderID)
+	if err != nil {
+		s.log(request.Context()).Error("change purchase order failed", zap.Error(err))
+		writeSupplierError(writer, err)
+		return
+	}
+
+	s.writeJSON(writer, request, order)
+}
+
+func writeSupplierError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, suppliers.ErrNotFound):
+		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	case errors.Is(err, suppliers.ErrInvalidStatus):
+		http.Error(writer, http.StatusText(http.StatusConflict), http.StatusConflict)
+	case errors.Is(err, suppliers.ErrInvalidQty), errors.Is(err, suppliers.ErrInvalidOrder):
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	default:
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
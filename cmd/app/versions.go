@@ -0,0 +1,66 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shohinsherov/crud/cmd/app/middleware"
+)
+
+// Префиксы HTTP API.
+const (
+	// v1Prefix - текущая версия API.
+	v1Prefix = "/api/v1"
+	// legacyPrefix - прежние адреса без версии, повторяют v1 и будут удалены.
+	legacyPrefix = "/api"
+)
+
+// legacyDeprecation - сроки удаления адресов без версии.
+var legacyDeprecation = middleware.Deprecation{
+	Since:  time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC),
+	Sunset: time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC),
+	Successor: func(request *http.Request) string {
+		return v1Prefix + strings.TrimPrefix(request.URL.Path, legacyPrefix)
+	},
+}
+
+// updateByPOSTDeprecation - сроки удаления обновления товаров и покупателей через POST
+// коллекции с ненулевым id; замена - PUT /{id}.
+var updateByPOSTDeprecation = middleware.Deprecation{
+	Since:  legacyDeprecation.Since,
+	Sunset: legacyDeprecation.Sunset,
+}
+
+// apiVersion - версия API: маршруты покупателей и менеджеров под общим префиксом.
+// Следующая версия с другими форматами запросов и ответов добавляется в apiVersions
+// со своей функцией routes и своими обработчиками; v1 при этом продолжает работать.
+type apiVersion struct {
+	prefix string
+	routes func(customersRouter *mux.Router, managersRouter *mux.Router)
+	// deprecation, если задан, помечает все маршруты версии как устаревшие.
+	deprecation *middleware.Deprecation
+}
+
+// apiVersions возвращает все смонтированные версии API.
+func (s *Server) apiVersions() []*apiVersion {
+	return []*apiVersion{
+		{prefix: v1Prefix, routes: s.routesV1},
+		{prefix: legacyPrefix, routes: s.routesV1, deprecation: &legacyDeprecation},
+	}
+}
+
+// mount регистрирует маршруты версии под <prefix>/customers и <prefix>/managers.
+func (s *Server) mount(version *apiVersion) {
+	customersRouter := s.mux.PathPrefix(version.prefix + "/customers").Subrouter()
+	managersRouter := s.mux.PathPrefix(version.prefix + "/managers").Subrouter()
+	if version.deprecation != nil {
+		customersRouter.Use(middleware.Deprecated(*version.deprecation))
+		managersRouter.Use(middleware.Deprecated(*version.deprecation))
+	}
+	customersRouter.Use(middleware.Authenticate(s.customersSvc.IDByToken, s.logger))
+	managersRouter.Use(middleware.Authenticate(s.managersSvc.IDByToken, s.logger))
+
+	version.routes(customersRouter, managersRouter)
+}
@@ -0,0 +1,48 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVersions_Deprecation(t *testing.T) {
+	server := newTestServer()
+
+	tests := []struct {
+		path       string
+		deprecated bool
+	}{
+		{"/api/v1/customers/products/search", false},
+		{"/api/customers/products/search", true},
+		{"/api/v1/managers/sales", false},
+		{"/api/managers/sales", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if recorder.Code == http.StatusNotFound {
+				t.Fatalf("route is not mounted")
+			}
+
+			header := recorder.Header()
+			if !tt.deprecated {
+				if header.Get("Deprecation") != "" || header.Get("Sunset") != "" {
+					t.Errorf("unexpected deprecation headers: %v", header)
+				}
+				return
+			}
+			if header.Get("Deprecation") != "@1792368000" {
+				t.Errorf("Deprecation: got %q", header.Get("Deprecation"))
+			}
+			if header.Get("Sunset") != "Thu, 01 Apr 2027 00:00:00 GMT" {
+				t.Errorf("Sunset: got %q", header.Get("Sunset"))
+			}
+			want := "<" + v1Prefix + tt.path[len(legacyPrefix):] + `>; rel="successor-version"`
+			if header.Get("Link") != want {
+				t.Errorf("Link: got %q, want %q", header.Get("Link"), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/shohinsherov/crud/cmd/app/middleware"
+	"github.com/shohinsherov/crud/pkg/webhooks"
+	"go.uber.org/zap"
+)
+
+// requireAdmin пропускает только администраторов; иначе отвечает клиенту сам и возвращает false.
+func (s *Server) requireAdmin(writer http.ResponseWriter, request *http.Request, op string) bool {
+	id, err := middleware.Authentication(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error(op+" failed", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return false
+	}
+	if id == 0 {
+		s.log(request.Context()).Warn("user is not manager")
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return false
+	}
+	if !s.managersSvc.IsAdmin(request.Context(), id) {
+		s.log(request.Context()).Warn("manager is not admin", zap.Int64("manager_id", id))
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleManagerGetWebhooks(writer http.ResponseWriter, request *http.Request) {
+	if !s.requireAdmin(writer, request, "manager get webhooks") {
+		return
+	}
+
+	items, err := s.webhooksSvc.Webhooks(request.Context())
+	if err != nil {
+		s.log(request.Context()).Error("get webhooks failed", zap.Error(err))
+		writeManagerError(writer, err)
+		return
+	}
+
+	s.writeJSON(writer, request, items)
+}
+
+// handleManagerCreateWebhook заводит вебхук. Секрет для проверки подписи есть только в этом ответе.
+func (s *Server) handleManagerCreateWebhook(writer http.ResponseWriter, request *http.Request) {
+	if !s.requireAdmin(writer, request, "manager create webhook") {
+		return
+	}
+
+	webhook := &webhooks.Webhook{}
+	err := json.NewDecoder(request.Body).Decode(&webhook)
+	if err != nil {
+		s.log(request.Context()).Warn("can't decode webhook", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	webhook, err = s.webhooksSvc.Create(request.Context(), webhook)
+	if err != nil {
+		s.log(request.Context()).Error("create webhook failed", zap.Error(err))
+		writeManagerError(writer, err)
+		return
+	}
+	s.writeCreated(writer, request, webhook.ID, webhook)
+}
+
+func (s *Server) handleManagerGetWebhookByID(writer http.ResponseWriter, request *http.Request) {
+	if !s.requireAdmin(writer, request, "manager get webhook by id") {
+		return
+	}
+
+	webhookID, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		s.log(request.Context()).Warn("get webhook: invalid id", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	webhook, err := s.webhooksSvc.WebhookByID(request.Context(), webhookID)
+	if err != nil {
+		s.log(request.Context()).Error("get webhook failed", zap.Error(err))
+		writeManagerError(writer, err)
+		return
+	}
+
+	s.writeJSON(writer, request, webhook)
+}
+
+func (s *Server) handleManagerRemoveWebhook(writer http.ResponseWriter, request *http.Request) {
+	if !s.requireAdmin(writer, request, "manager remove webhook") {
+		return
+	}
+
+	webhookID, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		s.log(request.Context()).Warn("remove webhook: invalid id", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	err = s.webhooksSvc.Remove(request.Context(), webhookID)
+	if err != nil {
+		s.log(request.Context()).Error("remove webhook failed", zap.Error(err))
+		writeManagerError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// handleManagerGetWebhookDeliveries возвращает журнал доставок вебхука, начиная с последних.
+func (s *Server) handleManagerGetWebhookDeliveries(writer http.ResponseWriter, request *http.Request) {
+	if !s.requireAdmin(writer, request, "manager get webhook deliveries") {
+		return
+	}
+
+	webhookID, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		s.log(request.Context()).Warn("get webhook deliveries: invalid id", zap.Error(err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	limit := 0
+	if value := request.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			s.log(request.Context()).Warn("invalid query parameter", zap.String("name", "limit"))
+			http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+	}
+
+	items, err := s.webhooksSvc.Deliveries(request.Context(), webhookID, limit)
+	if err != nil {
+		s.log(request.Context()).Error("get webhook deliveries failed", zap.Error(err))
+		writeManagerError(writer, err)
+		return
+	}
+
+	s.writeJSON(writer, request, items)
+}
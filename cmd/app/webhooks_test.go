@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/shohinsherov/crud/pkg/customers"
+	"github.com/shohinsherov/crud/pkg/events"
+	"github.com/shohinsherov/crud/pkg/webhooks"
+)
+
+func TestWebhooks_Delivery(t *testing.T) {
+	server := newTestServer()
+	managerToken := testManagerToken(t, server)
+	adminToken := testAdminToken(t, server)
+	const path = "/api/v1/managers/webhooks"
+
+	received := make(chan *http.Request, 1)
+	var body []byte
+	subscriber := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ = ioutil.ReadAll(request.Body)
+		received <- request
+	}))
+	defer subscriber.Close()
+
+	item := &webhooks.Webhook{URL: subscriber.URL, Events: []string{events.TypeCustomerRegistered}}
+	recorder := managerRequest(t, server, managerToken, POST, path, nil, item)
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("create by manager: got status %d, want %d", recorder.Code, http.StatusForbidden)
+	}
+	recorder = managerRequest(t, server, adminToken, POST, path, nil, &webhooks.Webhook{URL: "erp", Events: item.Events})
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("create with invalid url: got status %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+
+	created := &webhooks.Webhook{}
+	decodeRecorder(t, managerRequest(t, server, adminToken, POST, path, nil, item), http.StatusCreated, created)
+	if created.Secret == "" {
+		t.Fatalf("created webhook has no secret: %+v", created)
+	}
+	itemPath := path + "/" + strconv.FormatInt(created.ID, 10)
+
+	var listed []*webhooks.Webhook
+	decodeRecorder(t, managerRequest(t, server, adminToken, GET, path, nil, nil), http.StatusOK, &listed)
+	if len(listed) != 1 || listed[0].ID != created.ID || listed[0].Secret != "" {
+		t.Fatalf("unexpected webhooks: %+v", listed)
+	}
+
+	customer, err := server.customersSvc.Register(context.Background(), &customers.Registration{Name: "Customer", Phone: "+992000000101", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, attempts, err := server.webhooksSvc.Dispatch(context.Background())
+	if err != nil || attempts != 1 {
+		t.Fatalf("dispatch: got %d attempts, %v", attempts, err)
+	}
+
+	request := <-received
+	signature := webhooks.Sign(created.Secret, request.Header.Get(webhooks.TimestampHeader), body)
+	if request.Header.Get(webhooks.SignatureHeader) != signature {
+		t.Errorf("signature: got %q, want %q", request.Header.Get(webhooks.SignatureHeader), signature)
+	}
+	payload := &webhooks.Payload{}
+	err = json.Unmarshal(body, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registered := &customers.Customer{}
+	err = json.Unmarshal(payload.Data, registered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.Type != events.TypeCustomerRegistered || payload.Version != events.SchemaVersion || registered.ID != customer.ID {
+		t.Errorf("unexpected payload: %s", body)
+	}
+
+	var deliveries []*webhooks.Delivery
+	decodeRecorder(t, managerRequest(t, server, adminToken, GET, itemPath+"/deliveries?limit=10", nil, nil), http.StatusOK, &deliveries)
+	if len(deliveries) != 1 || deliveries[0].Status != webhooks.StatusDelivered || deliveries[0].Event != events.TypeCustomerRegistered {
+		t.Fatalf("unexpected deliveries: %+v", deliveries)
+	}
+
+	recorder = managerRequest(t, server, adminToken, DELETE, itemPath, nil, nil)
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("remove: got status %d, want %d", recorder.Code, http.StatusNoContent)
+	}
+	recorder = managerRequest(t, server, adminToken, GET, itemPath, nil, nil)
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("get removed: got status %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shohinsherov/crud/cmd/app"
+	"github.com/shohinsherov/crud/pkg/config"
+	"github.com/shohinsherov/crud/pkg/customers"
+	"github.com/shohinsherov/crud/pkg/hub"
+	"github.com/shohinsherov/crud/pkg/managers"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testDatabaseEnv - переменная окружения с DSN базы для интеграционных тестов.
+// Если она не задана, тесты HTTP API пропускаются.
+const testDatabaseEnv = "CRUD_TEST_DATABASE_URL"
+
+// testApp - приложение, собранное как в cmd/main.go, поверх отдельной схемы базы.
+type testApp struct {
+	t           *testing.T
+	server      *httptest.Server
+	managersSvc *managers.Service
+	events      *hub.Hub
+	pool        *pgxpool.Pool
+	// header - дополнительные заголовки запросов, см. with.
+	header http.Header
+}
+
+// newTestApp создаёт схему для теста, применяет в ней миграции и запускает сервер.
+// Схема удаляется по завершении теста.
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+	dsn := os.Getenv(testDatabaseEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDatabaseEnv)
+	}
+
+	schema := createTestSchema(t, dsn)
+	cfg := config.Default()
+	cfg.Database.DSN = withSearchPath(dsn, schema)
+	cfg.Database.MaxConns = 4
+	cfg.Auth.BcryptCost = bcrypt.MinCost
+
+	container, err := build(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("build app: %v", err)
+	}
+
+	a := &testApp{t: t}
+	err = container.Invoke(func(server *http.Server, pool *pgxpool.Pool, managersSvc *managers.Service, events *hub.Hub) {
+		a.server = httptest.NewServer(server.Handler)
+		a.managersSvc = managersSvc
+		a.events = events
+		a.pool = pool
+		t.Cleanup(func() {
+			a.server.Close()
+			pool.Close()
+		})
+	})
+	if err != nil {
+		t.Fatalf("start app: %v", err)
+	}
+	return a
+}
+
+// createTestSchema создаёт пустую схему со случайным именем.
+// pg_trgm ставится в public один раз: расширение нельзя установить в несколько схем.
+func createTestSchema(t *testing.T, dsn string) string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatalf("connect to test database: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	suffix := make([]byte, 6)
+	_, err = rand.Read(suffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := "test_" + hex.EncodeToString(suffix)
+
+	_, err = conn.Exec(ctx, `CREATE EXTENSION IF NOT EXISTS pg_trgm SCHEMA public`)
+	if err != nil {
+		t.Fatalf("create extension: %v", err)
+	}
+	_, err = conn.Exec(ctx, `CREATE SCHEMA `+schema)
+	if err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		conn, err := pgx.Connect(ctx, dsn)
+		if err != nil {
+			t.Errorf("connect to test database: %v", err)
+			return
+		}
+		defer conn.Close(ctx)
+		_, err = conn.Exec(ctx, `DROP SCHEMA `+schema+` CASCADE`)
+		if err != nil {
+			t.Errorf("drop schema %s: %v", schema, err)
+		}
+	})
+	return schema
+}
+
+// withSearchPath добавляет в DSN (URL или key=value) параметр search_path.
+func withSearchPath(dsn string, schema string) string {
+	searchPath := schema + ",public"
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err == nil {
+			query := u.Query()
+			query.Set("search_path", searchPath)
+			u.RawQuery = query.Encode()
+			return u.String()
+		}
+	}
+	return dsn + " search_path=" + searchPath
+}
+
+// with возвращает копию a, которая добавляет к запросам заголовок name.
+func (a *testApp) with(name string, value string) *testApp {
+	c := *a
+	c.header = a.header.Clone()
+	if c.header == nil {
+		c.header = http.Header{}
+	}
+	c.header.Set(name, value)
+	return &c
+}
+
+// ifMatch возвращает копию a, которая отправляет If-Match с ETag версии version.
+func (a *testApp) ifMatch(version int64) *testApp {
+	return a.with("If-Match", fmt.Sprintf(`"%d"`, version))
+}
+
+// do отправляет запрос; body сериализуется в JSON, token передаётся в заголовке Authorization.
+func (a *testApp) do(method string, path string, token string, body interface{}) *http.Response {
+	a.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			a.t.Fatalf("%s %s: %v", method, path, err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequest(method, a.server.URL+path, reader)
+	if err != nil {
+		a.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	for name, values := range a.header {
+		request.Header[name] = values
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		request.Header.Set("Authorization", token)
+	}
+	response, err := a.server.Client().Do(request)
+	if err != nil {
+		a.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return response
+}
+
+// expectStatus проверяет код ответа и возвращает тело.
+func (a *testApp) expectStatus(method string, path string, token string, body interface{}, status int) []byte {
+	a.t.Helper()
+	response := a.do(method, path, token, body)
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		a.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	if response.StatusCode != status {
+		a.t.Fatalf("%s %s: got status %d, want %d: %s", method, path, response.StatusCode, status, data)
+	}
+	return data
+}
+
+// expectJSON проверяет, что ответ 200 с JSON, и разбирает его в out.
+func (a *testApp) expectJSON(method string, path string, token string, body interface{}, out interface{}) {
+	a.t.Helper()
+	a.expectJSONStatus(method, path, token, body, http.StatusOK, out)
+}
+
+// expectCreated создаёт ресурс запросом POST, разбирает ответ 201 в out и возвращает адрес из Location.
+func (a *testApp) expectCreated(path string, token string, body interface{}, out interface{}) string {
+	a.t.Helper()
+	response := a.expectJSONStatus(http.MethodPost, path, token, body, http.StatusCreated, out)
+	location := response.Header.Get("Location")
+	if !strings.HasPrefix(location, path+"/") {
+		a.t.Fatalf("POST %s: got location %q", path, location)
+	}
+	return location
+}
+
+// expectJSONStatus проверяет код ответа и JSON в теле, разбирает его в out и возвращает ответ.
+func (a *testApp) expectJSONStatus(method string, path string, token string, body interface{}, status int, out interface{}) *http.Response {
+	a.t.Helper()
+	response := a.do(method, path, token, body)
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		a.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	if response.StatusCode != status {
+		a.t.Fatalf("%s %s: got status %d, want %d: %s", method, path, response.StatusCode, status, data)
+	}
+	if contentType := response.Header.Get("Content-Type"); contentType != "application/json" {
+		a.t.Fatalf("%s %s: got content type %q, want application/json", method, path, contentType)
+	}
+	err = json.Unmarshal(data, out)
+	if err != nil {
+		a.t.Fatalf("%s %s: can't decode %s: %v", method, path, data, err)
+	}
+	return response
+}
+
+// registerCustomer регистрирует покупателя через API.
+func (a *testApp) registerCustomer(phone string, password string) *customers.Customer {
+	a.t.Helper()
+	customer := &customers.Customer{}
+	a.expectJSON(http.MethodPost, "/api/v1/customers", "", &customers.Registration{Name: "Customer " + phone, Phone: phone, Password: password}, customer)
+	return customer
+}
+
+// customerToken выдаёт токен покупателя через API.
+func (a *testApp) customerToken(phone string, password string) string {
+	a.t.Helper()
+	token := &app.Token{}
+	a.expectJSON(http.MethodPost, "/api/v1/customers/token", "", &customers.Auth{Login: phone, Password: password}, token)
+	return token.Token
+}
+
+// createAdmin создаёт администратора напрямую через сервис, как команда admin create.
+func (a *testApp) createAdmin(phone string, password string) *managers.Registration {
+	a.t.Helper()
+	reg, err := a.managersSvc.Create(context.Background(), &managers.Registration{Name: "Admin " + phone, Phone: phone, Roles: []string{managers.ADMIN}}, password)
+	if err != nil {
+		a.t.Fatalf("create admin %s: %v", phone, err)
+	}
+	return reg
+}
+
+// managerToken выдаёт токен менеджера через API.
+func (a *testApp) managerToken(phone string, password string) string {
+	a.t.Helper()
+	token := &app.Token{}
+	a.expectJSON(http.MethodPost, "/api/v1/managers/token", "", &managers.Auth{Phone: phone, Password: password}, token)
+	return token.Token
+}
+
+// adminToken создаёт администратора и возвращает его токен.
+func (a *testApp) adminToken() string {
+	a.t.Helper()
+	admin := a.createAdmin("+992900000001", "secret")
+	return a.managerToken(admin.Phone, "secret")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/shohinsherov/crud/pkg/config"
+	"github.com/shohinsherov/crud/pkg/migrations"
+	"go.uber.org/zap"
+)
+
+// migrate выполняет подкоманду migrate.
+func migrate(cfg *config.Config, logger *zap.Logger, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	if args[0] == "create" {
+		fs := flag.NewFlagSet("migrate create", flag.ContinueOnError)
+		dir := fs.String("dir", migrations.Dir, "directory with migration files")
+		err := fs.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return errUsage
+		}
+		up, down, err := migrations.Create(*dir, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		fmt.Println(up)
+		fmt.Println(down)
+		return nil
+	}
+
+	pool, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	migrator, err := migrations.NewMigrator(pool, logger)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		if len(args) != 1 {
+			return errUsage
+		}
+		count, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migration(s)\n", count)
+	case "down":
+		steps := 1
+		if len(args) > 2 {
+			return errUsage
+		}
+		if len(args) == 2 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return errUsage
+			}
+		}
+		count, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reverted %d migration(s)\n", count)
+	case "status":
+		if len(args) != 1 {
+			return errUsage
+		}
+		items, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "VERSION\tNAME\tAPPLIED")
+		for _, item := range items {
+			applied := "pending"
+			if item.Applied != nil {
+				applied = item.Applied.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(writer, "%04d\t%s\t%s\n", item.Version, item.Name, applied)
+		}
+		return writer.Flush()
+	default:
+		return errUsage
+	}
+	return nil
+}
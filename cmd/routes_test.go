@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shohinsherov/crud/cmd/app"
+	"github.com/shohinsherov/crud/pkg/customers"
+	"github.com/shohinsherov/crud/pkg/events"
+	"github.com/shohinsherov/crud/pkg/health"
+	"github.com/shohinsherov/crud/pkg/hub"
+	"github.com/shohinsherov/crud/pkg/managers"
+	"github.com/shohinsherov/crud/pkg/suppliers"
+)
+
+func TestRoutes_Probes(t *testing.T) {
+	a := newTestApp(t)
+
+	result := &health.Result{}
+	a.expectJSON(http.MethodGet, "/healthz", "", nil, result)
+	if result.Status != health.StatusOK {
+		t.Errorf("healthz: got %+v", result)
+	}
+	result = &health.Result{}
+	a.expectJSON(http.MethodGet, "/readyz", "", nil, result)
+	if result.Status != health.StatusOK || len(result.Checks) != 3 {
+		t.Errorf("readyz: got %+v", result)
+	}
+
+	info := &app.BuildInfo{}
+	a.expectJSON(http.MethodGet, "/version", "", nil, info)
+	if info.SchemaVersion == 0 || info.SchemaVersion != info.ExpectedSchemaVersion {
+		t.Errorf("version: got %+v", info)
+	}
+
+	response := a.do(http.MethodGet, "/metrics", "", nil)
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusOK || !strings.Contains(string(data), "crud_http_requests_total") {
+		t.Errorf("metrics: got status %d: %s", response.StatusCode, data)
+	}
+}
+
+func TestRoutes_Customers(t *testing.T) {
+	a := newTestApp(t)
+	admin := a.adminToken()
+
+	category := &managers.Category{}
+	a.expectJSON(http.MethodPost, "/api/v1/managers/categories", admin, &managers.Category{Name: "Футболки"}, category)
+	product := &managers.Product{}
+	a.expectCreated("/api/v1/managers/products", admin, &managers.Product{Name: "Футболка красная", Price: 100, Qty: 3, CategoryID: category.ID, Attributes: map[string]string{"color": "red"}}, product)
+	a.expectCreated("/api/v1/managers/products", admin, &managers.Product{Name: "Хлеб", Price: 5, Qty: 10}, &managers.Product{})
+
+	customer := a.registerCustomer("+992000000001", "secret")
+	if customer.ID == 0 || !customer.Active {
+		t.Fatalf("register: got %+v", customer)
+	}
+	token := a.customerToken(customer.Phone, "secret")
+	if token == "" {
+		t.Fatal("empty customer token")
+	}
+
+	products := make([]*customers.Product, 0)
+	a.expectJSON(http.MethodGet, fmt.Sprintf("/api/v1/customers/products?category_id=%d", category.ID), token, nil, &products)
+	if len(products) != 1 || products[0].ID != product.ID {
+		t.Errorf("products in category: got %+v", products)
+	}
+	products = make([]*customers.Product, 0)
+	a.expectJSON(http.MethodGet, "/api/v1/customers/products?attr.color=red", token, nil, &products)
+	if len(products) != 1 || products[0].ID != product.ID {
+		t.Errorf("products by attribute: got %+v", products)
+	}
+
+	results := make([]*customers.SearchResult, 0)
+	a.expectJSON(http.MethodGet, "/api/v1/customers/products/search?in_stock=true&q="+url.QueryEscape("футболка"), token, nil, &results)
+	if len(results) != 1 || results[0].ID != product.ID {
+		t.Errorf("search: got %+v", results)
+	}
+	a.expectStatus(http.MethodGet, "/api/v1/customers/products/search", token, nil, http.StatusBadRequest)
+
+	categories := make([]*customers.Category, 0)
+	a.expectJSON(http.MethodGet, "/api/v1/customers/categories", token, nil, &categories)
+	if len(categories) != 1 || categories[0].Name != "Футболки" {
+		t.Errorf("categories: got %+v", categories)
+	}
+}
+
+func TestRoutes_ManagerAccounts(t *testing.T) {
+	a := newTestApp(t)
+	admin := a.adminToken()
+
+	registration := &managers.Registration{Name: "Manager", Phone: "+992000000002"}
+	a.expectStatus(http.MethodPost, "/api/v1/managers", "", registration, http.StatusForbidden)
+
+	token := &app.Token{}
+	a.expectJSON(http.MethodPost, "/api/v1/managers", admin, registration, token)
+	if token.Token == "" {
+		t.Fatal("empty manager token")
+	}
+	a.expectStatus(http.MethodPost, "/api/v1/managers", token.Token, &managers.Registration{Name: "Other", Phone: "+992000000003"}, http.StatusForbidden)
+	a.expectStatus(http.MethodGet, "/api/v1/managers/sales", "", nil, http.StatusForbidden)
+}
+
+func TestRoutes_ManagerCatalog(t *testing.T) {
+	a := newTestApp(t)
+	admin := a.adminToken()
+
+	parent := &managers.Category{}
+	a.expectJSON(http.MethodPost, "/api/v1/managers/categories", admin, &managers.Category{Name: "Одежда"}, parent)
+	child := &managers.Category{}
+	a.expectJSON(http.MethodPost, "/api/v1/managers/categories", admin, &managers.Category{Name: "Футболки", ParentID: parent.ID}, child)
+	categories := make([]*managers.Category, 0)
+	a.expectJSON(http.MethodGet, "/api/v1/managers/categories", admin, nil, &categories)
+	if len(categories) != 2 {
+		t.Errorf("categories: got %+v", categories)
+	}
+
+	product := &managers.Product{}
+	productPath := a.expectCreated("/api/v1/managers/products", admin, &managers.Product{Name: "Футболка", SKU: "TS", Price: 100, CategoryID: child.ID}, product)
+	if productPath != fmt.Sprintf("/api/v1/managers/products/%d", product.ID) {
+		t.Errorf("create product: got location %q", productPath)
+	}
+	product.Price = 120
+	a.expectStatus(http.MethodPut, productPath, admin, product, http.StatusPreconditionRequired)
+	a.ifMatch(product.Version).expectJSON(http.MethodPut, productPath, admin, product, product)
+	if product.Price != 120 {
+		t.Errorf("replace product: got %+v", product)
+	}
+	a.ifMatch(product.Version).expectJSON(http.MethodPatch, productPath, admin, map[string]interface{}{"qty": 4}, product)
+	if product.Price != 120 || product.Qty != 4 || product.SKU != "TS" {
+		t.Errorf("patch product: got %+v", product)
+	}
+	a.ifMatch(product.Version-1).expectStatus(http.MethodPatch, productPath, admin, map[string]interface{}{"qty": 5}, http.StatusPreconditionFailed)
+	a.with("If-Match", "*").expectStatus(http.MethodPut, fmt.Sprintf("/api/v1/managers/products/%d", product.ID+100), admin, product, http.StatusNotFound)
+	patched := product.Version
+	variant := &managers.Variant{}
+	a.expectJSON(http.MethodPost, productPath+"/variants", admin, &managers.Variant{SKU: "TS-XL", Attributes: map[string]string{"size": "XL"}, Qty: 2}, variant)
+	if variant.ID == 0 || variant.ProductID != product.ID {
+		t.Errorf("save variant: got %+v", variant)
+	}
+
+	barcode := &managers.Barcode{}
+	a.expectJSON(http.MethodPost, productPath+"/barcodes", admin, &managers.Barcode{Code: "4006381333931", VariantID: variant.ID}, barcode)
+	a.expectStatus(http.MethodPost, productPath+"/barcodes", admin, &managers.Barcode{Code: "4006381333932"}, http.StatusBadRequest)
+
+	result := &managers.ScanResult{}
+	a.expectJSON(http.MethodGet, "/api/v1/managers/products/lookup?barcode=4006381333931", admin, nil, result)
+	if result.Product == nil || result.Product.ID != product.ID || result.Variant == nil || result.Variant.ID != variant.ID {
+		t.Errorf("lookup: got %+v", result)
+	}
+	a.expectStatus(http.MethodDelete, productPath+"/barcodes/4006381333931", admin, nil, http.StatusOK)
+	a.expectStatus(http.MethodGet, "/api/v1/managers/products/lookup?barcode=4006381333931", admin, nil, http.StatusNotFound)
+
+	products := make([]*managers.Product, 0)
+	a.expectJSON(http.MethodGet, fmt.Sprintf("/api/v1/managers/products?category_id=%d", parent.ID), admin, nil, &products)
+	if len(products) != 1 || len(products[0].Variants) != 1 {
+		t.Errorf("products: got %+v", products)
+	}
+
+	history := make([]*managers.PriceChange, 0)
+	a.expectJSON(http.MethodGet, productPath+"/prices", admin, nil, &history)
+	if len(history) != 2 || history[0].Price != 120 {
+		t.Errorf("price history: got %+v", history)
+	}
+
+	scheduled := &managers.ScheduledPrice{}
+	a.expectJSON(http.MethodPost, productPath+"/prices/scheduled", admin, &managers.ScheduledPrice{Price: 90, Effective: time.Now().Add(time.Hour)}, scheduled)
+	if scheduled.Status != managers.PricePending {
+		t.Errorf("schedule price: got %+v", scheduled)
+	}
+	pending := make([]*managers.ScheduledPrice, 0)
+	a.expectJSON(http.MethodGet, productPath+"/prices/scheduled", admin, nil, &pending)
+	if len(pending) != 1 || pending[0].ID != scheduled.ID {
+		t.Errorf("scheduled prices: got %+v", pending)
+	}
+	a.expectJSON(http.MethodDelete, fmt.Sprintf("%s/prices/scheduled/%d", productPath, scheduled.ID), admin, nil, scheduled)
+	if scheduled.Status != managers.PriceCancelled {
+		t.Errorf("cancel scheduled price: got %+v", scheduled)
+	}
+
+	// Варианты и штрихкоды тоже меняют версию товара.
+	a.ifMatch(patched).expectStatus(http.MethodDelete, productPath, admin, nil, http.StatusPreconditionFailed)
+	response := a.expectJSONStatus(http.MethodGet, productPath, admin, nil, http.StatusOK, product)
+	etag := response.Header.Get("ETag")
+	if etag != fmt.Sprintf(`"%d"`, product.Version) || product.Version == patched {
+		t.Errorf("get product: got ETag %q for %+v", etag, product)
+	}
+	a.with("If-None-Match", etag).expectStatus(http.MethodGet, productPath, admin, nil, http.StatusNotModified)
+	a.ifMatch(product.Version).expectStatus(http.MethodDelete, productPath, admin, nil, http.StatusNoContent)
+	a.expectJSON(http.MethodGet, productPath, admin, nil, product)
+	if product.Active {
+		t.Errorf("removed product is active: %+v", product)
+	}
+	products = make([]*managers.Product, 0)
+	a.expectJSON(http.MethodGet, "/api/v1/managers/products", admin, nil, &products)
+	if len(products) != 0 {
+		t.Errorf("products after remove: got %+v", products)
+	}
+}
+
+func TestRoutes_ManagerSalesAndCustomers(t *testing.T) {
+	a := newTestApp(t)
+	admin := a.adminToken()
+	customer := a.registerCustomer("+992000000001", "secret")
+	other := a.registerCustomer("+992000000002", "secret")
+
+	product := &managers.Product{}
+	a.expectCreated("/api/v1/managers/products", admin, &managers.Product{Name: "Хлеб", Price: 5, Qty: 10}, product)
+
+	sale := &managers.Sale{}
+	request := &managers.Sale{CustomerID: customer.ID, Positions: []*managers.SalePosition{
+		{ProductID: product.ID, Qty: 3, Price: 5},
+	}}
+	a.with("Idempotency-Key", "sale-1").expectJSON(http.MethodPost, "/api/v1/managers/sales", admin, request, sale)
+	if sale.ID == 0 || len(sale.Positions) != 1 {
+		t.Errorf("make sale: got %+v", sale)
+	}
+	retry := &managers.Sale{}
+	response := a.with("Idempotency-Key", "sale-1").expectJSONStatus(http.MethodPost, "/api/v1/managers/sales", admin, request, http.StatusOK, retry)
+	if retry.ID != sale.ID || response.Header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry sale: got %+v, want sale %d", retry, sale.ID)
+	}
+	request.Positions[0].Qty = 1
+	a.with("Idempotency-Key", "sale-1").expectStatus(http.MethodPost, "/api/v1/managers/sales", admin, request, http.StatusUnprocessableEntity)
+	a.expectStatus(http.MethodPost, "/api/v1/managers/sales", admin, &managers.Sale{CustomerID: customer.ID, Positions: []*managers.SalePosition{
+		{ProductID: product.ID, Qty: 8, Price: 5},
+	}}, http.StatusConflict)
+
+	sales := &managers.Sales{}
+	a.expectJSON(http.MethodGet, "/api/v1/managers/sales", admin, nil, sales)
+	if sales.Total != 15 {
+		t.Errorf("sales: got %+v, want total 15", sales)
+	}
+
+	items := make([]*managers.Customer, 0)
+	a.expectJSON(http.MethodGet, "/api/v1/managers/customers", admin, nil, &items)
+	if len(items) != 2 {
+		t.Errorf("customers: got %+v", items)
+	}
+
+	customerPath := fmt.Sprintf("/api/v1/managers/customers/%d", customer.ID)
+	changed := &managers.Customer{}
+	a.ifMatch(1).expectJSON(http.MethodPut, customerPath, admin, &managers.Customer{Name: "Renamed", Phone: customer.Phone, Active: true}, changed)
+	if changed.Name != "Renamed" {
+		t.Errorf("replace customer: got %+v", changed)
+	}
+	a.ifMatch(1).expectStatus(http.MethodPatch, customerPath, admin, map[string]interface{}{"name": "Patched"}, http.StatusPreconditionFailed)
+	a.ifMatch(changed.Version).expectJSON(http.MethodPatch, customerPath, admin, map[string]interface{}{"name": "Patched"}, changed)
+	if changed.Name != "Patched" || changed.Phone != customer.Phone || !changed.Active {
+		t.Errorf("patch customer: got %+v", changed)
+	}
+	a.ifMatch(changed.Version).expectStatus(http.MethodPatch, customerPath, admin, map[string]interface{}{"phone": other.Phone}, http.StatusConflict)
+
+	created := &managers.Customer{}
+	createdPath := a.expectCreated("/api/v1/managers/customers", admin, map[string]string{"name": "Created", "phone": "+992000000003", "password": "secret"}, created)
+	a.customerToken(created.Phone, "secret")
+	a.expectStatus(http.MethodDelete, createdPath, admin, nil, http.StatusPreconditionRequired)
+	a.ifMatch(created.Version).expectStatus(http.MethodDelete, createdPath, admin, nil, http.StatusNoContent)
+	a.expectStatus(http.MethodGet, createdPath, admin, nil, http.StatusNotFound)
+
+	a.with("If-Match", "*").expectStatus(http.MethodDelete, fmt.Sprintf("/api/v1/managers/customers/%d", other.ID), admin, nil, http.StatusNoContent)
+	a.with("If-Match", "*").expectStatus(http.MethodDelete, fmt.Sprintf("/api/v1/managers/customers/%d", other.ID), admin, nil, http.StatusNotFound)
+	items = make([]*managers.Customer, 0)
+	a.expectJSON(http.MethodGet, "/api/v1/managers/customers", admin, nil, &items)
+	if len(items) != 1 || items[0].ID != customer.ID {
+		t.Errorf("customers after remove: got %+v", items)
+	}
+}
+
+func TestRoutes_ManagerSuppliers(t *testing.T) {
+	a := newTestApp(t)
+	admin := a.adminToken()
+
+	product := &managers.Product{}
+	a.expectCreated("/api/v1/managers/products", admin, &managers.Product{Name: "Хлеб", Price: 5}, product)
+
+	supplier := &suppliers.Supplier{}
+	a.expectJSON(http.MethodPost, "/api/v1/managers/suppliers", admin, &suppliers.Supplier{Name: "Пекарня", Phone: "+992000000010"}, supplier)
+	supplier.Terms = "net 30"
+	a.expectJSON(http.MethodPost, "/api/v1/managers/suppliers", admin, supplier, supplier)
+	found := &suppliers.Supplier{}
+	a.expectJSON(http.MethodGet, fmt.Sprintf("/api/v1/managers/suppliers/%d", supplier.ID), admin, nil, found)
+	if found.Terms != "net 30" {
+		t.Errorf("supplier by id: got %+v", found)
+	}
+	items := make([]*suppliers.Supplier, 0)
+	a.expectJSON(http.MethodGet, "/api/v1/managers/suppliers", admin, nil, &items)
+	if len(items) != 1 {
+		t.Errorf("suppliers: got %+v", items)
+	}
+
+	for _, invalid := range []*suppliers.PurchaseOrder{
+		{SupplierID: supplier.ID},
+		{SupplierID: supplier.ID, Lines: []*suppliers.PurchaseOrderLine{{ProductID: product.ID, Price: 3}}},
+		{SupplierID: supplier.ID + 100, Lines: []*suppliers.PurchaseOrderLine{{ProductID: product.ID, Price: 3, Qty: 20}}},
+		{SupplierID: supplier.ID, Lines: []*suppliers.PurchaseOrderLine{{ProductID: product.ID + 100, Price: 3, Qty: 20}}},
+	} {
+		a.expectStatus(http.MethodPost, "/api/v1/managers/purchase-orders", admin, invalid, http.StatusBadRequest)
+	}
+
+	newOrder := &suppliers.PurchaseOrder{SupplierID: supplier.ID, Lines: []*suppliers.PurchaseOrderLine{{ProductID: product.ID, Price: 3, Qty: 20}}}
+	order := &suppliers.PurchaseOrder{}
+	a.expectJSON(http.MethodPost, "/api/v1/managers/purchase-orders", admin, newOrder, order)
+	if order.Status != suppliers.StatusDraft {
+		t.Errorf("create purchase order: got %+v", order)
+	}
+	orderPath := fmt.Sprintf("/api/v1/managers/purchase-orders/%d", order.ID)
+	a.expectJSON(http.MethodPost, orderPath+"/send", admin, nil, order)
+	subscription, _ := a.events.Subscribe(0, func(event *hub.Event) bool { return event.Type == managers.EventStockChanged })
+	defer subscription.Close()
+	a.expectJSON(http.MethodPost, orderPath+"/receive", admin, nil, order)
+	if order.Status != suppliers.StatusReceived {
+		t.Errorf("receive purchase order: got %+v", order)
+	}
+	// Событие публикуется до ответа, поэтому уже должно быть в канале подписки.
+	select {
+	case event := <-subscription.Events():
+		change, ok := event.Data.(*managers.StockChange)
+		if !ok || change.ProductID != product.ID || change.Qty != 20 {
+			t.Errorf("stock changed on receive: got %+v", event.Data)
+		}
+	default:
+		t.Error("stock changed on receive: no event")
+	}
+	message := &events.Message{}
+	err := a.pool.QueryRow(context.Background(), `
+	SELECT type, payload FROM outbox WHERE aggregate_type = $1 AND aggregate_id = $2 ORDER BY id DESC LIMIT 1
+	`, events.AggregateProduct, product.ID).Scan(&message.Type, &message.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := events.Decode(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, ok := event.(*events.ProductChanged); !ok || changed.Change != events.ProductReceived || changed.Qty != 20 {
+		t.Errorf("outbox event on receive: got %+v", event)
+	}
+	a.expectStatus(http.MethodPost, orderPath+"/cancel", admin, nil, http.StatusConflict)
+
+	cancelled := &suppliers.PurchaseOrder{}
+	a.expectJSON(http.MethodPost, "/api/v1/managers/purchase-orders", admin, newOrder, cancelled)
+	a.expectJSON(http.MethodPost, fmt.Sprintf("/api/v1/managers/purchase-orders/%d/cancel", cancelled.ID), admin, nil, cancelled)
+	if cancelled.Status != suppliers.StatusCancelled {
+		t.Errorf("cancel purchase order: got %+v", cancelled)
+	}
+
+	received := &suppliers.PurchaseOrder{}
+	a.expectJSON(http.MethodGet, orderPath, admin, nil, received)
+	if len(received.Lines) != 1 || received.Lines[0].ReceivedQty != 20 {
+		t.Errorf("purchase order by id: got %+v", received)
+	}
+	orders := make([]*suppliers.PurchaseOrder, 0)
+	a.expectJSON(http.MethodGet, "/api/v1/managers/purchase-orders", admin, nil, &orders)
+	if len(orders) != 2 {
+		t.Errorf("purchase orders: got %+v", orders)
+	}
+
+	products := make([]*managers.Product, 0)
+	a.expectJSON(http.MethodGet, "/api/v1/managers/products", admin, nil, &products)
+	if len(products) != 1 || products[0].Qty != 20 {
+		t.Errorf("products after receive: got %+v", products)
+	}
+}
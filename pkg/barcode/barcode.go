@@ -0,0 +1,42 @@
+// Package barcode проверяет штрихкоды EAN-13 и UPC-A.
+package barcode
+
+import "errors"
+
+// ErrInvalidFormat возвращается, когда штрихкод не является EAN-13 или UPC-A.
+var ErrInvalidFormat = errors.New("invalid barcode format")
+
+// ErrInvalidChecksum возвращается, когда не совпадает контрольная цифра.
+var ErrInvalidChecksum = errors.New("invalid barcode checksum")
+
+// Normalize проверяет штрихкод и приводит его к 13-значному виду EAN-13.
+// UPC-A (12 цифр) дополняется ведущим нулём, поэтому один и тот же товар
+// находится независимо от того, как его считал сканер.
+func Normalize(code string) (string, error) {
+	if len(code) != 12 && len(code) != 13 {
+		return "", ErrInvalidFormat
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return "", ErrInvalidFormat
+		}
+	}
+	if len(code) == 12 {
+		code = "0" + code
+	}
+	if checkDigit(code[:12]) != code[12] {
+		return "", ErrInvalidChecksum
+	}
+	return code, nil
+}
+
+// checkDigit считает контрольную цифру GTIN: веса 3 и 1 чередуются справа налево.
+func checkDigit(digits string) byte {
+	sum := 0
+	weight := 3
+	for i := len(digits) - 1; i >= 0; i-- {
+		sum += int(digits[i]-'0') * weight
+		weight = 4 - weight
+	}
+	return byte('0' + (10-sum%10)%10)
+}
@@ -0,0 +1,98 @@
+// Package certreload подгружает TLS-сертификат заново, когда файлы на диске изменились.
+package certreload
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// checkInterval - как часто GetCertificate проверяет время изменения файлов.
+const checkInterval = 10 * time.Second
+
+// Reloader хранит текущий сертификат и перечитывает его при изменении файлов или вызове Reload.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	logger   *zap.Logger
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modified time.Time
+	checked  time.Time
+}
+
+// New загружает сертификат и ключ из файлов.
+func New(certFile string, keyFile string, logger *zap.Logger) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	err := r.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload перечитывает сертификат; при ошибке продолжает использоваться предыдущий.
+func (r *Reloader) Reload() error {
+	modified, err := r.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modified = modified
+	r.checked = time.Now()
+	return nil
+}
+
+// GetCertificate предназначен для tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	cert, modified, checked := r.cert, r.modified, r.checked
+	r.mu.RUnlock()
+
+	if time.Since(checked) < checkInterval {
+		return cert, nil
+	}
+
+	r.mu.Lock()
+	r.checked = time.Now()
+	r.mu.Unlock()
+
+	current, err := r.lastModified()
+	if err != nil || !current.After(modified) {
+		return cert, nil
+	}
+	err = r.Reload()
+	if err != nil {
+		r.logger.Error("can't reload certificate", zap.Error(err))
+		return cert, nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *Reloader) lastModified() (time.Time, error) {
+	var modified time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+	}
+	return modified, nil
+}
@@ -0,0 +1,574 @@
+// Package config загружает настройки приложения.
+//
+// Источники применяются в порядке возрастания приоритета:
+// значения по умолчанию, файл (YAML или TOML), переменные окружения CRUD_*, флаги командной строки.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+)
+
+// EnvPrefix - префикс переменных окружения, например CRUD_DSN.
+const EnvPrefix = "CRUD_"
+
+// ErrUnknownFormat возвращается, когда расширение файла конфигурации не поддерживается.
+var ErrUnknownFormat = errors.New("unknown config file format")
+
+// Config содержит все настройки приложения.
+type Config struct {
+	Server      Server      `yaml:"server" toml:"server"`
+	Database    Database    `yaml:"database" toml:"database"`
+	Auth        Auth        `yaml:"auth" toml:"auth"`
+	Log         Log         `yaml:"log" toml:"log"`
+	Tracing     Tracing     `yaml:"tracing" toml:"tracing"`
+	Idempotency Idempotency `yaml:"idempotency" toml:"idempotency"`
+	GraphQL     GraphQL     `yaml:"graphql" toml:"graphql"`
+	Events      Events      `yaml:"events" toml:"events"`
+	Webhooks    Webhooks    `yaml:"webhooks" toml:"webhooks"`
+	Relay       Relay       `yaml:"relay" toml:"relay"`
+}
+
+// Server - настройки HTTP- и gRPC-сервера.
+type Server struct {
+	Addr              string   `yaml:"addr" toml:"addr"`
+	ReadTimeout       Duration `yaml:"read_timeout" toml:"read_timeout"`
+	ReadHeaderTimeout Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	WriteTimeout      Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	ShutdownTimeout   Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	MaxHeaderBytes    int      `yaml:"max_header_bytes" toml:"max_header_bytes"`
+	MaxBodyBytes      int      `yaml:"max_body_bytes" toml:"max_body_bytes"`
+	TLSCert           string   `yaml:"tls_cert" toml:"tls_cert"`
+	TLSKey            string   `yaml:"tls_key" toml:"tls_key"`
+	// GRPCAddr - адрес gRPC API; пустой адрес отключает его. TLS настраивается так же, как у HTTP.
+	GRPCAddr string `yaml:"grpc_addr" toml:"grpc_addr"`
+}
+
+// Database - настройки подключения к PostgreSQL.
+type Database struct {
+	DSN            string   `yaml:"dsn" toml:"dsn"`
+	MaxConns       int      `yaml:"max_conns" toml:"max_conns"`
+	MinConns       int      `yaml:"min_conns" toml:"min_conns"`
+	ConnectTimeout Duration `yaml:"connect_timeout" toml:"connect_timeout"`
+}
+
+// Auth - настройки аутентификации.
+type Auth struct {
+	TokenTTL   Duration `yaml:"token_ttl" toml:"token_ttl"`
+	BcryptCost int      `yaml:"bcrypt_cost" toml:"bcrypt_cost"`
+}
+
+// Log - настройки логирования.
+type Log struct {
+	Level  string `yaml:"level" toml:"level"`
+	Format string `yaml:"format" toml:"format"`
+}
+
+// Tracing - настройки экспорта трассировок OpenTelemetry.
+type Tracing struct {
+	// Exporter: none, otlp (OTLP/HTTP) или stdout (в файл File или стандартный вывод).
+	Exporter    string  `yaml:"exporter" toml:"exporter"`
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint"`
+	Insecure    bool    `yaml:"insecure" toml:"insecure"`
+	File        string  `yaml:"file" toml:"file"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+}
+
+// Idempotency - настройки ключей Idempotency-Key.
+type Idempotency struct {
+	// Retention - сколько хранится ответ на запрос с ключом; повтор после этого срока выполняется заново.
+	Retention Duration `yaml:"retention" toml:"retention"`
+	// Lease - сколько ключ считается занятым выполняющимся запросом. Если процесс упал, не сохранив ответ,
+	// после этого срока запрос с тем же ключом выполняется заново. 0 - см. IdempotencyLease.
+	Lease Duration `yaml:"lease" toml:"lease"`
+}
+
+// GraphQL - ограничения запросов к /graphql.
+type GraphQL struct {
+	// MaxDepth - наибольшая вложенность полей запроса.
+	MaxDepth int `yaml:"max_depth" toml:"max_depth"`
+	// MaxComplexity - наибольшая сложность запроса: каждое поле стоит 1, поля списков умножают
+	// стоимость вложенных полей на аргумент limit или на размер списка по умолчанию.
+	MaxComplexity int `yaml:"max_complexity" toml:"max_complexity"`
+}
+
+// Events - настройки потока событий /api/managers/events.
+type Events struct {
+	// History - сколько последних событий хранится для возобновления потока по Last-Event-ID.
+	History int `yaml:"history" toml:"history"`
+	// Heartbeat - как часто в поток отправляется пустое сообщение, чтобы прокси не закрывали соединение.
+	Heartbeat Duration `yaml:"heartbeat" toml:"heartbeat"`
+	// StreamTimeout - сколько длится один ответ Server-Sent Events; затем клиент переподключается
+	// с Last-Event-ID. Должен быть меньше write-timeout, иначе сервер оборвёт ответ сам.
+	StreamTimeout Duration `yaml:"stream_timeout" toml:"stream_timeout"`
+}
+
+// Webhooks - настройки доставки вебхуков.
+type Webhooks struct {
+	// Interval - как часто проверяются новые события и доставки, время повтора которых наступило.
+	Interval Duration `yaml:"interval" toml:"interval"`
+	// Timeout - сколько ждать ответа подписчика.
+	Timeout Duration `yaml:"timeout" toml:"timeout"`
+	// MaxAttempts - после стольких неудачных попыток доставка больше не повторяется.
+	MaxAttempts int `yaml:"max_attempts" toml:"max_attempts"`
+	// Backoff - пауза после первой неудачной попытки; каждая следующая вдвое больше, но не больше MaxBackoff.
+	Backoff    Duration `yaml:"backoff" toml:"backoff"`
+	MaxBackoff Duration `yaml:"max_backoff" toml:"max_backoff"`
+}
+
+// Relay - настройки публикации доменных событий из outbox.
+type Relay struct {
+	// Interval - как часто проверяются новые события.
+	Interval Duration `yaml:"interval" toml:"interval"`
+	// BatchSize - сколько событий публикуется за один проход.
+	BatchSize int `yaml:"batch_size" toml:"batch_size"`
+	// Publishers - издатели через запятую: log (журнал приложения), file (файл File, JSON на строку).
+	// Пустое значение отключает публикацию.
+	Publishers string `yaml:"publishers" toml:"publishers"`
+	File       string `yaml:"file" toml:"file"`
+	// Retention - сколько хранятся опубликованные (без издателей - любые) и разосланные вебхукам события
+	// вместе с журналом их доставок.
+	Retention Duration `yaml:"retention" toml:"retention"`
+}
+
+// Duration - time.Duration, который читается из строки вида "5s" или "1h30m".
+type Duration time.Duration
+
+// UnmarshalText разбирает длительность в формате time.ParseDuration.
+func (d *Duration) UnmarshalText(text []byte) error {
+	value, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(value)
+	return nil
+}
+
+// UnmarshalYAML разбирает длительность из YAML-строки.
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var text string
+	err := unmarshal(&text)
+	if err != nil {
+		return err
+	}
+	return d.UnmarshalText([]byte(text))
+}
+
+// Duration возвращает значение как time.Duration.
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Default возвращает настройки по умолчанию. Пароль к базе в них не задан:
+// его нужно передать через файл, CRUD_DSN или стандартную переменную PGPASSWORD.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Addr:              "0.0.0.0:9999",
+			ReadTimeout:       Duration(15 * time.Second),
+			ReadHeaderTimeout: Duration(5 * time.Second),
+			WriteTimeout:      Duration(15 * time.Second),
+			IdleTimeout:       Duration(60 * time.Second),
+			ShutdownTimeout:   Duration(20 * time.Second),
+			MaxHeaderBytes:    1 << 16,
+			MaxBodyBytes:      1 << 20,
+		},
+		Database: Database{
+			DSN:            "postgres://app@localhost:5432/db",
+			MaxConns:       10,
+			MinConns:       0,
+			ConnectTimeout: Duration(5 * time.Second),
+		},
+		Auth: Auth{
+			TokenTTL:   Duration(time.Hour),
+			BcryptCost: bcrypt.DefaultCost,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			Endpoint:    "localhost:4318",
+			SampleRatio: 1,
+		},
+		Idempotency: Idempotency{
+			Retention: Duration(24 * time.Hour),
+		},
+		GraphQL: GraphQL{
+			MaxDepth:      10,
+			MaxComplexity: 50000,
+		},
+		Events: Events{
+			History:       1000,
+			Heartbeat:     Duration(5 * time.Second),
+			StreamTimeout: Duration(10 * time.Second),
+		},
+		Webhooks: Webhooks{
+			Interval:    Duration(5 * time.Second),
+			Timeout:     Duration(10 * time.Second),
+			MaxAttempts: 10,
+			Backoff:     Duration(30 * time.Second),
+			MaxBackoff:  Duration(time.Hour),
+		},
+		Relay: Relay{
+			Interval:   Duration(time.Second),
+			BatchSize:  100,
+			Publishers: "log",
+			Retention:  Duration(7 * 24 * time.Hour),
+		},
+	}
+}
+
+// binding связывает флаг и переменную окружения с полем конфигурации.
+type binding struct {
+	name  string
+	usage string
+	set   func(value string) error
+}
+
+// env возвращает имя переменной окружения для флага, например db-max-conns -> CRUD_DB_MAX_CONNS.
+func (b *binding) env() string {
+	return EnvPrefix + strings.ToUpper(strings.Replace(b.name, "-", "_", -1))
+}
+
+func (c *Config) bindings() []*binding {
+	return []*binding{
+		{"addr", "listen address (host:port)", stringSetter(&c.Server.Addr)},
+		{"read-timeout", "HTTP read timeout", durationSetter(&c.Server.ReadTimeout)},
+		{"write-timeout", "HTTP write timeout", durationSetter(&c.Server.WriteTimeout)},
+		{"read-header-timeout", "HTTP read header timeout", durationSetter(&c.Server.ReadHeaderTimeout)},
+		{"idle-timeout", "HTTP idle timeout", durationSetter(&c.Server.IdleTimeout)},
+		{"shutdown-timeout", "time to drain in-flight requests on shutdown", durationSetter(&c.Server.ShutdownTimeout)},
+		{"max-header-bytes", "maximum size of request headers", intSetter(&c.Server.MaxHeaderBytes)},
+		{"max-body-bytes", "maximum size of request body", intSetter(&c.Server.MaxBodyBytes)},
+		{"tls-cert", "TLS certificate file (enables HTTPS)", stringSetter(&c.Server.TLSCert)},
+		{"tls-key", "TLS private key file", stringSetter(&c.Server.TLSKey)},
+		{"grpc-addr", "gRPC listen address (host:port), empty to disable", stringSetter(&c.Server.GRPCAddr)},
+		{"dsn", "PostgreSQL connection string", stringSetter(&c.Database.DSN)},
+		{"db-max-conns", "maximum number of pool connections", intSetter(&c.Database.MaxConns)},
+		{"db-min-conns", "minimum number of pool connections", intSetter(&c.Database.MinConns)},
+		{"db-connect-timeout", "database connect timeout", durationSetter(&c.Database.ConnectTimeout)},
+		{"token-ttl", "lifetime of issued tokens", durationSetter(&c.Auth.TokenTTL)},
+		{"bcrypt-cost", "bcrypt cost for password hashes", intSetter(&c.Auth.BcryptCost)},
+		{"log-level", "log level (debug, info, warn, error)", stringSetter(&c.Log.Level)},
+		{"log-format", "log format (json, console)", stringSetter(&c.Log.Format)},
+		{"tracing-exporter", "trace exporter (none, otlp, stdout)", stringSetter(&c.Tracing.Exporter)},
+		{"tracing-endpoint", "OTLP/HTTP collector endpoint (host:port)", stringSetter(&c.Tracing.Endpoint)},
+		{"tracing-insecure", "use plain HTTP for the OTLP endpoint", boolSetter(&c.Tracing.Insecure)},
+		{"tracing-file", "file for the stdout exporter (empty means standard output)", stringSetter(&c.Tracing.File)},
+		{"tracing-sample-ratio", "fraction of traces to sample (0..1)", floatSetter(&c.Tracing.SampleRatio)},
+		{"idempotency-retention", "how long responses to requests with Idempotency-Key are kept", durationSetter(&c.Idempotency.Retention)},
+		{"idempotency-lease", "how long a key stays reserved by a request that has not completed, 0 for write-timeout plus db-connect-timeout", durationSetter(&c.Idempotency.Lease)},
+		{"graphql-max-depth", "maximum nesting of fields in a GraphQL query", intSetter(&c.GraphQL.MaxDepth)},
+		{"graphql-max-complexity", "maximum complexity of a GraphQL query", intSetter(&c.GraphQL.MaxComplexity)},
+		{"events-history", "number of recent events kept to resume the event stream", intSetter(&c.Events.History)},
+		{"events-heartbeat", "interval of keep-alive messages in the event stream", durationSetter(&c.Events.Heartbeat)},
+		{"events-stream-timeout", "duration of one Server-Sent Events response", durationSetter(&c.Events.StreamTimeout)},
+		{"webhooks-interval", "how often new events and due webhook deliveries are processed", durationSetter(&c.Webhooks.Interval)},
+		{"webhooks-timeout", "timeout of one webhook request", durationSetter(&c.Webhooks.Timeout)},
+		{"webhooks-max-attempts", "number of attempts before a webhook delivery fails", intSetter(&c.Webhooks.MaxAttempts)},
+		{"webhooks-backoff", "delay after the first failed webhook attempt, doubled after each next one", durationSetter(&c.Webhooks.Backoff)},
+		{"webhooks-max-backoff", "maximum delay between webhook attempts", durationSetter(&c.Webhooks.MaxBackoff)},
+		{"relay-interval", "how often new domain events are published", durationSetter(&c.Relay.Interval)},
+		{"relay-batch-size", "number of domain events published in one pass", intSetter(&c.Relay.BatchSize)},
+		{"relay-publishers", "comma-separated domain event publishers (log, file), empty to disable", stringSetter(&c.Relay.Publishers)},
+		{"relay-file", "file for the file publisher", stringSetter(&c.Relay.File)},
+		{"relay-retention", "how long published and dispatched events are kept in the outbox", durationSetter(&c.Relay.Retention)},
+	}
+}
+
+func stringSetter(target *string) func(string) error {
+	return func(value string) error {
+		*target = value
+		return nil
+	}
+}
+
+func intSetter(target *int) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+func boolSetter(target *bool) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+func floatSetter(target *float64) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+func durationSetter(target *Duration) func(string) error {
+	return func(value string) error {
+		return target.UnmarshalText([]byte(value))
+	}
+}
+
+// Load собирает конфигурацию из всех источников и проверяет её.
+// Путь к файлу задаётся флагом -config или переменной CRUD_CONFIG.
+// Аргументы после флагов (например, подкоманда) возвращаются вторым значением.
+func Load(name string, args []string) (*Config, []string, error) {
+	cfg := Default()
+	bindings := cfg.bindings()
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	path := fs.String("config", os.Getenv(EnvPrefix+"CONFIG"), "path to YAML or TOML config file")
+	for _, b := range bindings {
+		fs.String(b.name, "", b.usage+" (env "+b.env()+")")
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if *path != "" {
+		err = cfg.loadFile(*path)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, b := range bindings {
+		value, ok := os.LookupEnv(b.env())
+		if !ok {
+			continue
+		}
+		err = b.set(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", b.env(), err)
+		}
+	}
+
+	byName := make(map[string]*binding, len(bindings))
+	for _, b := range bindings {
+		byName[b.name] = b
+	}
+	fs.Visit(func(f *flag.Flag) {
+		b, ok := byName[f.Name]
+		if !ok || err != nil {
+			return
+		}
+		err = b.set(f.Value.String())
+		if err != nil {
+			err = fmt.Errorf("-%s: %w", f.Name, err)
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, c)
+	case ".toml":
+		_, err = toml.Decode(string(data), c)
+	default:
+		return ErrUnknownFormat
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate проверяет согласованность настроек.
+func (c *Config) Validate() error {
+	err := validateAddr("addr", c.Server.Addr)
+	if err != nil {
+		return err
+	}
+	if c.Server.GRPCAddr != "" {
+		err = validateAddr("grpc-addr", c.Server.GRPCAddr)
+		if err != nil {
+			return err
+		}
+		if c.Server.GRPCAddr == c.Server.Addr {
+			return errors.New("grpc-addr must differ from addr")
+		}
+	}
+	if c.Server.ReadTimeout < 0 || c.Server.ReadHeaderTimeout < 0 || c.Server.WriteTimeout < 0 || c.Server.IdleTimeout < 0 {
+		return errors.New("server timeouts must not be negative")
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		return errors.New("shutdown-timeout must be positive")
+	}
+	if c.Server.MaxHeaderBytes <= 0 || c.Server.MaxBodyBytes <= 0 {
+		return errors.New("max-header-bytes and max-body-bytes must be positive")
+	}
+	if (c.Server.TLSCert == "") != (c.Server.TLSKey == "") {
+		return errors.New("tls-cert and tls-key must be set together")
+	}
+
+	if c.Database.DSN == "" {
+		return errors.New("dsn is required")
+	}
+	if c.Database.MaxConns < 1 {
+		return errors.New("db-max-conns must be positive")
+	}
+	if c.Database.MinConns < 0 || c.Database.MinConns > c.Database.MaxConns {
+		return errors.New("db-min-conns must be between 0 and db-max-conns")
+	}
+	if c.Database.ConnectTimeout <= 0 {
+		return errors.New("db-connect-timeout must be positive")
+	}
+
+	if c.Auth.TokenTTL <= 0 {
+		return errors.New("token-ttl must be positive")
+	}
+	if c.Auth.BcryptCost < bcrypt.MinCost || c.Auth.BcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt-cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("log-level: unknown level %q", c.Log.Level)
+	}
+	switch c.Log.Format {
+	case "json", "console":
+	default:
+		return fmt.Errorf("log-format: unknown format %q", c.Log.Format)
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "otlp":
+		if c.Tracing.Endpoint == "" {
+			return errors.New("tracing-endpoint is required for the otlp exporter")
+		}
+	default:
+		return fmt.Errorf("tracing-exporter: unknown exporter %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return errors.New("tracing-sample-ratio must be between 0 and 1")
+	}
+
+	if c.Idempotency.Retention <= 0 {
+		return errors.New("idempotency-retention must be positive")
+	}
+	if c.Idempotency.Lease < 0 || c.IdempotencyLease() > c.Idempotency.Retention.Duration() {
+		return errors.New("idempotency-lease must not be negative or longer than idempotency-retention")
+	}
+	if c.IdempotencyLease() <= 0 {
+		return errors.New("idempotency-lease is required when write-timeout is 0")
+	}
+
+	if c.GraphQL.MaxDepth <= 0 || c.GraphQL.MaxComplexity <= 0 {
+		return errors.New("graphql-max-depth and graphql-max-complexity must be positive")
+	}
+
+	if c.Events.History <= 0 {
+		return errors.New("events-history must be positive")
+	}
+	if c.Events.Heartbeat <= 0 || c.Events.StreamTimeout <= 0 {
+		return errors.New("events-heartbeat and events-stream-timeout must be positive")
+	}
+	if c.Server.WriteTimeout > 0 && c.Events.StreamTimeout >= c.Server.WriteTimeout {
+		return errors.New("events-stream-timeout must be less than write-timeout")
+	}
+
+	if c.Webhooks.Interval <= 0 || c.Webhooks.Timeout <= 0 {
+		return errors.New("webhooks-interval and webhooks-timeout must be positive")
+	}
+	if c.Webhooks.MaxAttempts <= 0 {
+		return errors.New("webhooks-max-attempts must be positive")
+	}
+	if c.Webhooks.Backoff <= 0 || c.Webhooks.MaxBackoff < c.Webhooks.Backoff {
+		return errors.New("webhooks-backoff must be positive and not greater than webhooks-max-backoff")
+	}
+
+	if c.Relay.Interval <= 0 || c.Relay.BatchSize <= 0 {
+		return errors.New("relay-interval and relay-batch-size must be positive")
+	}
+	if c.Relay.Retention <= 0 {
+		return errors.New("relay-retention must be positive")
+	}
+	for _, name := range strings.Split(c.Relay.Publishers, ",") {
+		switch strings.TrimSpace(name) {
+		case "", "log":
+		case "file":
+			if c.Relay.File == "" {
+				return errors.New("relay-file is required for the file publisher")
+			}
+		default:
+			return fmt.Errorf("relay-publishers: unknown publisher %q", name)
+		}
+	}
+	return nil
+}
+
+// IdempotencyLease возвращает Idempotency.Lease, а если он не задан - время, за которое HTTP-запрос
+// гарантированно завершается: write-timeout и ожидание соединения с базой. При write-timeout 0 запрос
+// не ограничен, и lease нужно задать явно.
+func (c *Config) IdempotencyLease() time.Duration {
+	if c.Idempotency.Lease > 0 {
+		return c.Idempotency.Lease.Duration()
+	}
+	if c.Server.WriteTimeout <= 0 {
+		return 0
+	}
+	return c.Server.WriteTimeout.Duration() + c.Database.ConnectTimeout.Duration()
+}
+
+// validateAddr проверяет, что addr - адрес вида host:port с допустимым портом.
+func validateAddr(name string, addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	number, err := strconv.Atoi(port)
+	if err != nil || number < 1 || number > 65535 {
+		return fmt.Errorf("%s: invalid port %q", name, port)
+	}
+	return nil
+}
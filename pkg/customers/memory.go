@@ -0,0 +1,263 @@
+package customers
+
+import (
+	"context"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/shohinsherov/crud/pkg/events"
+	"github.com/shohinsherov/crud/pkg/memstore"
+	"github.com/shohinsherov/crud/pkg/outbox"
+)
+
+// MemoryRepo - реализация Repository поверх хранилища в памяти.
+type MemoryRepo struct {
+	store *memstore.Store
+}
+
+// NewMemoryRepo создаёт репозиторий поверх store.
+func NewMemoryRepo(store *memstore.Store) *MemoryRepo {
+	return &MemoryRepo{store: store}
+}
+
+func (r *MemoryRepo) ByID(ctx context.Context, id int64) (item *Customer, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		record, ok := d.Customers[id]
+		if !ok {
+			return ErrNotFound
+		}
+		item = customerFrom(record)
+		return nil
+	})
+	return item, err
+}
+
+func (r *MemoryRepo) All(ctx context.Context, activeOnly bool) (items []*Customer, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		items = make([]*Customer, 0)
+		for _, record := range d.SortedCustomers() {
+			if record.Active || !activeOnly {
+				items = append(items, customerFrom(record))
+			}
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (r *MemoryRepo) Create(ctx context.Context, item *Registration, hash string) (customer *Customer, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		if d.CustomerByPhone(item.Phone) != nil {
+			return ErrPhoneUsed
+		}
+		record := &memstore.Customer{
+			ID:       d.NextID(),
+			Name:     item.Name,
+			Phone:    item.Phone,
+			Password: hash,
+			Active:   true,
+			Version:  1,
+			Created:  d.Now(),
+		}
+		d.Customers[record.ID] = record
+		customer = customerFrom(record)
+		return outbox.Add(d, events.NewCustomerRegistered(customer.ID, customer.Name, customer.Phone, customer.Active, customer.Created))
+	})
+	return customer, err
+}
+
+func (r *MemoryRepo) Update(ctx context.Context, item *Customer) (customer *Customer, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		record, ok := d.Customers[item.ID]
+		if !ok {
+			return ErrNotFound
+		}
+		if other := d.CustomerByPhone(item.Phone); other != nil && other.ID != item.ID {
+			return ErrPhoneUsed
+		}
+		record.Name = item.Name
+		record.Phone = item.Phone
+		record.Touch()
+		customer = customerFrom(record)
+		return nil
+	})
+	return customer, err
+}
+
+func (r *MemoryRepo) Remove(ctx context.Context, id int64) (customer *Customer, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		record, ok := d.Customers[id]
+		if !ok {
+			return ErrNotFound
+		}
+		delete(d.Customers, id)
+		customer = customerFrom(record)
+		return nil
+	})
+	return customer, err
+}
+
+func (r *MemoryRepo) SetActive(ctx context.Context, id int64, active bool) (customer *Customer, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		record, ok := d.Customers[id]
+		if !ok {
+			return ErrNotFound
+		}
+		changed := record.Active != active
+		record.Active = active
+		record.Touch()
+		customer = customerFrom(record)
+		if !changed {
+			return nil
+		}
+		return outbox.Add(d, events.NewCustomerActiveChanged(id, active))
+	})
+	return customer, err
+}
+
+func (r *MemoryRepo) Credentials(ctx context.Context, phone string) (id int64, hash string, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		record := d.CustomerByPhone(phone)
+		if record == nil || !record.Active {
+			return ErrNoSuchUser
+		}
+		id, hash = record.ID, record.Password
+		return nil
+	})
+	return id, hash, err
+}
+
+func (r *MemoryRepo) Products(ctx context.Context, filter *ProductFilter) (items []*Product, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		items = make([]*Product, 0)
+		for _, record := range d.FilterProducts(filter.CategoryID, filter.Attributes) {
+			if len(items) == 500 {
+				break
+			}
+			items = append(items, productFrom(d, record))
+		}
+		return nil
+	})
+	return items, err
+}
+
+// Search ищет все слова запроса в названии и SKU; рангом служит доля совпавших символов названия.
+func (r *MemoryRepo) Search(ctx context.Context, query *SearchQuery) (items []*SearchResult, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		items = make([]*SearchResult, 0)
+		for _, record := range d.SearchProducts(query.Query) {
+			if query.MinPrice != 0 && record.Price < query.MinPrice {
+				continue
+			}
+			if query.MaxPrice != 0 && record.Price > query.MaxPrice {
+				continue
+			}
+			if query.InStock && !d.InStock(record) {
+				continue
+			}
+			items = append(items, &SearchResult{
+				Product:   productFrom(d, record),
+				Rank:      float64(len(query.Query)) / float64(len(record.Name)+1),
+				Highlight: highlight(record.Name, query.Query),
+			})
+		}
+		if query.Offset >= len(items) {
+			items = items[:0]
+			return nil
+		}
+		items = items[query.Offset:]
+		if len(items) > query.Limit {
+			items = items[:query.Limit]
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (r *MemoryRepo) Categories(ctx context.Context) (items []*Category, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		items = make([]*Category, 0)
+		for _, record := range d.SortedCategories() {
+			items = append(items, &Category{ID: record.ID, Name: record.Name, ParentID: record.ParentID})
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (r *MemoryRepo) SaveToken(ctx context.Context, token string, customerID int64, ttl time.Duration) error {
+	return r.store.Tx(func(d *memstore.Data) error {
+		d.CustomerTokens[token] = &memstore.Token{Token: token, OwnerID: customerID, Expire: d.Now().Add(ttl)}
+		return nil
+	})
+}
+
+func (r *MemoryRepo) TokenOwner(ctx context.Context, token string) (id int64, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		record, ok := d.CustomerTokens[token]
+		if !ok || !record.Expire.After(d.Now()) {
+			return nil
+		}
+		customer, ok := d.Customers[record.OwnerID]
+		if ok && customer.Active {
+			id = customer.ID
+		}
+		return nil
+	})
+	return id, err
+}
+
+func (r *MemoryRepo) PurgeExpiredTokens(ctx context.Context) (n int64, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		for token, record := range d.CustomerTokens {
+			if !record.Expire.After(d.Now()) {
+				delete(d.CustomerTokens, token)
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+func customerFrom(record *memstore.Customer) *Customer {
+	return &Customer{
+		ID:      record.ID,
+		Name:    record.Name,
+		Phone:   record.Phone,
+		Active:  record.Active,
+		Created: record.Created,
+	}
+}
+
+func productFrom(d *memstore.Data, record *memstore.Product) *Product {
+	item := &Product{
+		ID:         record.ID,
+		Name:       record.Name,
+		Price:      record.Price,
+		Qty:        record.Qty,
+		CategoryID: record.CategoryID,
+		Attributes: memstore.CopyAttributes(record.Attributes),
+		Variants:   make([]*Variant, 0),
+	}
+	for _, variant := range d.ProductVariants(record.ID, true) {
+		item.Variants = append(item.Variants, &Variant{
+			ID:         variant.ID,
+			SKU:        variant.SKU,
+			Attributes: memstore.CopyAttributes(variant.Attributes),
+			Qty:        variant.Qty,
+		})
+	}
+	return item
+}
+
+// highlight выделяет первое вхождение запроса в названии так же, как ts_headline; остальной текст
+// экранируется, чтобы название товара не попало в HTML разметкой.
+func highlight(name string, query string) string {
+	i := strings.Index(strings.ToLower(name), strings.ToLower(query))
+	if i < 0 {
+		return html.EscapeString(name)
+	}
+	return html.EscapeString(name[:i]) + "<b>" + html.EscapeString(name[i:i+len(query)]) + "</b>" + html.EscapeString(name[i+len(query):])
+}
@@ -0,0 +1,349 @@
+package customers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shohinsherov/crud/pkg/events"
+	"github.com/shohinsherov/crud/pkg/outbox"
+)
+
+// PgxRepo - реализация Repository поверх Postgres.
+type PgxRepo struct {
+	pool *pgxpool.Pool
+}
+
+// NewPgxRepo создаёт репозиторий поверх пула соединений.
+func NewPgxRepo(pool *pgxpool.Pool) *PgxRepo {
+	return &PgxRepo{pool: pool}
+}
+
+func (r *PgxRepo) ByID(ctx context.Context, id int64) (*Customer, error) {
+	item := &Customer{}
+	err := r.pool.QueryRow(ctx, `
+	SELECT id,name, phone, active, created FROM customers WHERE id = $1
+	`, id).Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (r *PgxRepo) All(ctx context.Context, activeOnly bool) ([]*Customer, error) {
+	items := make([]*Customer, 0)
+	rows, err := r.pool.Query(ctx, `
+	SELECT id,name, phone, active, created FROM customers WHERE active OR NOT $1 ORDER BY id
+	`, activeOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Customer{}
+		err = rows.Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Created)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (r *PgxRepo) Create(ctx context.Context, item *Registration, hash string) (*Customer, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	customer := &Customer{}
+	err = tx.QueryRow(ctx, `
+	INSERT INTO customers(name,phone,password) VALUES ($1,$2,$3) ON CONFLICT (phone) DO NOTHING RETURNING id, name, phone, active, created;
+	`, item.Name, item.Phone, hash).Scan(&customer.ID, &customer.Name, &customer.Phone, &customer.Active, &customer.Created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPhoneUsed
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = outbox.Insert(ctx, tx, events.NewCustomerRegistered(customer.ID, customer.Name, customer.Phone, customer.Active, customer.Created))
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return customer, nil
+}
+
+func (r *PgxRepo) Update(ctx context.Context, item *Customer) (*Customer, error) {
+	customer := &Customer{
+		ID:    item.ID,
+		Name:  item.Name,
+		Phone: item.Phone,
+	}
+	err := r.pool.QueryRow(ctx, `
+	UPDATE customers SET name =$1,phone=$2 WHERE id =$3 RETURNING active,created
+	`, item.Name, item.Phone, item.ID).Scan(&customer.Active, &customer.Created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return customer, nil
+}
+
+func (r *PgxRepo) Remove(ctx context.Context, id int64) (*Customer, error) {
+	customer := &Customer{}
+	err := r.pool.QueryRow(ctx, `
+	DELETE FROM customers WHERE id= $1 RETURNING id,name,phone,active,created
+	`, id).Scan(&customer.ID, &customer.Name, &customer.Phone, &customer.Active, &customer.Created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return customer, nil
+}
+
+func (r *PgxRepo) SetActive(ctx context.Context, id int64, active bool) (*Customer, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	customer := &Customer{}
+	var wasActive bool
+	err = tx.QueryRow(ctx, `
+	UPDATE customers c SET active= $2 FROM (SELECT id, active FROM customers WHERE id= $1 FOR UPDATE) old
+	WHERE c.id = old.id RETURNING c.id,c.name,c.phone,c.active,c.created,old.active
+	`, id, active).Scan(&customer.ID, &customer.Name, &customer.Phone, &customer.Active, &customer.Created, &wasActive)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if wasActive != active {
+		err = outbox.Insert(ctx, tx, events.NewCustomerActiveChanged(id, active))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return customer, nil
+}
+
+func (r *PgxRepo) Credentials(ctx context.Context, phone string) (int64, string, error) {
+	var id int64
+	var hash string
+	err := r.pool.QueryRow(ctx, `SELECT id,password From customers WHERE phone = $1 AND active`, phone).Scan(&id, &hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, "", ErrNoSuchUser
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	return id, hash, nil
+}
+
+func (r *PgxRepo) Products(ctx context.Context, filter *ProductFilter) ([]*Product, error) {
+	items := make([]*Product, 0)
+	attributes := filter.Attributes
+	if attributes == nil {
+		attributes = map[string]string{}
+	}
+	rows, err := r.pool.Query(ctx, `
+		SELECT p.id, p.name, p.price, p.qty, COALESCE(p.category_id, 0), p.attributes FROM products p
+		WHERE p.active = TRUE
+		AND ($1::BIGINT = 0 OR p.category_id IN (
+			WITH RECURSIVE tree AS (
+				SELECT id FROM categories WHERE id = $1
+				UNION
+				SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+			)
+			SELECT id FROM tree
+		))
+		AND (p.attributes @> $2::JSONB OR EXISTS (
+			SELECT 1 FROM product_variants v WHERE v.product_id = p.id AND v.active AND (p.attributes || v.attributes) @> $2::JSONB
+		))
+		ORDER BY p.id LIMIT 500
+	`, filter.CategoryID, attributes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		item := &Product{}
+		err = rows.Scan(&item.ID, &item.Name, &item.Price, &item.Qty, &item.CategoryID, &item.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		ids = append(ids, item.ID)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	variants, err := r.variants(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		item.Variants = variants[item.ID]
+	}
+
+	return items, nil
+}
+
+// Search ищет товары по названию и SKU: сначала полнотекстово (русская и английская
+// морфология), а при опечатках - по триграммному сходству названия. Название экранируется
+// до ts_headline так же, как html.EscapeString, и в подсветке разметкой остаются только <b></b>.
+func (r *PgxRepo) Search(ctx context.Context, query *SearchQuery) ([]*SearchResult, error) {
+	items := make([]*SearchResult, 0)
+	rows, err := r.pool.Query(ctx, `
+		WITH q AS (
+			SELECT websearch_to_tsquery('russian', $1) || websearch_to_tsquery('english', $1) AS query
+		)
+		SELECT p.id, p.name, p.price, p.qty, COALESCE(p.category_id, 0), p.attributes,
+			(ts_rank(p.search, q.query) + similarity(p.name, $1))::FLOAT8 AS rank,
+			ts_headline('russian', replace(replace(replace(replace(replace(p.name,
+				'&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;'),
+				q.query, 'StartSel=<b>, StopSel=</b>, HighlightAll=true') AS highlight
+		FROM products p, q
+		WHERE p.active = TRUE
+		AND (p.search @@ q.query OR p.name % $1)
+		AND ($2::INTEGER = 0 OR p.price >= $2)
+		AND ($3::INTEGER = 0 OR p.price <= $3)
+		AND (NOT $4::BOOLEAN OR p.qty > 0 OR EXISTS (
+			SELECT 1 FROM product_variants v WHERE v.product_id = p.id AND v.active AND v.qty > 0
+		))
+		ORDER BY rank DESC, p.id
+		LIMIT $5 OFFSET $6
+	`, query.Query, query.MinPrice, query.MaxPrice, query.InStock, query.Limit, query.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		item := &SearchResult{Product: &Product{}}
+		err = rows.Scan(&item.ID, &item.Name, &item.Price, &item.Qty, &item.CategoryID, &item.Attributes, &item.Rank, &item.Highlight)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		ids = append(ids, item.ID)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	variants, err := r.variants(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		item.Variants = variants[item.ID]
+	}
+
+	return items, nil
+}
+
+func (r *PgxRepo) variants(ctx context.Context, productIDs []int64) (map[int64][]*Variant, error) {
+	items := make(map[int64][]*Variant, len(productIDs))
+	for _, id := range productIDs {
+		items[id] = make([]*Variant, 0)
+	}
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, product_id, sku, attributes, qty FROM product_variants WHERE product_id = ANY($1) AND active = TRUE ORDER BY id
+	`, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID int64
+		item := &Variant{}
+		err = rows.Scan(&item.ID, &productID, &item.SKU, &item.Attributes, &item.Qty)
+		if err != nil {
+			return nil, err
+		}
+		items[productID] = append(items[productID], item)
+	}
+	return items, rows.Err()
+}
+
+func (r *PgxRepo) Categories(ctx context.Context) ([]*Category, error) {
+	items := make([]*Category, 0)
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, name, COALESCE(parent_id, 0) FROM categories ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Category{}
+		err = rows.Scan(&item.ID, &item.Name, &item.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (r *PgxRepo) SaveToken(ctx context.Context, token string, customerID int64, ttl time.Duration) error {
+	_, err := r.pool.Exec(ctx, `INSERT INTO customers_tokens(token,customer_id,expire) VALUES($1,$2,CURRENT_TIMESTAMP + make_interval(secs => $3))`, token, customerID, ttl.Seconds())
+	return err
+}
+
+func (r *PgxRepo) TokenOwner(ctx context.Context, token string) (int64, error) {
+	var id int64
+	err := r.pool.QueryRow(ctx, `
+	SELECT t.customer_id FROM customers_tokens t JOIN customers c ON c.id = t.customer_id
+	WHERE t.token = $1 AND t.expire > CURRENT_TIMESTAMP AND c.active
+	`, token).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (r *PgxRepo) PurgeExpiredTokens(ctx context.Context) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM customers_tokens WHERE expire <= CURRENT_TIMESTAMP`)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,46 @@
+package customers
+
+import (
+	"context"
+	"time"
+)
+
+// CustomerRepo хранит покупателей и хеши их паролей.
+type CustomerRepo interface {
+	// ByID возвращает ErrNotFound, если покупателя нет.
+	ByID(ctx context.Context, id int64) (*Customer, error)
+	// All возвращает покупателей по возрастанию ID, при activeOnly - только активных.
+	All(ctx context.Context, activeOnly bool) ([]*Customer, error)
+	// Create возвращает ErrPhoneUsed, если телефон уже зарегистрирован.
+	Create(ctx context.Context, item *Registration, hash string) (*Customer, error)
+	Update(ctx context.Context, item *Customer) (*Customer, error)
+	Remove(ctx context.Context, id int64) (*Customer, error)
+	// SetActive блокирует или разблокирует покупателя; если состояние изменилось, в outbox пишется
+	// CustomerBlocked или CustomerUnblocked.
+	SetActive(ctx context.Context, id int64, active bool) (*Customer, error)
+	// Credentials возвращает ID и хеш пароля активного покупателя или ErrNoSuchUser.
+	Credentials(ctx context.Context, phone string) (int64, string, error)
+}
+
+// ProductRepo отдаёт покупателям каталог товаров.
+type ProductRepo interface {
+	// Products возвращает активные товары с активными вариантами.
+	Products(ctx context.Context, filter *ProductFilter) ([]*Product, error)
+	Search(ctx context.Context, query *SearchQuery) ([]*SearchResult, error)
+	Categories(ctx context.Context) ([]*Category, error)
+}
+
+// TokenRepo хранит токены покупателей.
+type TokenRepo interface {
+	SaveToken(ctx context.Context, token string, customerID int64, ttl time.Duration) error
+	// TokenOwner возвращает ID активного покупателя с действующим токеном или 0.
+	TokenOwner(ctx context.Context, token string) (int64, error)
+	PurgeExpiredTokens(ctx context.Context) (int64, error)
+}
+
+// Repository объединяет все хранилища, нужные сервису.
+type Repository interface {
+	CustomerRepo
+	ProductRepo
+	TokenRepo
+}
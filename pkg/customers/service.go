@@ -5,15 +5,18 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
-	"log"
-	"sync"
 	"time"
 
-	"github.com/jackc/pgx/v4"
-	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shohinsherov/crud/pkg/config"
+	"github.com/shohinsherov/crud/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// tracer создаёт спаны для методов сервиса.
+var tracer = otel.Tracer("github.com/shohinsherov/crud/pkg/customers")
+
 // ErrTokenNotFound ...
 var ErrTokenNotFound = errors.New("token not found")
 
@@ -37,14 +40,38 @@ var ErrTokenExpired = errors.New("token expired")
 
 // Service описывает сервис работы с покупателями.
 type Service struct {
-	pool  *pgxpool.Pool
-	mu    sync.RWMutex
-	items []*Customer
+	customers  CustomerRepo
+	products   ProductRepo
+	tokens     TokenRepo
+	logger     *zap.Logger
+	tokenTTL   time.Duration
+	bcryptCost int
 }
 
 // NewService создаёт сервис
-func NewService(pool *pgxpool.Pool) *Service {
-	return &Service{pool: pool}
+func NewService(repo Repository, auth *config.Auth, logger *zap.Logger) *Service {
+	return &Service{
+		customers:  repo,
+		products:   repo,
+		tokens:     repo,
+		logger:     logger,
+		tokenTTL:   auth.TokenTTL.Duration(),
+		bcryptCost: auth.BcryptCost,
+	}
+}
+
+// log возвращает логгер с идентификатором запроса из ctx.
+func (s *Service) log(ctx context.Context) *zap.Logger {
+	return logging.For(ctx, s.logger)
+}
+
+// fail возвращает ошибки хранилища, понятные клиентам, как есть, а остальные логирует и заменяет на ErrInternal.
+func (s *Service) fail(ctx context.Context, op string, err error) error {
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrPhoneUsed) || errors.Is(err, ErrNoSuchUser) {
+		return err
+	}
+	s.log(ctx).Error(op+" failed", zap.Error(err))
+	return ErrInternal
 }
 
 type Auth struct {
@@ -68,150 +95,143 @@ type Registration struct {
 }
 
 type Product struct {
-	ID    int64  `json:"id"`
-	Name  string `json:"name"`
-	Price int    `json:"price"`
-	Qty   int    `json:"qty`
+	ID         int64             `json:"id"`
+	Name       string            `json:"name"`
+	Price      int               `json:"price"`
+	Qty        int               `json:"qty"`
+	CategoryID int64             `json:"category_id"`
+	Attributes map[string]string `json:"attributes"`
+	Variants   []*Variant        `json:"variants"`
 }
 
-func (s *Service) ByID(ctx context.Context, id int64) (*Customer, error) {
-	item := &Customer{}
+// Variant - вариант товара (например, размер или цвет) со своим остатком.
+type Variant struct {
+	ID         int64             `json:"id"`
+	SKU        string            `json:"sku"`
+	Attributes map[string]string `json:"attributes"`
+	Qty        int               `json:"qty"`
+}
 
-	err := s.pool.QueryRow(ctx, `
-	SELECT id,name, phone, active, created FROM customers WHERE id = $1
-	`, id).Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Created)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
-	}
+// Category - категория товаров, ParentID равен 0 у корневых категорий.
+type Category struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	ParentID int64  `json:"parent_id"`
+}
+
+// SearchQuery описывает параметры полнотекстового поиска товаров.
+type SearchQuery struct {
+	Query    string
+	MinPrice int
+	MaxPrice int
+	InStock  bool
+	Limit    int
+	Offset   int
+}
+
+// SearchResult - найденный товар с релевантностью и подсвеченным названием. Highlight - HTML:
+// спецсимволы названия экранированы, совпадения обёрнуты в <b></b>.
+type SearchResult struct {
+	*Product
+	Rank      float64 `json:"rank"`
+	Highlight string  `json:"highlight"`
+}
 
+// ProductFilter ограничивает список товаров категорией (вместе с вложенными) и атрибутами.
+type ProductFilter struct {
+	CategoryID int64
+	Attributes map[string]string
+}
+
+func (s *Service) ByID(ctx context.Context, id int64) (*Customer, error) {
+	ctx, span := tracer.Start(ctx, "customers.ByID")
+	defer span.End()
+
+	item, err := s.customers.ByID(ctx, id)
 	if err != nil {
-		log.Print(err)
-		return nil, ErrInternal
+		return nil, s.fail(ctx, "by id", err)
 	}
-
 	return item, nil
 }
 
 func (s *Service) All(ctx context.Context) ([]*Customer, error) {
-	items := make([]*Customer, 0)
-	rows, err := s.pool.Query(ctx, `
-	SELECT id,name, phone, active, created FROM customers ORDER BY id
-	`)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
-	}
+	ctx, span := tracer.Start(ctx, "customers.All")
+	defer span.End()
 
+	items, err := s.customers.All(ctx, false)
 	if err != nil {
-		log.Print(err)
-		return nil, ErrInternal
-	}
-
-	for rows.Next() {
-		item := &Customer{}
-		rows.Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Created)
-		items = append(items, item)
+		return nil, s.fail(ctx, "all", err)
 	}
 	return items, nil
 }
 
 func (s *Service) AllActive(ctx context.Context) ([]*Customer, error) {
-	items := make([]*Customer, 0)
-	rows, err := s.pool.Query(ctx, `
-	SELECT id,name, phone, active, created FROM customers WHERE active= true ORDER BY id;
-	`)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
-	}
+	ctx, span := tracer.Start(ctx, "customers.AllActive")
+	defer span.End()
 
+	items, err := s.customers.All(ctx, true)
 	if err != nil {
-		log.Print(err)
-		return nil, ErrInternal
-	}
-
-	for rows.Next() {
-		item := &Customer{}
-		rows.Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Created)
-		items = append(items, item)
+		return nil, s.fail(ctx, "all active", err)
 	}
 	return items, nil
 }
 
 func (s *Service) Register(ctx context.Context, item *Registration) (*Customer, error) {
-	customer := &Customer{}
-	hash, err := bcrypt.GenerateFromPassword([]byte(item.Password), bcrypt.DefaultCost)
+	ctx, span := tracer.Start(ctx, "customers.Register")
+	defer span.End()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(item.Password), s.bcryptCost)
 	if err != nil {
-		log.Print(err)
+		s.log(ctx).Error("register failed", zap.Error(err))
 		return nil, ErrInternal
 	}
-	log.Print(hex.EncodeToString(hash))
-	err = s.pool.QueryRow(ctx, `
-	INSERT INTO customers(name,phone,password) VALUES ($1,$2,$3) ON CONFLICT (phone) DO NOTHING RETURNING id, name, phone, active, created;
-	`, item.Name, item.Phone, hash).Scan(&customer.ID, &customer.Name, &customer.Phone, &customer.Active, &customer.Created)
+	customer, err := s.customers.Create(ctx, item, string(hash))
 	if err != nil {
-		log.Print(err)
-		return nil, ErrInternal
+		return nil, s.fail(ctx, "register", err)
 	}
 	return customer, nil
 }
 
 func (s *Service) Update(ctx context.Context, item *Customer) (*Customer, error) {
-	customer := &Customer{
-		ID:    item.ID,
-		Name:  item.Name,
-		Phone: item.Phone,
-	}
+	ctx, span := tracer.Start(ctx, "customers.Update")
+	defer span.End()
 
-	err := s.pool.QueryRow(ctx, `
-	UPDATE customers SET name =$1,phone=$2 WHERE id =$3 RETURNING active,created
-	`, item.Name, item.Phone, item.ID).Scan(&customer.Active, &customer.Created)
+	customer, err := s.customers.Update(ctx, item)
 	if err != nil {
-		log.Print(err)
-		return nil, ErrInternal
+		return nil, s.fail(ctx, "update", err)
 	}
 	return customer, nil
 }
 
 func (s *Service) RemoveByID(ctx context.Context, id int64) (*Customer, error) {
-	customer := &Customer{}
-	err := s.pool.QueryRow(ctx, `
-	DELETE FROM customers WHERE id= $1 RETURNING id,name,phone,active,created
-	`, id).Scan(&customer.ID, &customer.Name, &customer.Phone, &customer.Active, &customer.Created)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
-	}
+	ctx, span := tracer.Start(ctx, "customers.RemoveByID")
+	defer span.End()
+
+	customer, err := s.customers.Remove(ctx, id)
 	if err != nil {
-		log.Print(err)
-		return nil, ErrInternal
+		return nil, s.fail(ctx, "remove by id", err)
 	}
 	return customer, nil
 }
 
 func (s *Service) BlockByID(ctx context.Context, id int64) (*Customer, error) {
-	customer := &Customer{}
-	err := s.pool.QueryRow(ctx, `
-	UPDATE customers SET active= false WHERE id= $1 RETURNING id,name,phone,active,created
-	`, id).Scan(&customer.ID, &customer.Name, &customer.Phone, &customer.Active, &customer.Created)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
-	}
+	ctx, span := tracer.Start(ctx, "customers.BlockByID")
+	defer span.End()
+
+	customer, err := s.customers.SetActive(ctx, id, false)
 	if err != nil {
-		log.Print(err)
-		return nil, ErrInternal
+		return nil, s.fail(ctx, "block by id", err)
 	}
 	return customer, nil
 }
 
 func (s *Service) UnBlockByID(ctx context.Context, id int64) (*Customer, error) {
-	customer := &Customer{}
-	err := s.pool.QueryRow(ctx, `
-	UPDATE customers SET active= true WHERE id= $1 RETURNING id,name,phone,active,created
-	`, id).Scan(&customer.ID, &customer.Name, &customer.Phone, &customer.Active, &customer.Created)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
-	}
+	ctx, span := tracer.Start(ctx, "customers.UnBlockByID")
+	defer span.End()
+
+	customer, err := s.customers.SetActive(ctx, id, true)
 	if err != nil {
-		log.Print(err)
-		return nil, ErrInternal
+		return nil, s.fail(ctx, "unblock by id", err)
 	}
 	return customer, nil
 }
@@ -220,15 +240,15 @@ func (s *Service) Token(
 	ctx context.Context,
 	phone string, password string,
 ) (token string, err error) {
-	var hash string
-	var id int64
-	err = s.pool.QueryRow(ctx, `SELECT id,password From customers WHERE phone = $1`, phone).Scan(&id, &hash)
+	ctx, span := tracer.Start(ctx, "customers.Token")
+	defer span.End()
 
-	if err == pgx.ErrNoRows {
+	id, hash, err := s.customers.Credentials(ctx, phone)
+	if errors.Is(err, ErrNoSuchUser) {
 		return "", ErrInvalidPassword
 	}
 	if err != nil {
-		return "", ErrInternal
+		return "", s.fail(ctx, "token", err)
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
@@ -242,57 +262,70 @@ func (s *Service) Token(
 	}
 
 	token = hex.EncodeToString(buffer)
-	_, err = s.pool.Exec(ctx, `INSERT INTO customers_tokens(token,customer_id) VALUES($1,$2)`, token, id)
+	err = s.tokens.SaveToken(ctx, token, id, s.tokenTTL)
 	if err != nil {
-		return "", ErrInternal
+		return "", s.fail(ctx, "token", err)
 	}
 
 	return token, nil
 }
 
-func (s *Service) Products(ctx context.Context) ([]*Product, error) {
-	items := make([]*Product, 0)
-	rows, err := s.pool.Query(ctx, `
-		SELECT id, name, price, qty FROM products WHERE active = TRUE ORDER BY id LIMIT 500
-	`)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return items, nil
-	}
+func (s *Service) Products(ctx context.Context, filter *ProductFilter) ([]*Product, error) {
+	ctx, span := tracer.Start(ctx, "customers.Products")
+	defer span.End()
+
+	items, err := s.products.Products(ctx, filter)
 	if err != nil {
-		return nil, ErrInternal
+		return nil, s.fail(ctx, "products", err)
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		item := &Product{}
-		err = rows.Scan(&item.ID, &item.Name, &item.Price, &item.Qty)
-		if err != nil {
-			log.Print(err)
-			return nil, err
-		}
-		items = append(items, item)
+	return items, nil
+}
+
+// Search ищет товары по названию и SKU с фильтрами по цене и наличию.
+func (s *Service) Search(ctx context.Context, query *SearchQuery) ([]*SearchResult, error) {
+	ctx, span := tracer.Start(ctx, "customers.Search")
+	defer span.End()
+
+	if query.Limit <= 0 || query.Limit > 100 {
+		query.Limit = 20
 	}
-	err = rows.Err()
+	items, err := s.products.Search(ctx, query)
 	if err != nil {
-		log.Print(err)
-		return nil, err
+		return nil, s.fail(ctx, "search", err)
 	}
+	return items, nil
+}
 
+func (s *Service) Categories(ctx context.Context) ([]*Category, error) {
+	ctx, span := tracer.Start(ctx, "customers.Categories")
+	defer span.End()
+
+	items, err := s.products.Categories(ctx)
+	if err != nil {
+		return nil, s.fail(ctx, "categories", err)
+	}
 	return items, nil
 }
 
 func (s *Service) IDByToken(ctx context.Context, token string) (int64, error) {
-	var id int64
-	err := s.pool.QueryRow(ctx, `
-	SELECT customer_id FROM customers_tokens WHERE token = $1
-	`, token).Scan(&id)
+	ctx, span := tracer.Start(ctx, "customers.IDByToken")
+	defer span.End()
 
-	if err == pgx.ErrNoRows {
-		return 0, nil
-	}
+	id, err := s.tokens.TokenOwner(ctx, token)
 	if err != nil {
-		return 0, ErrInternal
+		return 0, s.fail(ctx, "id by token", err)
 	}
-
 	return id, nil
 }
+
+// PurgeExpiredTokens удаляет истёкшие токены покупателей и возвращает их количество.
+func (s *Service) PurgeExpiredTokens(ctx context.Context) (int64, error) {
+	ctx, span := tracer.Start(ctx, "customers.PurgeExpiredTokens")
+	defer span.End()
+
+	n, err := s.tokens.PurgeExpiredTokens(ctx)
+	if err != nil {
+		return 0, s.fail(ctx, "purge expired tokens", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,212 @@
+package customers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shohinsherov/crud/pkg/config"
+	"github.com/shohinsherov/crud/pkg/memstore"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestService(t *testing.T) (*Service, *memstore.Store) {
+	t.Helper()
+	store := memstore.New()
+	auth := &config.Auth{TokenTTL: config.Duration(time.Hour), BcryptCost: bcrypt.MinCost}
+	return NewService(NewMemoryRepo(store), auth, zap.NewNop()), store
+}
+
+func register(t *testing.T, svc *Service, phone string, password string) *Customer {
+	t.Helper()
+	customer, err := svc.Register(context.Background(), &Registration{Name: "Customer " + phone, Phone: phone, Password: password})
+	if err != nil {
+		t.Fatalf("register %s: %v", phone, err)
+	}
+	return customer
+}
+
+func TestService_Register(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+
+	customer := register(t, svc, "+992000000001", "secret")
+	if customer.ID == 0 || !customer.Active || customer.Phone != "+992000000001" {
+		t.Fatalf("unexpected customer: %+v", customer)
+	}
+
+	_, err := svc.Register(ctx, &Registration{Name: "Other", Phone: "+992000000001", Password: "other"})
+	if !errors.Is(err, ErrPhoneUsed) {
+		t.Fatalf("register same phone: got %v, want %v", err, ErrPhoneUsed)
+	}
+
+	found, err := svc.ByID(ctx, customer.ID)
+	if err != nil {
+		t.Fatalf("by id: %v", err)
+	}
+	if found.Name != customer.Name {
+		t.Errorf("by id: got %q, want %q", found.Name, customer.Name)
+	}
+	_, err = svc.ByID(ctx, customer.ID+100)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("by unknown id: got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestService_Token(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+	customer := register(t, svc, "+992000000001", "secret")
+
+	token, err := svc.Token(ctx, customer.Phone, "secret")
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	id, err := svc.IDByToken(ctx, token)
+	if err != nil || id != customer.ID {
+		t.Fatalf("id by token: got %d, %v, want %d", id, err, customer.ID)
+	}
+
+	for name, login := range map[string]Auth{
+		"wrong password": {Login: customer.Phone, Password: "wrong"},
+		"unknown phone":  {Login: "+992999999999", Password: "secret"},
+	} {
+		_, err = svc.Token(ctx, login.Login, login.Password)
+		if !errors.Is(err, ErrInvalidPassword) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrInvalidPassword)
+		}
+	}
+
+	id, err = svc.IDByToken(ctx, "unknown")
+	if err != nil || id != 0 {
+		t.Errorf("id by unknown token: got %d, %v, want 0", id, err)
+	}
+}
+
+func TestService_BlockedCustomer(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+	customer := register(t, svc, "+992000000001", "secret")
+	token, err := svc.Token(ctx, customer.Phone, "secret")
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+
+	_, err = svc.BlockByID(ctx, customer.ID)
+	if err != nil {
+		t.Fatalf("block: %v", err)
+	}
+	id, err := svc.IDByToken(ctx, token)
+	if err != nil || id != 0 {
+		t.Errorf("id by token of blocked customer: got %d, %v, want 0", id, err)
+	}
+	_, err = svc.Token(ctx, customer.Phone, "secret")
+	if !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("token of blocked customer: got %v, want %v", err, ErrInvalidPassword)
+	}
+
+	active, err := svc.AllActive(ctx)
+	if err != nil || len(active) != 0 {
+		t.Errorf("all active: got %d, %v, want 0", len(active), err)
+	}
+
+	_, err = svc.UnBlockByID(ctx, customer.ID)
+	if err != nil {
+		t.Fatalf("unblock: %v", err)
+	}
+	id, err = svc.IDByToken(ctx, token)
+	if err != nil || id != customer.ID {
+		t.Errorf("id by token after unblock: got %d, %v, want %d", id, err, customer.ID)
+	}
+}
+
+func TestService_PurgeExpiredTokens(t *testing.T) {
+	svc, store := newTestService(t)
+	ctx := context.Background()
+	customer := register(t, svc, "+992000000001", "secret")
+	token, err := svc.Token(ctx, customer.Phone, "secret")
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+
+	store.SetClock(func() time.Time { return time.Now().Add(2 * time.Hour) })
+	id, err := svc.IDByToken(ctx, token)
+	if err != nil || id != 0 {
+		t.Errorf("id by expired token: got %d, %v, want 0", id, err)
+	}
+	n, err := svc.PurgeExpiredTokens(ctx)
+	if err != nil || n != 1 {
+		t.Errorf("purge: got %d, %v, want 1", n, err)
+	}
+}
+
+func TestService_Products(t *testing.T) {
+	svc, store := newTestService(t)
+	ctx := context.Background()
+	err := store.Tx(func(d *memstore.Data) error {
+		d.Categories[1] = &memstore.Category{ID: 1, Name: "Одежда"}
+		d.Categories[2] = &memstore.Category{ID: 2, Name: "Футболки", ParentID: 1}
+		d.Categories[3] = &memstore.Category{ID: 3, Name: "Еда"}
+		d.Products[10] = &memstore.Product{ID: 10, Name: "Футболка", Price: 100, CategoryID: 2, Attributes: map[string]string{"color": "red"}, Active: true}
+		d.Products[11] = &memstore.Product{ID: 11, Name: "Хлеб", Price: 5, Qty: 10, CategoryID: 3, Active: true}
+		d.Products[12] = &memstore.Product{ID: 12, Name: "Снятая футболка", Price: 100, CategoryID: 2, Active: false}
+		d.Variants[20] = &memstore.Variant{ID: 20, ProductID: 10, SKU: "TS-XL", Attributes: map[string]string{"size": "XL"}, Qty: 3, Active: true}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		filter *ProductFilter
+		want   []int64
+	}{
+		{"all", &ProductFilter{}, []int64{10, 11}},
+		{"parent category", &ProductFilter{CategoryID: 1}, []int64{10}},
+		{"product attribute", &ProductFilter{Attributes: map[string]string{"color": "red"}}, []int64{10}},
+		{"variant attribute", &ProductFilter{Attributes: map[string]string{"color": "red", "size": "XL"}}, []int64{10}},
+		{"no match", &ProductFilter{Attributes: map[string]string{"size": "S"}}, []int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := svc.Products(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("products: %v", err)
+			}
+			if len(items) != len(tt.want) {
+				t.Fatalf("products: got %d items, want %v", len(items), tt.want)
+			}
+			for i, item := range items {
+				if item.ID != tt.want[i] {
+					t.Errorf("products[%d]: got %d, want %d", i, item.ID, tt.want[i])
+				}
+			}
+		})
+	}
+
+	items, err := svc.Products(ctx, &ProductFilter{CategoryID: 2})
+	if err != nil || len(items) != 1 || len(items[0].Variants) != 1 || items[0].Variants[0].SKU != "TS-XL" {
+		t.Errorf("products with variants: got %+v, %v", items, err)
+	}
+
+	results, err := svc.Search(ctx, &SearchQuery{Query: "футболка", InStock: true})
+	if err != nil || len(results) != 1 || results[0].ID != 10 {
+		t.Errorf("search: got %+v, %v", results, err)
+	}
+
+	err = store.Tx(func(d *memstore.Data) error {
+		d.Products[13] = &memstore.Product{ID: 13, Name: "Хлеб <img src=x onerror=alert(1)>", Price: 5, Active: true}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err = svc.Search(ctx, &SearchQuery{Query: "onerror", Limit: 10})
+	want := "Хлеб &lt;img src=x <b>onerror</b>=alert(1)&gt;"
+	if err != nil || len(results) != 1 || results[0].Highlight != want {
+		t.Errorf("search with markup in name: got %+v, %v, want highlight %q", results, err, want)
+	}
+}
@@ -0,0 +1,168 @@
+// Package events описывает доменные события покупателей, товаров и продаж и рассылает их из outbox.
+// Репозитории пишут событие в outbox в той же транзакции, что и изменение (см. пакет outbox), а Relay
+// публикует сохранённые события в Publisher-ы: хотя бы один раз и по порядку внутри каждого агрегата.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Типы событий.
+const (
+	TypeCustomerRegistered = "customer.registered"
+	TypeCustomerBlocked    = "customer.blocked"
+	TypeCustomerUnblocked  = "customer.unblocked"
+	TypeProductChanged     = "product.changed"
+	TypeSaleCreated        = "sale.created"
+)
+
+// SchemaVersion - версия формата событий в outbox; меняется при несовместимом изменении их полей.
+// Версия 1 - payload до появления пакета: Sale для sale.created и Customer для customer.registered.
+const SchemaVersion = 2
+
+// Types - все типы событий.
+var Types = []string{TypeCustomerRegistered, TypeCustomerBlocked, TypeCustomerUnblocked, TypeProductChanged, TypeSaleCreated}
+
+// Типы агрегатов: порядок событий сохраняется внутри агрегата с одним типом и ID.
+const (
+	AggregateCustomer = "customer"
+	AggregateProduct  = "product"
+	AggregateSale     = "sale"
+)
+
+// Изменения товара в ProductChanged.
+const (
+	ProductCreated  = "created"
+	ProductUpdated  = "updated"
+	ProductRemoved  = "removed"
+	ProductPriced   = "price"
+	ProductReceived = "received"
+)
+
+// Event - доменное событие об изменении одного агрегата.
+type Event interface {
+	EventType() string
+	AggregateType() string
+	AggregateID() int64
+}
+
+// Message - событие, сохранённое в outbox; Payload - JSON самого события в формате версии Version.
+type Message struct {
+	ID            int64           `json:"id"`
+	Type          string          `json:"type"`
+	Version       int             `json:"version"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   int64           `json:"aggregate_id"`
+	Payload       json.RawMessage `json:"payload"`
+	Created       time.Time       `json:"created"`
+}
+
+// CustomerRegistered - покупатель зарегистрировался сам или его завёл менеджер.
+type CustomerRegistered struct {
+	ID      int64     `json:"id"`
+	Name    string    `json:"name"`
+	Phone   string    `json:"phone"`
+	Active  bool      `json:"active"`
+	Created time.Time `json:"created"`
+}
+
+func (e *CustomerRegistered) EventType() string     { return TypeCustomerRegistered }
+func (e *CustomerRegistered) AggregateType() string { return AggregateCustomer }
+func (e *CustomerRegistered) AggregateID() int64    { return e.ID }
+
+// NewCustomerRegistered возвращает событие о регистрации покупателя.
+func NewCustomerRegistered(id int64, name string, phone string, active bool, created time.Time) *CustomerRegistered {
+	return &CustomerRegistered{ID: id, Name: name, Phone: phone, Active: active, Created: created}
+}
+
+// CustomerBlocked - покупатель заблокирован: он не может войти, а его токены не действуют.
+type CustomerBlocked struct {
+	ID int64 `json:"id"`
+}
+
+func (e *CustomerBlocked) EventType() string     { return TypeCustomerBlocked }
+func (e *CustomerBlocked) AggregateType() string { return AggregateCustomer }
+func (e *CustomerBlocked) AggregateID() int64    { return e.ID }
+
+// CustomerUnblocked - покупатель снова активен.
+type CustomerUnblocked struct {
+	ID int64 `json:"id"`
+}
+
+func (e *CustomerUnblocked) EventType() string     { return TypeCustomerUnblocked }
+func (e *CustomerUnblocked) AggregateType() string { return AggregateCustomer }
+func (e *CustomerUnblocked) AggregateID() int64    { return e.ID }
+
+// NewCustomerActiveChanged возвращает CustomerUnblocked, если покупатель id стал активен, иначе CustomerBlocked.
+func NewCustomerActiveChanged(id int64, active bool) Event {
+	if active {
+		return &CustomerUnblocked{ID: id}
+	}
+	return &CustomerBlocked{ID: id}
+}
+
+// ProductChanged - товар создан, изменён, снят с продажи, получил запланированную цену или пополнен по заказу
+// поставщику; поля - состояние товара после изменения. Остатки, списанные продажей, описывает SaleCreated.
+type ProductChanged struct {
+	ID      int64  `json:"id"`
+	Change  string `json:"change"`
+	Name    string `json:"name"`
+	SKU     string `json:"sku"`
+	Price   int    `json:"price"`
+	Qty     int    `json:"qty"`
+	Active  bool   `json:"active"`
+	Version int64  `json:"version"`
+}
+
+func (e *ProductChanged) EventType() string     { return TypeProductChanged }
+func (e *ProductChanged) AggregateType() string { return AggregateProduct }
+func (e *ProductChanged) AggregateID() int64    { return e.ID }
+
+// SaleCreated - сохранена продажа; остатки по её позициям уже списаны.
+type SaleCreated struct {
+	ID         int64           `json:"id"`
+	ManagerID  int64           `json:"manager_id"`
+	CustomerID int64           `json:"customer_id"`
+	Created    time.Time       `json:"created"`
+	Positions  []*SalePosition `json:"positions"`
+}
+
+// SalePosition - позиция продажи в SaleCreated.
+type SalePosition struct {
+	ID        int64  `json:"id"`
+	ProductID int64  `json:"product_id"`
+	VariantID int64  `json:"variant_id"`
+	Barcode   string `json:"barcode,omitempty"`
+	Price     int    `json:"price"`
+	Qty       int    `json:"qty"`
+}
+
+func (e *SaleCreated) EventType() string     { return TypeSaleCreated }
+func (e *SaleCreated) AggregateType() string { return AggregateSale }
+func (e *SaleCreated) AggregateID() int64    { return e.ID }
+
+// Decode восстанавливает событие из сообщения outbox.
+func Decode(message *Message) (Event, error) {
+	var event Event
+	switch message.Type {
+	case TypeCustomerRegistered:
+		event = &CustomerRegistered{}
+	case TypeCustomerBlocked:
+		event = &CustomerBlocked{}
+	case TypeCustomerUnblocked:
+		event = &CustomerUnblocked{}
+	case TypeProductChanged:
+		event = &ProductChanged{}
+	case TypeSaleCreated:
+		event = &SaleCreated{}
+	default:
+		return nil, fmt.Errorf("unknown event type %q", message.Type)
+	}
+	err := json.Unmarshal(message.Payload, event)
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
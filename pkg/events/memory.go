@@ -0,0 +1,93 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/shohinsherov/crud/pkg/memstore"
+)
+
+// MemoryRepo - реализация Repository поверх хранилища в памяти.
+type MemoryRepo struct {
+	store *memstore.Store
+	// mu не даёт двум Batch обрабатывать события одновременно; хранилище на время публикации не блокируется.
+	mu sync.Mutex
+}
+
+// NewMemoryRepo создаёт репозиторий поверх store.
+func NewMemoryRepo(store *memstore.Store) *MemoryRepo {
+	return &MemoryRepo{store: store}
+}
+
+func (r *MemoryRepo) Batch(ctx context.Context, limit int, process func(messages []*Message) []int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	messages := make([]*Message, 0)
+	err := r.store.Tx(func(d *memstore.Data) error {
+		for _, record := range d.Outbox {
+			if len(messages) == limit {
+				break
+			}
+			if record.Published {
+				continue
+			}
+			messages = append(messages, &Message{
+				ID:            record.ID,
+				Type:          record.Type,
+				Version:       record.Version,
+				AggregateType: record.AggregateType,
+				AggregateID:   record.AggregateID,
+				Payload:       append([]byte(nil), record.Payload...),
+				Created:       record.Created,
+			})
+		}
+		return nil
+	})
+	if err != nil || len(messages) == 0 {
+		return 0, err
+	}
+
+	published := make(map[int64]bool)
+	for _, id := range process(messages) {
+		published[id] = true
+	}
+	err = r.store.Tx(func(d *memstore.Data) error {
+		for _, record := range d.Outbox {
+			if published[record.ID] {
+				record.Published = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(published), nil
+}
+
+func (r *MemoryRepo) Purge(ctx context.Context, retention time.Duration, published bool) (n int64, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		before := d.Now().Add(-retention)
+		referenced := make(map[int64]bool)
+		for _, record := range d.WebhookDeliveries {
+			referenced[record.MessageID] = true
+		}
+
+		kept := d.Outbox[:0]
+		for _, record := range d.Outbox {
+			if (published && !record.Published) || !record.Dispatched || !record.Created.Before(before) || referenced[record.ID] {
+				kept = append(kept, record)
+				continue
+			}
+			n++
+		}
+		for i := len(kept); i < len(d.Outbox); i++ {
+			d.Outbox[i] = nil
+		}
+		d.Outbox = kept
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,91 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// relayLock - ключ advisory-блокировки Postgres, которую держит экземпляр, публикующий события.
+const relayLock = 7340010
+
+// PgxRepo - реализация Repository поверх Postgres.
+type PgxRepo struct {
+	pool *pgxpool.Pool
+}
+
+// NewPgxRepo создаёт репозиторий поверх пула соединений.
+func NewPgxRepo(pool *pgxpool.Pool) *PgxRepo {
+	return &PgxRepo{pool: pool}
+}
+
+// Batch держит транзакцию с advisory-блокировкой, пока process публикует события: экземпляр, не получивший
+// блокировку, ничего не делает до следующего прохода.
+func (r *PgxRepo) Batch(ctx context.Context, limit int, process func(messages []*Message) []int64) (int, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var locked bool
+	err = tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, relayLock).Scan(&locked)
+	if err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	rows, err := tx.Query(ctx, `
+	SELECT id, type, version, aggregate_type, aggregate_id, payload, created FROM outbox
+	WHERE published IS NULL
+	ORDER BY id
+	LIMIT $1
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+	messages := make([]*Message, 0)
+	for rows.Next() {
+		message := &Message{}
+		err = rows.Scan(&message.ID, &message.Type, &message.Version, &message.AggregateType, &message.AggregateID, &message.Payload, &message.Created)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		messages = append(messages, message)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return 0, err
+	}
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	published := process(messages)
+	tag, err := tx.Exec(ctx, `UPDATE outbox SET published = CURRENT_TIMESTAMP WHERE id = ANY($1)`, published)
+	if err != nil {
+		return 0, err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (r *PgxRepo) Purge(ctx context.Context, retention time.Duration, published bool) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `
+	DELETE FROM outbox m
+	WHERE (m.published IS NOT NULL OR NOT $2) AND m.dispatched IS NOT NULL AND m.created < CURRENT_TIMESTAMP - $1::INTERVAL
+		AND NOT EXISTS (SELECT 1 FROM webhook_deliveries d WHERE d.message_id = m.id)
+	`, retention, published)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,129 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Publisher отправляет событие потребителям. Ошибка означает, что событие не доставлено: Relay повторит его
+// вместе с последующими событиями того же агрегата. Повтор возможен и после успеха, поэтому потребители
+// отсеивают дубли по Message.ID.
+type Publisher interface {
+	Publish(ctx context.Context, message *Message) error
+}
+
+// LogPublisher пишет события в журнал приложения.
+type LogPublisher struct {
+	logger *zap.Logger
+}
+
+// NewLogPublisher создаёт издателя, который пишет в logger.
+func NewLogPublisher(logger *zap.Logger) *LogPublisher {
+	return &LogPublisher{logger: logger}
+}
+
+func (p *LogPublisher) Publish(ctx context.Context, message *Message) error {
+	p.logger.Info("domain event",
+		zap.Int64("event_id", message.ID),
+		zap.String("type", message.Type),
+		zap.String("aggregate_type", message.AggregateType),
+		zap.Int64("aggregate_id", message.AggregateID),
+		zap.ByteString("payload", message.Payload))
+	return nil
+}
+
+// FilePublisher дописывает события в файл, по одному JSON на строку.
+type FilePublisher struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFilePublisher открывает файл path для дописывания, создавая его при необходимости.
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FilePublisher{file: file}, nil
+}
+
+// Publish возвращается после записи строки на диск, иначе событие потерялось бы при сбое.
+func (p *FilePublisher) Publish(ctx context.Context, message *Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.file.Write(append(data, '\n'))
+	if err != nil {
+		return err
+	}
+	return p.file.Sync()
+}
+
+// Close закрывает файл.
+func (p *FilePublisher) Close() error {
+	return p.file.Close()
+}
+
+// MemoryPublisher хранит опубликованные события в памяти; нужен в тестах и для подписчиков внутри процесса.
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	messages []*Message
+}
+
+// NewMemoryPublisher создаёт пустого издателя.
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, message *Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, message)
+	return nil
+}
+
+// Messages возвращает опубликованные события в порядке публикации.
+func (p *MemoryPublisher) Messages() []*Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*Message(nil), p.messages...)
+}
+
+// NATSConn - часть клиента NATS, которая нужна NATSPublisher; *nats.Conn ей соответствует. Обычный Publish
+// NATS не подтверждает доставку: для гарантии "хотя бы один раз" передайте обёртку над JetStream, которая
+// возвращает ошибку, если сервер не подтвердил сообщение.
+type NATSConn interface {
+	Publish(subject string, data []byte) error
+}
+
+// NATSPublisher публикует события в NATS в тему <prefix>.<тип события>, например crud.events.sale.created.
+type NATSPublisher struct {
+	conn   NATSConn
+	prefix string
+}
+
+// NewNATSPublisher создаёт издателя поверх соединения conn.
+func NewNATSPublisher(conn NATSConn, prefix string) *NATSPublisher {
+	return &NATSPublisher{conn: conn, prefix: strings.TrimSuffix(prefix, ".")}
+}
+
+func (p *NATSPublisher) Publish(ctx context.Context, message *Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	err = p.conn.Publish(p.prefix+"."+message.Type, data)
+	if err != nil {
+		return fmt.Errorf("publish to nats: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/shohinsherov/crud/pkg/config"
+	"github.com/shohinsherov/crud/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// Имена издателей в настройке relay.publishers.
+const (
+	PublisherLog  = "log"
+	PublisherFile = "file"
+)
+
+// aggregate - тип и ID агрегата события.
+type aggregate struct {
+	typ string
+	id  int64
+}
+
+// Relay публикует события из outbox во все Publisher-ы. Событие отмечается опубликованным, только когда
+// его приняли все издатели, поэтому доставка - хотя бы один раз. Если событие агрегата не опубликовано,
+// следующие события того же агрегата в этом проходе пропускаются, и порядок внутри агрегата сохраняется;
+// события других агрегатов публикуются дальше.
+type Relay struct {
+	repo       Repository
+	publishers []Publisher
+	purgers    []DeliveryPurger
+	batchSize  int
+	retention  time.Duration
+	logger     *zap.Logger
+}
+
+// DeliveryPurger удаляет записи, которые ссылаются на события outbox (например, доставки вебхуков);
+// Purge вызывает его перед удалением самих событий.
+type DeliveryPurger interface {
+	PurgeDeliveries(ctx context.Context, retention time.Duration) (int64, error)
+}
+
+// NewRelay создаёт Relay с издателями из cfg.Publishers. Другие издатели (NATS, в памяти) подключаются
+// через AddPublisher.
+func NewRelay(repo Repository, cfg *config.Relay, logger *zap.Logger) (*Relay, error) {
+	relay := &Relay{repo: repo, batchSize: cfg.BatchSize, retention: cfg.Retention.Duration(), logger: logger}
+	for _, name := range strings.Split(cfg.Publishers, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case PublisherLog:
+			relay.AddPublisher(NewLogPublisher(logger.Named("events")))
+		case PublisherFile:
+			publisher, err := NewFilePublisher(cfg.File)
+			if err != nil {
+				relay.Close()
+				return nil, err
+			}
+			relay.AddPublisher(publisher)
+		default:
+			relay.Close()
+			return nil, fmt.Errorf("unknown events publisher %q", name)
+		}
+	}
+	return relay, nil
+}
+
+// AddPublisher подключает издателя; вызывается до RunRelay.
+func (r *Relay) AddPublisher(publisher Publisher) {
+	r.publishers = append(r.publishers, publisher)
+}
+
+// AddDeliveryPurger подключает purger; вызывается до RunPurger.
+func (r *Relay) AddDeliveryPurger(purger DeliveryPurger) {
+	r.purgers = append(r.purgers, purger)
+}
+
+// Publishers возвращает число подключённых издателей.
+func (r *Relay) Publishers() int {
+	return len(r.publishers)
+}
+
+// log возвращает логгер с идентификатором запроса из ctx.
+func (r *Relay) log(ctx context.Context) *zap.Logger {
+	return logging.For(ctx, r.logger)
+}
+
+// PublishPending публикует один пакет событий и возвращает число опубликованных.
+func (r *Relay) PublishPending(ctx context.Context) (int, error) {
+	return r.repo.Batch(ctx, r.batchSize, func(messages []*Message) []int64 {
+		failed := make(map[aggregate]bool)
+		published := make([]int64, 0, len(messages))
+		for _, message := range messages {
+			key := aggregate{typ: message.AggregateType, id: message.AggregateID}
+			if failed[key] {
+				continue
+			}
+			err := r.publish(ctx, message)
+			if err != nil {
+				failed[key] = true
+				r.log(ctx).Warn("can't publish event",
+					zap.Int64("event_id", message.ID),
+					zap.String("type", message.Type),
+					zap.Error(err))
+				continue
+			}
+			published = append(published, message.ID)
+		}
+		return published
+	})
+}
+
+func (r *Relay) publish(ctx context.Context, message *Message) error {
+	for _, publisher := range r.publishers {
+		err := publisher.Publish(ctx, message)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close закрывает издателей, которые держат ресурсы (например, файл).
+func (r *Relay) Close() {
+	for _, publisher := range r.publishers {
+		if closer, ok := publisher.(io.Closer); ok {
+			err := closer.Close()
+			if err != nil {
+				r.logger.Error("can't close events publisher", zap.Error(err))
+			}
+		}
+	}
+}
+
+// RunRelay раз в interval публикует новые события, пока не отменён ctx; пакет из batch-size событий
+// сразу продолжается следующим. По завершении закрывает издателей.
+func (r *Relay) RunRelay(ctx context.Context, interval time.Duration) {
+	defer r.Close()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		published, err := r.PublishPending(ctx)
+		if err != nil {
+			r.log(ctx).Error("run events relay failed", zap.Error(err))
+		}
+		if published > 0 {
+			r.log(ctx).Debug("published events", zap.Int("count", published))
+		}
+		if err == nil && published == r.batchSize {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge удаляет из outbox опубликованные и разосланные вебхукам события старше срока хранения; сначала
+// DeliveryPurger-ы удаляют ссылки на них. Без издателей события не публикуются, и достаточно рассылки.
+func (r *Relay) Purge(ctx context.Context) (int64, error) {
+	for _, purger := range r.purgers {
+		_, err := purger.PurgeDeliveries(ctx, r.retention)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return r.repo.Purge(ctx, r.retention, len(r.publishers) > 0)
+}
+
+// RunPurger раз в interval удаляет устаревшие события, пока не отменён ctx.
+func (r *Relay) RunPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := r.Purge(ctx)
+		if err != nil {
+			r.log(ctx).Error("purge outbox failed", zap.Error(err))
+		}
+		if n > 0 {
+			r.log(ctx).Info("purged outbox", zap.Int64("count", n))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
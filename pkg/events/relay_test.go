@@ -0,0 +1,321 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shohinsherov/crud/pkg/config"
+	"github.com/shohinsherov/crud/pkg/memstore"
+	"go.uber.org/zap"
+)
+
+// flakyPublisher не принимает каждое событие из fail при первой попытке.
+type flakyPublisher struct {
+	fail map[int64]bool
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, message *Message) error {
+	if p.fail[message.ID] {
+		delete(p.fail, message.ID)
+		return errors.New("broker is unavailable")
+	}
+	return nil
+}
+
+// natsConn запоминает опубликованные сообщения.
+type natsConn struct {
+	subjects []string
+	data     [][]byte
+}
+
+func (c *natsConn) Publish(subject string, data []byte) error {
+	c.subjects = append(c.subjects, subject)
+	c.data = append(c.data, data)
+	return nil
+}
+
+// addEvents записывает события в outbox так же, как outbox.Add, и возвращает их номера.
+func addEvents(t *testing.T, store *memstore.Store, items ...Event) []int64 {
+	t.Helper()
+	ids := make([]int64, 0, len(items))
+	err := store.Tx(func(d *memstore.Data) error {
+		for _, item := range items {
+			data, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			record := &memstore.OutboxMessage{
+				ID:            d.NextID(),
+				Type:          item.EventType(),
+				Version:       SchemaVersion,
+				AggregateType: item.AggregateType(),
+				AggregateID:   item.AggregateID(),
+				Payload:       data,
+				Created:       d.Now(),
+			}
+			d.Outbox = append(d.Outbox, record)
+			ids = append(ids, record.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func newTestRelay(t *testing.T, store *memstore.Store, publishers ...Publisher) *Relay {
+	t.Helper()
+	relay, err := NewRelay(NewMemoryRepo(store), &config.Relay{BatchSize: 10}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, publisher := range publishers {
+		relay.AddPublisher(publisher)
+	}
+	return relay
+}
+
+func publishedIDs(publisher *MemoryPublisher) []int64 {
+	ids := make([]int64, 0)
+	for _, message := range publisher.Messages() {
+		ids = append(ids, message.ID)
+	}
+	return ids
+}
+
+func TestRelay_OrderPerAggregate(t *testing.T) {
+	store := memstore.New()
+	ctx := context.Background()
+	ids := addEvents(t, store,
+		&ProductChanged{ID: 1, Change: ProductCreated},
+		&CustomerRegistered{ID: 2},
+		&ProductChanged{ID: 1, Change: ProductUpdated},
+		&CustomerBlocked{ID: 2},
+	)
+	received := NewMemoryPublisher()
+	relay := newTestRelay(t, store, &flakyPublisher{fail: map[int64]bool{ids[0]: true}}, received)
+
+	published, err := relay.PublishPending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Первое событие товара не принято, поэтому второе ждёт его; события покупателя идут дальше.
+	if want := []int64{ids[1], ids[3]}; published != 2 || !reflect.DeepEqual(publishedIDs(received), want) {
+		t.Fatalf("first pass: published %d, received %v, want %v", published, publishedIDs(received), want)
+	}
+
+	published, err = relay.PublishPending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{ids[1], ids[3], ids[0], ids[2]}; published != 2 || !reflect.DeepEqual(publishedIDs(received), want) {
+		t.Fatalf("second pass: published %d, received %v, want %v", published, publishedIDs(received), want)
+	}
+
+	published, err = relay.PublishPending(ctx)
+	if err != nil || published != 0 {
+		t.Fatalf("third pass: published %d, %v", published, err)
+	}
+
+	event, err := Decode(received.Messages()[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, ok := event.(*ProductChanged); !ok || changed.ID != 1 || changed.Change != ProductUpdated {
+		t.Errorf("decoded %#v", event)
+	}
+}
+
+func TestRelay_Publishers(t *testing.T) {
+	store := memstore.New()
+	ctx := context.Background()
+	created := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	ids := addEvents(t, store, &SaleCreated{ID: 5, ManagerID: 1, Created: created, Positions: []*SalePosition{{ID: 6, ProductID: 1, Price: 100, Qty: 2}}})
+
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	relay, err := NewRelay(NewMemoryRepo(store), &config.Relay{BatchSize: 10, Publishers: "log, file", File: path}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := &natsConn{}
+	relay.AddPublisher(NewNATSPublisher(conn, "crud.events."))
+	if relay.Publishers() != 3 {
+		t.Fatalf("got %d publishers, want 3", relay.Publishers())
+	}
+	_, err = relay.PublishPending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay.Close()
+
+	if len(conn.subjects) != 1 || conn.subjects[0] != "crud.events.sale.created" {
+		t.Fatalf("nats subjects: %v", conn.subjects)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	lines := make([]*Message, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		message := &Message{}
+		err = json.Unmarshal(scanner.Bytes(), message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, message)
+	}
+	if len(lines) != 1 || lines[0].ID != ids[0] || lines[0].AggregateType != AggregateSale || lines[0].AggregateID != 5 {
+		t.Fatalf("file lines: %+v", lines)
+	}
+	event, err := Decode(lines[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sale, ok := event.(*SaleCreated)
+	if !ok || !sale.Created.Equal(created) || len(sale.Positions) != 1 || sale.Positions[0].Qty != 2 {
+		t.Errorf("decoded %#v", event)
+	}
+
+	_, err = NewRelay(NewMemoryRepo(store), &config.Relay{BatchSize: 10, Publishers: "kafka"}, zap.NewNop())
+	if err == nil {
+		t.Error("unknown publisher: want error")
+	}
+}
+
+// deliveryPurger удаляет из хранилища доставки событий из done, как webhooks.Service.PurgeDeliveries.
+type deliveryPurger struct {
+	store *memstore.Store
+	done  map[int64]bool
+	calls int
+}
+
+func (p *deliveryPurger) PurgeDeliveries(ctx context.Context, retention time.Duration) (int64, error) {
+	p.calls++
+	var n int64
+	err := p.store.Tx(func(d *memstore.Data) error {
+		for id, record := range d.WebhookDeliveries {
+			if p.done[record.MessageID] {
+				delete(d.WebhookDeliveries, id)
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+func TestRelay_Purge(t *testing.T) {
+	store := memstore.New()
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	store.SetClock(func() time.Time { return now })
+	ctx := context.Background()
+	ids := addEvents(t, store, &CustomerRegistered{ID: 1}, &CustomerRegistered{ID: 2}, &CustomerRegistered{ID: 3})
+	relay, err := NewRelay(NewMemoryRepo(store), &config.Relay{BatchSize: 10, Retention: config.Duration(24 * time.Hour)}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay.AddPublisher(NewMemoryPublisher())
+	_, err = relay.PublishPending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Первые два события разосланы вебхукам: доставку первого purger удаляет, второго - нет.
+	// Третье ещё не разослано.
+	err = store.Tx(func(d *memstore.Data) error {
+		d.Outbox[0].Dispatched = true
+		d.Outbox[1].Dispatched = true
+		d.WebhookDeliveries[100] = &memstore.WebhookDelivery{ID: 100, MessageID: ids[0]}
+		d.WebhookDeliveries[101] = &memstore.WebhookDelivery{ID: 101, MessageID: ids[1]}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	purger := &deliveryPurger{store: store, done: map[int64]bool{ids[0]: true}}
+	relay.AddDeliveryPurger(purger)
+
+	n, err := relay.Purge(ctx)
+	if err != nil || n != 0 {
+		t.Fatalf("purge fresh events: got %d, %v, want 0", n, err)
+	}
+
+	now = now.Add(25 * time.Hour)
+	n, err = relay.Purge(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("purge: got %d, %v, want 1", n, err)
+	}
+	if purger.calls != 2 {
+		t.Errorf("delivery purger: got %d calls, want 2", purger.calls)
+	}
+	err = store.Tx(func(d *memstore.Data) error {
+		kept := make([]int64, 0)
+		for _, record := range d.Outbox {
+			kept = append(kept, record.ID)
+		}
+		if want := ids[1:]; !reflect.DeepEqual(kept, want) {
+			t.Errorf("outbox: got %v, want %v", kept, want)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRelay_PurgeWithoutPublishers(t *testing.T) {
+	store := memstore.New()
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	store.SetClock(func() time.Time { return now })
+	ctx := context.Background()
+	ids := addEvents(t, store, &CustomerRegistered{ID: 1}, &CustomerRegistered{ID: 2})
+	err := store.Tx(func(d *memstore.Data) error {
+		d.Outbox[0].Dispatched = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Relay{BatchSize: 10, Retention: config.Duration(24 * time.Hour)}
+	now = now.Add(25 * time.Hour)
+
+	// С издателем неопубликованное событие ждёт публикации.
+	relay, err := NewRelay(NewMemoryRepo(store), cfg, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay.AddPublisher(&flakyPublisher{})
+	n, err := relay.Purge(ctx)
+	if err != nil || n != 0 {
+		t.Fatalf("purge unpublished events: got %d, %v, want 0", n, err)
+	}
+
+	// Без издателей события не публикуются: удаляются разосланные вебхукам.
+	relay, err = NewRelay(NewMemoryRepo(store), cfg, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err = relay.Purge(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("purge without publishers: got %d, %v, want 1", n, err)
+	}
+	err = store.Tx(func(d *memstore.Data) error {
+		if len(d.Outbox) != 1 || d.Outbox[0].ID != ids[1] {
+			t.Errorf("outbox: got %d events, want only %d", len(d.Outbox), ids[1])
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
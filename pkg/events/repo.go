@@ -0,0 +1,17 @@
+package events
+
+import (
+	"context"
+	"time"
+)
+
+// Repository читает неопубликованные события из outbox и удаляет обработанные.
+type Repository interface {
+	// Batch передаёт process до limit неопубликованных событий в порядке записи и отмечает опубликованными
+	// те, номера которых вернул process. Пока идёт обработка, другие экземпляры пакет не получают: иначе
+	// события одного агрегата могли бы опубликоваться не по порядку. Возвращает число отмеченных событий.
+	Batch(ctx context.Context, limit int, process func(messages []*Message) []int64) (int, error)
+	// Purge удаляет события старше retention, которые разосланы вебхукам и на которые не ссылается
+	// ни одна доставка; если published - только опубликованные из них. Возвращает число удалённых событий.
+	Purge(ctx context.Context, retention time.Duration, published bool) (int64, error)
+}
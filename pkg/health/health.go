@@ -0,0 +1,84 @@
+// Package health выполняет проверки готовности сервиса.
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// checkTimeout ограничивает время одной проверки.
+const checkTimeout = 2 * time.Second
+
+// Check проверяет одну зависимость и возвращает ошибку, если она не готова.
+type Check func(ctx context.Context) error
+
+// Result - итог проверки: общий статус и статус каждой проверки ("ok" или текст ошибки).
+type Result struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Статусы Result.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Checker хранит именованные проверки.
+type Checker struct {
+	mu     sync.RWMutex
+	checks map[string]Check
+}
+
+// NewChecker создаёт пустой набор проверок.
+func NewChecker() *Checker {
+	return &Checker{checks: make(map[string]Check)}
+}
+
+// Add регистрирует проверку под именем name.
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// Run выполняет все проверки параллельно.
+func (c *Checker) Run(ctx context.Context) *Result {
+	c.mu.RLock()
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	checks := make([]Check, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		checks[i] = c.checks[name]
+	}
+	c.mu.RUnlock()
+
+	errs := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+			errs[i] = check(ctx)
+		}(i, check)
+	}
+	wg.Wait()
+
+	result := &Result{Status: StatusOK, Checks: make(map[string]string, len(names))}
+	for i, name := range names {
+		if errs[i] != nil {
+			result.Status = StatusFail
+			result.Checks[name] = errs[i].Error()
+			continue
+		}
+		result.Checks[name] = StatusOK
+	}
+	return result
+}
@@ -0,0 +1,125 @@
+// Package hub рассылает события внутри процесса: подписчики получают новые события
+// и могут возобновить подписку с последнего полученного номера.
+package hub
+
+import (
+	"sync"
+	"time"
+)
+
+// Reset - тип события, которое получает подписчик, пропустивший больше событий, чем хранит хаб.
+const Reset = "reset"
+
+// SubscriberBuffer - сколько событий ждёт отправки одному подписчику. Подписчик, который не успевает
+// их забирать, отключается, чтобы не задерживать остальных; он может переподключиться с последним номером.
+const SubscriberBuffer = 64
+
+// Event - событие с номером; номера растут на единицу в пределах процесса.
+type Event struct {
+	ID      int64       `json:"id"`
+	Type    string      `json:"type"`
+	Data    interface{} `json:"data"`
+	Created time.Time   `json:"created"`
+	// Audience - пользователь, которому адресовано событие; 0 - событие для всех. Учитывается фильтром подписки.
+	Audience int64 `json:"-"`
+}
+
+// Hub хранит последние события и рассылает новые подписчикам.
+type Hub struct {
+	mu          sync.Mutex
+	lastID      int64
+	history     []*Event
+	size        int
+	subscribers map[*Subscription]bool
+}
+
+// New создаёт хаб, который помнит size последних событий для возобновления подписки.
+func New(size int) *Hub {
+	return &Hub{size: size, subscribers: make(map[*Subscription]bool)}
+}
+
+// Publish нумерует событие и отправляет его подписчикам. Publish не блокируется.
+func (h *Hub) Publish(typ string, audience int64, data interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	event := &Event{ID: h.lastID, Type: typ, Data: data, Created: time.Now(), Audience: audience}
+	h.history = append(h.history, event)
+	if len(h.history) > h.size {
+		h.history = h.history[len(h.history)-h.size:]
+	}
+
+	for subscription := range h.subscribers {
+		if !subscription.filter(event) {
+			continue
+		}
+		select {
+		case subscription.events <- event:
+		default:
+			h.remove(subscription)
+		}
+	}
+}
+
+// Subscribe подписывает на события, для которых filter возвращает true. Если lastID не 0, сразу
+// возвращаются пропущенные события с номерами больше lastID. Если часть из них уже вытеснена из истории
+// или lastID выдан до перезапуска процесса, вместо них возвращается одно событие Reset с номером
+// последнего события: подписчику нужно заново прочитать текущее состояние.
+func (h *Hub) Subscribe(lastID int64, filter func(event *Event) bool) (*Subscription, []*Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subscription := &Subscription{hub: h, events: make(chan *Event, SubscriberBuffer), filter: filter}
+	h.subscribers[subscription] = true
+
+	missed := make([]*Event, 0)
+	if lastID == 0 {
+		return subscription, missed
+	}
+	if lastID > h.lastID || (len(h.history) > 0 && h.history[0].ID > lastID+1) {
+		missed = append(missed, &Event{ID: h.lastID, Type: Reset, Created: time.Now()})
+		return subscription, missed
+	}
+	for _, event := range h.history {
+		if event.ID > lastID && filter(event) {
+			missed = append(missed, event)
+		}
+	}
+	return subscription, missed
+}
+
+// remove отключает подписчика; вызывается под h.mu.
+func (h *Hub) remove(subscription *Subscription) {
+	if h.subscribers[subscription] {
+		delete(h.subscribers, subscription)
+		close(subscription.events)
+	}
+}
+
+// Subscribers возвращает число подписчиков.
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+// Subscription - подписка на события хаба.
+type Subscription struct {
+	hub    *Hub
+	events chan *Event
+	filter func(event *Event) bool
+}
+
+// Events возвращает канал новых событий. Канал закрывается после Close или если подписчик
+// не успевал забирать события и был отключён.
+func (s *Subscription) Events() <-chan *Event {
+	return s.events
+}
+
+// Close отменяет подписку.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
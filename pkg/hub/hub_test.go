@@ -0,0 +1,70 @@
+package hub
+
+import (
+	"testing"
+)
+
+func all(event *Event) bool {
+	return true
+}
+
+func TestHub_PublishAndResume(t *testing.T) {
+	h := New(3)
+	sales := func(event *Event) bool { return event.Audience == 0 || event.Audience == 7 }
+	subscription, missed := h.Subscribe(0, sales)
+	defer subscription.Close()
+	if len(missed) != 0 {
+		t.Fatalf("missed on first subscribe: got %v", missed)
+	}
+
+	h.Publish("stock.changed", 0, 1)
+	h.Publish("sale.created", 8, 2)
+	h.Publish("sale.created", 7, 3)
+	for _, want := range []int64{1, 3} {
+		event := <-subscription.Events()
+		if event.ID != want {
+			t.Errorf("got event %d, want %d", event.ID, want)
+		}
+	}
+
+	_, missed = h.Subscribe(1, sales)
+	if len(missed) != 1 || missed[0].ID != 3 {
+		t.Errorf("resume after 1: got %+v, want event 3", missed)
+	}
+
+	h.Publish("stock.changed", 0, 4)
+	h.Publish("stock.changed", 0, 5)
+	for _, lastID := range []int64{1, 10} {
+		_, missed = h.Subscribe(lastID, sales)
+		if len(missed) != 1 || missed[0].Type != Reset || missed[0].ID != 5 {
+			t.Errorf("resume after %d: got %+v, want reset at 5", lastID, missed)
+		}
+	}
+	_, missed = h.Subscribe(2, sales)
+	if len(missed) != 3 || missed[0].ID != 3 || missed[2].ID != 5 {
+		t.Errorf("resume after 2: got %+v, want events 3, 4, 5", missed)
+	}
+}
+
+func TestHub_DropsSlowSubscriber(t *testing.T) {
+	h := New(SubscriberBuffer * 2)
+	slow, _ := h.Subscribe(0, all)
+	fast, _ := h.Subscribe(0, all)
+	defer fast.Close()
+
+	for i := 0; i <= SubscriberBuffer; i++ {
+		h.Publish("stock.changed", 0, i)
+		<-fast.Events()
+	}
+	if h.Subscribers() != 1 {
+		t.Errorf("subscribers: got %d, want 1", h.Subscribers())
+	}
+	n := 0
+	for range slow.Events() {
+		n++
+	}
+	if n != SubscriberBuffer {
+		t.Errorf("slow subscriber received %d events, want %d", n, SubscriberBuffer)
+	}
+	slow.Close()
+}
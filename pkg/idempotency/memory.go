@@ -0,0 +1,99 @@
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	"github.com/shohinsherov/crud/pkg/memstore"
+)
+
+// MemoryRepo - реализация Repository поверх хранилища в памяти.
+type MemoryRepo struct {
+	store *memstore.Store
+}
+
+// NewMemoryRepo создаёт репозиторий поверх store.
+func NewMemoryRepo(store *memstore.Store) *MemoryRepo {
+	return &MemoryRepo{store: store}
+}
+
+func (r *MemoryRepo) Reserve(ctx context.Context, record *Record, retention time.Duration, lease time.Duration) (existing *Record, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		id := memstore.IdempotencyKeyID(record.Scope, record.Key)
+		current, ok := d.IdempotencyKeys[id]
+		expired := ok && (current.Created.Before(d.Now().Add(-retention)) || current.Status == 0 && current.Created.Before(d.Now().Add(-lease)))
+		if ok && !expired {
+			existing = recordFrom(current)
+			return nil
+		}
+		record.Status = 0
+		record.Created = d.Now()
+		d.IdempotencyKeys[id] = &memstore.IdempotencyKey{
+			Scope:       record.Scope,
+			Key:         record.Key,
+			RequestHash: record.RequestHash,
+			Created:     record.Created,
+		}
+		return nil
+	})
+	return existing, err
+}
+
+func (r *MemoryRepo) Complete(ctx context.Context, record *Record) error {
+	return r.store.Tx(func(d *memstore.Data) error {
+		current, ok := d.IdempotencyKeys[memstore.IdempotencyKeyID(record.Scope, record.Key)]
+		if !ok || current.Status != 0 || !current.Created.Equal(record.Created) {
+			return ErrLeaseExpired
+		}
+		current.Status = record.Status
+		current.Header = copyHeader(record.Header)
+		current.Body = append([]byte(nil), record.Body...)
+		return nil
+	})
+}
+
+func (r *MemoryRepo) Release(ctx context.Context, record *Record) error {
+	return r.store.Tx(func(d *memstore.Data) error {
+		id := memstore.IdempotencyKeyID(record.Scope, record.Key)
+		current, ok := d.IdempotencyKeys[id]
+		if !ok || current.Status != 0 || !current.Created.Equal(record.Created) {
+			return ErrLeaseExpired
+		}
+		delete(d.IdempotencyKeys, id)
+		return nil
+	})
+}
+
+func (r *MemoryRepo) Purge(ctx context.Context, retention time.Duration) (n int64, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		before := d.Now().Add(-retention)
+		for id, record := range d.IdempotencyKeys {
+			if record.Created.Before(before) {
+				delete(d.IdempotencyKeys, id)
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+func recordFrom(record *memstore.IdempotencyKey) *Record {
+	return &Record{
+		Scope:       record.Scope,
+		Key:         record.Key,
+		RequestHash: record.RequestHash,
+		Status:      record.Status,
+		Header:      copyHeader(record.Header),
+		Body:        append([]byte(nil), record.Body...),
+		Created:     record.Created,
+	}
+}
+
+func copyHeader(header map[string]string) map[string]string {
+	result := make(map[string]string, len(header))
+	for name, value := range header {
+		result[name] = value
+	}
+	return result
+}
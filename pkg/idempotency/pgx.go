@@ -0,0 +1,93 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// PgxRepo - реализация Repository поверх Postgres.
+type PgxRepo struct {
+	pool *pgxpool.Pool
+}
+
+// NewPgxRepo создаёт репозиторий поверх пула соединений.
+func NewPgxRepo(pool *pgxpool.Pool) *PgxRepo {
+	return &PgxRepo{pool: pool}
+}
+
+func (r *PgxRepo) Reserve(ctx context.Context, record *Record, retention time.Duration, lease time.Duration) (*Record, error) {
+	// Ключ может освободиться между INSERT и SELECT (Release после ошибки), тогда резервируем заново.
+	for {
+		err := r.pool.QueryRow(ctx, `
+		INSERT INTO idempotency_keys(scope, key, request_hash) VALUES ($1, $2, $3)
+		ON CONFLICT (scope, key) DO UPDATE SET request_hash = EXCLUDED.request_hash, status = 0, header = '{}', body = NULL, created = CURRENT_TIMESTAMP
+		WHERE idempotency_keys.created < CURRENT_TIMESTAMP - $4::INTERVAL
+			OR idempotency_keys.status = 0 AND idempotency_keys.created < CURRENT_TIMESTAMP - $5::INTERVAL
+		RETURNING created
+		`, record.Scope, record.Key, record.RequestHash, retention, lease).Scan(&record.Created)
+		if err == nil {
+			record.Status = 0
+			return nil, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+
+		existing := &Record{Scope: record.Scope, Key: record.Key}
+		err = r.pool.QueryRow(ctx, `
+		SELECT request_hash, status, header, COALESCE(body, ''), created FROM idempotency_keys WHERE scope = $1 AND key = $2
+		`, record.Scope, record.Key).Scan(&existing.RequestHash, &existing.Status, &existing.Header, &existing.Body, &existing.Created)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return existing, nil
+	}
+}
+
+func (r *PgxRepo) Complete(ctx context.Context, record *Record) error {
+	header := record.Header
+	if header == nil {
+		header = map[string]string{}
+	}
+	tag, err := r.pool.Exec(ctx, `
+	UPDATE idempotency_keys SET status = $4, header = $5, body = $6
+	WHERE scope = $1 AND key = $2 AND created = $3 AND status = 0
+	`, record.Scope, record.Key, record.Created, record.Status, header, record.Body)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrLeaseExpired
+	}
+	return nil
+}
+
+func (r *PgxRepo) Release(ctx context.Context, record *Record) error {
+	tag, err := r.pool.Exec(ctx, `
+	DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND created = $3 AND status = 0
+	`, record.Scope, record.Key, record.Created)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrLeaseExpired
+	}
+	return nil
+}
+
+func (r *PgxRepo) Purge(ctx context.Context, retention time.Duration) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `
+	DELETE FROM idempotency_keys WHERE created < CURRENT_TIMESTAMP - $1::INTERVAL
+	`, retention)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
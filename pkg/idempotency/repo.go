@@ -0,0 +1,23 @@
+package idempotency
+
+import (
+	"context"
+	"time"
+)
+
+// Repository хранит ключи идемпотентности вместе с ответами на запросы.
+type Repository interface {
+	// Reserve сохраняет record как выполняющийся запрос, заполняет record.Created и возвращает nil.
+	// Если ключ record.Scope/record.Key уже есть и создан не раньше retention назад,
+	// запись не меняется и возвращается сохранённая; более старая заменяется. Запрос без ответа
+	// (Status 0) держит ключ только lease.
+	Reserve(ctx context.Context, record *Record, retention time.Duration, lease time.Duration) (*Record, error)
+	// Complete сохраняет ответ выполненного запроса. Если ключ уже не занят резервацией с record.Created,
+	// возвращает ErrLeaseExpired.
+	Complete(ctx context.Context, record *Record) error
+	// Release удаляет ключ невыполненного запроса, чтобы его можно было повторить. Если ключ уже не занят
+	// резервацией с record.Created, возвращает ErrLeaseExpired.
+	Release(ctx context.Context, record *Record) error
+	// Purge удаляет ключи, созданные раньше retention назад, и возвращает их количество.
+	Purge(ctx context.Context, retention time.Duration) (int64, error)
+}
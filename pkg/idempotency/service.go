@@ -0,0 +1,137 @@
+// Package idempotency хранит ответы на запросы с заголовком Idempotency-Key,
+// чтобы повтор запроса (например, после обрыва сети) возвращал прежний результат, а не выполнял его ещё раз.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/shohinsherov/crud/pkg/config"
+	"github.com/shohinsherov/crud/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidKey возвращается, если ключ пустой, длиннее MaxKeyLength или содержит непечатные символы.
+var ErrInvalidKey = errors.New("invalid idempotency key")
+
+// ErrKeyReused возвращается, если ключ уже использован для запроса с другим телом.
+var ErrKeyReused = errors.New("idempotency key reused with another request")
+
+// ErrInProgress возвращается, если запрос с тем же ключом ещё выполняется.
+var ErrInProgress = errors.New("request with idempotency key is in progress")
+
+// ErrLeaseExpired возвращается из Complete и Release, если запрос выполнялся дольше lease и ключ
+// уже занял повтор: ответ этого запроса не сохраняется.
+var ErrLeaseExpired = errors.New("idempotency key lease expired")
+
+// MaxKeyLength - максимальная длина ключа.
+const MaxKeyLength = 255
+
+// Record - ключ идемпотентности и ответ на запрос с ним.
+type Record struct {
+	// Scope - владелец ключа, например manager:1: ключи разных пользователей не пересекаются.
+	Scope       string
+	Key         string
+	RequestHash string
+	// Status - HTTP-код ответа, 0 - запрос ещё выполняется.
+	Status int
+	Header map[string]string
+	Body   []byte
+	// Created - когда ключ занят; по нему Complete и Release отличают свою резервацию от резервации повтора.
+	Created time.Time
+}
+
+// Service выдаёт и хранит ключи идемпотентности.
+type Service struct {
+	repo      Repository
+	logger    *zap.Logger
+	retention time.Duration
+	lease     time.Duration
+}
+
+// NewService создаёт сервис
+func NewService(repo Repository, cfg *config.Idempotency, logger *zap.Logger) *Service {
+	return &Service{repo: repo, logger: logger, retention: cfg.Retention.Duration(), lease: cfg.Lease.Duration()}
+}
+
+// log возвращает логгер с идентификатором запроса из ctx.
+func (s *Service) log(ctx context.Context) *zap.Logger {
+	return logging.For(ctx, s.logger)
+}
+
+// ValidKey сообщает, можно ли использовать key как ключ идемпотентности.
+func ValidKey(key string) bool {
+	if key == "" || len(key) > MaxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Begin резервирует ключ key для запроса с хешем requestHash.
+// Если запрос с этим ключом уже выполнен, возвращает сохранённый ответ. Запись со Status 0 означает,
+// что ключ занят этим запросом: его нужно выполнить и передать запись в Complete или Release.
+// Ключ запроса, который не завершился за lease (например, процесс упал), резервируется заново.
+func (s *Service) Begin(ctx context.Context, scope string, key string, requestHash string) (*Record, error) {
+	if !ValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+	record := &Record{Scope: scope, Key: key, RequestHash: requestHash}
+	existing, err := s.repo.Reserve(ctx, record, s.retention, s.lease)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return record, nil
+	}
+	if existing.RequestHash != requestHash {
+		return nil, ErrKeyReused
+	}
+	if existing.Status == 0 {
+		return nil, ErrInProgress
+	}
+	return existing, nil
+}
+
+// Complete сохраняет ответ на запрос, начатый Begin: record - запись из Begin с заполненными
+// Status, Header и Body.
+func (s *Service) Complete(ctx context.Context, record *Record) error {
+	return s.repo.Complete(ctx, record)
+}
+
+// Release освобождает ключ запроса, который не удалось выполнить, чтобы клиент мог его повторить.
+func (s *Service) Release(ctx context.Context, record *Record) error {
+	return s.repo.Release(ctx, record)
+}
+
+// Purge удаляет ключи старше срока хранения.
+func (s *Service) Purge(ctx context.Context) (int64, error) {
+	return s.repo.Purge(ctx, s.retention)
+}
+
+// RunPurger раз в interval удаляет устаревшие ключи, пока не отменён ctx.
+func (s *Service) RunPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.Purge(ctx)
+		if err != nil {
+			s.log(ctx).Error("purge idempotency keys failed", zap.Error(err))
+		}
+		if n > 0 {
+			s.log(ctx).Info("purged idempotency keys", zap.Int64("count", n))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
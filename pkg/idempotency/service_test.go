@@ -0,0 +1,188 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shohinsherov/crud/pkg/config"
+	"github.com/shohinsherov/crud/pkg/memstore"
+	"go.uber.org/zap"
+)
+
+func newTestService(t *testing.T) (*Service, *memstore.Store) {
+	t.Helper()
+	store := memstore.New()
+	cfg := &config.Idempotency{Retention: config.Duration(time.Hour), Lease: config.Duration(time.Minute)}
+	return NewService(NewMemoryRepo(store), cfg, zap.NewNop()), store
+}
+
+func TestService_Begin(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+
+	reservation, err := svc.Begin(ctx, "manager:1", "key-1", "hash")
+	if err != nil || reservation.Status != 0 {
+		t.Fatalf("begin: got %+v, %v", reservation, err)
+	}
+	_, err = svc.Begin(ctx, "manager:1", "key-1", "hash")
+	if !errors.Is(err, ErrInProgress) {
+		t.Errorf("begin in progress: got %v, want %v", err, ErrInProgress)
+	}
+	record, err := svc.Begin(ctx, "manager:2", "key-1", "other")
+	if err != nil || record.Status != 0 {
+		t.Errorf("begin in other scope: got %+v, %v", record, err)
+	}
+
+	reservation.Status = 201
+	reservation.Header = map[string]string{"Content-Type": "application/json"}
+	reservation.Body = []byte(`{"id":1}`)
+	err = svc.Complete(ctx, reservation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err = svc.Begin(ctx, "manager:1", "key-1", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != 201 || string(record.Body) != `{"id":1}` || record.Header["Content-Type"] != "application/json" {
+		t.Errorf("begin completed: got %+v", record)
+	}
+	_, err = svc.Begin(ctx, "manager:1", "key-1", "other")
+	if !errors.Is(err, ErrKeyReused) {
+		t.Errorf("begin with other request: got %v, want %v", err, ErrKeyReused)
+	}
+
+	err = svc.Release(ctx, reservation)
+	if !errors.Is(err, ErrLeaseExpired) {
+		t.Errorf("release completed key: got %v, want %v", err, ErrLeaseExpired)
+	}
+	record, err = svc.Begin(ctx, "manager:1", "key-1", "hash")
+	if err != nil || record.Status != 201 {
+		t.Errorf("release must keep completed key: got %+v, %v", record, err)
+	}
+
+	for _, key := range []string{"", strings.Repeat("k", MaxKeyLength+1), "key\n", "ключ"} {
+		_, err = svc.Begin(ctx, "manager:1", key, "hash")
+		if !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("begin with key %q: got %v, want %v", key, err, ErrInvalidKey)
+		}
+	}
+}
+
+func TestService_Release(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+
+	reservation, err := svc.Begin(ctx, "manager:1", "key-1", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = svc.Release(ctx, reservation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := svc.Begin(ctx, "manager:1", "key-1", "other")
+	if err != nil || record.Status != 0 {
+		t.Errorf("begin after release: got %+v, %v", record, err)
+	}
+}
+
+func TestService_Retention(t *testing.T) {
+	svc, store := newTestService(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	store.SetClock(func() time.Time { return now.Add(-2 * time.Hour) })
+	for _, key := range []string{"old-1", "old-2"} {
+		_, err := svc.Begin(ctx, "manager:1", key, "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.SetClock(func() time.Time { return now })
+	_, err := svc.Begin(ctx, "manager:1", "new", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := svc.Begin(ctx, "manager:1", "old-1", "other")
+	if err != nil || record.Status != 0 {
+		t.Errorf("begin with expired key: got %+v, %v", record, err)
+	}
+
+	n, err := svc.Purge(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("purge: got %d, want 1", n)
+	}
+	_, err = svc.Begin(ctx, "manager:1", "new", "hash")
+	if !errors.Is(err, ErrInProgress) {
+		t.Errorf("purge removed fresh key: got %v", err)
+	}
+}
+
+func TestService_Lease(t *testing.T) {
+	svc, store := newTestService(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	store.SetClock(func() time.Time { return now })
+	reservations := make(map[string]*Record)
+	for _, key := range []string{"lost", "done", "slow"} {
+		reservation, err := svc.Begin(ctx, "manager:1", key, "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		reservations[key] = reservation
+	}
+	reservations["done"].Status = 201
+	err := svc.Complete(ctx, reservations["done"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Запросы с ключами lost и slow не завершились: после lease ключ снова можно занять.
+	store.SetClock(func() time.Time { return now.Add(2 * time.Minute) })
+	record, err := svc.Begin(ctx, "manager:1", "lost", "hash")
+	if err != nil || record.Status != 0 {
+		t.Errorf("begin after lease: got %+v, %v", record, err)
+	}
+	_, err = svc.Begin(ctx, "manager:1", "lost", "hash")
+	if !errors.Is(err, ErrInProgress) {
+		t.Errorf("begin reserved again: got %v, want %v", err, ErrInProgress)
+	}
+	record, err = svc.Begin(ctx, "manager:1", "done", "hash")
+	if err != nil || record.Status != 201 {
+		t.Errorf("lease must keep completed key: got %+v, %v", record, err)
+	}
+
+	// Медленный запрос завершился после того, как ключ занял повтор: он не должен ни освободить ключ
+	// повтора, ни записать свой ответ поверх его ответа.
+	retry, err := svc.Begin(ctx, "manager:1", "slow", "hash")
+	if err != nil || retry.Status != 0 {
+		t.Fatalf("begin retry: got %+v, %v", retry, err)
+	}
+	err = svc.Release(ctx, reservations["slow"])
+	if !errors.Is(err, ErrLeaseExpired) {
+		t.Errorf("release after lease: got %v, want %v", err, ErrLeaseExpired)
+	}
+	reservations["slow"].Status = 500
+	err = svc.Complete(ctx, reservations["slow"])
+	if !errors.Is(err, ErrLeaseExpired) {
+		t.Errorf("complete after lease: got %v, want %v", err, ErrLeaseExpired)
+	}
+	retry.Status = 201
+	err = svc.Complete(ctx, retry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err = svc.Begin(ctx, "manager:1", "slow", "hash")
+	if err != nil || record.Status != 201 {
+		t.Errorf("begin after retry: got %+v, %v", record, err)
+	}
+}
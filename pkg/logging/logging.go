@@ -0,0 +1,112 @@
+// Package logging настраивает структурированный логгер приложения.
+//
+// Идентификатор запроса передаётся через context и добавляется к записям функцией For.
+// Поля с секретами (пароли, токены, хэши) маскируются независимо от того, кто их залогировал.
+package logging
+
+import (
+	"context"
+	"strings"
+
+	"github.com/shohinsherov/crud/pkg/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Redacted подставляется вместо значений секретных полей.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys - подстроки имён полей, значения которых нельзя писать в лог.
+var sensitiveKeys = []string{"password", "token", "hash", "secret", "authorization", "dsn"}
+
+type requestIDKey struct{}
+
+// New создаёт логгер с уровнем и форматом из настроек.
+func New(cfg *config.Config) (*zap.Logger, error) {
+	var level zapcore.Level
+	err := level.UnmarshalText([]byte(cfg.Log.Level))
+	if err != nil {
+		return nil, err
+	}
+
+	zapConfig := zap.NewProductionConfig()
+	if cfg.Log.Format == "console" {
+		zapConfig = zap.NewDevelopmentConfig()
+	}
+	zapConfig.Level = zap.NewAtomicLevelAt(level)
+	zapConfig.EncoderConfig.TimeKey = "time"
+	zapConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	return zapConfig.Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &redactCore{Core: core}
+	}))
+}
+
+// WithRequestID сохраняет идентификатор запроса в контексте.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID возвращает идентификатор запроса из контекста или пустую строку.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// For возвращает логгер, дополненный идентификатором запроса из ctx.
+func For(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	id := RequestID(ctx)
+	if id == "" {
+		return logger
+	}
+	return logger.With(zap.String("request_id", id))
+}
+
+// IsSensitive сообщает, относится ли поле с таким именем к секретам.
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactCore маскирует значения секретных полей перед записью.
+type redactCore struct {
+	zapcore.Core
+}
+
+func (c *redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactCore{Core: c.Core.With(redact(fields))}
+}
+
+func (c *redactCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *redactCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(entry, redact(fields))
+}
+
+func redact(fields []zapcore.Field) []zapcore.Field {
+	var result []zapcore.Field
+	for i, field := range fields {
+		if !IsSensitive(field.Key) {
+			continue
+		}
+		if result == nil {
+			result = make([]zapcore.Field, len(fields))
+			copy(result, fields)
+		}
+		result[i] = zap.String(field.Key, Redacted)
+	}
+	if result == nil {
+		return fields
+	}
+	return result
+}
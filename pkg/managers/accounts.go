@@ -0,0 +1,129 @@
+package managers
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Create создаёт менеджера с паролем; используется для первичной настройки из командной строки.
+func (s *Service) Create(ctx context.Context, reg *Registration, password string) (*Registration, error) {
+	ctx, span := tracer.Start(ctx, "managers.Create")
+	defer span.End()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.bcryptCost)
+	if err != nil {
+		s.log(ctx).Error("create failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	reg, err = s.managers.CreateManager(ctx, reg, isAdmin(reg.Roles), string(hash))
+	if err != nil {
+		return nil, s.fail(ctx, "create", err)
+	}
+	return reg, nil
+}
+
+// ResetPassword задаёт менеджеру новый пароль и отзывает все его токены.
+func (s *Service) ResetPassword(ctx context.Context, phone string, password string) error {
+	ctx, span := tracer.Start(ctx, "managers.ResetPassword")
+	defer span.End()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.bcryptCost)
+	if err != nil {
+		s.log(ctx).Error("reset password failed", zap.Error(err))
+		return ErrInternal
+	}
+
+	err = s.managers.SetPassword(ctx, phone, string(hash))
+	if err != nil {
+		return s.fail(ctx, "reset password", err)
+	}
+	return nil
+}
+
+// Managers возвращает менеджеров; роль ADMIN указана у администраторов.
+func (s *Service) Managers(ctx context.Context) ([]*Registration, error) {
+	ctx, span := tracer.Start(ctx, "managers.Managers")
+	defer span.End()
+
+	items, err := s.managers.Managers(ctx)
+	if err != nil {
+		return nil, s.fail(ctx, "managers", err)
+	}
+	return items, nil
+}
+
+// ManagersByIDs возвращает найденных менеджеров из ids; используется для пакетной загрузки.
+func (s *Service) ManagersByIDs(ctx context.Context, ids []int64) ([]*Registration, error) {
+	ctx, span := tracer.Start(ctx, "managers.ManagersByIDs")
+	defer span.End()
+
+	items, err := s.managers.ManagersByIDs(ctx, ids)
+	if err != nil {
+		return nil, s.fail(ctx, "managers by ids", err)
+	}
+	return items, nil
+}
+
+// PurgeExpiredTokens удаляет истёкшие токены менеджеров и возвращает их количество.
+func (s *Service) PurgeExpiredTokens(ctx context.Context) (int64, error) {
+	ctx, span := tracer.Start(ctx, "managers.PurgeExpiredTokens")
+	defer span.End()
+
+	n, err := s.tokens.PurgeExpiredTokens(ctx)
+	if err != nil {
+		return 0, s.fail(ctx, "purge expired tokens", err)
+	}
+	return n, nil
+}
+
+// ImportedFields отмечает необязательные колонки, заданные в строке импорта.
+type ImportedFields struct {
+	SKU        bool
+	Qty        bool
+	CategoryID bool
+	Attributes bool
+}
+
+// ImportProduct создаёт товар или, если товар с таким SKU уже есть, обновляет его.
+// При обновлении поля, не отмеченные в fields, сохраняют прежние значения.
+// Возвращает true, когда товар был создан.
+func (s *Service) ImportProduct(ctx context.Context, managerID int64, product *Product, fields ImportedFields) (bool, error) {
+	ctx, span := tracer.Start(ctx, "managers.ImportProduct")
+	defer span.End()
+
+	if product.SKU != "" {
+		id, err := s.products.ProductIDBySKU(ctx, product.SKU)
+		if err != nil {
+			return false, s.fail(ctx, "import product", err)
+		}
+		if id != 0 {
+			product.ID = id
+		}
+	}
+
+	if product.ID == 0 {
+		_, err := s.CreateProduct(ctx, managerID, product)
+		return err == nil, err
+	}
+	current, err := s.products.ProductByID(ctx, product.ID)
+	if err != nil {
+		return false, s.fail(ctx, "import product", err)
+	}
+	if !fields.SKU {
+		product.SKU = current.SKU
+	}
+	if !fields.Qty {
+		product.Qty = current.Qty
+	}
+	if !fields.CategoryID {
+		product.CategoryID = current.CategoryID
+	}
+	if !fields.Attributes {
+		product.Attributes = current.Attributes
+	}
+	_, err = s.UpdateProduct(ctx, managerID, product)
+	return false, err
+}
@@ -0,0 +1,97 @@
+package managers
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Типы событий, которые сервис отправляет в Publisher.
+const (
+	EventStockChanged = "stock.changed"
+	EventPriceChanged = "price.changed"
+	EventSaleCreated  = "sale.created"
+)
+
+// Publisher получает события об изменении остатков, цен и о новых продажах. audience - менеджер,
+// которому адресовано событие, 0 - событие для всех. Publish не должен блокироваться.
+type Publisher interface {
+	Publish(typ string, audience int64, data interface{})
+}
+
+// StockChange - новый остаток товара или его варианта (VariantID не 0).
+type StockChange struct {
+	ProductID int64 `json:"product_id"`
+	VariantID int64 `json:"variant_id"`
+	Qty       int   `json:"qty"`
+}
+
+// SetPublisher задаёт получателя событий; без него события не отправляются.
+func (s *Service) SetPublisher(publisher Publisher) {
+	s.publisher = publisher
+}
+
+func (s *Service) publish(typ string, audience int64, data interface{}) {
+	if s.publisher != nil {
+		s.publisher.Publish(typ, audience, data)
+	}
+}
+
+// publishProduct отправляет изменения цены и остатков товара по сравнению с previous; для нового товара
+// previous - пустой Product.
+func (s *Service) publishProduct(managerID int64, previous *Product, product *Product) {
+	if previous.Price != product.Price {
+		s.publish(EventPriceChanged, 0, &PriceChange{
+			ProductID: product.ID,
+			OldPrice:  previous.Price,
+			Price:     product.Price,
+			ManagerID: managerID,
+			Created:   time.Now(),
+		})
+	}
+	if previous.Qty != product.Qty {
+		s.publish(EventStockChanged, 0, &StockChange{ProductID: product.ID, Qty: product.Qty})
+	}
+}
+
+// publishSale отправляет продажу её менеджеру и новые остатки проданных товаров всем. Остатки читаются
+// заново после продажи; если прочитать их не удалось, событие об остатках пропускается.
+func (s *Service) publishSale(ctx context.Context, sale *Sale) {
+	if s.publisher == nil {
+		return
+	}
+	s.publish(EventSaleCreated, sale.ManagerID, sale)
+
+	ids := make([]int64, 0, len(sale.Positions))
+	for _, position := range sale.Positions {
+		ids = append(ids, position.ProductID)
+	}
+	products, err := s.products.ProductsByIDs(ctx, ids)
+	if err != nil {
+		s.log(ctx).Error("publish stock failed", zap.Error(err))
+		return
+	}
+	byID := make(map[int64]*Product, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+	}
+
+	published := make(map[StockChange]bool)
+	for _, position := range sale.Positions {
+		product, ok := byID[position.ProductID]
+		if !ok {
+			continue
+		}
+		change := StockChange{ProductID: product.ID, VariantID: position.VariantID, Qty: product.Qty}
+		for _, variant := range product.Variants {
+			if variant.ID == position.VariantID {
+				change.Qty = variant.Qty
+			}
+		}
+		if !published[change] {
+			published[change] = true
+			s.publish(EventStockChanged, 0, &change)
+		}
+	}
+}
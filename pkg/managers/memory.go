@@ -0,0 +1,912 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/shohinsherov/crud/pkg/events"
+	"github.com/shohinsherov/crud/pkg/memstore"
+	"github.com/shohinsherov/crud/pkg/outbox"
+)
+
+// errDuplicateSKU соответствует нарушению уникальности sku в Postgres.
+var errDuplicateSKU = errors.New("duplicate sku")
+
+// MemoryRepo - реализация Repository поверх хранилища в памяти.
+type MemoryRepo struct {
+	store *memstore.Store
+}
+
+// NewMemoryRepo создаёт репозиторий поверх store.
+func NewMemoryRepo(store *memstore.Store) *MemoryRepo {
+	return &MemoryRepo{store: store}
+}
+
+func (r *MemoryRepo) CreateManager(ctx context.Context, reg *Registration, isAdmin bool, hash string) (*Registration, error) {
+	err := r.store.Tx(func(d *memstore.Data) error {
+		if d.ManagerByPhone(reg.Phone) != nil {
+			return ErrPhoneUsed
+		}
+		record := &memstore.Manager{
+			ID:       d.NextID(),
+			Name:     reg.Name,
+			Phone:    reg.Phone,
+			Password: hash,
+			IsAdmin:  isAdmin,
+			Created:  d.Now(),
+		}
+		d.Managers[record.ID] = record
+		reg.ID = record.ID
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reg, nil
+}
+
+func (r *MemoryRepo) IsAdmin(ctx context.Context, id int64) (ok bool, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		record, found := d.Managers[id]
+		ok = found && record.IsAdmin
+		return nil
+	})
+	return ok, err
+}
+
+func (r *MemoryRepo) Credentials(ctx context.Context, phone string) (id int64, hash string, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		record := d.ManagerByPhone(phone)
+		if record == nil {
+			return ErrNoSuchUser
+		}
+		id, hash = record.ID, record.Password
+		return nil
+	})
+	return id, hash, err
+}
+
+func (r *MemoryRepo) SetPassword(ctx context.Context, phone string, hash string) error {
+	return r.store.Tx(func(d *memstore.Data) error {
+		record := d.ManagerByPhone(phone)
+		if record == nil {
+			return ErrNoSuchUser
+		}
+		record.Password = hash
+		for token, item := range d.ManagerTokens {
+			if item.OwnerID == record.ID {
+				delete(d.ManagerTokens, token)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *MemoryRepo) Managers(ctx context.Context) (items []*Registration, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		items = make([]*Registration, 0)
+		for _, record := range d.SortedManagers() {
+			if len(items) == 500 {
+				break
+			}
+			items = append(items, managerFrom(record))
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (r *MemoryRepo) ManagersByIDs(ctx context.Context, ids []int64) (items []*Registration, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		items = make([]*Registration, 0, len(ids))
+		for _, id := range uniqueIDs(ids) {
+			if record, ok := d.Managers[id]; ok {
+				items = append(items, managerFrom(record))
+			}
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (r *MemoryRepo) Customers(ctx context.Context) (items []*Customer, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		items = make([]*Customer, 0)
+		for _, record := range d.SortedCustomers() {
+			if record.Active && len(items) < 500 {
+				items = append(items, customerFrom(record))
+			}
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (r *MemoryRepo) CustomerByID(ctx context.Context, id int64) (item *Customer, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		record, ok := d.Customers[id]
+		if !ok {
+			return ErrNotFound
+		}
+		item = customerFrom(record)
+		return nil
+	})
+	return item, err
+}
+
+func (r *MemoryRepo) CustomersByIDs(ctx context.Context, ids []int64) (items []*Customer, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		items = make([]*Customer, 0, len(ids))
+		for _, id := range uniqueIDs(ids) {
+			if record, ok := d.Customers[id]; ok {
+				items = append(items, customerFrom(record))
+			}
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (r *MemoryRepo) CreateCustomer(ctx context.Context, customer *Customer, hash string) (*Customer, error) {
+	err := r.store.Tx(func(d *memstore.Data) error {
+		if d.CustomerByPhone(customer.Phone) != nil {
+			return ErrPhoneUsed
+		}
+		record := &memstore.Customer{
+			ID:       d.NextID(),
+			Name:     customer.Name,
+			Phone:    customer.Phone,
+			Password: hash,
+			Active:   customer.Active,
+			Version:  1,
+			Created:  d.Now(),
+		}
+		d.Customers[record.ID] = record
+		customer.ID = record.ID
+		customer.Version = record.Version
+		customer.Created = record.Created
+		return outbox.Add(d, events.NewCustomerRegistered(customer.ID, customer.Name, customer.Phone, customer.Active, customer.Created))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return customer, nil
+}
+
+func (r *MemoryRepo) RemoveCustomer(ctx context.Context, id int64, version int64) error {
+	return r.store.Tx(func(d *memstore.Data) error {
+		record, ok := d.Customers[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if version != 0 && record.Version != version {
+			return ErrVersionMismatch
+		}
+		for token, record := range d.CustomerTokens {
+			if record.OwnerID == id {
+				delete(d.CustomerTokens, token)
+			}
+		}
+		delete(d.Customers, id)
+		return nil
+	})
+}
+
+func (r *MemoryRepo) ChangeCustomer(ctx context.Context, customer *Customer) (*Customer, error) {
+	err := r.store.Tx(func(d *memstore.Data) error {
+		record, ok := d.Customers[customer.ID]
+		if !ok {
+			return ErrNotFound
+		}
+		if customer.Version != 0 && record.Version != customer.Version {
+			return ErrVersionMismatch
+		}
+		if other := d.CustomerByPhone(customer.Phone); other != nil && other.ID != customer.ID {
+			return ErrPhoneUsed
+		}
+		changed := record.Active != customer.Active
+		record.Name = customer.Name
+		record.Phone = customer.Phone
+		record.Active = customer.Active
+		record.Touch()
+		customer.Version = record.Version
+		customer.Created = record.Created
+		if !changed {
+			return nil
+		}
+		return outbox.Add(d, events.NewCustomerActiveChanged(customer.ID, customer.Active))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return customer, nil
+}
+
+func (r *MemoryRepo) CreateProduct(ctx context.Context, managerID int64, product *Product) (item *Product, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		if d.ProductBySKU(product.SKU) != nil {
+			return errDuplicateSKU
+		}
+		record := &memstore.Product{
+			ID:         d.NextID(),
+			Name:       product.Name,
+			SKU:        product.SKU,
+			Price:      product.Price,
+			Qty:        product.Qty,
+			CategoryID: product.CategoryID,
+			Attributes: memstore.CopyAttributes(product.Attributes),
+			Active:     true,
+			Version:    1,
+			Created:    d.Now(),
+		}
+		d.Products[record.ID] = record
+		recordMemoryPrice(d, record.ID, 0, record.Price, managerID)
+		item = productFrom(d, record)
+		return outbox.Add(d, productChanged(events.ProductCreated, item))
+	})
+	return item, err
+}
+
+func (r *MemoryRepo) UpdateProduct(ctx context.Context, managerID int64, product *Product) (item *Product, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		record, ok := d.Products[product.ID]
+		if !ok {
+			return ErrNotFound
+		}
+		if product.Version != 0 && record.Version != product.Version {
+			return ErrVersionMismatch
+		}
+		if other := d.ProductBySKU(product.SKU); other != nil && other.ID != product.ID {
+			return errDuplicateSKU
+		}
+		if record.Price != product.Price {
+			recordMemoryPrice(d, record.ID, record.Price, product.Price, managerID)
+		}
+		record.Name = product.Name
+		record.SKU = product.SKU
+		record.Price = product.Price
+		record.Qty = product.Qty
+		record.CategoryID = product.CategoryID
+		record.Attributes = memstore.CopyAttributes(product.Attributes)
+		record.Touch()
+		item = productFrom(d, record)
+		return outbox.Add(d, productChanged(events.ProductUpdated, item))
+	})
+	return item, err
+}
+
+func recordMemoryPrice(d *memstore.Data, productID int64, oldPrice int, price int, managerID int64) {
+	d.Prices = append(d.Prices, &memstore.Price{
+		ID:        d.NextID(),
+		ProductID: productID,
+		OldPrice:  oldPrice,
+		Price:     price,
+		ManagerID: managerID,
+		Created:   d.Now(),
+	})
+}
+
+func (r *MemoryRepo) ProductByID(ctx context.Context, id int64) (item *Product, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		record, ok := d.Products[id]
+		if !ok {
+			return ErrNotFound
+		}
+		item = productFrom(d, record)
+		return nil
+	})
+	return item, err
+}
+
+func (r *MemoryRepo) ProductsByIDs(ctx context.Context, ids []int64) (items []*Product, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		items = make([]*Product, 0, len(ids))
+		for _, id := range uniqueIDs(ids) {
+			if record, ok := d.Products[id]; ok {
+				items = append(items, productFrom(d, record))
+			}
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (r *MemoryRepo) ProductIDBySKU(ctx context.Context, sku string) (id int64, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		if record := d.ProductBySKU(sku); record != nil {
+			id = record.ID
+		}
+		return nil
+	})
+	return id, err
+}
+
+func (r *MemoryRepo) Products(ctx context.Context, filter *ProductFilter) (items []*Product, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		items = make([]*Product, 0)
+		for _, record := range d.FilterProducts(filter.CategoryID, filter.Attributes) {
+			if len(items) == 500 {
+				break
+			}
+			items = append(items, productFrom(d, record))
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (r *MemoryRepo) RemoveProduct(ctx context.Context, id int64, version int64) error {
+	return r.store.Tx(func(d *memstore.Data) error {
+		record, ok := d.Products[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if version != 0 && record.Version != version {
+			return ErrVersionMismatch
+		}
+		record.Active = false
+		record.Touch()
+		return outbox.Add(d, productChanged(events.ProductRemoved, productFrom(d, record)))
+	})
+}
+
+func (r *MemoryRepo) AddBarcode(ctx context.Context, item *Barcode) (*Barcode, error) {
+	err := r.store.Tx(func(d *memstore.Data) error {
+		product, ok := d.Products[item.ProductID]
+		if !ok {
+			return ErrNotFound
+		}
+		if item.VariantID != 0 {
+			variant, ok := d.Variants[item.VariantID]
+			if !ok || variant.ProductID != item.ProductID {
+				return ErrNotFound
+			}
+		}
+		if _, ok := d.Barcodes[item.Code]; ok {
+			return ErrBarcodeUsed
+		}
+		d.Barcodes[item.Code] = &memstore.Barcode{Code: item.Code, ProductID: item.ProductID, VariantID: item.VariantID}
+		product.Touch()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (r *MemoryRepo) RemoveBarcode(ctx context.Context, productID int64, code string) error {
+	return r.store.Tx(func(d *memstore.Data) error {
+		record, ok := d.Barcodes[code]
+		if !ok || record.ProductID != productID {
+			return ErrNotFound
+		}
+		delete(d.Barcodes, code)
+		d.Products[productID].Touch()
+		return nil
+	})
+}
+
+func (r *MemoryRepo) LookupBarcode(ctx context.Context, code string) (productID int64, variantID int64, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		record, ok := d.Barcodes[code]
+		if !ok {
+			return ErrNotFound
+		}
+		productID, variantID = record.ProductID, record.VariantID
+		return nil
+	})
+	return productID, variantID, err
+}
+
+func (r *MemoryRepo) LookupSKU(ctx context.Context, sku string) (productID int64, variantID int64, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		if record := d.ProductBySKU(sku); record != nil {
+			productID = record.ID
+			return nil
+		}
+		if record := d.VariantBySKU(sku); record != nil {
+			productID, variantID = record.ProductID, record.ID
+			return nil
+		}
+		return ErrNotFound
+	})
+	return productID, variantID, err
+}
+
+func (r *MemoryRepo) SaveVariant(ctx context.Context, variant *Variant) (*Variant, error) {
+	err := r.store.Tx(func(d *memstore.Data) error {
+		if other := d.VariantBySKU(variant.SKU); other != nil && other.ID != variant.ID {
+			return errDuplicateSKU
+		}
+		product, ok := d.Products[variant.ProductID]
+		if !ok {
+			return ErrNotFound
+		}
+		if variant.ID == 0 {
+			record := &memstore.Variant{
+				ID:         d.NextID(),
+				ProductID:  variant.ProductID,
+				SKU:        variant.SKU,
+				Attributes: memstore.CopyAttributes(variant.Attributes),
+				Qty:        variant.Qty,
+				Active:     true,
+				Created:    d.Now(),
+			}
+			d.Variants[record.ID] = record
+			product.Touch()
+			variant.ID, variant.Active, variant.Created = record.ID, record.Active, record.Created
+			return nil
+		}
+
+		record, ok := d.Variants[variant.ID]
+		if !ok || record.ProductID != variant.ProductID {
+			return ErrNotFound
+		}
+		record.SKU = variant.SKU
+		record.Attributes = memstore.CopyAttributes(variant.Attributes)
+		record.Qty = variant.Qty
+		record.Active = variant.Active
+		product.Touch()
+		variant.Created = record.Created
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return variant, nil
+}
+
+func (r *MemoryRepo) Categories(ctx context.Context) (items []*Category, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		items = make([]*Category, 0)
+		for _, record := range d.SortedCategories() {
+			items = append(items, &Category{ID: record.ID, Name: record.Name, ParentID: record.ParentID, Created: record.Created})
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (r *MemoryRepo) SaveCategory(ctx context.Context, category *Category) (*Category, error) {
+	err := r.store.Tx(func(d *memstore.Data) error {
+		if category.ID == 0 {
+			record := &memstore.Category{ID: d.NextID(), Name: category.Name, ParentID: category.ParentID, Created: d.Now()}
+			d.Categories[record.ID] = record
+			category.ID, category.Created = record.ID, record.Created
+			return nil
+		}
+
+		record, ok := d.Categories[category.ID]
+		if !ok {
+			return ErrNotFound
+		}
+		for parent := d.Categories[category.ParentID]; parent != nil; parent = d.Categories[parent.ParentID] {
+			if parent.ID == category.ID {
+				return ErrInvalidCategory
+			}
+		}
+		record.Name = category.Name
+		record.ParentID = category.ParentID
+		category.Created = record.Created
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+func (r *MemoryRepo) PriceHistory(ctx context.Context, productID int64) (items []*PriceChange, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		items = make([]*PriceChange, 0)
+		for i := len(d.Prices) - 1; i >= 0 && len(items) < 500; i-- {
+			record := d.Prices[i]
+			if record.ProductID != productID {
+				continue
+			}
+			items = append(items, &PriceChange{
+				ID:        record.ID,
+				ProductID: record.ProductID,
+				OldPrice:  record.OldPrice,
+				Price:     record.Price,
+				ManagerID: record.ManagerID,
+				Created:   record.Created,
+			})
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (r *MemoryRepo) ScheduledPrices(ctx context.Context, productID int64) (items []*ScheduledPrice, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		items = make([]*ScheduledPrice, 0)
+		for _, record := range d.ScheduledPrices {
+			if record.ProductID == productID {
+				items = append(items, scheduledPriceFrom(record))
+			}
+		}
+		sort.Slice(items, func(i, j int) bool {
+			if items[i].Effective.Equal(items[j].Effective) {
+				return items[i].ID > items[j].ID
+			}
+			return items[i].Effective.After(items[j].Effective)
+		})
+		if len(items) > 500 {
+			items = items[:500]
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (r *MemoryRepo) SchedulePrice(ctx context.Context, item *ScheduledPrice) (*ScheduledPrice, error) {
+	err := r.store.Tx(func(d *memstore.Data) error {
+		if _, ok := d.Products[item.ProductID]; !ok {
+			return ErrNotFound
+		}
+		record := &memstore.ScheduledPrice{
+			ID:        d.NextID(),
+			ProductID: item.ProductID,
+			Price:     item.Price,
+			ManagerID: item.ManagerID,
+			Effective: item.Effective.UTC(),
+			Status:    PricePending,
+			Created:   d.Now(),
+		}
+		d.ScheduledPrices[record.ID] = record
+		item.ID, item.Status, item.Created = record.ID, record.Status, record.Created
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (r *MemoryRepo) CancelScheduledPrice(ctx context.Context, productID int64, id int64) (item *ScheduledPrice, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		record, ok := d.ScheduledPrices[id]
+		if !ok || record.ProductID != productID || record.Status != PricePending {
+			return ErrNotFound
+		}
+		record.Status = PriceCancelled
+		item = scheduledPriceFrom(record)
+		return nil
+	})
+	return item, err
+}
+
+func (r *MemoryRepo) ApplyScheduledPrices(ctx context.Context) (changes []*PriceChange, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		items := make([]*memstore.ScheduledPrice, 0)
+		for _, record := range d.ScheduledPrices {
+			if record.Status == PricePending && !record.Effective.After(d.Now()) {
+				items = append(items, record)
+			}
+		}
+		sort.Slice(items, func(i, j int) bool {
+			if items[i].Effective.Equal(items[j].Effective) {
+				return items[i].ID < items[j].ID
+			}
+			return items[i].Effective.Before(items[j].Effective)
+		})
+
+		for _, item := range items {
+			product, ok := d.Products[item.ProductID]
+			if !ok {
+				return ErrNotFound
+			}
+			if product.Price != item.Price {
+				recordMemoryPrice(d, product.ID, product.Price, item.Price, item.ManagerID)
+			}
+			changes = append(changes, &PriceChange{
+				ProductID: product.ID,
+				OldPrice:  product.Price,
+				Price:     item.Price,
+				ManagerID: item.ManagerID,
+				Created:   d.Now(),
+			})
+			product.Price = item.Price
+			product.Touch()
+			item.Status = PriceApplied
+			err := outbox.Add(d, productChanged(events.ProductPriced, productFrom(d, product)))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return changes, err
+}
+
+func (r *MemoryRepo) CreateSale(ctx context.Context, sale *Sale) (*Sale, error) {
+	err := r.store.Tx(func(d *memstore.Data) error {
+		// Сначала проверяем все позиции: откатить частично списанные остатки хранилище не умеет.
+		products := make(map[int64]int)
+		variants := make(map[int64]int)
+		for _, position := range sale.Positions {
+			if position.Barcode != "" {
+				record, ok := d.Barcodes[position.Barcode]
+				if !ok || d.Products[record.ProductID] == nil {
+					return ErrNotFound
+				}
+				position.ProductID, position.VariantID = record.ProductID, record.VariantID
+				if position.Price == 0 {
+					position.Price = d.Products[record.ProductID].Price
+				}
+			}
+			if position.VariantID != 0 {
+				variant, ok := d.Variants[position.VariantID]
+				if !ok || !variant.Active || (position.ProductID != 0 && variant.ProductID != position.ProductID) {
+					return ErrNotFound
+				}
+				position.ProductID = variant.ProductID
+				variants[variant.ID] += position.Qty
+				if variant.Qty < variants[variant.ID] {
+					return ErrOutOfStock
+				}
+			} else {
+				products[position.ProductID] += position.Qty
+			}
+			product, ok := d.Products[position.ProductID]
+			if !ok || !product.Active {
+				return ErrNotFound
+			}
+			if position.VariantID == 0 && product.Qty < products[product.ID] {
+				return ErrOutOfStock
+			}
+		}
+
+		record := &memstore.Sale{ID: d.NextID(), ManagerID: sale.ManagerID, CustomerID: sale.CustomerID, Created: d.Now()}
+		d.Sales[record.ID] = record
+		sale.ID, sale.Created = record.ID, record.Created
+		for id, qty := range products {
+			d.Products[id].Qty -= qty
+			d.Products[id].Touch()
+		}
+		for id, qty := range variants {
+			d.Variants[id].Qty -= qty
+			d.Products[d.Variants[id].ProductID].Touch()
+		}
+		for _, position := range sale.Positions {
+			position.ID = d.NextID()
+			position.SaleID = sale.ID
+			position.Created = sale.Created
+			d.Positions = append(d.Positions, &memstore.Position{
+				ID:        position.ID,
+				SaleID:    position.SaleID,
+				ProductID: position.ProductID,
+				VariantID: position.VariantID,
+				Price:     position.Price,
+				Qty:       position.Qty,
+				Created:   position.Created,
+			})
+		}
+		return outbox.Add(d, saleCreated(sale))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sale, nil
+}
+
+func (r *MemoryRepo) SalesTotal(ctx context.Context, managerID int64) (sum int, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		for _, position := range d.Positions {
+			if sale, ok := d.Sales[position.SaleID]; ok && sale.ManagerID == managerID {
+				sum += position.Qty * position.Price
+			}
+		}
+		return nil
+	})
+	return sum, err
+}
+
+func (r *MemoryRepo) Sales(ctx context.Context, filter *SaleFilter) (items []*Sale, err error) {
+	var customers map[int64]bool
+	if filter.CustomerIDs != nil {
+		customers = make(map[int64]bool, len(filter.CustomerIDs))
+		for _, id := range filter.CustomerIDs {
+			customers[id] = true
+		}
+	}
+	err = r.store.Tx(func(d *memstore.Data) error {
+		items = make([]*Sale, 0)
+		sales := make(map[int64]*Sale)
+		perCustomer := make(map[int64]int)
+		for _, record := range d.SortedSales() {
+			if !filter.PerCustomer && len(items) == filter.Limit {
+				break
+			}
+			if (filter.ManagerID != 0 && record.ManagerID != filter.ManagerID) ||
+				(customers != nil && !customers[record.CustomerID]) ||
+				(!filter.From.IsZero() && record.Created.Before(filter.From)) ||
+				(!filter.To.IsZero() && !record.Created.Before(filter.To)) {
+				continue
+			}
+			if filter.PerCustomer {
+				if perCustomer[record.CustomerID] == filter.Limit {
+					continue
+				}
+				perCustomer[record.CustomerID]++
+			}
+			sale := &Sale{ID: record.ID, ManagerID: record.ManagerID, CustomerID: record.CustomerID, Created: record.Created, Positions: make([]*SalePosition, 0)}
+			sales[sale.ID] = sale
+			items = append(items, sale)
+		}
+		for _, position := range d.Positions {
+			if sale, ok := sales[position.SaleID]; ok {
+				sale.Positions = append(sale.Positions, &SalePosition{
+					ID:        position.ID,
+					ProductID: position.ProductID,
+					VariantID: position.VariantID,
+					SaleID:    position.SaleID,
+					Price:     position.Price,
+					Qty:       position.Qty,
+					Created:   position.Created,
+				})
+			}
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (r *MemoryRepo) SalesReport(ctx context.Context, from time.Time, to time.Time) (report *SalesReport, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		report = &SalesReport{From: from, To: to, Products: make([]*ProductSales, 0), Managers: make([]*ManagerSales, 0)}
+		products := make(map[int64]*ProductSales)
+		managers := make(map[int64]*ManagerSales)
+		counted := make(map[int64]bool)
+		for _, position := range d.Positions {
+			sale, ok := d.Sales[position.SaleID]
+			if !ok || sale.Created.Before(from) || !sale.Created.Before(to) {
+				continue
+			}
+			revenue := position.Qty * position.Price
+			product, ok := products[position.ProductID]
+			if !ok {
+				product = &ProductSales{ProductID: position.ProductID}
+				products[product.ProductID] = product
+				report.Products = append(report.Products, product)
+			}
+			manager, ok := managers[sale.ManagerID]
+			if !ok {
+				manager = &ManagerSales{ManagerID: sale.ManagerID}
+				managers[manager.ManagerID] = manager
+				report.Managers = append(report.Managers, manager)
+			}
+			if !counted[sale.ID] {
+				counted[sale.ID] = true
+				report.Sales++
+				manager.Sales++
+			}
+			report.Units += position.Qty
+			report.Revenue += revenue
+			product.Units += position.Qty
+			product.Revenue += revenue
+			manager.Revenue += revenue
+		}
+		sort.Slice(report.Products, func(i, j int) bool {
+			a, b := report.Products[i], report.Products[j]
+			return a.Revenue > b.Revenue || (a.Revenue == b.Revenue && a.ProductID < b.ProductID)
+		})
+		sort.Slice(report.Managers, func(i, j int) bool {
+			a, b := report.Managers[i], report.Managers[j]
+			return a.Revenue > b.Revenue || (a.Revenue == b.Revenue && a.ManagerID < b.ManagerID)
+		})
+		if len(report.Products) > 500 {
+			report.Products = report.Products[:500]
+		}
+		return nil
+	})
+	return report, err
+}
+
+func (r *MemoryRepo) SaveToken(ctx context.Context, token string, managerID int64, ttl time.Duration) error {
+	return r.store.Tx(func(d *memstore.Data) error {
+		d.ManagerTokens[token] = &memstore.Token{Token: token, OwnerID: managerID, Expire: d.Now().Add(ttl)}
+		return nil
+	})
+}
+
+func (r *MemoryRepo) TokenOwner(ctx context.Context, token string) (id int64, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		record, ok := d.ManagerTokens[token]
+		if ok && record.Expire.After(d.Now()) {
+			id = record.OwnerID
+		}
+		return nil
+	})
+	return id, err
+}
+
+func (r *MemoryRepo) PurgeExpiredTokens(ctx context.Context) (n int64, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		for token, record := range d.ManagerTokens {
+			if !record.Expire.After(d.Now()) {
+				delete(d.ManagerTokens, token)
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+// uniqueIDs возвращает ids без повторов по возрастанию, как выборка WHERE id = ANY(...) ORDER BY id.
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	items := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			items = append(items, id)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i] < items[j] })
+	return items
+}
+
+func managerFrom(record *memstore.Manager) *Registration {
+	return &Registration{ID: record.ID, Name: record.Name, Phone: record.Phone, Roles: managerRoles(record.IsAdmin)}
+}
+
+func customerFrom(record *memstore.Customer) *Customer {
+	return &Customer{
+		ID:      record.ID,
+		Name:    record.Name,
+		Phone:   record.Phone,
+		Active:  record.Active,
+		Version: record.Version,
+		Created: record.Created,
+	}
+}
+
+func productFrom(d *memstore.Data, record *memstore.Product) *Product {
+	item := &Product{
+		ID:         record.ID,
+		Name:       record.Name,
+		SKU:        record.SKU,
+		Price:      record.Price,
+		Qty:        record.Qty,
+		CategoryID: record.CategoryID,
+		Attributes: memstore.CopyAttributes(record.Attributes),
+		Variants:   make([]*Variant, 0),
+		Barcodes:   make([]*Barcode, 0),
+		Active:     record.Active,
+		Version:    record.Version,
+		Created:    record.Created,
+	}
+	for _, variant := range d.ProductVariants(record.ID, false) {
+		item.Variants = append(item.Variants, &Variant{
+			ID:         variant.ID,
+			ProductID:  variant.ProductID,
+			SKU:        variant.SKU,
+			Attributes: memstore.CopyAttributes(variant.Attributes),
+			Qty:        variant.Qty,
+			Active:     variant.Active,
+			Created:    variant.Created,
+		})
+	}
+	for _, code := range d.ProductBarcodes(record.ID) {
+		item.Barcodes = append(item.Barcodes, &Barcode{Code: code.Code, ProductID: code.ProductID, VariantID: code.VariantID})
+	}
+	return item
+}
+
+func scheduledPriceFrom(record *memstore.ScheduledPrice) *ScheduledPrice {
+	return &ScheduledPrice{
+		ID:        record.ID,
+		ProductID: record.ProductID,
+		Price:     record.Price,
+		ManagerID: record.ManagerID,
+		Effective: record.Effective,
+		Status:    record.Status,
+		Created:   record.Created,
+	}
+}
@@ -0,0 +1,1152 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shohinsherov/crud/pkg/events"
+	"github.com/shohinsherov/crud/pkg/outbox"
+)
+
+// PgxRepo - реализация Repository поверх Postgres.
+type PgxRepo struct {
+	pool *pgxpool.Pool
+}
+
+// NewPgxRepo создаёт репозиторий поверх пула соединений.
+func NewPgxRepo(pool *pgxpool.Pool) *PgxRepo {
+	return &PgxRepo{pool: pool}
+}
+
+func (r *PgxRepo) CreateManager(ctx context.Context, reg *Registration, isAdmin bool, hash string) (*Registration, error) {
+	err := r.pool.QueryRow(ctx, `
+	INSERT INTO managers(name,phone,password,is_admin) VALUES ($1,$2,NULLIF($3,''),$4) ON CONFLICT (phone) DO NOTHING RETURNING id
+	`, reg.Name, reg.Phone, hash, isAdmin).Scan(&reg.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPhoneUsed
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reg, nil
+}
+
+func (r *PgxRepo) IsAdmin(ctx context.Context, id int64) (ok bool, err error) {
+	err = r.pool.QueryRow(ctx, `
+	SELECT is_admin FROM managers  WHERE id = $1
+	`, id).Scan(&ok)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return ok, err
+}
+
+func (r *PgxRepo) Credentials(ctx context.Context, phone string) (int64, string, error) {
+	var id int64
+	var hash string
+	err := r.pool.QueryRow(ctx, `SELECT id,COALESCE(password,'') From managers WHERE phone = $1`, phone).Scan(&id, &hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, "", ErrNoSuchUser
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	return id, hash, nil
+}
+
+func (r *PgxRepo) SetPassword(ctx context.Context, phone string, hash string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var id int64
+	err = tx.QueryRow(ctx, `
+	UPDATE managers SET password = $2 WHERE phone = $1 RETURNING id
+	`, phone, hash).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNoSuchUser
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM managers_tokens WHERE manager_id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *PgxRepo) Managers(ctx context.Context) ([]*Registration, error) {
+	return r.queryManagers(ctx, `SELECT id, name, phone, is_admin FROM managers ORDER BY id LIMIT 500`)
+}
+
+func (r *PgxRepo) ManagersByIDs(ctx context.Context, ids []int64) ([]*Registration, error) {
+	return r.queryManagers(ctx, `SELECT id, name, phone, is_admin FROM managers WHERE id = ANY($1) ORDER BY id`, ids)
+}
+
+func (r *PgxRepo) queryManagers(ctx context.Context, sql string, args ...interface{}) ([]*Registration, error) {
+	items := make([]*Registration, 0)
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Registration{}
+		var admin bool
+		err = rows.Scan(&item.ID, &item.Name, &item.Phone, &admin)
+		if err != nil {
+			return nil, err
+		}
+		item.Roles = managerRoles(admin)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (r *PgxRepo) Customers(ctx context.Context) ([]*Customer, error) {
+	items := make([]*Customer, 0)
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, name, phone, active, version, created FROM customers WHERE active = TRUE ORDER BY id LIMIT 500
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Customer{}
+		err = rows.Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Version, &item.Created)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (r *PgxRepo) CustomerByID(ctx context.Context, id int64) (*Customer, error) {
+	item := &Customer{}
+	err := r.pool.QueryRow(ctx, `
+	SELECT id, name, phone, active, version, created FROM customers WHERE id = $1
+	`, id).Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Version, &item.Created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (r *PgxRepo) CustomersByIDs(ctx context.Context, ids []int64) ([]*Customer, error) {
+	items := make([]*Customer, 0, len(ids))
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, name, phone, active, version, created FROM customers WHERE id = ANY($1) ORDER BY id
+	`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Customer{}
+		err = rows.Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Version, &item.Created)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (r *PgxRepo) CreateCustomer(ctx context.Context, customer *Customer, hash string) (*Customer, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+	INSERT INTO customers(name,phone,password,active) VALUES ($1,$2,$3,$4) ON CONFLICT (phone) DO NOTHING RETURNING id,active,version,created
+	`, customer.Name, customer.Phone, hash, customer.Active).Scan(&customer.ID, &customer.Active, &customer.Version, &customer.Created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPhoneUsed
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = outbox.Insert(ctx, tx, events.NewCustomerRegistered(customer.ID, customer.Name, customer.Phone, customer.Active, customer.Created))
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return customer, nil
+}
+
+func (r *PgxRepo) RemoveCustomer(ctx context.Context, id int64, version int64) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var current int64
+	err = tx.QueryRow(ctx, `SELECT version FROM customers WHERE id = $1 FOR UPDATE`, id).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if version != 0 && current != version {
+		return ErrVersionMismatch
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM customers_tokens WHERE customer_id = $1`, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+	DELETE from customers where id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *PgxRepo) ChangeCustomer(ctx context.Context, customer *Customer) (*Customer, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var wasActive bool
+	err = tx.QueryRow(ctx, `
+	UPDATE customers c SET name = $2, phone = $3, active = $4 FROM (SELECT id, active FROM customers WHERE id = $1 FOR UPDATE) old
+	WHERE c.id = old.id AND ($5::BIGINT = 0 OR c.version = $5) RETURNING c.name,c.phone,c.active,c.version,c.created,old.active
+	`, customer.ID, customer.Name, customer.Phone, customer.Active, customer.Version).Scan(&customer.Name, &customer.Phone, &customer.Active, &customer.Version, &customer.Created, &wasActive)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, r.notUpdated(ctx, "customers", customer.ID)
+	}
+	if isUniqueViolation(err) {
+		return nil, ErrPhoneUsed
+	}
+	if err != nil {
+		return nil, err
+	}
+	if wasActive != customer.Active {
+		err = outbox.Insert(ctx, tx, events.NewCustomerActiveChanged(customer.ID, customer.Active))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return customer, nil
+}
+
+// isUniqueViolation сообщает, что запрос нарушил ограничение уникальности.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func (r *PgxRepo) CreateProduct(ctx context.Context, managerID int64, product *Product) (*Product, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+	INSERT INTO products(name,sku,qty,price,category_id,attributes) VALUES ($1,NULLIF($6,''),$2,$3,NULLIF($4::BIGINT,0),$5) RETURNING id,name,COALESCE(sku,''),qty,price,COALESCE(category_id,0),attributes,active,version,created;
+	`, product.Name, product.Qty, product.Price, product.CategoryID, product.Attributes, product.SKU).Scan(&product.ID, &product.Name, &product.SKU, &product.Qty, &product.Price, &product.CategoryID, &product.Attributes, &product.Active, &product.Version, &product.Created)
+	if err != nil {
+		return nil, err
+	}
+	err = recordPrice(ctx, tx, product.ID, 0, product.Price, managerID)
+	if err != nil {
+		return nil, err
+	}
+	err = outbox.Insert(ctx, tx, productChanged(events.ProductCreated, product))
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	product.Variants = make([]*Variant, 0)
+	product.Barcodes = make([]*Barcode, 0)
+	return product, nil
+}
+
+func (r *PgxRepo) UpdateProduct(ctx context.Context, managerID int64, product *Product) (*Product, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var oldPrice int
+	var version int64
+	err = tx.QueryRow(ctx, `SELECT price, version FROM products WHERE id = $1 FOR UPDATE`, product.ID).Scan(&oldPrice, &version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if product.Version != 0 && product.Version != version {
+		return nil, ErrVersionMismatch
+	}
+
+	err = tx.QueryRow(ctx, `
+	UPDATE  products SET  name=$1,sku=NULLIF($7,''),qty=$2,price=$3,category_id=NULLIF($5::BIGINT,0),attributes=$6  WHERE id = $4 RETURNING id,name,COALESCE(sku,''),qty,price,COALESCE(category_id,0),attributes,active,version,created;
+	`, product.Name, product.Qty, product.Price, product.ID, product.CategoryID, product.Attributes, product.SKU).Scan(&product.ID, &product.Name, &product.SKU, &product.Qty, &product.Price, &product.CategoryID, &product.Attributes, &product.Active, &product.Version, &product.Created)
+	if err != nil {
+		return nil, err
+	}
+	if oldPrice != product.Price {
+		err = recordPrice(ctx, tx, product.ID, oldPrice, product.Price, managerID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = outbox.Insert(ctx, tx, productChanged(events.ProductUpdated, product))
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.loadProductDetails(ctx, []*Product{product})
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// recordPrice добавляет запись в историю цен в рамках транзакции изменения товара.
+func recordPrice(ctx context.Context, tx pgx.Tx, productID int64, oldPrice int, price int, managerID int64) error {
+	_, err := tx.Exec(ctx, `
+	INSERT INTO product_prices(product_id, old_price, price, manager_id) VALUES ($1, $2, $3, NULLIF($4::BIGINT, 0))
+	`, productID, oldPrice, price, managerID)
+	return err
+}
+
+func (r *PgxRepo) ProductByID(ctx context.Context, id int64) (*Product, error) {
+	product := &Product{}
+	err := r.pool.QueryRow(ctx, `
+	SELECT id,name,COALESCE(sku,''),qty,price,COALESCE(category_id,0),attributes,active,version,created FROM products WHERE id = $1
+	`, id).Scan(&product.ID, &product.Name, &product.SKU, &product.Qty, &product.Price, &product.CategoryID, &product.Attributes, &product.Active, &product.Version, &product.Created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = r.loadProductDetails(ctx, []*Product{product})
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+func (r *PgxRepo) ProductsByIDs(ctx context.Context, ids []int64) ([]*Product, error) {
+	items := make([]*Product, 0, len(ids))
+	rows, err := r.pool.Query(ctx, `
+		SELECT id,name,COALESCE(sku,''),qty,price,COALESCE(category_id,0),attributes,active,version,created FROM products
+		WHERE id = ANY($1) ORDER BY id
+	`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Product{}
+		err = rows.Scan(&item.ID, &item.Name, &item.SKU, &item.Qty, &item.Price, &item.CategoryID, &item.Attributes, &item.Active, &item.Version, &item.Created)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	err = r.loadProductDetails(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *PgxRepo) ProductIDBySKU(ctx context.Context, sku string) (int64, error) {
+	var id int64
+	err := r.pool.QueryRow(ctx, `SELECT id FROM products WHERE sku = $1`, sku).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+func (r *PgxRepo) Products(ctx context.Context, filter *ProductFilter) ([]*Product, error) {
+	items := make([]*Product, 0)
+	attributes := filter.Attributes
+	if attributes == nil {
+		attributes = map[string]string{}
+	}
+	rows, err := r.pool.Query(ctx, `
+		SELECT p.id, p.name, COALESCE(p.sku, ''), p.price, p.qty, COALESCE(p.category_id, 0), p.attributes, p.version FROM products p
+		WHERE p.active = TRUE
+		AND ($1::BIGINT = 0 OR p.category_id IN (
+			WITH RECURSIVE tree AS (
+				SELECT id FROM categories WHERE id = $1
+				UNION
+				SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+			)
+			SELECT id FROM tree
+		))
+		AND (p.attributes @> $2::JSONB OR EXISTS (
+			SELECT 1 FROM product_variants v WHERE v.product_id = p.id AND v.active AND (p.attributes || v.attributes) @> $2::JSONB
+		))
+		ORDER BY p.id LIMIT 500
+	`, filter.CategoryID, attributes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Product{}
+		err = rows.Scan(&item.ID, &item.Name, &item.SKU, &item.Price, &item.Qty, &item.CategoryID, &item.Attributes, &item.Version)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	err = r.loadProductDetails(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (r *PgxRepo) RemoveProduct(ctx context.Context, id int64, version int64) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	product := &Product{}
+	err = tx.QueryRow(ctx, `
+	UPDATE products SET active = FALSE WHERE id = $1 AND ($2::BIGINT = 0 OR version = $2)
+	RETURNING id,name,COALESCE(sku,''),qty,price,active,version
+	`, id, version).Scan(&product.ID, &product.Name, &product.SKU, &product.Qty, &product.Price, &product.Active, &product.Version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return r.notUpdated(ctx, "products", id)
+	}
+	if err != nil {
+		return err
+	}
+	err = outbox.Insert(ctx, tx, productChanged(events.ProductRemoved, product))
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// notUpdated объясняет, почему условное изменение записи id в table не затронуло ни одной строки:
+// записи нет (ErrNotFound) или её версия другая (ErrVersionMismatch).
+func (r *PgxRepo) notUpdated(ctx context.Context, table string, id int64) error {
+	var exists bool
+	err := r.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM `+table+` WHERE id = $1)`, id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrVersionMismatch
+	}
+	return ErrNotFound
+}
+
+// loadProductDetails загружает варианты и штрихкоды товаров.
+func (r *PgxRepo) loadProductDetails(ctx context.Context, products []*Product) error {
+	ids := make([]int64, 0, len(products))
+	for _, product := range products {
+		ids = append(ids, product.ID)
+	}
+	variants, err := r.variants(ctx, ids)
+	if err != nil {
+		return err
+	}
+	barcodes, err := r.barcodes(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, product := range products {
+		product.Variants = variants[product.ID]
+		product.Barcodes = barcodes[product.ID]
+	}
+	return nil
+}
+
+func (r *PgxRepo) variants(ctx context.Context, productIDs []int64) (map[int64][]*Variant, error) {
+	items := make(map[int64][]*Variant, len(productIDs))
+	for _, id := range productIDs {
+		items[id] = make([]*Variant, 0)
+	}
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, product_id, sku, attributes, qty, active, created FROM product_variants WHERE product_id = ANY($1) ORDER BY id
+	`, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Variant{}
+		err = rows.Scan(&item.ID, &item.ProductID, &item.SKU, &item.Attributes, &item.Qty, &item.Active, &item.Created)
+		if err != nil {
+			return nil, err
+		}
+		items[item.ProductID] = append(items[item.ProductID], item)
+	}
+	return items, rows.Err()
+}
+
+func (r *PgxRepo) barcodes(ctx context.Context, productIDs []int64) (map[int64][]*Barcode, error) {
+	items := make(map[int64][]*Barcode, len(productIDs))
+	for _, id := range productIDs {
+		items[id] = make([]*Barcode, 0)
+	}
+	rows, err := r.pool.Query(ctx, `
+		SELECT barcode, product_id, COALESCE(variant_id, 0) FROM product_barcodes WHERE product_id = ANY($1) ORDER BY barcode
+	`, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Barcode{}
+		err = rows.Scan(&item.Code, &item.ProductID, &item.VariantID)
+		if err != nil {
+			return nil, err
+		}
+		items[item.ProductID] = append(items[item.ProductID], item)
+	}
+	return items, rows.Err()
+}
+
+func (r *PgxRepo) AddBarcode(ctx context.Context, item *Barcode) (*Barcode, error) {
+	err := r.pool.QueryRow(ctx, `
+	INSERT INTO product_barcodes(barcode,product_id,variant_id)
+	SELECT $1, p.id, NULLIF($3::BIGINT,0) FROM products p
+	WHERE p.id = $2 AND ($3 = 0 OR EXISTS (SELECT 1 FROM product_variants v WHERE v.id = $3 AND v.product_id = p.id))
+	ON CONFLICT (barcode) DO NOTHING
+	RETURNING barcode
+	`, item.Code, item.ProductID, item.VariantID).Scan(&item.Code)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Штрихкод не добавлен: либо нет товара или варианта, либо код занят.
+		var exists bool
+		err = r.pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM products WHERE id = $1)
+			AND ($2 = 0 OR EXISTS (SELECT 1 FROM product_variants WHERE id = $2 AND product_id = $1))
+		`, item.ProductID, item.VariantID).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrNotFound
+		}
+		return nil, ErrBarcodeUsed
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (r *PgxRepo) RemoveBarcode(ctx context.Context, productID int64, code string) error {
+	tag, err := r.pool.Exec(ctx, `
+	DELETE FROM product_barcodes WHERE barcode = $1 AND product_id = $2
+	`, code, productID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PgxRepo) LookupBarcode(ctx context.Context, code string) (productID int64, variantID int64, err error) {
+	err = r.pool.QueryRow(ctx, `
+	SELECT product_id, COALESCE(variant_id, 0) FROM product_barcodes WHERE barcode = $1
+	`, code).Scan(&productID, &variantID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, ErrNotFound
+	}
+	return productID, variantID, err
+}
+
+func (r *PgxRepo) LookupSKU(ctx context.Context, sku string) (productID int64, variantID int64, err error) {
+	err = r.pool.QueryRow(ctx, `
+	SELECT id, 0 FROM products WHERE sku = $1
+	UNION ALL
+	SELECT product_id, id FROM product_variants WHERE sku = $1
+	ORDER BY 2
+	LIMIT 1
+	`, sku).Scan(&productID, &variantID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, ErrNotFound
+	}
+	return productID, variantID, err
+}
+
+func (r *PgxRepo) SaveVariant(ctx context.Context, variant *Variant) (*Variant, error) {
+	var err error
+	if variant.ID == 0 {
+		err = r.pool.QueryRow(ctx, `
+		INSERT INTO product_variants(product_id,sku,attributes,qty) VALUES ($1,$2,$3,$4) RETURNING id,active,created
+		`, variant.ProductID, variant.SKU, variant.Attributes, variant.Qty).Scan(&variant.ID, &variant.Active, &variant.Created)
+	} else {
+		err = r.pool.QueryRow(ctx, `
+		UPDATE product_variants SET sku=$3,attributes=$4,qty=$5,active=$6 WHERE id = $1 AND product_id = $2 RETURNING created
+		`, variant.ID, variant.ProductID, variant.SKU, variant.Attributes, variant.Qty, variant.Active).Scan(&variant.Created)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return variant, nil
+}
+
+func (r *PgxRepo) Categories(ctx context.Context) ([]*Category, error) {
+	items := make([]*Category, 0)
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, name, COALESCE(parent_id, 0), created FROM categories ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Category{}
+		err = rows.Scan(&item.ID, &item.Name, &item.ParentID, &item.Created)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (r *PgxRepo) SaveCategory(ctx context.Context, category *Category) (*Category, error) {
+	var err error
+	if category.ID == 0 {
+		err = r.pool.QueryRow(ctx, `
+		INSERT INTO categories(name,parent_id) VALUES ($1,NULLIF($2::BIGINT,0)) RETURNING id,created
+		`, category.Name, category.ParentID).Scan(&category.ID, &category.Created)
+	} else {
+		err = r.updateCategory(ctx, category)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// updateCategory меняет категорию, проверив, что новый родитель не вложен в неё. Блокировка таблицы не даёт
+// двум одновременным переносам замкнуть цикл.
+func (r *PgxRepo) updateCategory(ctx context.Context, category *Category) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE`)
+	if err != nil {
+		return err
+	}
+	var cycle bool
+	err = tx.QueryRow(ctx, `
+		WITH RECURSIVE parents AS (
+			SELECT id, parent_id FROM categories WHERE id = $2
+			UNION
+			SELECT c.id, c.parent_id FROM categories c JOIN parents p ON c.id = p.parent_id
+		)
+		SELECT EXISTS (SELECT 1 FROM parents WHERE id = $1)
+	`, category.ID, category.ParentID).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return ErrInvalidCategory
+	}
+	err = tx.QueryRow(ctx, `
+		UPDATE categories SET name=$2,parent_id=NULLIF($3::BIGINT,0) WHERE id = $1 RETURNING created
+	`, category.ID, category.Name, category.ParentID).Scan(&category.Created)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *PgxRepo) PriceHistory(ctx context.Context, productID int64) ([]*PriceChange, error) {
+	items := make([]*PriceChange, 0)
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, product_id, old_price, price, COALESCE(manager_id, 0), created FROM product_prices
+		WHERE product_id = $1 ORDER BY created DESC, id DESC LIMIT 500
+	`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &PriceChange{}
+		err = rows.Scan(&item.ID, &item.ProductID, &item.OldPrice, &item.Price, &item.ManagerID, &item.Created)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (r *PgxRepo) ScheduledPrices(ctx context.Context, productID int64) ([]*ScheduledPrice, error) {
+	items := make([]*ScheduledPrice, 0)
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, product_id, price, manager_id, effective, status, created FROM scheduled_prices
+		WHERE product_id = $1 ORDER BY effective DESC, id DESC LIMIT 500
+	`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &ScheduledPrice{}
+		err = rows.Scan(&item.ID, &item.ProductID, &item.Price, &item.ManagerID, &item.Effective, &item.Status, &item.Created)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (r *PgxRepo) SchedulePrice(ctx context.Context, item *ScheduledPrice) (*ScheduledPrice, error) {
+	err := r.pool.QueryRow(ctx, `
+	INSERT INTO scheduled_prices(product_id, price, manager_id, effective) VALUES ($1, $2, $3, $4) RETURNING id, status, created
+	`, item.ProductID, item.Price, item.ManagerID, item.Effective.UTC()).Scan(&item.ID, &item.Status, &item.Created)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (r *PgxRepo) CancelScheduledPrice(ctx context.Context, productID int64, id int64) (*ScheduledPrice, error) {
+	item := &ScheduledPrice{}
+	err := r.pool.QueryRow(ctx, `
+	UPDATE scheduled_prices SET status = $3 WHERE id = $1 AND product_id = $2 AND status = $4
+	RETURNING id, product_id, price, manager_id, effective, status, created
+	`, id, productID, PriceCancelled, PricePending).Scan(&item.ID, &item.ProductID, &item.Price, &item.ManagerID, &item.Effective, &item.Status, &item.Created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// ApplyScheduledPrices блокирует строки через SKIP LOCKED, поэтому несколько экземпляров
+// не применят одно изменение дважды.
+func (r *PgxRepo) ApplyScheduledPrices(ctx context.Context) ([]*PriceChange, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, product_id, price, manager_id FROM scheduled_prices
+		WHERE status = $1 AND effective <= CURRENT_TIMESTAMP
+		ORDER BY effective, id
+		FOR UPDATE SKIP LOCKED
+	`, PricePending)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*ScheduledPrice, 0)
+	for rows.Next() {
+		item := &ScheduledPrice{}
+		err = rows.Scan(&item.ID, &item.ProductID, &item.Price, &item.ManagerID)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]*PriceChange, 0, len(items))
+	for _, item := range items {
+		var oldPrice int
+		err = tx.QueryRow(ctx, `SELECT price FROM products WHERE id = $1 FOR UPDATE`, item.ProductID).Scan(&oldPrice)
+		if err != nil {
+			return nil, err
+		}
+		product := &Product{}
+		err = tx.QueryRow(ctx, `
+		UPDATE products SET price = $2 WHERE id = $1 RETURNING id,name,COALESCE(sku,''),qty,price,active,version
+		`, item.ProductID, item.Price).Scan(&product.ID, &product.Name, &product.SKU, &product.Qty, &product.Price, &product.Active, &product.Version)
+		if err != nil {
+			return nil, err
+		}
+		err = outbox.Insert(ctx, tx, productChanged(events.ProductPriced, product))
+		if err != nil {
+			return nil, err
+		}
+		if oldPrice != item.Price {
+			err = recordPrice(ctx, tx, item.ProductID, oldPrice, item.Price, item.ManagerID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		_, err = tx.Exec(ctx, `UPDATE scheduled_prices SET status = $2 WHERE id = $1`, item.ID, PriceApplied)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, &PriceChange{
+			ProductID: item.ProductID,
+			OldPrice:  oldPrice,
+			Price:     item.Price,
+			ManagerID: item.ManagerID,
+			Created:   time.Now(),
+		})
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (r *PgxRepo) CreateSale(ctx context.Context, sale *Sale) (*Sale, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+	INSERT INTO sales(manager_id,customer_id) VALUES ($1,$2) RETURNING id, created;
+	`, sale.ManagerID, sale.CustomerID).Scan(&sale.ID, &sale.Created)
+	if err != nil {
+		return nil, err
+	}
+	for _, position := range sale.Positions {
+		if position.Barcode != "" {
+			err = resolveBarcode(ctx, tx, position)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = takeStock(ctx, tx, position)
+		if err != nil {
+			return nil, err
+		}
+		position.SaleID = sale.ID
+		err = tx.QueryRow(ctx, `
+		INSERT INTO sales_positions (sale_id,product_id,variant_id,qty,price) VALUES ($1,$2,NULLIF($3::BIGINT,0),$4,$5) RETURNING id, created
+		`, sale.ID, position.ProductID, position.VariantID, position.Qty, position.Price).Scan(&position.ID, &position.Created)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = outbox.Insert(ctx, tx, saleCreated(sale))
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sale, nil
+}
+
+// resolveBarcode заполняет товар, вариант и (если не указана) цену позиции по штрихкоду.
+func resolveBarcode(ctx context.Context, tx pgx.Tx, position *SalePosition) error {
+	var price int
+	err := tx.QueryRow(ctx, `
+	SELECT b.product_id, COALESCE(b.variant_id, 0), p.price FROM product_barcodes b JOIN products p ON p.id = b.product_id WHERE b.barcode = $1
+	`, position.Barcode).Scan(&position.ProductID, &position.VariantID, &price)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if position.Price == 0 {
+		position.Price = price
+	}
+	return nil
+}
+
+// takeStock списывает остаток товара или, если указан вариант, остаток варианта. Возвращает ErrNotFound,
+// если товара или варианта нет или он снят с продажи, и ErrOutOfStock, если не хватает остатка.
+func takeStock(ctx context.Context, tx pgx.Tx, position *SalePosition) error {
+	if position.VariantID != 0 {
+		var qty int
+		err := tx.QueryRow(ctx, `
+		SELECT v.qty FROM product_variants v JOIN products p ON p.id = v.product_id
+		WHERE v.id = $1 AND v.active AND p.active AND ($2::BIGINT = 0 OR v.product_id = $2)
+		FOR UPDATE OF v
+		`, position.VariantID, position.ProductID).Scan(&qty)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if qty < position.Qty {
+			return ErrOutOfStock
+		}
+		return tx.QueryRow(ctx, `
+		UPDATE product_variants SET qty = qty - $2 WHERE id = $1 RETURNING product_id
+		`, position.VariantID, position.Qty).Scan(&position.ProductID)
+	}
+
+	var qty int
+	err := tx.QueryRow(ctx, `
+	SELECT qty FROM products WHERE id = $1 AND active FOR UPDATE
+	`, position.ProductID).Scan(&qty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if qty < position.Qty {
+		return ErrOutOfStock
+	}
+	_, err = tx.Exec(ctx, `UPDATE products SET qty = qty - $2 WHERE id = $1`, position.ProductID, position.Qty)
+	return err
+}
+
+func (r *PgxRepo) SalesTotal(ctx context.Context, managerID int64) (sum int, err error) {
+	err = r.pool.QueryRow(ctx, `
+	SELECT COALESCE(SUM(sp.qty * sp.price),0) total
+	FROM sales s
+	JOIN sales_positions sp ON sp.sale_id = s.id
+	WHERE s.manager_id = $1`, managerID).Scan(&sum)
+	return sum, err
+}
+
+func (r *PgxRepo) Sales(ctx context.Context, filter *SaleFilter) ([]*Sale, error) {
+	items := make([]*Sale, 0)
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, manager_id, customer_id, created FROM (
+			SELECT id, manager_id, customer_id, created,
+			ROW_NUMBER() OVER (PARTITION BY CASE WHEN $6::BOOLEAN THEN customer_id END ORDER BY id DESC) n
+			FROM sales
+			WHERE ($1::BIGINT = 0 OR manager_id = $1)
+			AND ($2::BIGINT[] IS NULL OR customer_id = ANY($2))
+			AND ($3::TIMESTAMP IS NULL OR created >= $3)
+			AND ($4::TIMESTAMP IS NULL OR created < $4)
+		) s WHERE n <= $5 ORDER BY id DESC
+	`, filter.ManagerID, filter.CustomerIDs, nullTime(filter.From), nullTime(filter.To), filter.Limit, filter.PerCustomer)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		item := &Sale{}
+		err = rows.Scan(&item.ID, &item.ManagerID, &item.CustomerID, &item.Created)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		ids = append(ids, item.ID)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	positions, err := r.positions(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		item.Positions = positions[item.ID]
+	}
+	return items, nil
+}
+
+// positions загружает позиции продаж.
+func (r *PgxRepo) positions(ctx context.Context, saleIDs []int64) (map[int64][]*SalePosition, error) {
+	items := make(map[int64][]*SalePosition, len(saleIDs))
+	for _, id := range saleIDs {
+		items[id] = make([]*SalePosition, 0)
+	}
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, sale_id, product_id, COALESCE(variant_id, 0), price, qty, created FROM sales_positions WHERE sale_id = ANY($1) ORDER BY id
+	`, saleIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &SalePosition{}
+		err = rows.Scan(&item.ID, &item.SaleID, &item.ProductID, &item.VariantID, &item.Price, &item.Qty, &item.Created)
+		if err != nil {
+			return nil, err
+		}
+		items[item.SaleID] = append(items[item.SaleID], item)
+	}
+	return items, rows.Err()
+}
+
+func (r *PgxRepo) SalesReport(ctx context.Context, from time.Time, to time.Time) (*SalesReport, error) {
+	report := &SalesReport{From: from, To: to, Products: make([]*ProductSales, 0), Managers: make([]*ManagerSales, 0)}
+	err := r.pool.QueryRow(ctx, `
+	SELECT COUNT(DISTINCT s.id), COALESCE(SUM(sp.qty), 0), COALESCE(SUM(sp.qty * sp.price), 0)
+	FROM sales s JOIN sales_positions sp ON sp.sale_id = s.id
+	WHERE s.created >= $1 AND s.created < $2
+	`, from, to).Scan(&report.Sales, &report.Units, &report.Revenue)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT sp.product_id, SUM(sp.qty), SUM(sp.qty * sp.price) revenue
+		FROM sales s JOIN sales_positions sp ON sp.sale_id = s.id
+		WHERE s.created >= $1 AND s.created < $2
+		GROUP BY sp.product_id ORDER BY revenue DESC, sp.product_id LIMIT 500
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		item := &ProductSales{}
+		err = rows.Scan(&item.ProductID, &item.Units, &item.Revenue)
+		if err != nil {
+			return nil, err
+		}
+		report.Products = append(report.Products, item)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = r.pool.Query(ctx, `
+		SELECT s.manager_id, COUNT(DISTINCT s.id), SUM(sp.qty * sp.price) revenue
+		FROM sales s JOIN sales_positions sp ON sp.sale_id = s.id
+		WHERE s.created >= $1 AND s.created < $2
+		GROUP BY s.manager_id ORDER BY revenue DESC, s.manager_id
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		item := &ManagerSales{}
+		err = rows.Scan(&item.ManagerID, &item.Sales, &item.Revenue)
+		if err != nil {
+			return nil, err
+		}
+		report.Managers = append(report.Managers, item)
+	}
+	return report, rows.Err()
+}
+
+// nullTime передаёт нулевое время как NULL, чтобы условие по нему не применялось.
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (r *PgxRepo) SaveToken(ctx context.Context, token string, managerID int64, ttl time.Duration) error {
+	_, err := r.pool.Exec(ctx, `INSERT INTO managers_tokens(token,manager_id,expire) VALUES($1,$2,CURRENT_TIMESTAMP + make_interval(secs => $3))`, token, managerID, ttl.Seconds())
+	return err
+}
+
+func (r *PgxRepo) TokenOwner(ctx context.Context, token string) (int64, error) {
+	var id int64
+	err := r.pool.QueryRow(ctx, `
+	SELECT manager_id FROM managers_tokens WHERE token = $1 AND expire > CURRENT_TIMESTAMP
+	`, token).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (r *PgxRepo) PurgeExpiredTokens(ctx context.Context) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM managers_tokens WHERE expire <= CURRENT_TIMESTAMP`)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
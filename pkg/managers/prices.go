@@ -0,0 +1,130 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrInvalidPrice возвращается, когда цена или дата её вступления в силу некорректны.
+var ErrInvalidPrice = errors.New("invalid price")
+
+// Статусы запланированного изменения цены.
+const (
+	PricePending   = "PENDING"
+	PriceApplied   = "APPLIED"
+	PriceCancelled = "CANCELLED"
+)
+
+// PriceChange - запись истории цены товара.
+type PriceChange struct {
+	ID        int64     `json:"id"`
+	ProductID int64     `json:"product_id"`
+	OldPrice  int       `json:"old_price"`
+	Price     int       `json:"price"`
+	ManagerID int64     `json:"manager_id"`
+	Created   time.Time `json:"created"`
+}
+
+// ScheduledPrice - изменение цены, которое вступит в силу в момент Effective.
+type ScheduledPrice struct {
+	ID        int64     `json:"id"`
+	ProductID int64     `json:"product_id"`
+	Price     int       `json:"price"`
+	ManagerID int64     `json:"manager_id"`
+	Effective time.Time `json:"effective"`
+	Status    string    `json:"status"`
+	Created   time.Time `json:"created"`
+}
+
+// PriceHistory возвращает историю цен товара, начиная с последних изменений.
+func (s *Service) PriceHistory(ctx context.Context, productID int64) ([]*PriceChange, error) {
+	ctx, span := tracer.Start(ctx, "managers.PriceHistory")
+	defer span.End()
+
+	items, err := s.prices.PriceHistory(ctx, productID)
+	if err != nil {
+		return nil, s.fail(ctx, "price history", err)
+	}
+	return items, nil
+}
+
+// ScheduledPrices возвращает запланированные изменения цены товара.
+func (s *Service) ScheduledPrices(ctx context.Context, productID int64) ([]*ScheduledPrice, error) {
+	ctx, span := tracer.Start(ctx, "managers.ScheduledPrices")
+	defer span.End()
+
+	items, err := s.prices.ScheduledPrices(ctx, productID)
+	if err != nil {
+		return nil, s.fail(ctx, "scheduled prices", err)
+	}
+	return items, nil
+}
+
+// SchedulePrice планирует изменение цены товара на будущее.
+func (s *Service) SchedulePrice(ctx context.Context, item *ScheduledPrice) (*ScheduledPrice, error) {
+	ctx, span := tracer.Start(ctx, "managers.SchedulePrice")
+	defer span.End()
+
+	if item.Price <= 0 || !item.Effective.After(time.Now()) {
+		return nil, ErrInvalidPrice
+	}
+	item, err := s.prices.SchedulePrice(ctx, item)
+	if err != nil {
+		return nil, s.fail(ctx, "schedule price", err)
+	}
+	return item, nil
+}
+
+// CancelScheduledPrice отменяет ещё не применённое изменение цены.
+func (s *Service) CancelScheduledPrice(ctx context.Context, productID int64, id int64) (*ScheduledPrice, error) {
+	ctx, span := tracer.Start(ctx, "managers.CancelScheduledPrice")
+	defer span.End()
+
+	item, err := s.prices.CancelScheduledPrice(ctx, productID, id)
+	if err != nil {
+		return nil, s.fail(ctx, "cancel scheduled price", err)
+	}
+	return item, nil
+}
+
+// ApplyScheduledPrices применяет наступившие изменения цен и возвращает их количество.
+func (s *Service) ApplyScheduledPrices(ctx context.Context) (int, error) {
+	ctx, span := tracer.Start(ctx, "managers.ApplyScheduledPrices")
+	defer span.End()
+
+	changes, err := s.prices.ApplyScheduledPrices(ctx)
+	if err != nil {
+		return 0, s.fail(ctx, "apply scheduled prices", err)
+	}
+	for _, change := range changes {
+		if change.OldPrice != change.Price {
+			s.publish(EventPriceChanged, 0, change)
+		}
+	}
+	return len(changes), nil
+}
+
+// RunPriceScheduler раз в interval применяет наступившие изменения цен, пока не отменён ctx.
+func (s *Service) RunPriceScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.ApplyScheduledPrices(ctx)
+		if err != nil {
+			s.log(ctx).Error("run price scheduler failed", zap.Error(err))
+		}
+		if n > 0 {
+			s.log(ctx).Info("applied scheduled prices", zap.Int("count", n))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
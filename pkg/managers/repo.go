@@ -0,0 +1,154 @@
+package managers
+
+import (
+	"context"
+	"time"
+
+	"github.com/shohinsherov/crud/pkg/events"
+)
+
+// ManagerRepo хранит менеджеров и хеши их паролей.
+type ManagerRepo interface {
+	// CreateManager возвращает ErrPhoneUsed, если телефон уже зарегистрирован; пустой hash - менеджер без пароля.
+	CreateManager(ctx context.Context, reg *Registration, isAdmin bool, hash string) (*Registration, error)
+	IsAdmin(ctx context.Context, id int64) (bool, error)
+	// Credentials возвращает ID и хеш пароля менеджера или ErrNoSuchUser.
+	Credentials(ctx context.Context, phone string) (int64, string, error)
+	// SetPassword меняет пароль и отзывает все токены менеджера; ErrNoSuchUser, если его нет.
+	SetPassword(ctx context.Context, phone string, hash string) error
+	// Managers возвращает менеджеров по возрастанию ID, не больше 500.
+	Managers(ctx context.Context) ([]*Registration, error)
+	// ManagersByIDs возвращает найденных менеджеров из ids; отсутствующие пропускаются.
+	ManagersByIDs(ctx context.Context, ids []int64) ([]*Registration, error)
+}
+
+// CustomerRepo даёт менеджерам доступ к покупателям.
+type CustomerRepo interface {
+	// Customers возвращает активных покупателей.
+	Customers(ctx context.Context) ([]*Customer, error)
+	// CustomerByID возвращает покупателя (в том числе неактивного) или ErrNotFound.
+	CustomerByID(ctx context.Context, id int64) (*Customer, error)
+	// CustomersByIDs возвращает найденных покупателей (в том числе неактивных) из ids.
+	CustomersByIDs(ctx context.Context, ids []int64) ([]*Customer, error)
+	// CreateCustomer возвращает ErrPhoneUsed, если телефон уже зарегистрирован.
+	CreateCustomer(ctx context.Context, customer *Customer, hash string) (*Customer, error)
+	// RemoveCustomer удаляет покупателя вместе с его токенами; ErrNotFound, если его нет.
+	// Ненулевая version должна совпасть с текущей, иначе ErrVersionMismatch.
+	RemoveCustomer(ctx context.Context, id int64, version int64) error
+	// ChangeCustomer возвращает ErrNotFound, если покупателя нет, ErrPhoneUsed, если телефон занят другим,
+	// и ErrVersionMismatch, если customer.Version ненулевая и не совпадает с текущей.
+	ChangeCustomer(ctx context.Context, customer *Customer) (*Customer, error)
+}
+
+// ProductRepo хранит товары с вариантами, штрихкодами и категориями.
+// Товары возвращаются вместе с вариантами и штрихкодами.
+type ProductRepo interface {
+	// CreateProduct и UpdateProduct записывают изменение цены в историю от имени managerID
+	// в той же транзакции, что и сам товар.
+	CreateProduct(ctx context.Context, managerID int64, product *Product) (*Product, error)
+	// UpdateProduct возвращает ErrNotFound, если товара нет, и ErrVersionMismatch,
+	// если product.Version ненулевая и не совпадает с текущей.
+	UpdateProduct(ctx context.Context, managerID int64, product *Product) (*Product, error)
+	ProductByID(ctx context.Context, id int64) (*Product, error)
+	// ProductsByIDs возвращает найденные товары (в том числе снятые с продажи) из ids.
+	ProductsByIDs(ctx context.Context, ids []int64) ([]*Product, error)
+	// ProductIDBySKU возвращает 0, если товара с таким SKU нет.
+	ProductIDBySKU(ctx context.Context, sku string) (int64, error)
+	Products(ctx context.Context, filter *ProductFilter) ([]*Product, error)
+	// RemoveProduct снимает товар с продажи: история цен и продажи продолжают на него ссылаться.
+	// ErrNotFound, если товара нет; ненулевая version - условие, как в UpdateProduct.
+	RemoveProduct(ctx context.Context, id int64, version int64) error
+	// AddBarcode возвращает ErrNotFound, если нет товара или варианта этого товара, и ErrBarcodeUsed,
+	// если штрихкод занят.
+	AddBarcode(ctx context.Context, item *Barcode) (*Barcode, error)
+	RemoveBarcode(ctx context.Context, productID int64, code string) error
+	// LookupBarcode и LookupSKU возвращают товар и вариант (0 - весь товар) или ErrNotFound. Если SKU есть
+	// и у товара, и у варианта, LookupSKU возвращает товар.
+	LookupBarcode(ctx context.Context, code string) (int64, int64, error)
+	LookupSKU(ctx context.Context, sku string) (int64, int64, error)
+	SaveVariant(ctx context.Context, variant *Variant) (*Variant, error)
+	Categories(ctx context.Context) ([]*Category, error)
+	// SaveCategory возвращает ErrInvalidCategory, если новый родитель - сама категория или вложенная в неё.
+	SaveCategory(ctx context.Context, category *Category) (*Category, error)
+}
+
+// PriceRepo хранит историю цен и запланированные изменения.
+type PriceRepo interface {
+	PriceHistory(ctx context.Context, productID int64) ([]*PriceChange, error)
+	ScheduledPrices(ctx context.Context, productID int64) ([]*ScheduledPrice, error)
+	SchedulePrice(ctx context.Context, item *ScheduledPrice) (*ScheduledPrice, error)
+	CancelScheduledPrice(ctx context.Context, productID int64, id int64) (*ScheduledPrice, error)
+	// ApplyScheduledPrices применяет наступившие изменения и возвращает их по одному на каждое изменение.
+	ApplyScheduledPrices(ctx context.Context) ([]*PriceChange, error)
+}
+
+// SaleRepo хранит продажи.
+type SaleRepo interface {
+	// CreateSale атомарно списывает остатки и сохраняет продажу с позициями.
+	// Позиции со штрихкодом получают товар, вариант и (если не указана) цену по нему.
+	// Возвращает ErrNotFound для неизвестного штрихкода, товара или варианта (в том числе снятого с продажи)
+	// и ErrOutOfStock, только если остатка не хватает.
+	CreateSale(ctx context.Context, sale *Sale) (*Sale, error)
+	// SalesTotal возвращает сумму продаж менеджера.
+	SalesTotal(ctx context.Context, managerID int64) (int, error)
+	// Sales возвращает продажи с позициями, от новых к старым, не больше filter.Limit.
+	Sales(ctx context.Context, filter *SaleFilter) ([]*Sale, error)
+	// SalesReport считает продажи с from включительно до to.
+	SalesReport(ctx context.Context, from time.Time, to time.Time) (*SalesReport, error)
+}
+
+// TokenRepo хранит токены менеджеров.
+type TokenRepo interface {
+	SaveToken(ctx context.Context, token string, managerID int64, ttl time.Duration) error
+	// TokenOwner возвращает ID менеджера с действующим токеном или 0.
+	TokenOwner(ctx context.Context, token string) (int64, error)
+	PurgeExpiredTokens(ctx context.Context) (int64, error)
+}
+
+// Repository объединяет все хранилища, нужные сервису. Реализации пишут в outbox события в той же
+// транзакции, что и изменение: CustomerRegistered при CreateCustomer, CustomerBlocked и CustomerUnblocked
+// при смене active в ChangeCustomer, ProductChanged при CreateProduct, UpdateProduct, RemoveProduct и
+// ApplyScheduledPrices и SaleCreated при CreateSale.
+type Repository interface {
+	ManagerRepo
+	CustomerRepo
+	ProductRepo
+	PriceRepo
+	SaleRepo
+	TokenRepo
+}
+
+// productChanged возвращает событие об изменении change с состоянием product после него.
+func productChanged(change string, product *Product) *events.ProductChanged {
+	return &events.ProductChanged{
+		ID:      product.ID,
+		Change:  change,
+		Name:    product.Name,
+		SKU:     product.SKU,
+		Price:   product.Price,
+		Qty:     product.Qty,
+		Active:  product.Active,
+		Version: product.Version,
+	}
+}
+
+func saleCreated(sale *Sale) *events.SaleCreated {
+	event := &events.SaleCreated{
+		ID:         sale.ID,
+		ManagerID:  sale.ManagerID,
+		CustomerID: sale.CustomerID,
+		Created:    sale.Created,
+		Positions:  make([]*events.SalePosition, 0, len(sale.Positions)),
+	}
+	for _, position := range sale.Positions {
+		event.Positions = append(event.Positions, &events.SalePosition{
+			ID:        position.ID,
+			ProductID: position.ProductID,
+			VariantID: position.VariantID,
+			Barcode:   position.Barcode,
+			Price:     position.Price,
+			Qty:       position.Qty,
+		})
+	}
+	return event
+}
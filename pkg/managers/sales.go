@@ -0,0 +1,94 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrInvalidPeriod = errors.New("invalid period")
+
+// Ограничения списка продаж.
+const (
+	// DefaultSalesLimit - размер списка, если лимит не указан.
+	DefaultSalesLimit = 100
+	// MaxSalesLimit - наибольший размер списка, как у остальных списков хранилища.
+	MaxSalesLimit = 500
+)
+
+// SaleFilter ограничивает список продаж; нулевые поля не ограничивают.
+type SaleFilter struct {
+	ManagerID int64
+	// CustomerIDs, если не nil, оставляет продажи этих покупателей; пустой список - ни одной продажи.
+	CustomerIDs []int64
+	// From и To - период создания продажи: с From включительно до To.
+	From  time.Time
+	To    time.Time
+	Limit int
+	// PerCustomer применяет Limit к продажам каждого покупателя, а не ко всему списку.
+	PerCustomer bool
+}
+
+// SalesReport - итоги продаж за период.
+type SalesReport struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Sales   int       `json:"sales"`
+	Units   int       `json:"units"`
+	Revenue int       `json:"revenue"`
+	// Products и Managers упорядочены по убыванию выручки.
+	Products []*ProductSales `json:"products"`
+	Managers []*ManagerSales `json:"managers"`
+}
+
+// ProductSales - продажи товара за период отчёта.
+type ProductSales struct {
+	ProductID int64 `json:"product_id"`
+	Units     int   `json:"units"`
+	Revenue   int   `json:"revenue"`
+}
+
+// ManagerSales - продажи менеджера за период отчёта.
+type ManagerSales struct {
+	ManagerID int64 `json:"manager_id"`
+	Sales     int   `json:"sales"`
+	Revenue   int   `json:"revenue"`
+}
+
+// Sales возвращает продажи по фильтру; лимит больше MaxSalesLimit уменьшается до него.
+func (s *Service) Sales(ctx context.Context, filter *SaleFilter) ([]*Sale, error) {
+	ctx, span := tracer.Start(ctx, "managers.Sales")
+	defer span.End()
+
+	query := *filter
+	if query.Limit <= 0 {
+		query.Limit = DefaultSalesLimit
+	}
+	if query.Limit > MaxSalesLimit {
+		query.Limit = MaxSalesLimit
+	}
+	if query.CustomerIDs != nil && len(query.CustomerIDs) == 0 {
+		return make([]*Sale, 0), nil
+	}
+
+	items, err := s.sales.Sales(ctx, &query)
+	if err != nil {
+		return nil, s.fail(ctx, "sales", err)
+	}
+	return items, nil
+}
+
+// SalesReport считает продажи за период с from до to; если from не раньше to, возвращает ErrInvalidPeriod.
+func (s *Service) SalesReport(ctx context.Context, from time.Time, to time.Time) (*SalesReport, error) {
+	ctx, span := tracer.Start(ctx, "managers.SalesReport")
+	defer span.End()
+
+	if !from.Before(to) {
+		return nil, ErrInvalidPeriod
+	}
+	report, err := s.sales.SalesReport(ctx, from, to)
+	if err != nil {
+		return nil, s.fail(ctx, "sales report", err)
+	}
+	return report, nil
+}
@@ -5,15 +5,19 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
-	"log"
-	"strconv"
 	"time"
 
-	"github.com/jackc/pgx"
-	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shohinsherov/crud/pkg/barcode"
+	"github.com/shohinsherov/crud/pkg/config"
+	"github.com/shohinsherov/crud/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// tracer создаёт спаны для методов сервиса.
+var tracer = otel.Tracer("github.com/shohinsherov/crud/pkg/managers")
+
 var ErrTokenNotFound = errors.New("token not found")
 var ErrNotFound = errors.New("item not found")
 var ErrInternal = errors.New("internal error")
@@ -21,17 +25,92 @@ var ErrNoSuchUser = errors.New("no such user")
 var ErrInvalidPassword = errors.New("invalid password")
 var ErrPhoneUsed = errors.New("phone alredy registered")
 var ErrTokenExpired = errors.New("token expired")
+var ErrInvalidBarcode = errors.New("invalid barcode")
+var ErrBarcodeUsed = errors.New("barcode already used")
+var ErrOutOfStock = errors.New("product out of stock")
+var ErrInvalidCustomer = errors.New("invalid customer")
+var ErrVersionMismatch = errors.New("version mismatch")
+var ErrInvalidCategory = errors.New("invalid category")
 
 const (
 	ADMIN = "ADMIN"
 )
 
 type Service struct {
-	pool *pgxpool.Pool
+	managers   ManagerRepo
+	customers  CustomerRepo
+	products   ProductRepo
+	prices     PriceRepo
+	sales      SaleRepo
+	tokens     TokenRepo
+	publisher  Publisher
+	logger     *zap.Logger
+	tokenTTL   time.Duration
+	bcryptCost int
+}
+
+func NewService(repo Repository, auth *config.Auth, logger *zap.Logger) *Service {
+	return &Service{
+		managers:   repo,
+		customers:  repo,
+		products:   repo,
+		prices:     repo,
+		sales:      repo,
+		tokens:     repo,
+		logger:     logger,
+		tokenTTL:   auth.TokenTTL.Duration(),
+		bcryptCost: auth.BcryptCost,
+	}
+}
+
+// log возвращает логгер с идентификатором запроса из ctx.
+func (s *Service) log(ctx context.Context) *zap.Logger {
+	return logging.For(ctx, s.logger)
+}
+
+// fail возвращает ошибки хранилища, понятные клиентам, как есть, а остальные логирует и заменяет на ErrInternal.
+func (s *Service) fail(ctx context.Context, op string, err error) error {
+	for _, known := range []error{ErrNotFound, ErrNoSuchUser, ErrPhoneUsed, ErrBarcodeUsed, ErrOutOfStock, ErrVersionMismatch, ErrInvalidCategory} {
+		if errors.Is(err, known) {
+			return err
+		}
+	}
+	s.log(ctx).Error(op+" failed", zap.Error(err))
+	return ErrInternal
+}
+
+// newToken создаёт токен менеджера id со сроком действия s.tokenTTL.
+func (s *Service) newToken(ctx context.Context, id int64) (string, error) {
+	buffer := make([]byte, 256)
+	n, err := rand.Read(buffer)
+	if n != len(buffer) || err != nil {
+		return "", ErrInternal
+	}
+
+	token := hex.EncodeToString(buffer)
+	err = s.tokens.SaveToken(ctx, token, id, s.tokenTTL)
+	if err != nil {
+		return "", s.fail(ctx, "save token", err)
+	}
+	return token, nil
+}
+
+// managerRoles возвращает роли менеджера по признаку администратора.
+func managerRoles(admin bool) []string {
+	if admin {
+		return []string{ADMIN}
+	}
+	return []string{}
 }
 
-func NewService(pool *pgxpool.Pool) *Service {
-	return &Service{pool: pool}
+// isAdmin сообщает, есть ли среди ролей ADMIN.
+func isAdmin(roles []string) bool {
+	for _, role := range roles {
+		if role == ADMIN {
+			return true
+		}
+	}
+	return false
 }
 
 type Auth struct {
@@ -40,13 +119,59 @@ type Auth struct {
 }
 
 type Product struct {
-	ID      int64     `json:"id"`
-	Name    string    `json:"name"`
-	Price   int       `json:"price"`
-	Qty     int       `json:"qty"`
-	Active  bool      `json:"active"`
+	ID         int64             `json:"id"`
+	Name       string            `json:"name"`
+	SKU        string            `json:"sku"`
+	Price      int               `json:"price"`
+	Qty        int               `json:"qty"`
+	CategoryID int64             `json:"category_id"`
+	Attributes map[string]string `json:"attributes"`
+	Variants   []*Variant        `json:"variants"`
+	Barcodes   []*Barcode        `json:"barcodes"`
+	Active     bool              `json:"active"`
+	// Version растёт при каждом изменении товара, его вариантов и штрихкодов.
+	// Ненулевая версия в UpdateProduct - условие: товар обновится, только если версия совпадает.
+	Version int64     `json:"version"`
 	Created time.Time `json:"created"`
 }
+
+// Variant - вариант товара (например, размер или цвет) со своим SKU и остатком.
+type Variant struct {
+	ID         int64             `json:"id"`
+	ProductID  int64             `json:"product_id"`
+	SKU        string            `json:"sku"`
+	Attributes map[string]string `json:"attributes"`
+	Qty        int               `json:"qty"`
+	Active     bool              `json:"active"`
+	Created    time.Time         `json:"created"`
+}
+
+// Barcode - штрихкод товара, VariantID равен 0, если штрихкод относится ко всему товару.
+type Barcode struct {
+	Code      string `json:"code"`
+	ProductID int64  `json:"product_id"`
+	VariantID int64  `json:"variant_id"`
+}
+
+// ScanResult - товар (и его вариант, если он известен), найденный по штрихкоду или SKU.
+type ScanResult struct {
+	Product *Product `json:"product"`
+	Variant *Variant `json:"variant,omitempty"`
+}
+
+// Category - категория товаров, ParentID равен 0 у корневых категорий.
+type Category struct {
+	ID       int64     `json:"id"`
+	Name     string    `json:"name"`
+	ParentID int64     `json:"parent_id"`
+	Created  time.Time `json:"created"`
+}
+
+// ProductFilter ограничивает список товаров категорией (вместе с вложенными) и атрибутами.
+type ProductFilter struct {
+	CategoryID int64
+	Attributes map[string]string
+}
 type Sales struct {
 	ManagerID int64 `json:"manager_id"`
 	Total     int   `json:"total"`
@@ -62,6 +187,8 @@ type Sale struct {
 type SalePosition struct {
 	ID        int64     `json:"id"`
 	ProductID int64     `json:"product_id"`
+	VariantID int64     `json:"variant_id"`
+	Barcode   string    `json:"barcode,omitempty"`
 	SaleID    int64     `json:"sale_id"`
 	Price     int       `json:"price"`
 	Qty       int       `json:"qty"`
@@ -75,290 +202,397 @@ type Registration struct {
 	Roles []string `json:"roles"`
 }
 type Customer struct {
-	ID      int64     `json:"id"`
-	Name    string    `json:"name"`
-	Phone   string    `json:"phone"`
-	Active  bool      `json:"active"`
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Phone  string `json:"phone"`
+	Active bool   `json:"active"`
+	// Version растёт при каждом изменении; ненулевая версия в ChangeCustomer - условие, как у Product.
+	Version int64     `json:"version"`
 	Created time.Time `json:"created"`
 }
 
 func (s *Service) IDByToken(ctx context.Context, token string) (int64, error) {
-	var id int64
-	err := s.pool.QueryRow(ctx, `
-	SELECT manager_id FROM managers_tokens WHERE token = $1
-	`, token).Scan(&id)
+	ctx, span := tracer.Start(ctx, "managers.IDByToken")
+	defer span.End()
 
-	if errors.Is(err, pgx.ErrNoRows) {
-		log.Print(err)
-		return 0, nil
-	}
+	id, err := s.tokens.TokenOwner(ctx, token)
 	if err != nil {
-		log.Print(err)
+		s.log(ctx).Error("id by token failed", zap.Error(err))
 		return 0, nil
 	}
-
 	return id, nil
 }
 
 func (s *Service) IsAdmin(ctx context.Context, id int64) (ok bool) {
-	err := s.pool.QueryRow(ctx, `
-	SELECT is_admin FROM managers  WHERE id = $1
-	`, id).Scan(&ok)
+	ctx, span := tracer.Start(ctx, "managers.IsAdmin")
+	defer span.End()
+
+	ok, err := s.managers.IsAdmin(ctx, id)
 	if err != nil {
+		s.log(ctx).Error("is admin failed", zap.Error(err))
 		return false
 	}
-
 	return ok
 }
 
 func (s *Service) Register(ctx context.Context, reg *Registration) (string, error) {
-	var token string
-	isAdmin := false
-	var id int64
+	ctx, span := tracer.Start(ctx, "managers.Register")
+	defer span.End()
 
-	for _, role := range reg.Roles {
-		if role == ADMIN {
-			isAdmin = true
-		}
-	}
-
-	err := s.pool.QueryRow(ctx, `
-	INSERT INTO managers(name,phone,is_admin) VALUES ($1,$2,$3) ON CONFLICT (phone) DO NOTHING RETURNING id;
-	`, reg.Name, reg.Phone, isAdmin).Scan(&id)
-	if err != nil {
-		log.Print(err)
-		return "", ErrInternal
-	}
-	buffer := make([]byte, 256)
-	n, err := rand.Read(buffer)
-	if n != len(buffer) || err != nil {
-		return "", ErrInternal
-	}
-
-	token = hex.EncodeToString(buffer)
-	_, err = s.pool.Exec(ctx, `INSERT INTO managers_tokens(token,manager_id) VALUES($1,$2)`, token, id)
+	_, err := s.managers.CreateManager(ctx, reg, isAdmin(reg.Roles), "")
 	if err != nil {
-		return "", ErrInternal
+		return "", s.fail(ctx, "register", err)
 	}
-
-	return token, nil
+	return s.newToken(ctx, reg.ID)
 }
 
 func (s *Service) Token(
 	ctx context.Context,
 	phone string, password string,
 ) (token string, err error) {
-	var hash string
-	var id int64
-	err = s.pool.QueryRow(ctx, `SELECT id,password From managers WHERE phone = $1`, phone).Scan(&id, &hash)
+	ctx, span := tracer.Start(ctx, "managers.Token")
+	defer span.End()
 
-	if errors.Is(err, pgx.ErrNoRows) {
+	id, hash, err := s.managers.Credentials(ctx, phone)
+	if errors.Is(err, ErrNoSuchUser) {
 		return "", ErrInvalidPassword
 	}
 	if err != nil {
-		log.Print(err, "Managers svc 130")
-		return "", ErrInternal
+		return "", s.fail(ctx, "token", err)
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	if err != nil {
 		return "", ErrInvalidPassword
 	}
-	buffer := make([]byte, 256)
-	n, err := rand.Read(buffer)
-	if n != len(buffer) || err != nil {
-		return "", ErrInternal
-	}
+	return s.newToken(ctx, id)
+}
+
+// CreateProduct создаёт товар; начальная цена попадает в историю цен от имени managerID.
+func (s *Service) CreateProduct(ctx context.Context, managerID int64, product *Product) (*Product, error) {
+	ctx, span := tracer.Start(ctx, "managers.CreateProduct")
+	defer span.End()
 
-	token = hex.EncodeToString(buffer)
-	log.Print("id", id)
-	_, err = s.pool.Exec(ctx, `INSERT INTO managers_tokens(token,manager_id) VALUES($1,$2)`, token, id)
+	if product.Attributes == nil {
+		product.Attributes = map[string]string{}
+	}
+	product, err := s.products.CreateProduct(ctx, managerID, product)
 	if err != nil {
-		log.Print(err)
-		return "", ErrInternal
+		return nil, s.fail(ctx, "create product", err)
 	}
-
-	return token, nil
+	s.publishProduct(managerID, &Product{}, product)
+	return product, nil
 }
 
-func (s *Service) CreateProduct(ctx context.Context, product *Product) (*Product, error) {
-	err := s.pool.QueryRow(ctx, `
-	INSERT INTO products(name,qty,price) VALUES ($1,$2,$3) RETURNING id,name,qty,price,active,created;
-	`, product.Name, product.Qty, product.Price).Scan(&product.ID, &product.Name, &product.Qty, &product.Price, &product.Active, &product.Created)
+// ProductByID возвращает товар (в том числе снятый с продажи) или ErrNotFound.
+func (s *Service) ProductByID(ctx context.Context, id int64) (*Product, error) {
+	ctx, span := tracer.Start(ctx, "managers.ProductByID")
+	defer span.End()
+
+	product, err := s.products.ProductByID(ctx, id)
 	if err != nil {
-		log.Print(err)
-		return nil, ErrInternal
+		return nil, s.fail(ctx, "product by id", err)
 	}
 	return product, nil
 }
 
-func (s *Service) UpdateProduct(ctx context.Context, product *Product) (*Product, error) {
-	err := s.pool.QueryRow(ctx, `
-	UPDATE  products SET  name=$1,qty=$2,price=$3  WHERE id = $4 RETURNING id,name,qty,price,active,created;
-	`, product.Name, product.Qty, product.Price, product.ID).Scan(&product.ID, &product.Name, &product.Qty, &product.Price, &product.Active, &product.Created)
+// ProductsByIDs возвращает найденные товары из ids; используется для пакетной загрузки.
+func (s *Service) ProductsByIDs(ctx context.Context, ids []int64) ([]*Product, error) {
+	ctx, span := tracer.Start(ctx, "managers.ProductsByIDs")
+	defer span.End()
+
+	items, err := s.products.ProductsByIDs(ctx, ids)
 	if err != nil {
-		log.Print(err)
-		return nil, ErrInternal
+		return nil, s.fail(ctx, "products by ids", err)
 	}
-	return product, nil
+	return items, nil
 }
 
-func (s *Service) MakekSalePosition(ctx context.Context, position *SalePosition) bool {
-	active := false
-	qty := 0
-	err := s.pool.QueryRow(ctx, `
-	SELECT qty,active FROM products WHERE id = $1
-	`, position.ProductID).Scan(&qty, &active)
+// UpdateProduct обновляет товар; изменение цены записывается в историю от имени managerID.
+func (s *Service) UpdateProduct(ctx context.Context, managerID int64, product *Product) (*Product, error) {
+	ctx, span := tracer.Start(ctx, "managers.UpdateProduct")
+	defer span.End()
+
+	if product.Attributes == nil {
+		product.Attributes = map[string]string{}
+	}
+	// Прежнее состояние нужно только для событий: без получателя лишний запрос не делаем.
+	var previous *Product
+	if s.publisher != nil {
+		var err error
+		previous, err = s.products.ProductByID(ctx, product.ID)
+		if err != nil {
+			return nil, s.fail(ctx, "update product", err)
+		}
+	}
+	product, err := s.products.UpdateProduct(ctx, managerID, product)
 	if err != nil {
-		return false
+		return nil, s.fail(ctx, "update product", err)
 	}
-	if qty < position.Qty || !active {
-		return false
+	if previous != nil {
+		s.publishProduct(managerID, previous, product)
 	}
-	_, err = s.pool.Exec(ctx, `
-	UPDATE products SET qty = $1 WHERE id = $2
-	`, qty-position.Qty, position.ProductID)
+	return product, nil
+}
+
+// AddBarcode проверяет контрольную цифру и привязывает штрихкод к товару или его варианту.
+func (s *Service) AddBarcode(ctx context.Context, item *Barcode) (*Barcode, error) {
+	ctx, span := tracer.Start(ctx, "managers.AddBarcode")
+	defer span.End()
+
+	code, err := barcode.Normalize(item.Code)
 	if err != nil {
-		log.Print(err)
-		return false
+		return nil, ErrInvalidBarcode
+	}
+	item.Code = code
+
+	item, err = s.products.AddBarcode(ctx, item)
+	if err != nil {
+		return nil, s.fail(ctx, "add barcode", err)
 	}
-	return true
+	return item, nil
 }
 
-func (s *Service) MakeSale(ctx context.Context, sale *Sale) (*Sale, error) {
-	positionsSql := "INSERT INTO sales_positions (sale_id,product_id,qty,price) VALUES "
+func (s *Service) RemoveBarcode(ctx context.Context, productID int64, code string) error {
+	ctx, span := tracer.Start(ctx, "managers.RemoveBarcode")
+	defer span.End()
 
-	err := s.pool.QueryRow(ctx, `
-	INSERT INTO sales(manager_id,customer_id) VALUES ($1,$2) RETURNING id, created;
-	`, sale.ManagerID, sale.CustomerID).Scan(&sale.ID, &sale.Created)
+	code, err := barcode.Normalize(code)
 	if err != nil {
-		log.Print(err)
-		return nil, ErrInternal
+		return ErrInvalidBarcode
 	}
-	for _, position := range sale.Positions {
-		if !s.MakekSalePosition(ctx, position) {
-			log.Print("Invalid position")
-			return nil, ErrInternal
-		}
-		positionsSql += "(" + strconv.FormatInt(sale.ID, 10) + "," + strconv.FormatInt(position.ProductID, 10) + "," + strconv.Itoa(position.Price) + "," + strconv.Itoa(position.Qty) + "),"
+	err = s.products.RemoveBarcode(ctx, productID, code)
+	if err != nil {
+		return s.fail(ctx, "remove barcode", err)
 	}
+	return nil
+}
 
-	positionsSql = positionsSql[0 : len(positionsSql)-1] //Remove last comma
+// Lookup ищет товар по штрихкоду (если он задан) или по SKU товара либо варианта.
+func (s *Service) Lookup(ctx context.Context, code string, sku string) (*ScanResult, error) {
+	ctx, span := tracer.Start(ctx, "managers.Lookup")
+	defer span.End()
 
-	log.Print(positionsSql)
-	_, err = s.pool.Exec(ctx, positionsSql)
+	var productID, variantID int64
+	var err error
+	if code != "" {
+		code, err = barcode.Normalize(code)
+		if err != nil {
+			return nil, ErrInvalidBarcode
+		}
+		productID, variantID, err = s.products.LookupBarcode(ctx, code)
+	} else {
+		productID, variantID, err = s.products.LookupSKU(ctx, sku)
+	}
 	if err != nil {
-		log.Print(err)
-		return nil, ErrInternal
+		return nil, s.fail(ctx, "lookup", err)
 	}
 
-	return sale, nil
+	product, err := s.products.ProductByID(ctx, productID)
+	if err != nil {
+		return nil, s.fail(ctx, "lookup", err)
+	}
+	result := &ScanResult{Product: product}
+	for _, variant := range product.Variants {
+		if variant.ID == variantID {
+			result.Variant = variant
+		}
+	}
+	return result, nil
 }
 
-func (s *Service) GetSales(ctx context.Context, id int64) (sum int, err error) {
-	err = s.pool.QueryRow(ctx, `
-	SELECT COALESCE(SUM(sp.qty * sp.price),0) total
-	FROM managers m
-	left JOIN sales s ON s.manager_id= $1
-	left JOIN sales_positions sp ON sp.sale_id = s.id 
-	GROUP BY m.id
-	LIMIT 1`, id).Scan(&sum)
+// SaveVariant создаёт вариант товара (если ID равен 0) или обновляет существующий.
+func (s *Service) SaveVariant(ctx context.Context, variant *Variant) (*Variant, error) {
+	ctx, span := tracer.Start(ctx, "managers.SaveVariant")
+	defer span.End()
+
+	if variant.Attributes == nil {
+		variant.Attributes = map[string]string{}
+	}
+	previousQty := -1
+	if s.publisher != nil && variant.ID != 0 {
+		product, err := s.products.ProductByID(ctx, variant.ProductID)
+		if err != nil {
+			return nil, s.fail(ctx, "save variant", err)
+		}
+		for _, item := range product.Variants {
+			if item.ID == variant.ID {
+				previousQty = item.Qty
+			}
+		}
+	}
+	variant, err := s.products.SaveVariant(ctx, variant)
 	if err != nil {
-		log.Print(err)
-		return 0, ErrInternal
+		return nil, s.fail(ctx, "save variant", err)
 	}
-	return sum, nil
+	if variant.Qty != previousQty {
+		s.publish(EventStockChanged, 0, &StockChange{ProductID: variant.ProductID, VariantID: variant.ID, Qty: variant.Qty})
+	}
+	return variant, nil
 }
 
-func (s *Service) Products(ctx context.Context) ([]*Product, error) {
-	items := make([]*Product, 0)
-	rows, err := s.pool.Query(ctx, `
-		SELECT id, name, price, qty FROM products WHERE active = TRUE ORDER BY id LIMIT 500
-	`)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return items, nil
+func (s *Service) Categories(ctx context.Context) ([]*Category, error) {
+	ctx, span := tracer.Start(ctx, "managers.Categories")
+	defer span.End()
+
+	items, err := s.products.Categories(ctx)
+	if err != nil {
+		return nil, s.fail(ctx, "categories", err)
 	}
+	return items, nil
+}
+
+// SaveCategory создаёт категорию (если ID равен 0) или обновляет существующую. Родителем не может быть
+// сама категория или вложенная в неё: ErrInvalidCategory.
+func (s *Service) SaveCategory(ctx context.Context, category *Category) (*Category, error) {
+	ctx, span := tracer.Start(ctx, "managers.SaveCategory")
+	defer span.End()
+
+	category, err := s.products.SaveCategory(ctx, category)
 	if err != nil {
-		return nil, ErrInternal
+		return nil, s.fail(ctx, "save category", err)
 	}
-	defer rows.Close()
+	return category, nil
+}
 
-	for rows.Next() {
-		item := &Product{}
-		err = rows.Scan(&item.ID, &item.Name, &item.Price, &item.Qty)
+// MakeSale списывает остатки и сохраняет продажу; если хотя бы одной позиции не хватает,
+// продажа не сохраняется и возвращается ErrOutOfStock. Неизвестный или снятый с продажи товар - ErrNotFound.
+func (s *Service) MakeSale(ctx context.Context, sale *Sale) (*Sale, error) {
+	ctx, span := tracer.Start(ctx, "managers.MakeSale")
+	defer span.End()
+
+	for _, position := range sale.Positions {
+		if position.Barcode == "" {
+			continue
+		}
+		code, err := barcode.Normalize(position.Barcode)
 		if err != nil {
-			log.Print(err)
-			return nil, err
+			return nil, ErrInvalidBarcode
 		}
-		items = append(items, item)
+		position.Barcode = code
 	}
-	err = rows.Err()
-	if err != nil {
-		log.Print(err)
+
+	sale, err := s.sales.CreateSale(ctx, sale)
+	if errors.Is(err, ErrOutOfStock) || errors.Is(err, ErrNotFound) {
+		s.log(ctx).Warn("invalid sale position", zap.Error(err))
 		return nil, err
 	}
+	if err != nil {
+		return nil, s.fail(ctx, "make sale", err)
+	}
+	s.publishSale(ctx, sale)
+	return sale, nil
+}
+
+func (s *Service) GetSales(ctx context.Context, id int64) (sum int, err error) {
+	ctx, span := tracer.Start(ctx, "managers.GetSales")
+	defer span.End()
+
+	sum, err = s.sales.SalesTotal(ctx, id)
+	if err != nil {
+		return 0, s.fail(ctx, "get sales", err)
+	}
+	return sum, nil
+}
+
+func (s *Service) Products(ctx context.Context, filter *ProductFilter) ([]*Product, error) {
+	ctx, span := tracer.Start(ctx, "managers.Products")
+	defer span.End()
 
+	items, err := s.products.Products(ctx, filter)
+	if err != nil {
+		return nil, s.fail(ctx, "products", err)
+	}
 	return items, nil
 }
 
-func (s *Service) RemoveProductById(ctx context.Context, id int64) (err error) {
-	_, err = s.pool.Exec(ctx, `
-	DELETE from products where id = $1`, id)
+// RemoveProductById снимает товар с продажи; ненулевая version - условие, как в UpdateProduct.
+func (s *Service) RemoveProductById(ctx context.Context, id int64, version int64) (err error) {
+	ctx, span := tracer.Start(ctx, "managers.RemoveProductById")
+	defer span.End()
+
+	err = s.products.RemoveProduct(ctx, id, version)
 	if err != nil {
-		log.Print(err)
-		return ErrInternal
+		return s.fail(ctx, "remove product by id", err)
 	}
 	return nil
 }
 
-func (s *Service) RemoveCustomerById(ctx context.Context, id int64) (err error) {
-	_, err = s.pool.Exec(ctx, `
-	DELETE from customers where id = $1`, id)
+// RemoveCustomerById удаляет покупателя; ненулевая version - условие, как в ChangeCustomer.
+func (s *Service) RemoveCustomerById(ctx context.Context, id int64, version int64) (err error) {
+	ctx, span := tracer.Start(ctx, "managers.RemoveCustomerById")
+	defer span.End()
+
+	err = s.customers.RemoveCustomer(ctx, id, version)
 	if err != nil {
-		log.Print(err)
-		return ErrInternal
+		return s.fail(ctx, "remove customer by id", err)
 	}
 	return nil
 }
 
 func (s *Service) Customers(ctx context.Context) ([]*Customer, error) {
-	items := make([]*Customer, 0)
-	rows, err := s.pool.Query(ctx, `
-		SELECT id, name, phone, active, created FROM customers WHERE active = TRUE ORDER BY id LIMIT 500
-	`)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return items, nil
+	ctx, span := tracer.Start(ctx, "managers.Customers")
+	defer span.End()
+
+	items, err := s.customers.Customers(ctx)
+	if err != nil {
+		return nil, s.fail(ctx, "customers", err)
 	}
+	return items, nil
+}
+
+// CustomerByID возвращает покупателя или ErrNotFound.
+func (s *Service) CustomerByID(ctx context.Context, id int64) (*Customer, error) {
+	ctx, span := tracer.Start(ctx, "managers.CustomerByID")
+	defer span.End()
+
+	customer, err := s.customers.CustomerByID(ctx, id)
 	if err != nil {
-		return nil, ErrInternal
+		return nil, s.fail(ctx, "customer by id", err)
 	}
-	defer rows.Close()
+	return customer, nil
+}
 
-	for rows.Next() {
-		item := &Customer{}
-		err = rows.Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Created)
-		if err != nil {
-			log.Print(err)
-			return nil, err
-		}
-		items = append(items, item)
+// CustomersByIDs возвращает найденных покупателей из ids; используется для пакетной загрузки.
+func (s *Service) CustomersByIDs(ctx context.Context, ids []int64) ([]*Customer, error) {
+	ctx, span := tracer.Start(ctx, "managers.CustomersByIDs")
+	defer span.End()
+
+	items, err := s.customers.CustomersByIDs(ctx, ids)
+	if err != nil {
+		return nil, s.fail(ctx, "customers by ids", err)
 	}
-	err = rows.Err()
+	return items, nil
+}
+
+// CreateCustomer заводит покупателя с паролем password; без телефона или пароля возвращает ErrInvalidCustomer.
+func (s *Service) CreateCustomer(ctx context.Context, customer *Customer, password string) (*Customer, error) {
+	ctx, span := tracer.Start(ctx, "managers.CreateCustomer")
+	defer span.End()
+
+	if customer.Phone == "" || password == "" {
+		return nil, ErrInvalidCustomer
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.bcryptCost)
 	if err != nil {
-		log.Print(err)
-		return nil, err
+		s.log(ctx).Error("create customer failed", zap.Error(err))
+		return nil, ErrInternal
 	}
 
-	return items, nil
+	customer, err = s.customers.CreateCustomer(ctx, customer, string(hash))
+	if err != nil {
+		return nil, s.fail(ctx, "create customer", err)
+	}
+	return customer, nil
 }
 
 func (s *Service) ChangeCustomer(ctx context.Context, customer *Customer) (*Customer, error) {
-	err := s.pool.QueryRow(ctx, `
-	UPDATE customers SET name = $2, phone = $3, active = $4  where id = $1 RETURNING name,phone,active
-	`, customer.ID, customer.Name, customer.Phone, customer.Active).Scan(&customer.Name, &customer.Phone, &customer.Active)
+	ctx, span := tracer.Start(ctx, "managers.ChangeCustomer")
+	defer span.End()
+
+	customer, err := s.customers.ChangeCustomer(ctx, customer)
 	if err != nil {
-		log.Print(err)
-		return nil, ErrInternal
+		return nil, s.fail(ctx, "change customer", err)
 	}
 	return customer, nil
 }
@@ -0,0 +1,555 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shohinsherov/crud/pkg/config"
+	"github.com/shohinsherov/crud/pkg/memstore"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestService(t *testing.T) (*Service, *memstore.Store) {
+	t.Helper()
+	store := memstore.New()
+	auth := &config.Auth{TokenTTL: config.Duration(time.Hour), BcryptCost: bcrypt.MinCost}
+	return NewService(NewMemoryRepo(store), auth, zap.NewNop()), store
+}
+
+func createManager(t *testing.T, svc *Service, phone string, roles ...string) *Registration {
+	t.Helper()
+	reg, err := svc.Create(context.Background(), &Registration{Name: "Manager " + phone, Phone: phone, Roles: roles}, "secret")
+	if err != nil {
+		t.Fatalf("create manager %s: %v", phone, err)
+	}
+	return reg
+}
+
+func createProduct(t *testing.T, svc *Service, managerID int64, product *Product) *Product {
+	t.Helper()
+	product, err := svc.CreateProduct(context.Background(), managerID, product)
+	if err != nil {
+		t.Fatalf("create product %s: %v", product.Name, err)
+	}
+	return product
+}
+
+func TestService_Accounts(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+
+	admin := createManager(t, svc, "+992000000001", ADMIN)
+	manager := createManager(t, svc, "+992000000002")
+	_, err := svc.Create(ctx, &Registration{Name: "Other", Phone: admin.Phone}, "secret")
+	if !errors.Is(err, ErrPhoneUsed) {
+		t.Fatalf("create same phone: got %v, want %v", err, ErrPhoneUsed)
+	}
+	if !svc.IsAdmin(ctx, admin.ID) || svc.IsAdmin(ctx, manager.ID) {
+		t.Errorf("is admin: got %v and %v, want true and false", svc.IsAdmin(ctx, admin.ID), svc.IsAdmin(ctx, manager.ID))
+	}
+
+	token, err := svc.Token(ctx, admin.Phone, "secret")
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	id, err := svc.IDByToken(ctx, token)
+	if err != nil || id != admin.ID {
+		t.Fatalf("id by token: got %d, %v, want %d", id, err, admin.ID)
+	}
+	_, err = svc.Token(ctx, admin.Phone, "wrong")
+	if !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("token with wrong password: got %v, want %v", err, ErrInvalidPassword)
+	}
+
+	err = svc.ResetPassword(ctx, admin.Phone, "changed")
+	if err != nil {
+		t.Fatalf("reset password: %v", err)
+	}
+	id, err = svc.IDByToken(ctx, token)
+	if err != nil || id != 0 {
+		t.Errorf("id by revoked token: got %d, %v, want 0", id, err)
+	}
+	_, err = svc.Token(ctx, admin.Phone, "changed")
+	if err != nil {
+		t.Errorf("token with new password: %v", err)
+	}
+	err = svc.ResetPassword(ctx, "+992999999999", "changed")
+	if !errors.Is(err, ErrNoSuchUser) {
+		t.Errorf("reset password of unknown manager: got %v, want %v", err, ErrNoSuchUser)
+	}
+}
+
+func TestService_Register(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+
+	token, err := svc.Register(ctx, &Registration{Name: "Manager", Phone: "+992000000001"})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	id, err := svc.IDByToken(ctx, token)
+	if err != nil || id == 0 {
+		t.Fatalf("id by token: got %d, %v", id, err)
+	}
+	if svc.IsAdmin(ctx, id) {
+		t.Errorf("manager without roles is admin")
+	}
+	_, err = svc.Token(ctx, "+992000000001", "")
+	if !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("token of manager without password: got %v, want %v", err, ErrInvalidPassword)
+	}
+}
+
+func TestService_Products(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+	manager := createManager(t, svc, "+992000000001")
+
+	product := createProduct(t, svc, manager.ID, &Product{Name: "Хлеб", SKU: "BREAD", Price: 5, Qty: 10})
+	if product.ID == 0 || !product.Active || product.Attributes == nil {
+		t.Fatalf("unexpected product: %+v", product)
+	}
+
+	product.Price = 7
+	product, err := svc.UpdateProduct(ctx, manager.ID, product)
+	if err != nil {
+		t.Fatalf("update product: %v", err)
+	}
+	if product.Version != 2 {
+		t.Errorf("version after update: got %d, want 2", product.Version)
+	}
+	_, err = svc.UpdateProduct(ctx, manager.ID, &Product{ID: product.ID, Name: "Хлеб", Price: 9, Version: 1})
+	if !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("update stale product: got %v, want %v", err, ErrVersionMismatch)
+	}
+	_, err = svc.UpdateProduct(ctx, manager.ID, &Product{ID: product.ID + 100, Name: "Нет", Price: 1})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("update unknown product: got %v, want %v", err, ErrNotFound)
+	}
+
+	history, err := svc.PriceHistory(ctx, product.ID)
+	if err != nil {
+		t.Fatalf("price history: %v", err)
+	}
+	if len(history) != 2 || history[0].OldPrice != 5 || history[0].Price != 7 || history[1].Price != 5 {
+		t.Errorf("price history: got %+v", history)
+	}
+
+	created, err := svc.ImportProduct(ctx, manager.ID, &Product{Name: "Хлеб белый", SKU: "BREAD", Price: 8, Qty: 20}, ImportedFields{SKU: true, Qty: true})
+	if err != nil || created {
+		t.Fatalf("import existing product: got %v, %v, want false", created, err)
+	}
+	_, err = svc.ImportProduct(ctx, manager.ID, &Product{Name: "Хлеб белый", SKU: "BREAD", Price: 8}, ImportedFields{SKU: true})
+	if err != nil {
+		t.Fatalf("import existing product without qty: %v", err)
+	}
+	imported, err := svc.ProductByID(ctx, product.ID)
+	if err != nil || imported.Qty != 20 {
+		t.Errorf("qty after import without qty: got %+v, %v, want 20", imported, err)
+	}
+	created, err = svc.ImportProduct(ctx, manager.ID, &Product{Name: "Молоко", SKU: "MILK", Price: 12, Qty: 5}, ImportedFields{SKU: true, Qty: true})
+	if err != nil || !created {
+		t.Fatalf("import new product: got %v, %v, want true", created, err)
+	}
+
+	items, err := svc.Products(ctx, &ProductFilter{})
+	if err != nil {
+		t.Fatalf("products: %v", err)
+	}
+	if len(items) != 2 || items[0].Name != "Хлеб белый" || items[0].Price != 8 || items[1].SKU != "MILK" {
+		t.Errorf("products: got %+v", items)
+	}
+
+	result, err := svc.Lookup(ctx, "", "MILK")
+	if err != nil || result.Product.Name != "Молоко" {
+		t.Errorf("lookup by sku: got %+v, %v", result, err)
+	}
+
+	err = svc.RemoveProductById(ctx, product.ID, 1)
+	if !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("remove stale product: got %v, want %v", err, ErrVersionMismatch)
+	}
+	err = svc.RemoveProductById(ctx, product.ID, 0)
+	if err != nil {
+		t.Fatalf("remove product: %v", err)
+	}
+	removed, err := svc.ProductByID(ctx, product.ID)
+	if err != nil || removed.Active {
+		t.Errorf("removed product: got %+v, %v, want inactive", removed, err)
+	}
+	err = svc.RemoveProductById(ctx, product.ID+100, 0)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("remove unknown product: got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestService_Categories(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+
+	root, err := svc.SaveCategory(ctx, &Category{Name: "Продукты"})
+	if err != nil {
+		t.Fatalf("save root: %v", err)
+	}
+	child, err := svc.SaveCategory(ctx, &Category{Name: "Молочное", ParentID: root.ID})
+	if err != nil {
+		t.Fatalf("save child: %v", err)
+	}
+	for _, parentID := range []int64{root.ID, child.ID} {
+		_, err = svc.SaveCategory(ctx, &Category{ID: root.ID, Name: "Продукты", ParentID: parentID})
+		if !errors.Is(err, ErrInvalidCategory) {
+			t.Errorf("move root under %d: got %v, want %v", parentID, err, ErrInvalidCategory)
+		}
+	}
+	_, err = svc.SaveCategory(ctx, &Category{ID: child.ID, Name: "Молочное"})
+	if err != nil {
+		t.Errorf("move child to root: %v", err)
+	}
+}
+
+func TestService_Customers(t *testing.T) {
+	svc, store := newTestService(t)
+	ctx := context.Background()
+
+	_, err := svc.CreateCustomer(ctx, &Customer{Name: "Без пароля", Phone: "+992000000001"}, "")
+	if !errors.Is(err, ErrInvalidCustomer) {
+		t.Fatalf("create customer without password: got %v, want %v", err, ErrInvalidCustomer)
+	}
+	customer, err := svc.CreateCustomer(ctx, &Customer{Name: "Покупатель", Phone: "+992000000001", Active: true}, "secret")
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+	other, err := svc.CreateCustomer(ctx, &Customer{Name: "Другой", Phone: "+992000000002", Active: true}, "secret")
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+	_, err = svc.CreateCustomer(ctx, &Customer{Name: "Повтор", Phone: customer.Phone}, "secret")
+	if !errors.Is(err, ErrPhoneUsed) {
+		t.Errorf("create same phone: got %v, want %v", err, ErrPhoneUsed)
+	}
+
+	found, err := svc.CustomerByID(ctx, customer.ID)
+	if err != nil || found.Phone != customer.Phone || !found.Active {
+		t.Errorf("customer by id: got %+v, %v", found, err)
+	}
+	_, err = svc.CustomerByID(ctx, other.ID+100)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown customer: got %v, want %v", err, ErrNotFound)
+	}
+
+	_, err = svc.ChangeCustomer(ctx, &Customer{ID: customer.ID, Name: "Покупатель", Phone: other.Phone, Active: true})
+	if !errors.Is(err, ErrPhoneUsed) {
+		t.Errorf("change to used phone: got %v, want %v", err, ErrPhoneUsed)
+	}
+	_, err = svc.ChangeCustomer(ctx, &Customer{ID: other.ID + 100, Name: "Нет", Phone: "+992000000003"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("change unknown customer: got %v, want %v", err, ErrNotFound)
+	}
+	changed, err := svc.ChangeCustomer(ctx, &Customer{ID: customer.ID, Name: "Новое имя", Phone: customer.Phone, Active: true, Version: customer.Version})
+	if err != nil || changed.Version != customer.Version+1 {
+		t.Fatalf("change customer: got %+v, %v", changed, err)
+	}
+	_, err = svc.ChangeCustomer(ctx, &Customer{ID: customer.ID, Name: "Старое имя", Phone: customer.Phone, Active: true, Version: customer.Version})
+	if !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("change stale customer: got %v, want %v", err, ErrVersionMismatch)
+	}
+
+	err = store.Tx(func(d *memstore.Data) error {
+		d.CustomerTokens["token"] = &memstore.Token{Token: "token", OwnerID: customer.ID, Expire: d.Now().Add(time.Hour)}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = svc.RemoveCustomerById(ctx, customer.ID, customer.Version)
+	if !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("remove stale customer: got %v, want %v", err, ErrVersionMismatch)
+	}
+	err = svc.RemoveCustomerById(ctx, customer.ID, changed.Version)
+	if err != nil {
+		t.Fatalf("remove customer: %v", err)
+	}
+	err = store.Tx(func(d *memstore.Data) error {
+		if len(d.CustomerTokens) != 0 {
+			t.Errorf("tokens of removed customer: got %d, want 0", len(d.CustomerTokens))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = svc.RemoveCustomerById(ctx, customer.ID, 0)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("remove removed customer: got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestService_ScheduledPrices(t *testing.T) {
+	svc, store := newTestService(t)
+	ctx := context.Background()
+	manager := createManager(t, svc, "+992000000001")
+	product := createProduct(t, svc, manager.ID, &Product{Name: "Хлеб", Price: 5, Qty: 10})
+
+	_, err := svc.SchedulePrice(ctx, &ScheduledPrice{ProductID: product.ID, Price: 6, ManagerID: manager.ID, Effective: time.Now().Add(-time.Minute)})
+	if !errors.Is(err, ErrInvalidPrice) {
+		t.Fatalf("schedule price in the past: got %v, want %v", err, ErrInvalidPrice)
+	}
+	scheduled, err := svc.SchedulePrice(ctx, &ScheduledPrice{ProductID: product.ID, Price: 6, ManagerID: manager.ID, Effective: time.Now().Add(time.Hour)})
+	if err != nil || scheduled.Status != PricePending {
+		t.Fatalf("schedule price: got %+v, %v", scheduled, err)
+	}
+
+	n, err := svc.ApplyScheduledPrices(ctx)
+	if err != nil || n != 0 {
+		t.Fatalf("apply before effective: got %d, %v, want 0", n, err)
+	}
+	store.SetClock(func() time.Time { return time.Now().Add(2 * time.Hour) })
+	n, err = svc.ApplyScheduledPrices(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("apply after effective: got %d, %v, want 1", n, err)
+	}
+
+	items, err := svc.Products(ctx, &ProductFilter{})
+	if err != nil || len(items) != 1 || items[0].Price != 6 {
+		t.Errorf("products after apply: got %+v, %v", items, err)
+	}
+	_, err = svc.CancelScheduledPrice(ctx, product.ID, scheduled.ID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("cancel applied price: got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestService_MakeSale(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+	manager := createManager(t, svc, "+992000000001")
+	bread := createProduct(t, svc, manager.ID, &Product{Name: "Хлеб", Price: 5, Qty: 10})
+	shirt := createProduct(t, svc, manager.ID, &Product{Name: "Футболка", Price: 100})
+	variant, err := svc.SaveVariant(ctx, &Variant{ProductID: shirt.ID, SKU: "TS-XL", Attributes: map[string]string{"size": "XL"}, Qty: 2})
+	if err != nil {
+		t.Fatalf("save variant: %v", err)
+	}
+	_, err = svc.AddBarcode(ctx, &Barcode{Code: "4006381333931", ProductID: shirt.ID, VariantID: variant.ID})
+	if err != nil {
+		t.Fatalf("add barcode: %v", err)
+	}
+	_, err = svc.AddBarcode(ctx, &Barcode{Code: "4006381333932", ProductID: shirt.ID})
+	if !errors.Is(err, ErrInvalidBarcode) {
+		t.Errorf("add barcode with wrong check digit: got %v, want %v", err, ErrInvalidBarcode)
+	}
+	_, err = svc.AddBarcode(ctx, &Barcode{Code: "4006381333931", ProductID: shirt.ID})
+	if !errors.Is(err, ErrBarcodeUsed) {
+		t.Errorf("add used barcode: got %v, want %v", err, ErrBarcodeUsed)
+	}
+	_, err = svc.AddBarcode(ctx, &Barcode{Code: "5901234123457", ProductID: bread.ID, VariantID: variant.ID})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("add barcode to variant of another product: got %v, want %v", err, ErrNotFound)
+	}
+
+	sale, err := svc.MakeSale(ctx, &Sale{ManagerID: manager.ID, CustomerID: 1, Positions: []*SalePosition{
+		{ProductID: bread.ID, Qty: 3, Price: 5},
+		{Barcode: "4006381333931", Qty: 1},
+	}})
+	if err != nil {
+		t.Fatalf("make sale: %v", err)
+	}
+	if sale.ID == 0 || sale.Positions[1].ProductID != shirt.ID || sale.Positions[1].VariantID != variant.ID || sale.Positions[1].Price != 100 {
+		t.Errorf("unexpected sale: %+v, %+v", sale, sale.Positions[1])
+	}
+
+	_, err = svc.MakeSale(ctx, &Sale{ManagerID: manager.ID, CustomerID: 1, Positions: []*SalePosition{
+		{ProductID: bread.ID, Qty: 1, Price: 5},
+		{VariantID: variant.ID, Qty: 2, Price: 100},
+	}})
+	if !errors.Is(err, ErrOutOfStock) {
+		t.Fatalf("make sale over stock: got %v, want %v", err, ErrOutOfStock)
+	}
+	_, err = svc.MakeSale(ctx, &Sale{ManagerID: manager.ID, CustomerID: 1, Positions: []*SalePosition{
+		{ProductID: bread.ID + 100, Qty: 1, Price: 5},
+	}})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("make sale of unknown product: got %v, want %v", err, ErrNotFound)
+	}
+
+	result, err := svc.Lookup(ctx, "4006381333931", "")
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if result.Variant == nil || result.Variant.Qty != 1 {
+		t.Errorf("variant after sales: got %+v", result.Variant)
+	}
+	items, err := svc.Products(ctx, &ProductFilter{})
+	if err != nil || items[0].Qty != 7 {
+		t.Errorf("bread after failed sale: got %+v, %v, want qty 7", items[0], err)
+	}
+
+	total, err := svc.GetSales(ctx, manager.ID)
+	if err != nil || total != 3*5+100 {
+		t.Errorf("sales total: got %d, %v, want %d", total, err, 3*5+100)
+	}
+}
+
+func TestService_SalesReport(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+	first := createManager(t, svc, "+992000000001")
+	second := createManager(t, svc, "+992000000002", ADMIN)
+	bread := createProduct(t, svc, first.ID, &Product{Name: "Хлеб", Price: 5, Qty: 100})
+	milk := createProduct(t, svc, first.ID, &Product{Name: "Молоко", Price: 10, Qty: 100})
+	start := time.Now().Add(-time.Minute)
+
+	for _, sale := range []*Sale{
+		{ManagerID: first.ID, CustomerID: 1, Positions: []*SalePosition{{ProductID: bread.ID, Qty: 2, Price: 5}}},
+		{ManagerID: second.ID, CustomerID: 2, Positions: []*SalePosition{{ProductID: milk.ID, Qty: 3, Price: 10}, {ProductID: bread.ID, Qty: 1, Price: 5}}},
+		{ManagerID: first.ID, CustomerID: 2, Positions: []*SalePosition{{ProductID: bread.ID, Qty: 1, Price: 5}}},
+	} {
+		_, err := svc.MakeSale(ctx, sale)
+		if err != nil {
+			t.Fatalf("make sale: %v", err)
+		}
+	}
+
+	items, err := svc.Sales(ctx, &SaleFilter{ManagerID: first.ID})
+	if err != nil || len(items) != 2 || items[0].CustomerID != 2 || len(items[0].Positions) != 1 {
+		t.Fatalf("manager sales: got %d sales, %v, want 2 newest first", len(items), err)
+	}
+	items, err = svc.Sales(ctx, &SaleFilter{CustomerIDs: []int64{2}, Limit: 1})
+	if err != nil || len(items) != 1 || items[0].ManagerID != first.ID {
+		t.Errorf("customer sales with limit: got %d sales, %v", len(items), err)
+	}
+	items, err = svc.Sales(ctx, &SaleFilter{CustomerIDs: []int64{1, 2}, Limit: 1, PerCustomer: true})
+	if err != nil || len(items) != 2 || items[0].CustomerID != 2 || items[1].CustomerID != 1 {
+		t.Errorf("last sale of each customer: got %d sales, %v", len(items), err)
+	}
+	items, err = svc.Sales(ctx, &SaleFilter{CustomerIDs: []int64{}})
+	if err != nil || len(items) != 0 {
+		t.Errorf("sales of no customers: got %d sales, %v, want none", len(items), err)
+	}
+
+	_, err = svc.SalesReport(ctx, start, start)
+	if !errors.Is(err, ErrInvalidPeriod) {
+		t.Errorf("empty period: got %v, want %v", err, ErrInvalidPeriod)
+	}
+	report, err := svc.SalesReport(ctx, start, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("sales report: %v", err)
+	}
+	if report.Sales != 3 || report.Units != 7 || report.Revenue != 50 {
+		t.Errorf("report totals: got %d sales, %d units, %d revenue, want 3, 7, 50", report.Sales, report.Units, report.Revenue)
+	}
+	if len(report.Products) != 2 || report.Products[0].ProductID != milk.ID || report.Products[1].Units != 4 {
+		t.Errorf("report products: got %+v", report.Products)
+	}
+	if len(report.Managers) != 2 || report.Managers[0].ManagerID != second.ID || report.Managers[1].Sales != 2 {
+		t.Errorf("report managers: got %+v", report.Managers)
+	}
+
+	registrations, err := svc.ManagersByIDs(ctx, []int64{second.ID, second.ID, 100})
+	if err != nil || len(registrations) != 1 || !isAdmin(registrations[0].Roles) {
+		t.Errorf("managers by ids: got %+v, %v", registrations, err)
+	}
+	products, err := svc.ProductsByIDs(ctx, []int64{milk.ID, bread.ID})
+	if err != nil || len(products) != 2 || products[0].ID != bread.ID {
+		t.Errorf("products by ids: got %d, %v", len(products), err)
+	}
+}
+
+type recordedEvent struct {
+	typ      string
+	audience int64
+	data     interface{}
+}
+
+type recordingPublisher struct {
+	events []recordedEvent
+}
+
+func (p *recordingPublisher) Publish(typ string, audience int64, data interface{}) {
+	p.events = append(p.events, recordedEvent{typ, audience, data})
+}
+
+// take возвращает записанные события и очищает список.
+func (p *recordingPublisher) take() []recordedEvent {
+	events := p.events
+	p.events = nil
+	return events
+}
+
+func TestService_Events(t *testing.T) {
+	svc, store := newTestService(t)
+	publisher := &recordingPublisher{}
+	svc.SetPublisher(publisher)
+	ctx := context.Background()
+	manager := createManager(t, svc, "+992000000001")
+
+	bread := createProduct(t, svc, manager.ID, &Product{Name: "Хлеб", Price: 5, Qty: 10})
+	events := publisher.take()
+	if len(events) != 2 || events[0].typ != EventPriceChanged || events[1].typ != EventStockChanged {
+		t.Fatalf("create product: got %+v", events)
+	}
+
+	bread.Price = 6
+	bread, err := svc.UpdateProduct(ctx, manager.ID, bread)
+	if err != nil {
+		t.Fatalf("update product: %v", err)
+	}
+	events = publisher.take()
+	if len(events) != 1 || events[0].typ != EventPriceChanged {
+		t.Fatalf("update price: got %+v", events)
+	}
+	if change := events[0].data.(*PriceChange); change.OldPrice != 5 || change.Price != 6 || change.ManagerID != manager.ID {
+		t.Errorf("price change: got %+v", change)
+	}
+
+	shirt := createProduct(t, svc, manager.ID, &Product{Name: "Футболка", Price: 100})
+	variant, err := svc.SaveVariant(ctx, &Variant{ProductID: shirt.ID, SKU: "TS-XL", Qty: 2})
+	if err != nil {
+		t.Fatalf("save variant: %v", err)
+	}
+	_, err = svc.SaveVariant(ctx, variant)
+	if err != nil {
+		t.Fatalf("save variant again: %v", err)
+	}
+	events = publisher.take()
+	if len(events) != 2 || events[1].data.(*StockChange).VariantID != variant.ID {
+		t.Fatalf("save variant: got %+v, want price of the new product and one stock change", events)
+	}
+
+	_, err = svc.MakeSale(ctx, &Sale{ManagerID: manager.ID, Positions: []*SalePosition{
+		{ProductID: bread.ID, Qty: 3, Price: 6},
+		{ProductID: shirt.ID, VariantID: variant.ID, Qty: 1, Price: 100},
+	}})
+	if err != nil {
+		t.Fatalf("make sale: %v", err)
+	}
+	events = publisher.take()
+	if len(events) != 3 || events[0].typ != EventSaleCreated || events[0].audience != manager.ID {
+		t.Fatalf("make sale: got %+v", events)
+	}
+	for i, want := range []StockChange{{ProductID: bread.ID, Qty: 7}, {ProductID: shirt.ID, VariantID: variant.ID, Qty: 1}} {
+		if got := events[i+1].data.(*StockChange); *got != want || events[i+1].audience != 0 {
+			t.Errorf("stock after sale: got %+v, want %+v", got, want)
+		}
+	}
+
+	_, err = svc.SchedulePrice(ctx, &ScheduledPrice{ProductID: bread.ID, Price: 6, ManagerID: manager.ID, Effective: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("schedule price: %v", err)
+	}
+	_, err = svc.SchedulePrice(ctx, &ScheduledPrice{ProductID: bread.ID, Price: 7, ManagerID: manager.ID, Effective: time.Now().Add(90 * time.Minute)})
+	if err != nil {
+		t.Fatalf("schedule price: %v", err)
+	}
+	store.SetClock(func() time.Time { return time.Now().Add(2 * time.Hour) })
+	n, err := svc.ApplyScheduledPrices(ctx)
+	if err != nil || n != 2 {
+		t.Fatalf("apply scheduled prices: got %d, %v, want 2", n, err)
+	}
+	events = publisher.take()
+	if len(events) != 1 || events[0].data.(*PriceChange).OldPrice != 6 || events[0].data.(*PriceChange).Price != 7 {
+		t.Errorf("apply scheduled prices: got %+v, want only the change from 6 to 7", events)
+	}
+}
@@ -0,0 +1,484 @@
+// Package memstore - хранилище в памяти с теми же таблицами, что и в Postgres.
+// Используется in-memory репозиториями сервисов в тестах и при локальной разработке.
+package memstore
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Customer - запись таблицы customers.
+type Customer struct {
+	ID       int64
+	Name     string
+	Phone    string
+	Password string
+	Active   bool
+	Version  int64
+	Created  time.Time
+}
+
+// Manager - запись таблицы managers.
+type Manager struct {
+	ID       int64
+	Name     string
+	Phone    string
+	Password string
+	IsAdmin  bool
+	Created  time.Time
+}
+
+// Token - токен покупателя или менеджера.
+type Token struct {
+	Token   string
+	OwnerID int64
+	Expire  time.Time
+}
+
+// Product - запись таблицы products.
+type Product struct {
+	ID         int64
+	Name       string
+	SKU        string
+	Price      int
+	Qty        int
+	CategoryID int64
+	Attributes map[string]string
+	Active     bool
+	Version    int64
+	Created    time.Time
+}
+
+// Touch увеличивает версию покупателя, как триггер customers_bump_version.
+func (c *Customer) Touch() {
+	c.Version++
+}
+
+// Touch увеличивает версию товара, как триггеры products_bump_version и product_*_bump_version:
+// её меняет изменение самого товара, его вариантов и штрихкодов.
+func (p *Product) Touch() {
+	p.Version++
+}
+
+// Variant - запись таблицы product_variants.
+type Variant struct {
+	ID         int64
+	ProductID  int64
+	SKU        string
+	Attributes map[string]string
+	Qty        int
+	Active     bool
+	Created    time.Time
+}
+
+// Barcode - запись таблицы product_barcodes.
+type Barcode struct {
+	Code      string
+	ProductID int64
+	VariantID int64
+}
+
+// Category - запись таблицы categories.
+type Category struct {
+	ID       int64
+	Name     string
+	ParentID int64
+	Created  time.Time
+}
+
+// Sale - запись таблицы sales.
+type Sale struct {
+	ID         int64
+	ManagerID  int64
+	CustomerID int64
+	Created    time.Time
+}
+
+// Position - запись таблицы sales_positions.
+type Position struct {
+	ID        int64
+	SaleID    int64
+	ProductID int64
+	VariantID int64
+	Price     int
+	Qty       int
+	Created   time.Time
+}
+
+// Price - запись истории цен product_prices.
+type Price struct {
+	ID        int64
+	ProductID int64
+	OldPrice  int
+	Price     int
+	ManagerID int64
+	Created   time.Time
+}
+
+// ScheduledPrice - запись таблицы scheduled_prices.
+type ScheduledPrice struct {
+	ID        int64
+	ProductID int64
+	Price     int
+	ManagerID int64
+	Effective time.Time
+	Status    string
+	Created   time.Time
+}
+
+// IdempotencyKey - запись таблицы idempotency_keys.
+type IdempotencyKey struct {
+	Scope       string
+	Key         string
+	RequestHash string
+	Status      int
+	Header      map[string]string
+	Body        []byte
+	Created     time.Time
+}
+
+// OutboxMessage - запись таблицы outbox.
+type OutboxMessage struct {
+	ID            int64
+	Type          string
+	Version       int
+	AggregateType string
+	AggregateID   int64
+	Payload       []byte
+	Created       time.Time
+	Dispatched    bool
+	Published     bool
+}
+
+// Webhook - запись таблицы webhooks.
+type Webhook struct {
+	ID      int64
+	URL     string
+	Events  []string
+	Secret  string
+	Created time.Time
+}
+
+// WebhookDelivery - запись таблицы webhook_deliveries.
+type WebhookDelivery struct {
+	ID             int64
+	WebhookID      int64
+	MessageID      int64
+	Status         string
+	Attempts       int
+	NextAttempt    time.Time
+	ResponseStatus int
+	Error          string
+	Created        time.Time
+	Updated        time.Time
+}
+
+// Data - таблицы хранилища. Доступна только внутри Store.Tx.
+type Data struct {
+	Customers       map[int64]*Customer
+	Managers        map[int64]*Manager
+	CustomerTokens  map[string]*Token
+	ManagerTokens   map[string]*Token
+	Products        map[int64]*Product
+	Variants        map[int64]*Variant
+	Barcodes        map[string]*Barcode
+	Categories      map[int64]*Category
+	Sales           map[int64]*Sale
+	Positions       []*Position
+	Prices          []*Price
+	ScheduledPrices map[int64]*ScheduledPrice
+	// IdempotencyKeys - ключи по scope и key, см. IdempotencyKeyID.
+	IdempotencyKeys map[string]*IdempotencyKey
+	// Outbox - сообщения в порядке добавления.
+	Outbox            []*OutboxMessage
+	Webhooks          map[int64]*Webhook
+	WebhookDeliveries map[int64]*WebhookDelivery
+
+	now func() time.Time
+	seq int64
+}
+
+// Store - хранилище в памяти, безопасное для конкурентного использования.
+type Store struct {
+	mu   sync.Mutex
+	data *Data
+}
+
+// New создаёт пустое хранилище.
+func New() *Store {
+	return &Store{data: &Data{
+		Customers:         make(map[int64]*Customer),
+		Managers:          make(map[int64]*Manager),
+		CustomerTokens:    make(map[string]*Token),
+		ManagerTokens:     make(map[string]*Token),
+		Products:          make(map[int64]*Product),
+		Variants:          make(map[int64]*Variant),
+		Barcodes:          make(map[string]*Barcode),
+		Categories:        make(map[int64]*Category),
+		Sales:             make(map[int64]*Sale),
+		ScheduledPrices:   make(map[int64]*ScheduledPrice),
+		IdempotencyKeys:   make(map[string]*IdempotencyKey),
+		Webhooks:          make(map[int64]*Webhook),
+		WebhookDeliveries: make(map[int64]*WebhookDelivery),
+		now:               time.Now,
+	}}
+}
+
+// SetClock подменяет источник текущего времени (например, чтобы проверить истечение токенов).
+func (s *Store) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.now = now
+}
+
+// Tx выполняет fn под блокировкой хранилища.
+// Откатывать изменения хранилище не умеет, поэтому fn должна проверить всё до первой записи.
+func (s *Store) Tx(fn func(d *Data) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn(s.data)
+}
+
+// NextID возвращает следующий идентификатор (общий для всех таблиц, как и порядок вставки).
+func (d *Data) NextID() int64 {
+	d.seq++
+	return d.seq
+}
+
+// Now возвращает текущее время хранилища.
+func (d *Data) Now() time.Time {
+	return d.now()
+}
+
+// IdempotencyKeyID возвращает ключ записи в IdempotencyKeys, как первичный ключ (scope, key).
+func IdempotencyKeyID(scope string, key string) string {
+	return scope + "\x00" + key
+}
+
+// CustomerByPhone возвращает покупателя с телефоном phone или nil.
+func (d *Data) CustomerByPhone(phone string) *Customer {
+	for _, item := range d.Customers {
+		if item.Phone == phone {
+			return item
+		}
+	}
+	return nil
+}
+
+// ManagerByPhone возвращает менеджера с телефоном phone или nil.
+func (d *Data) ManagerByPhone(phone string) *Manager {
+	for _, item := range d.Managers {
+		if item.Phone == phone {
+			return item
+		}
+	}
+	return nil
+}
+
+// SortedCustomers возвращает покупателей по возрастанию ID.
+func (d *Data) SortedCustomers() []*Customer {
+	items := make([]*Customer, 0, len(d.Customers))
+	for _, item := range d.Customers {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items
+}
+
+// SortedManagers возвращает менеджеров по возрастанию ID.
+func (d *Data) SortedManagers() []*Manager {
+	items := make([]*Manager, 0, len(d.Managers))
+	for _, item := range d.Managers {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items
+}
+
+// SortedSales возвращает продажи по убыванию ID, то есть от новых к старым.
+func (d *Data) SortedSales() []*Sale {
+	items := make([]*Sale, 0, len(d.Sales))
+	for _, item := range d.Sales {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID > items[j].ID })
+	return items
+}
+
+// SortedProducts возвращает товары по возрастанию ID.
+func (d *Data) SortedProducts() []*Product {
+	items := make([]*Product, 0, len(d.Products))
+	for _, item := range d.Products {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items
+}
+
+// SortedCategories возвращает категории по возрастанию ID.
+func (d *Data) SortedCategories() []*Category {
+	items := make([]*Category, 0, len(d.Categories))
+	for _, item := range d.Categories {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items
+}
+
+// ProductVariants возвращает варианты товара по возрастанию ID.
+func (d *Data) ProductVariants(productID int64, activeOnly bool) []*Variant {
+	items := make([]*Variant, 0)
+	for _, item := range d.Variants {
+		if item.ProductID == productID && (item.Active || !activeOnly) {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items
+}
+
+// ProductBarcodes возвращает штрихкоды товара по возрастанию кода.
+func (d *Data) ProductBarcodes(productID int64) []*Barcode {
+	items := make([]*Barcode, 0)
+	for _, item := range d.Barcodes {
+		if item.ProductID == productID {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Code < items[j].Code })
+	return items
+}
+
+// ProductBySKU возвращает товар с артикулом sku или nil.
+func (d *Data) ProductBySKU(sku string) *Product {
+	for _, item := range d.Products {
+		if sku != "" && item.SKU == sku {
+			return item
+		}
+	}
+	return nil
+}
+
+// VariantBySKU возвращает вариант с артикулом sku или nil.
+func (d *Data) VariantBySKU(sku string) *Variant {
+	for _, item := range d.Variants {
+		if sku != "" && item.SKU == sku {
+			return item
+		}
+	}
+	return nil
+}
+
+// FilterProducts возвращает активные товары категории categoryID (вместе с вложенными, 0 - любой)
+// с атрибутами attributes у самого товара или у одного из его активных вариантов.
+func (d *Data) FilterProducts(categoryID int64, attributes map[string]string) []*Product {
+	var tree map[int64]bool
+	if categoryID != 0 {
+		tree = d.categoryTree(categoryID)
+	}
+
+	items := make([]*Product, 0)
+	for _, item := range d.SortedProducts() {
+		if !item.Active || (tree != nil && !tree[item.CategoryID]) {
+			continue
+		}
+		if !d.productHas(item, attributes) {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// SearchProducts возвращает активные товары, в названии или SKU которых встречаются все слова query.
+// Это упрощённая замена полнотекстового поиска Postgres.
+func (d *Data) SearchProducts(query string) []*Product {
+	words := strings.Fields(strings.ToLower(query))
+	items := make([]*Product, 0)
+	for _, item := range d.SortedProducts() {
+		if !item.Active || len(words) == 0 {
+			continue
+		}
+		text := strings.ToLower(item.Name + " " + item.SKU)
+		found := true
+		for _, word := range words {
+			if !strings.Contains(text, word) {
+				found = false
+			}
+		}
+		if found {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// InStock сообщает, есть ли товар в наличии сам или в одном из активных вариантов.
+func (d *Data) InStock(product *Product) bool {
+	if product.Qty > 0 {
+		return true
+	}
+	for _, variant := range d.ProductVariants(product.ID, true) {
+		if variant.Qty > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// categoryTree возвращает категорию id вместе со всеми вложенными.
+func (d *Data) categoryTree(id int64) map[int64]bool {
+	tree := map[int64]bool{}
+	if _, ok := d.Categories[id]; !ok {
+		return tree
+	}
+	tree[id] = true
+	for changed := true; changed; {
+		changed = false
+		for _, item := range d.Categories {
+			if tree[item.ParentID] && !tree[item.ID] {
+				tree[item.ID] = true
+				changed = true
+			}
+		}
+	}
+	return tree
+}
+
+// productHas повторяет условие attributes @> filter для товара и его вариантов.
+func (d *Data) productHas(product *Product, attributes map[string]string) bool {
+	if contains(product.Attributes, attributes) {
+		return true
+	}
+	for _, variant := range d.ProductVariants(product.ID, true) {
+		merged := CopyAttributes(product.Attributes)
+		for key, value := range variant.Attributes {
+			merged[key] = value
+		}
+		if contains(merged, attributes) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(attributes map[string]string, filter map[string]string) bool {
+	for key, value := range filter {
+		current, ok := attributes[key]
+		if !ok || current != value {
+			return false
+		}
+	}
+	return true
+}
+
+// CopyAttributes возвращает копию атрибутов, чтобы записи хранилища не менялись снаружи.
+func CopyAttributes(attributes map[string]string) map[string]string {
+	items := make(map[string]string, len(attributes))
+	for key, value := range attributes {
+		items[key] = value
+	}
+	return items
+}
@@ -0,0 +1,177 @@
+// Package metrics собирает метрики приложения в формате Prometheus.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/shohinsherov/crud/cmd/app/middleware"
+)
+
+const namespace = "crud"
+
+// Результаты входа для метки result счётчика logins.
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+	LoginError   = "error"
+)
+
+// unmatchedRoute - метка для запросов, не попавших ни в один маршрут.
+const unmatchedRoute = "unmatched"
+
+// Metrics хранит реестр и все метрики приложения.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+
+	SalesCreated prometheus.Counter
+	UnitsSold    prometheus.Counter
+	OutOfStock   prometheus.Counter
+	Logins       *prometheus.CounterVec
+}
+
+// New создаёт и регистрирует метрики, включая стандартные метрики Go-рантайма и процесса.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route template, method and status code.",
+		}, []string{"route", "method", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route template and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		SalesCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sales_created_total",
+			Help:      "Sales successfully created.",
+		}),
+		UnitsSold: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "units_sold_total",
+			Help:      "Product units sold.",
+		}),
+		OutOfStock: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sales_out_of_stock_total",
+			Help:      "Sales rejected because of insufficient stock.",
+		}),
+		Logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Token requests by role and result.",
+		}, []string{"role", "result"}),
+	}
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.requests,
+		m.latency,
+		m.SalesCreated,
+		m.UnitsSold,
+		m.OutOfStock,
+		m.Logins,
+	)
+	return m
+}
+
+// Register добавляет в реестр дополнительный сборщик.
+func (m *Metrics) Register(collector prometheus.Collector) error {
+	return m.registry.Register(collector)
+}
+
+// Handler отдаёт метрики для Prometheus.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Instrument считает запросы и время их обработки. В метку route попадает шаблон
+// маршрута из router (например, /api/v1/managers/products/{id}), а не фактический путь,
+// чтобы число временных рядов не росло вместе с числом идентификаторов.
+func (m *Metrics) Instrument(router *mux.Router) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			start := time.Now()
+			route := unmatchedRoute
+			var match mux.RouteMatch
+			if router.Match(request, &match) && match.Route != nil {
+				if template, err := match.Route.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+
+			recorder := middleware.NewStatusRecorder(writer)
+			handler.ServeHTTP(recorder, request)
+
+			m.requests.WithLabelValues(route, request.Method, strconv.Itoa(recorder.Status())).Inc()
+			m.latency.WithLabelValues(route, request.Method).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
+// poolCollector снимает статистику пула соединений в момент сбора метрик.
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	acquired     *prometheus.Desc
+	idle         *prometheus.Desc
+	total        *prometheus.Desc
+	max          *prometheus.Desc
+	acquires     *prometheus.Desc
+	acquireWait  *prometheus.Desc
+	emptyAcquire *prometheus.Desc
+	canceled     *prometheus.Desc
+}
+
+// NewPoolCollector создаёт сборщик статистики pgxpool.
+func NewPoolCollector(pool *pgxpool.Pool) prometheus.Collector {
+	desc := func(name string, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+	return &poolCollector{
+		pool:         pool,
+		acquired:     desc("acquired_connections", "Connections currently in use."),
+		idle:         desc("idle_connections", "Idle connections in the pool."),
+		total:        desc("total_connections", "All connections in the pool, including ones being established."),
+		max:          desc("max_connections", "Maximum size of the pool."),
+		acquires:     desc("acquires_total", "Successful connection acquisitions."),
+		acquireWait:  desc("acquire_duration_seconds_total", "Total time spent acquiring connections."),
+		emptyAcquire: desc("empty_acquires_total", "Acquisitions that had to wait because the pool was empty."),
+		canceled:     desc("canceled_acquires_total", "Acquisitions canceled by context."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquired
+	ch <- c.idle
+	ch <- c.total
+	ch <- c.max
+	ch <- c.acquires
+	ch <- c.acquireWait
+	ch <- c.emptyAcquire
+	ch <- c.canceled
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquired, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.max, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireWait, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquire, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceled, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+}
@@ -0,0 +1,404 @@
+// Package migrations применяет версионированные миграции схемы, встроенные в бинарник.
+//
+// Каждая миграция - пара файлов sql/NNNN_name.up.sql и sql/NNNN_name.down.sql.
+// Применённые версии и контрольные суммы хранятся в таблице schema_migrations,
+// а рекомендательная блокировка не даёт нескольким экземплярам мигрировать одновременно.
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+)
+
+// Dir - каталог с миграциями относительно корня репозитория; команда create берёт его по умолчанию.
+const Dir = "pkg/migrations/sql"
+
+// lockKey - ключ pg_advisory_lock, общий для всех экземпляров приложения.
+const lockKey = 7_296_617_132_048_253
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// ErrChecksumMismatch возвращается, когда применённая миграция была изменена после применения.
+var ErrChecksumMismatch = errors.New("migration checksum mismatch")
+
+// ErrUnknownVersion возвращается, когда в базе применена версия, отсутствующая в бинарнике.
+var ErrUnknownVersion = errors.New("unknown migration version")
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration - одна версия схемы.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status описывает состояние одной миграции.
+type Status struct {
+	Version  int64      `json:"version"`
+	Name     string     `json:"name"`
+	Applied  *time.Time `json:"applied,omitempty"`
+	Checksum string     `json:"checksum"`
+}
+
+// Load читает встроенные миграции, упорядоченные по версии.
+func Load() ([]*Migration, error) {
+	return load(files)
+}
+
+func load(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		data, err := fs.ReadFile(fsys, "sql/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has different names: %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(data)
+			sum := sha256.Sum256(data)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	items := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Checksum == "" {
+			return nil, fmt.Errorf("migration %d has no up file", migration.Version)
+		}
+		items = append(items, migration)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Version < items[j].Version
+	})
+	return items, nil
+}
+
+// Migrator применяет и откатывает миграции.
+type Migrator struct {
+	pool       *pgxpool.Pool
+	logger     *zap.Logger
+	migrations []*Migration
+}
+
+// NewMigrator создаёт мигратор со встроенными миграциями.
+func NewMigrator(pool *pgxpool.Pool, logger *zap.Logger) (*Migrator, error) {
+	items, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{pool: pool, logger: logger, migrations: items}, nil
+}
+
+// Up применяет все ещё не применённые миграции и возвращает их количество.
+func (m *Migrator) Up(ctx context.Context) (count int, err error) {
+	err = m.locked(ctx, func(conn *pgxpool.Conn, applied map[int64]string) error {
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			err := m.apply(ctx, conn, migration.Up, func(tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, `
+				INSERT INTO schema_migrations(version, name, checksum) VALUES ($1, $2, $3)
+				`, migration.Version, migration.Name, migration.Checksum)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			m.logger.Info("migration applied", zap.Int64("version", migration.Version), zap.String("name", migration.Name))
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down откатывает steps последних применённых миграций.
+func (m *Migrator) Down(ctx context.Context, steps int) (count int, err error) {
+	err = m.locked(ctx, func(conn *pgxpool.Conn, applied map[int64]string) error {
+		for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			err := m.apply(ctx, conn, migration.Down, func(tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			m.logger.Info("migration reverted", zap.Int64("version", migration.Version), zap.String("name", migration.Name))
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Status возвращает состояние всех известных миграций.
+func (m *Migrator) Status(ctx context.Context) ([]*Status, error) {
+	err := m.ensureTable(ctx, m.pool)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := m.pool.Query(ctx, `SELECT version, applied FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		err = rows.Scan(&version, &at)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		item := &Status{Version: migration.Version, Name: migration.Name, Checksum: migration.Checksum}
+		if at, ok := applied[migration.Version]; ok {
+			item.Applied = &at
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Version возвращает последнюю применённую версию схемы (0, если миграций не было).
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	err := m.ensureTable(ctx, m.pool)
+	if err != nil {
+		return 0, err
+	}
+	var version int64
+	err = m.pool.QueryRow(ctx, `
+	SELECT COALESCE(MAX(version), 0) FROM schema_migrations
+	`).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Check проверяет, что схема базы совпадает с последней встроенной миграцией.
+func (m *Migrator) Check(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if expected := m.Latest(); version != expected {
+		return fmt.Errorf("schema version %d, expected %d", version, expected)
+	}
+	return nil
+}
+
+// Latest возвращает версию последней миграции, известной мигратору.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Create создаёт пустую пару файлов для новой миграции в каталоге dir; каталог должен существовать.
+func Create(dir string, name string) (up string, down string, err error) {
+	if !regexp.MustCompile(`^\w+$`).MatchString(name) {
+		return "", "", fmt.Errorf("invalid migration name %q", name)
+	}
+	info, err := os.Stat(dir)
+	if errors.Is(err, os.ErrNotExist) || err == nil && !info.IsDir() {
+		return "", "", fmt.Errorf("migrations directory %s not found: run from the repository root or pass -dir", dir)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", "", err
+	}
+	var version int64
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		current, err := strconv.ParseInt(match[1], 10, 64)
+		if err == nil && current > version {
+			version = current
+		}
+	}
+
+	prefix := filepath.Join(dir, fmt.Sprintf("%04d_%s", version+1, name))
+	up, down = prefix+".up.sql", prefix+".down.sql"
+	for _, path := range []string{up, down} {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return "", "", err
+		}
+		err = file.Close()
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return up, down, nil
+}
+
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+func (m *Migrator) ensureTable(ctx context.Context, db execer) error {
+	_, err := db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations
+	(
+		version  BIGINT PRIMARY KEY,
+		name     TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)
+	`)
+	return err
+}
+
+// locked выполняет fn на отдельном соединении под рекомендательной блокировкой,
+// предварительно сверив контрольные суммы уже применённых миграций.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *pgxpool.Conn, applied map[int64]string) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockKey)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+		if err != nil {
+			m.logger.Error("can't release migration lock", zap.Error(err))
+		}
+	}()
+
+	err = m.ensureTable(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return fn(conn, applied)
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *pgxpool.Conn) (map[int64]string, error) {
+	rows, err := conn.Query(ctx, `SELECT version, checksum FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]string)
+	for rows.Next() {
+		var version int64
+		var checksum string
+		err = rows.Scan(&version, &checksum)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = checksum
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[int64]*Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+	for version, checksum := range applied {
+		migration, ok := known[version]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+		}
+		if migration.Checksum != checksum {
+			return nil, fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, version, migration.Name)
+		}
+	}
+	return applied, nil
+}
+
+// apply выполняет скрипт и запись в schema_migrations в одной транзакции.
+func (m *Migrator) apply(ctx context.Context, conn *pgxpool.Conn, script string, record func(tx pgx.Tx) error) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, script)
+	if err != nil {
+		return err
+	}
+	err = record(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
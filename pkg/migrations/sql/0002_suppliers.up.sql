@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS suppliers
+(
+    id      BIGSERIAL PRIMARY KEY,
+    name    TEXT NOT NULL,
+    phone   TEXT NOT NULL DEFAULT '',
+    email   TEXT NOT NULL DEFAULT '',
+    address TEXT NOT NULL DEFAULT '',
+    terms   TEXT NOT NULL DEFAULT '',
+    active  BOOLEAN NOT NULL DEFAULT TRUE,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS purchase_orders
+(
+    id          BIGSERIAL PRIMARY KEY,
+    supplier_id BIGINT NOT NULL REFERENCES suppliers,
+    manager_id  BIGINT NOT NULL REFERENCES managers,
+    status      TEXT NOT NULL DEFAULT 'DRAFT' CHECK (status IN ('DRAFT', 'SENT', 'PARTIALLY_RECEIVED', 'RECEIVED', 'CANCELLED')),
+    created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS purchase_order_lines
+(
+    id           BIGSERIAL PRIMARY KEY,
+    order_id     BIGINT NOT NULL REFERENCES purchase_orders,
+    product_id   BIGINT NOT NULL REFERENCES products,
+    price        INTEGER NOT NULL DEFAULT 0 CHECK (price >= 0),
+    qty          INTEGER NOT NULL CHECK (qty > 0),
+    received_qty INTEGER NOT NULL DEFAULT 0 CHECK (received_qty >= 0 AND received_qty <= qty),
+    created      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,5 @@
+ALTER TABLE sales_positions DROP COLUMN IF EXISTS variant_id;
+DROP TABLE IF EXISTS product_variants;
+ALTER TABLE products DROP COLUMN IF EXISTS attributes;
+ALTER TABLE products DROP COLUMN IF EXISTS category_id;
+DROP TABLE IF EXISTS categories;
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS categories
+(
+    id        BIGSERIAL PRIMARY KEY,
+    name      TEXT NOT NULL,
+    parent_id BIGINT REFERENCES categories,
+    created   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS category_id BIGINT REFERENCES categories;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS products_category_id_idx ON products (category_id);
+CREATE INDEX IF NOT EXISTS products_attributes_idx ON products USING GIN (attributes);
+
+CREATE TABLE IF NOT EXISTS product_variants
+(
+    id         BIGSERIAL PRIMARY KEY,
+    product_id BIGINT NOT NULL REFERENCES products,
+    sku        TEXT NOT NULL UNIQUE,
+    attributes JSONB NOT NULL DEFAULT '{}',
+    qty        INTEGER NOT NULL DEFAULT 0 CHECK (qty >= 0),
+    active     BOOLEAN NOT NULL DEFAULT TRUE,
+    created    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS product_variants_product_id_idx ON product_variants (product_id);
+
+ALTER TABLE sales_positions ADD COLUMN IF NOT EXISTS variant_id BIGINT REFERENCES product_variants;
@@ -0,0 +1,11 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS sku TEXT UNIQUE;
+
+CREATE TABLE IF NOT EXISTS product_barcodes
+(
+    barcode    TEXT PRIMARY KEY CHECK (barcode ~ '^[0-9]{13}$'),
+    product_id BIGINT NOT NULL REFERENCES products,
+    variant_id BIGINT REFERENCES product_variants,
+    created    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS product_barcodes_product_id_idx ON product_barcodes (product_id);
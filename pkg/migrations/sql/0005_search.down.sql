@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS products_name_trgm_idx;
+DROP INDEX IF EXISTS products_search_idx;
+ALTER TABLE products DROP COLUMN IF EXISTS search;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS product_prices
+(
+    id         BIGSERIAL PRIMARY KEY,
+    product_id BIGINT NOT NULL REFERENCES products,
+    old_price  INTEGER NOT NULL DEFAULT 0 CHECK (old_price >= 0),
+    price      INTEGER NOT NULL CHECK (price > 0),
+    manager_id BIGINT REFERENCES managers,
+    created    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS product_prices_product_id_idx ON product_prices (product_id, created);
+
+CREATE TABLE IF NOT EXISTS scheduled_prices
+(
+    id         BIGSERIAL PRIMARY KEY,
+    product_id BIGINT NOT NULL REFERENCES products,
+    price      INTEGER NOT NULL CHECK (price > 0),
+    manager_id BIGINT NOT NULL REFERENCES managers,
+    effective  TIMESTAMP NOT NULL,
+    status     TEXT NOT NULL DEFAULT 'PENDING' CHECK (status IN ('PENDING', 'APPLIED', 'CANCELLED')),
+    created    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_prices_pending_idx ON scheduled_prices (effective) WHERE status = 'PENDING';
@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS product_barcodes_bump_version ON product_barcodes;
+DROP TRIGGER IF EXISTS product_variants_bump_version ON product_variants;
+DROP TRIGGER IF EXISTS customers_bump_version ON customers;
+DROP TRIGGER IF EXISTS products_bump_version ON products;
+DROP FUNCTION IF EXISTS bump_product_version();
+DROP FUNCTION IF EXISTS bump_version();
+ALTER TABLE customers DROP COLUMN IF EXISTS version;
+ALTER TABLE products DROP COLUMN IF EXISTS version;
@@ -0,0 +1,31 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION bump_version() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER products_bump_version BEFORE UPDATE ON products
+    FOR EACH ROW EXECUTE FUNCTION bump_version();
+CREATE TRIGGER customers_bump_version BEFORE UPDATE ON customers
+    FOR EACH ROW EXECUTE FUNCTION bump_version();
+
+-- Варианты и штрихкоды входят в представление товара, поэтому их изменение тоже меняет его версию.
+CREATE OR REPLACE FUNCTION bump_product_version() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        UPDATE products SET version = version + 1 WHERE id = OLD.product_id;
+        RETURN OLD;
+    END IF;
+    UPDATE products SET version = version + 1 WHERE id = NEW.product_id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER product_variants_bump_version AFTER INSERT OR UPDATE OR DELETE ON product_variants
+    FOR EACH ROW EXECUTE FUNCTION bump_product_version();
+CREATE TRIGGER product_barcodes_bump_version AFTER INSERT OR UPDATE OR DELETE ON product_barcodes
+    FOR EACH ROW EXECUTE FUNCTION bump_product_version();
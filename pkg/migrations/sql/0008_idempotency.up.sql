@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys
+(
+    scope        TEXT NOT NULL,
+    key          TEXT NOT NULL,
+    request_hash TEXT NOT NULL,
+    -- status 0 - запрос ещё выполняется, иначе HTTP-код сохранённого ответа.
+    status       INTEGER NOT NULL DEFAULT 0,
+    header       JSONB NOT NULL DEFAULT '{}',
+    body         BYTEA,
+    created      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_created_idx ON idempotency_keys (created);
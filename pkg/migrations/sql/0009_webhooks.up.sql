@@ -0,0 +1,39 @@
+-- outbox - сообщения о событиях, которые пишутся в одной транзакции с изменением данных.
+CREATE TABLE IF NOT EXISTS outbox
+(
+    id         BIGSERIAL PRIMARY KEY,
+    type       TEXT      NOT NULL,
+    payload    JSONB     NOT NULL,
+    created    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    -- dispatched - когда по сообщению созданы доставки вебхуков; NULL - ещё не созданы.
+    dispatched TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (id) WHERE dispatched IS NULL;
+
+CREATE TABLE IF NOT EXISTS webhooks
+(
+    id      BIGSERIAL PRIMARY KEY,
+    url     TEXT      NOT NULL,
+    events  TEXT[]    NOT NULL,
+    secret  TEXT      NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id              BIGSERIAL PRIMARY KEY,
+    webhook_id      BIGINT    NOT NULL REFERENCES webhooks ON DELETE CASCADE,
+    message_id      BIGINT    NOT NULL REFERENCES outbox,
+    status          TEXT      NOT NULL DEFAULT 'PENDING',
+    attempts        INTEGER   NOT NULL DEFAULT 0,
+    next_attempt    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    -- response_status - HTTP-код последней попытки, 0 - ответа не было.
+    response_status INTEGER   NOT NULL DEFAULT 0,
+    error           TEXT      NOT NULL DEFAULT '',
+    created         TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated         TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (webhook_id, message_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt) WHERE status = 'PENDING';
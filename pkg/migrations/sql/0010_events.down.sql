@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS outbox_unpublished_idx;
+ALTER TABLE outbox DROP COLUMN IF EXISTS published;
+ALTER TABLE outbox DROP COLUMN IF EXISTS aggregate_id;
+ALTER TABLE outbox DROP COLUMN IF EXISTS aggregate_type;
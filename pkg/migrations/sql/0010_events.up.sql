@@ -0,0 +1,11 @@
+-- aggregate_type и aggregate_id - агрегат события: Relay публикует события одного агрегата по порядку.
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS aggregate_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS aggregate_id BIGINT NOT NULL DEFAULT 0;
+-- published - когда Relay опубликовал событие; NULL - ещё не опубликовано.
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS published TIMESTAMP;
+
+-- В записанных раньше событиях (sale.created, customer.registered) агрегат - объект из payload.
+UPDATE outbox SET aggregate_type = split_part(type, '.', 1), aggregate_id = (payload ->> 'id')::BIGINT
+WHERE aggregate_type = '';
+
+CREATE INDEX IF NOT EXISTS outbox_unpublished_idx ON outbox (id) WHERE published IS NULL;
@@ -0,0 +1,2 @@
+-- По message_id удаляются доставки старых событий outbox: уникальный индекс (webhook_id, message_id) для этого не подходит.
+CREATE INDEX IF NOT EXISTS webhook_deliveries_message_idx ON webhook_deliveries (message_id);
@@ -0,0 +1,5 @@
+-- version - версия формата payload (events.SchemaVersion), в которой записано событие; подписчики вебхуков
+-- получают её в поле version. До 0010_events payload был объектом целиком (Sale, Customer) - это версия 1.
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+UPDATE outbox SET version = 2 WHERE created >= (SELECT applied FROM schema_migrations WHERE version = 10);
+ALTER TABLE outbox ALTER COLUMN version DROP DEFAULT;
@@ -0,0 +1,43 @@
+// Package outbox записывает доменные события в таблицу outbox в той же транзакции, что и само
+// изменение данных: событие появляется тогда и только тогда, когда изменение сохранено. Рассылают
+// события фоновые задачи (см. пакеты events и webhooks).
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shohinsherov/crud/pkg/events"
+	"github.com/shohinsherov/crud/pkg/memstore"
+)
+
+// Insert добавляет событие в транзакции tx, в которой меняются сами данные.
+func Insert(ctx context.Context, tx pgx.Tx, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+	INSERT INTO outbox(type, version, aggregate_type, aggregate_id, payload) VALUES ($1, $2, $3, $4, $5)
+	`, event.EventType(), events.SchemaVersion, event.AggregateType(), event.AggregateID(), data)
+	return err
+}
+
+// Add добавляет событие в хранилище в памяти; вызывается внутри memstore.Store.Tx вместе с изменением.
+func Add(d *memstore.Data, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	d.Outbox = append(d.Outbox, &memstore.OutboxMessage{
+		ID:            d.NextID(),
+		Type:          event.EventType(),
+		Version:       events.SchemaVersion,
+		AggregateType: event.AggregateType(),
+		AggregateID:   event.AggregateID(),
+		Payload:       data,
+		Created:       d.Now(),
+	})
+	return nil
+}
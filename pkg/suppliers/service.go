@@ -0,0 +1,497 @@
+package suppliers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shohinsherov/crud/pkg/events"
+	"github.com/shohinsherov/crud/pkg/logging"
+	"github.com/shohinsherov/crud/pkg/managers"
+	"github.com/shohinsherov/crud/pkg/outbox"
+	"go.uber.org/zap"
+)
+
+// ErrNotFound возвращается, когда поставщик или заказ не найден.
+var ErrNotFound = errors.New("item not found")
+
+// ErrInternal возвращается, когда произошла внутренняя ошибка.
+var ErrInternal = errors.New("internal error")
+
+// ErrInvalidStatus возвращается, когда заказ нельзя перевести в запрошенный статус.
+var ErrInvalidStatus = errors.New("invalid purchase order status")
+
+// ErrInvalidQty возвращается, когда количество в строке заказа некорректно.
+var ErrInvalidQty = errors.New("invalid qty")
+
+// ErrInvalidOrder возвращается, когда в заказе нет строк или его поставщик либо товар не существуют.
+var ErrInvalidOrder = errors.New("invalid purchase order")
+
+// Статусы заказа поставщику.
+const (
+	StatusDraft             = "DRAFT"
+	StatusSent              = "SENT"
+	StatusPartiallyReceived = "PARTIALLY_RECEIVED"
+	StatusReceived          = "RECEIVED"
+	StatusCancelled         = "CANCELLED"
+)
+
+// Service описывает сервис работы с поставщиками и заказами поставщикам.
+type Service struct {
+	pool      *pgxpool.Pool
+	logger    *zap.Logger
+	publisher managers.Publisher
+}
+
+// NewService создаёт сервис.
+func NewService(pool *pgxpool.Pool, logger *zap.Logger) *Service {
+	return &Service{pool: pool, logger: logger}
+}
+
+// SetPublisher задаёт получателя событий об остатках, принятых по заказам; без него события не отправляются.
+func (s *Service) SetPublisher(publisher managers.Publisher) {
+	s.publisher = publisher
+}
+
+// log возвращает логгер с идентификатором запроса из ctx.
+func (s *Service) log(ctx context.Context) *zap.Logger {
+	return logging.For(ctx, s.logger)
+}
+
+// Supplier представляет информацию о поставщике.
+type Supplier struct {
+	ID      int64     `json:"id"`
+	Name    string    `json:"name"`
+	Phone   string    `json:"phone"`
+	Email   string    `json:"email"`
+	Address string    `json:"address"`
+	Terms   string    `json:"terms"`
+	Active  bool      `json:"active"`
+	Created time.Time `json:"created"`
+}
+
+// PurchaseOrder представляет заказ поставщику.
+type PurchaseOrder struct {
+	ID         int64                `json:"id"`
+	SupplierID int64                `json:"supplier_id"`
+	ManagerID  int64                `json:"manager_id"`
+	Status     string               `json:"status"`
+	Created    time.Time            `json:"created"`
+	Lines      []*PurchaseOrderLine `json:"lines"`
+}
+
+// PurchaseOrderLine представляет строку заказа поставщику.
+type PurchaseOrderLine struct {
+	ID          int64     `json:"id"`
+	OrderID     int64     `json:"order_id"`
+	ProductID   int64     `json:"product_id"`
+	Price       int       `json:"price"`
+	Qty         int       `json:"qty"`
+	ReceivedQty int       `json:"received_qty"`
+	Created     time.Time `json:"created"`
+}
+
+// Receipt описывает количество, принятое по строке заказа.
+type Receipt struct {
+	LineID int64 `json:"line_id"`
+	Qty    int   `json:"qty"`
+}
+
+func (s *Service) Suppliers(ctx context.Context) ([]*Supplier, error) {
+	items := make([]*Supplier, 0)
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, name, phone, email, address, terms, active, created FROM suppliers ORDER BY id LIMIT 500
+	`)
+	if err != nil {
+		s.log(ctx).Error("suppliers failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Supplier{}
+		err = rows.Scan(&item.ID, &item.Name, &item.Phone, &item.Email, &item.Address, &item.Terms, &item.Active, &item.Created)
+		if err != nil {
+			s.log(ctx).Error("suppliers failed", zap.Error(err))
+			return nil, ErrInternal
+		}
+		items = append(items, item)
+	}
+	err = rows.Err()
+	if err != nil {
+		s.log(ctx).Error("suppliers failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	return items, nil
+}
+
+func (s *Service) SupplierByID(ctx context.Context, id int64) (*Supplier, error) {
+	item := &Supplier{}
+	err := s.pool.QueryRow(ctx, `
+	SELECT id, name, phone, email, address, terms, active, created FROM suppliers WHERE id = $1
+	`, id).Scan(&item.ID, &item.Name, &item.Phone, &item.Email, &item.Address, &item.Terms, &item.Active, &item.Created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		s.log(ctx).Error("supplier by id failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return item, nil
+}
+
+func (s *Service) CreateSupplier(ctx context.Context, item *Supplier) (*Supplier, error) {
+	err := s.pool.QueryRow(ctx, `
+	INSERT INTO suppliers(name, phone, email, address, terms) VALUES ($1, $2, $3, $4, $5) RETURNING id, active, created
+	`, item.Name, item.Phone, item.Email, item.Address, item.Terms).Scan(&item.ID, &item.Active, &item.Created)
+	if err != nil {
+		s.log(ctx).Error("create supplier failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return item, nil
+}
+
+func (s *Service) UpdateSupplier(ctx context.Context, item *Supplier) (*Supplier, error) {
+	err := s.pool.QueryRow(ctx, `
+	UPDATE suppliers SET name = $2, phone = $3, email = $4, address = $5, terms = $6, active = $7 WHERE id = $1 RETURNING created
+	`, item.ID, item.Name, item.Phone, item.Email, item.Address, item.Terms, item.Active).Scan(&item.Created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		s.log(ctx).Error("update supplier failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return item, nil
+}
+
+func (s *Service) PurchaseOrders(ctx context.Context) ([]*PurchaseOrder, error) {
+	items := make([]*PurchaseOrder, 0)
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, supplier_id, manager_id, status, created FROM purchase_orders ORDER BY id DESC LIMIT 500
+	`)
+	if err != nil {
+		s.log(ctx).Error("purchase orders failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &PurchaseOrder{}
+		err = rows.Scan(&item.ID, &item.SupplierID, &item.ManagerID, &item.Status, &item.Created)
+		if err != nil {
+			s.log(ctx).Error("purchase orders failed", zap.Error(err))
+			return nil, ErrInternal
+		}
+		items = append(items, item)
+	}
+	err = rows.Err()
+	if err != nil {
+		s.log(ctx).Error("purchase orders failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	return items, nil
+}
+
+func (s *Service) PurchaseOrderByID(ctx context.Context, id int64) (*PurchaseOrder, error) {
+	return s.purchaseOrder(ctx, s.pool, id)
+}
+
+// CreatePurchaseOrder создаёт черновик заказа вместе со строками.
+func (s *Service) CreatePurchaseOrder(ctx context.Context, order *PurchaseOrder) (*PurchaseOrder, error) {
+	if len(order.Lines) == 0 {
+		return nil, ErrInvalidOrder
+	}
+	for _, line := range order.Lines {
+		if line.Qty <= 0 || line.Price < 0 {
+			return nil, ErrInvalidQty
+		}
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		s.log(ctx).Error("create purchase order failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+	INSERT INTO purchase_orders(supplier_id, manager_id) VALUES ($1, $2) RETURNING id, status, created
+	`, order.SupplierID, order.ManagerID).Scan(&order.ID, &order.Status, &order.Created)
+	if isForeignKeyViolation(err) {
+		return nil, ErrInvalidOrder
+	}
+	if err != nil {
+		s.log(ctx).Error("create purchase order failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	for _, line := range order.Lines {
+		line.OrderID = order.ID
+		err = tx.QueryRow(ctx, `
+		INSERT INTO purchase_order_lines(order_id, product_id, price, qty) VALUES ($1, $2, $3, $4) RETURNING id, received_qty, created
+		`, line.OrderID, line.ProductID, line.Price, line.Qty).Scan(&line.ID, &line.ReceivedQty, &line.Created)
+		if isForeignKeyViolation(err) {
+			return nil, ErrInvalidOrder
+		}
+		if err != nil {
+			s.log(ctx).Error("create purchase order failed", zap.Error(err))
+			return nil, ErrInternal
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		s.log(ctx).Error("create purchase order failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return order, nil
+}
+
+// Send отправляет черновик заказа поставщику.
+func (s *Service) Send(ctx context.Context, id int64) (*PurchaseOrder, error) {
+	return s.changeStatus(ctx, id, StatusSent, StatusDraft)
+}
+
+// Cancel отменяет заказ, по которому ещё ничего не принято.
+func (s *Service) Cancel(ctx context.Context, id int64) (*PurchaseOrder, error) {
+	return s.changeStatus(ctx, id, StatusCancelled, StatusDraft, StatusSent)
+}
+
+// Receive принимает товар по заказу и увеличивает остатки товаров в одной транзакции вместе с событиями
+// ProductChanged в outbox, затем отправляет новые остатки в Publisher. Если receipts пуст, принимается весь оставшийся по заказу товар.
+func (s *Service) Receive(ctx context.Context, id int64, receipts []*Receipt) (*PurchaseOrder, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		s.log(ctx).Error("receive failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	err = tx.QueryRow(ctx, `
+	SELECT status FROM purchase_orders WHERE id = $1 FOR UPDATE
+	`, id).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		s.log(ctx).Error("receive failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+	if status != StatusSent && status != StatusPartiallyReceived {
+		return nil, ErrInvalidStatus
+	}
+
+	if len(receipts) == 0 {
+		receipts, err = s.outstanding(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Новые остатки товаров в порядке приёма; события о них отправляются после фиксации.
+	stock := make(map[int64]int)
+	changed := make([]int64, 0)
+	for _, receipt := range receipts {
+		if receipt.Qty <= 0 {
+			return nil, ErrInvalidQty
+		}
+		var productID int64
+		err = tx.QueryRow(ctx, `
+		UPDATE purchase_order_lines SET received_qty = received_qty + $1
+		WHERE id = $2 AND order_id = $3 AND received_qty + $1 <= qty
+		RETURNING product_id
+		`, receipt.Qty, receipt.LineID, id).Scan(&productID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidQty
+		}
+		if err != nil {
+			s.log(ctx).Error("receive failed", zap.Error(err))
+			return nil, ErrInternal
+		}
+
+		event := &events.ProductChanged{Change: events.ProductReceived}
+		err = tx.QueryRow(ctx, `
+		UPDATE products SET qty = qty + $1 WHERE id = $2
+		RETURNING id, name, COALESCE(sku, ''), qty, price, active, version
+		`, receipt.Qty, productID).Scan(&event.ID, &event.Name, &event.SKU, &event.Qty, &event.Price, &event.Active, &event.Version)
+		if err != nil {
+			s.log(ctx).Error("receive failed", zap.Error(err))
+			return nil, ErrInternal
+		}
+		err = outbox.Insert(ctx, tx, event)
+		if err != nil {
+			s.log(ctx).Error("receive failed", zap.Error(err))
+			return nil, ErrInternal
+		}
+		if _, ok := stock[productID]; !ok {
+			changed = append(changed, productID)
+		}
+		stock[productID] = event.Qty
+	}
+
+	_, err = tx.Exec(ctx, `
+	UPDATE purchase_orders SET status = CASE
+		WHEN NOT EXISTS (SELECT 1 FROM purchase_order_lines WHERE order_id = $1 AND received_qty < qty) THEN $2
+		ELSE $3
+	END
+	WHERE id = $1
+	`, id, StatusReceived, StatusPartiallyReceived)
+	if err != nil {
+		s.log(ctx).Error("receive failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	order, err := s.purchaseOrder(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		s.log(ctx).Error("receive failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+	if s.publisher != nil {
+		for _, productID := range changed {
+			s.publisher.Publish(managers.EventStockChanged, 0, &managers.StockChange{ProductID: productID, Qty: stock[productID]})
+		}
+	}
+	return order, nil
+}
+
+func (s *Service) changeStatus(ctx context.Context, id int64, status string, from ...string) (*PurchaseOrder, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		s.log(ctx).Error("change status failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	var current string
+	err = tx.QueryRow(ctx, `
+	SELECT status FROM purchase_orders WHERE id = $1 FOR UPDATE
+	`, id).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		s.log(ctx).Error("change status failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	allowed := false
+	for _, item := range from {
+		if item == current {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return nil, ErrInvalidStatus
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE purchase_orders SET status = $2 WHERE id = $1`, id, status)
+	if err != nil {
+		s.log(ctx).Error("change status failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	order, err := s.purchaseOrder(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		s.log(ctx).Error("change status failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return order, nil
+}
+
+// isForeignKeyViolation сообщает, что запрос сослался на несуществующую запись.
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
+
+// querier - общий интерфейс пула и транзакции для чтения.
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+func (s *Service) purchaseOrder(ctx context.Context, q querier, id int64) (*PurchaseOrder, error) {
+	order := &PurchaseOrder{Lines: make([]*PurchaseOrderLine, 0)}
+	err := q.QueryRow(ctx, `
+	SELECT id, supplier_id, manager_id, status, created FROM purchase_orders WHERE id = $1
+	`, id).Scan(&order.ID, &order.SupplierID, &order.ManagerID, &order.Status, &order.Created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		s.log(ctx).Error("purchase order failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	rows, err := q.Query(ctx, `
+	SELECT id, order_id, product_id, price, qty, received_qty, created FROM purchase_order_lines WHERE order_id = $1 ORDER BY id
+	`, id)
+	if err != nil {
+		s.log(ctx).Error("purchase order failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		line := &PurchaseOrderLine{}
+		err = rows.Scan(&line.ID, &line.OrderID, &line.ProductID, &line.Price, &line.Qty, &line.ReceivedQty, &line.Created)
+		if err != nil {
+			s.log(ctx).Error("purchase order failed", zap.Error(err))
+			return nil, ErrInternal
+		}
+		order.Lines = append(order.Lines, line)
+	}
+	err = rows.Err()
+	if err != nil {
+		s.log(ctx).Error("purchase order failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	return order, nil
+}
+
+func (s *Service) outstanding(ctx context.Context, tx pgx.Tx, id int64) ([]*Receipt, error) {
+	receipts := make([]*Receipt, 0)
+	rows, err := tx.Query(ctx, `
+	SELECT id, qty - received_qty FROM purchase_order_lines WHERE order_id = $1 AND received_qty < qty ORDER BY id
+	`, id)
+	if err != nil {
+		s.log(ctx).Error("outstanding failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		receipt := &Receipt{}
+		err = rows.Scan(&receipt.LineID, &receipt.Qty)
+		if err != nil {
+			s.log(ctx).Error("outstanding failed", zap.Error(err))
+			return nil, ErrInternal
+		}
+		receipts = append(receipts, receipt)
+	}
+	err = rows.Err()
+	if err != nil {
+		s.log(ctx).Error("outstanding failed", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	return receipts, nil
+}
@@ -0,0 +1,159 @@
+// Package tracing настраивает OpenTelemetry: экспорт спанов, HTTP-middleware и трассировку SQL.
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v4"
+	"github.com/shohinsherov/crud/cmd/app/middleware"
+	"github.com/shohinsherov/crud/pkg/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName - имя сервиса в ресурсах трассировки.
+const ServiceName = "crud"
+
+const instrumentation = "github.com/shohinsherov/crud/pkg/tracing"
+
+// Setup настраивает глобальный TracerProvider по конфигурации и возвращает функцию,
+// которая отправляет оставшиеся спаны и освобождает ресурсы. При exporter = none
+// спаны не записываются, но контекст трассировки из входящих запросов всё равно передаётся дальше.
+func Setup(ctx context.Context, cfg *config.Tracing) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if cfg.Exporter == "none" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	var closer io.Closer
+	switch cfg.Exporter {
+	case "otlp":
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+	case "stdout":
+		var writer io.Writer = os.Stdout
+		if cfg.File != "" {
+			file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				return nil, err
+			}
+			writer, closer = file, file
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(writer))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			closeErr := closer.Close()
+			if err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+// Middleware создаёт спан для каждого маршрута; имя спана - метод и шаблон маршрута.
+// Подключается через Router.Use, поэтому срабатывает только для найденных маршрутов.
+func Middleware(handler http.Handler) http.Handler {
+	tracer := otel.Tracer(instrumentation)
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		route := request.URL.Path
+		if current := mux.CurrentRoute(request); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+		ctx, span := tracer.Start(ctx, request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", request.Method),
+				attribute.String("http.route", route),
+				attribute.String("http.target", request.URL.Path),
+			),
+		)
+		defer span.End()
+
+		recorder := middleware.NewStatusRecorder(writer)
+		handler.ServeHTTP(recorder, request.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.status_code", recorder.Status()))
+		if recorder.Status() >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.Status()))
+		}
+	})
+}
+
+// QueryTracer превращает записи журнала pgx о выполненных запросах в спаны.
+// В pgx v4 нет отдельного хука трассировки, но журнал получает контекст запроса
+// и его длительность, поэтому спан восстанавливается задним числом.
+// Аргументы запросов в спаны не попадают: в них бывают пароли и токены.
+type QueryTracer struct {
+	tracer trace.Tracer
+}
+
+// NewQueryTracer создаёт трассировщик SQL для pgx.ConnConfig.Logger;
+// уровень журнала соединения должен быть не ниже pgx.LogLevelInfo.
+func NewQueryTracer() *QueryTracer {
+	return &QueryTracer{tracer: otel.Tracer(instrumentation)}
+}
+
+// Log реализует pgx.Logger.
+func (t *QueryTracer) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	duration, ok := data["time"].(time.Duration)
+	if !ok || !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		return
+	}
+	end := time.Now()
+	statement, _ := data["sql"].(string)
+
+	_, span := t.tracer.Start(ctx, "db."+msg,
+		trace.WithTimestamp(end.Add(-duration)),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.statement", statement),
+		),
+	)
+	if err, ok := data["err"].(error); ok {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	if rows, ok := data["rowCount"].(int); ok {
+		span.SetAttributes(attribute.Int("db.rows", rows))
+	}
+	span.End(trace.WithTimestamp(end))
+}
@@ -0,0 +1,13 @@
+// Package version хранит сведения о сборке. Значения подставляются при сборке:
+//
+//	go build -ldflags "-X github.com/shohinsherov/crud/pkg/version.Version=v1.2.0 \
+//		-X github.com/shohinsherov/crud/pkg/version.Commit=$(git rev-parse HEAD) \
+//		-X github.com/shohinsherov/crud/pkg/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd
+package version
+
+// Версия, коммит и время сборки; "unknown", если не заданы через -ldflags.
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
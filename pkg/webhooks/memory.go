@@ -0,0 +1,252 @@
+package webhooks
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/shohinsherov/crud/pkg/events"
+	"github.com/shohinsherov/crud/pkg/memstore"
+)
+
+// MemoryRepo - реализация Repository поверх хранилища в памяти.
+type MemoryRepo struct {
+	store *memstore.Store
+}
+
+// NewMemoryRepo создаёт репозиторий поверх store.
+func NewMemoryRepo(store *memstore.Store) *MemoryRepo {
+	return &MemoryRepo{store: store}
+}
+
+func (r *MemoryRepo) CreateWebhook(ctx context.Context, item *Webhook) (*Webhook, error) {
+	err := r.store.Tx(func(d *memstore.Data) error {
+		record := &memstore.Webhook{
+			ID:      d.NextID(),
+			URL:     item.URL,
+			Events:  append([]string(nil), item.Events...),
+			Secret:  item.Secret,
+			Created: d.Now(),
+		}
+		d.Webhooks[record.ID] = record
+		item.ID, item.Created = record.ID, record.Created
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (r *MemoryRepo) Webhooks(ctx context.Context) (items []*Webhook, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		items = make([]*Webhook, 0, len(d.Webhooks))
+		for _, record := range d.Webhooks {
+			items = append(items, webhookFrom(record))
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+		return nil
+	})
+	return items, err
+}
+
+func (r *MemoryRepo) WebhookByID(ctx context.Context, id int64) (item *Webhook, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		record, ok := d.Webhooks[id]
+		if !ok {
+			return ErrNotFound
+		}
+		item = webhookFrom(record)
+		return nil
+	})
+	return item, err
+}
+
+func (r *MemoryRepo) RemoveWebhook(ctx context.Context, id int64) error {
+	return r.store.Tx(func(d *memstore.Data) error {
+		if _, ok := d.Webhooks[id]; !ok {
+			return ErrNotFound
+		}
+		delete(d.Webhooks, id)
+		for deliveryID, record := range d.WebhookDeliveries {
+			if record.WebhookID == id {
+				delete(d.WebhookDeliveries, deliveryID)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *MemoryRepo) Deliveries(ctx context.Context, webhookID int64, limit int) (items []*Delivery, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		items = make([]*Delivery, 0)
+		for _, record := range d.WebhookDeliveries {
+			if record.WebhookID == webhookID {
+				items = append(items, deliveryFrom(d, record))
+			}
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].ID > items[j].ID })
+		if len(items) > limit {
+			items = items[:limit]
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (r *MemoryRepo) Fanout(ctx context.Context, limit int) (n int, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		webhooks := make([]*memstore.Webhook, 0, len(d.Webhooks))
+		for _, record := range d.Webhooks {
+			webhooks = append(webhooks, record)
+		}
+		sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+
+		for _, message := range d.Outbox {
+			if n == limit {
+				break
+			}
+			if message.Dispatched {
+				continue
+			}
+			for _, webhook := range webhooks {
+				if !subscribed(webhook.Events, message.Type) {
+					continue
+				}
+				record := &memstore.WebhookDelivery{
+					ID:          d.NextID(),
+					WebhookID:   webhook.ID,
+					MessageID:   message.ID,
+					Status:      StatusPending,
+					NextAttempt: d.Now(),
+					Created:     d.Now(),
+					Updated:     d.Now(),
+				}
+				d.WebhookDeliveries[record.ID] = record
+			}
+			message.Dispatched = true
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+func (r *MemoryRepo) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) (items []*Attempt, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		due := make([]*memstore.WebhookDelivery, 0)
+		for _, record := range d.WebhookDeliveries {
+			if record.Status == StatusPending && !record.NextAttempt.After(d.Now()) {
+				due = append(due, record)
+			}
+		}
+		sort.Slice(due, func(i, j int) bool {
+			if due[i].NextAttempt.Equal(due[j].NextAttempt) {
+				return due[i].ID < due[j].ID
+			}
+			return due[i].NextAttempt.Before(due[j].NextAttempt)
+		})
+		if len(due) > limit {
+			due = due[:limit]
+		}
+
+		items = make([]*Attempt, 0, len(due))
+		for _, record := range due {
+			record.NextAttempt = d.Now().Add(lease)
+			webhook := d.Webhooks[record.WebhookID]
+			message := outboxMessage(d, record.MessageID)
+			items = append(items, &Attempt{
+				Delivery: deliveryFrom(d, record),
+				URL:      webhook.URL,
+				Secret:   webhook.Secret,
+				Message: &events.Message{
+					ID:            message.ID,
+					Type:          message.Type,
+					Version:       message.Version,
+					AggregateType: message.AggregateType,
+					AggregateID:   message.AggregateID,
+					Payload:       append([]byte(nil), message.Payload...),
+					Created:       message.Created,
+				},
+			})
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (r *MemoryRepo) SaveAttempt(ctx context.Context, delivery *Delivery, retryAfter time.Duration) error {
+	return r.store.Tx(func(d *memstore.Data) error {
+		record, ok := d.WebhookDeliveries[delivery.ID]
+		if !ok || !record.NextAttempt.Equal(delivery.NextAttempt) {
+			return errLeaseExpired
+		}
+		record.Status = delivery.Status
+		record.Attempts = delivery.Attempts
+		record.ResponseStatus = delivery.ResponseStatus
+		record.Error = delivery.Error
+		record.NextAttempt = d.Now().Add(retryAfter)
+		record.Updated = d.Now()
+		return nil
+	})
+}
+
+func (r *MemoryRepo) PurgeDeliveries(ctx context.Context, retention time.Duration, pending string) (n int64, err error) {
+	err = r.store.Tx(func(d *memstore.Data) error {
+		before := d.Now().Add(-retention)
+		waiting := make(map[int64]bool)
+		for _, record := range d.WebhookDeliveries {
+			waiting[record.MessageID] = waiting[record.MessageID] || record.Status == pending
+		}
+		for id, record := range d.WebhookDeliveries {
+			message := outboxMessage(d, record.MessageID)
+			if !message.Dispatched || !message.Created.Before(before) || waiting[record.MessageID] {
+				continue
+			}
+			delete(d.WebhookDeliveries, id)
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+func subscribed(types []string, typ string) bool {
+	for _, item := range types {
+		if item == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func outboxMessage(d *memstore.Data, id int64) *memstore.OutboxMessage {
+	i := sort.Search(len(d.Outbox), func(i int) bool { return d.Outbox[i].ID >= id })
+	return d.Outbox[i]
+}
+
+func webhookFrom(record *memstore.Webhook) *Webhook {
+	return &Webhook{
+		ID:      record.ID,
+		URL:     record.URL,
+		Events:  append([]string(nil), record.Events...),
+		Secret:  record.Secret,
+		Created: record.Created,
+	}
+}
+
+func deliveryFrom(d *memstore.Data, record *memstore.WebhookDelivery) *Delivery {
+	return &Delivery{
+		ID:             record.ID,
+		WebhookID:      record.WebhookID,
+		MessageID:      record.MessageID,
+		Event:          outboxMessage(d, record.MessageID).Type,
+		Status:         record.Status,
+		Attempts:       record.Attempts,
+		NextAttempt:    record.NextAttempt,
+		ResponseStatus: record.ResponseStatus,
+		Error:          record.Error,
+		Created:        record.Created,
+		Updated:        record.Updated,
+	}
+}
@@ -0,0 +1,196 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shohinsherov/crud/pkg/events"
+)
+
+// PgxRepo - реализация Repository поверх Postgres.
+type PgxRepo struct {
+	pool *pgxpool.Pool
+}
+
+// NewPgxRepo создаёт репозиторий поверх пула соединений.
+func NewPgxRepo(pool *pgxpool.Pool) *PgxRepo {
+	return &PgxRepo{pool: pool}
+}
+
+func (r *PgxRepo) CreateWebhook(ctx context.Context, item *Webhook) (*Webhook, error) {
+	err := r.pool.QueryRow(ctx, `
+	INSERT INTO webhooks(url, events, secret) VALUES ($1, $2, $3) RETURNING id, created
+	`, item.URL, item.Events, item.Secret).Scan(&item.ID, &item.Created)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (r *PgxRepo) Webhooks(ctx context.Context) ([]*Webhook, error) {
+	rows, err := r.pool.Query(ctx, `SELECT id, url, events, secret, created FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*Webhook, 0)
+	for rows.Next() {
+		item := &Webhook{}
+		err = rows.Scan(&item.ID, &item.URL, &item.Events, &item.Secret, &item.Created)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *PgxRepo) WebhookByID(ctx context.Context, id int64) (*Webhook, error) {
+	item := &Webhook{}
+	err := r.pool.QueryRow(ctx, `
+	SELECT id, url, events, secret, created FROM webhooks WHERE id = $1
+	`, id).Scan(&item.ID, &item.URL, &item.Events, &item.Secret, &item.Created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (r *PgxRepo) RemoveWebhook(ctx context.Context, id int64) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PgxRepo) Deliveries(ctx context.Context, webhookID int64, limit int) ([]*Delivery, error) {
+	rows, err := r.pool.Query(ctx, `
+	SELECT d.id, d.webhook_id, d.message_id, m.type, d.status, d.attempts, d.next_attempt, d.response_status, d.error, d.created, d.updated
+	FROM webhook_deliveries d JOIN outbox m ON m.id = d.message_id
+	WHERE d.webhook_id = $1
+	ORDER BY d.id DESC
+	LIMIT $2
+	`, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*Delivery, 0)
+	for rows.Next() {
+		item := &Delivery{}
+		err = rows.Scan(&item.ID, &item.WebhookID, &item.MessageID, &item.Event, &item.Status, &item.Attempts, &item.NextAttempt, &item.ResponseStatus, &item.Error, &item.Created, &item.Updated)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Fanout блокирует события через SKIP LOCKED, поэтому несколько экземпляров не разошлют одно событие дважды.
+func (r *PgxRepo) Fanout(ctx context.Context, limit int) (int, error) {
+	tag, err := r.pool.Exec(ctx, `
+	WITH messages AS (
+		SELECT id, type FROM outbox WHERE dispatched IS NULL ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED
+	), deliveries AS (
+		INSERT INTO webhook_deliveries(webhook_id, message_id)
+		SELECT w.id, m.id FROM messages m JOIN webhooks w ON m.type = ANY(w.events)
+		ON CONFLICT (webhook_id, message_id) DO NOTHING
+	)
+	UPDATE outbox SET dispatched = CURRENT_TIMESTAMP WHERE id IN (SELECT id FROM messages)
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (r *PgxRepo) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*Attempt, error) {
+	rows, err := r.pool.Query(ctx, `
+	UPDATE webhook_deliveries d SET next_attempt = CURRENT_TIMESTAMP + $3::INTERVAL
+	FROM webhooks w, outbox m
+	WHERE d.id IN (
+		SELECT id FROM webhook_deliveries
+		WHERE status = $2 AND next_attempt <= CURRENT_TIMESTAMP
+		ORDER BY next_attempt, id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	) AND w.id = d.webhook_id AND m.id = d.message_id
+	RETURNING d.id, d.webhook_id, d.message_id, d.status, d.attempts, d.next_attempt, d.response_status, d.error, d.created, d.updated,
+		w.url, w.secret, m.type, m.version, m.aggregate_type, m.aggregate_id, m.payload, m.created
+	`, limit, StatusPending, lease)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*Attempt, 0)
+	for rows.Next() {
+		delivery := &Delivery{}
+		message := &events.Message{}
+		item := &Attempt{Delivery: delivery, Message: message}
+		err = rows.Scan(
+			&delivery.ID, &delivery.WebhookID, &delivery.MessageID, &delivery.Status, &delivery.Attempts, &delivery.NextAttempt,
+			&delivery.ResponseStatus, &delivery.Error, &delivery.Created, &delivery.Updated,
+			&item.URL, &item.Secret, &message.Type, &message.Version, &message.AggregateType, &message.AggregateID, &message.Payload, &message.Created,
+		)
+		if err != nil {
+			return nil, err
+		}
+		message.ID = delivery.MessageID
+		delivery.Event = message.Type
+		items = append(items, item)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *PgxRepo) SaveAttempt(ctx context.Context, delivery *Delivery, retryAfter time.Duration) error {
+	tag, err := r.pool.Exec(ctx, `
+	UPDATE webhook_deliveries
+	SET status = $2, attempts = $3, response_status = $4, error = $5, next_attempt = CURRENT_TIMESTAMP + $6::INTERVAL, updated = CURRENT_TIMESTAMP
+	WHERE id = $1 AND next_attempt = $7
+	`, delivery.ID, delivery.Status, delivery.Attempts, delivery.ResponseStatus, delivery.Error, retryAfter, delivery.NextAttempt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errLeaseExpired
+	}
+	return nil
+}
+
+func (r *PgxRepo) PurgeDeliveries(ctx context.Context, retention time.Duration, pending string) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `
+	DELETE FROM webhook_deliveries d USING outbox m
+	WHERE d.message_id = m.id AND m.dispatched IS NOT NULL AND m.created < CURRENT_TIMESTAMP - $1::INTERVAL
+		AND NOT EXISTS (SELECT 1 FROM webhook_deliveries p WHERE p.message_id = m.id AND p.status = $2)
+	`, retention, pending)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
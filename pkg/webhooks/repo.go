@@ -0,0 +1,29 @@
+package webhooks
+
+import (
+	"context"
+	"time"
+)
+
+// Repository хранит вебхуки и их доставки и читает события из outbox.
+type Repository interface {
+	CreateWebhook(ctx context.Context, item *Webhook) (*Webhook, error)
+	Webhooks(ctx context.Context) ([]*Webhook, error)
+	WebhookByID(ctx context.Context, id int64) (*Webhook, error)
+	RemoveWebhook(ctx context.Context, id int64) error
+	// Deliveries возвращает последние limit доставок вебхука, начиная с новых.
+	Deliveries(ctx context.Context, webhookID int64, limit int) ([]*Delivery, error)
+	// Fanout берёт до limit ещё не разосланных событий outbox по порядку, создаёт по доставке для каждого
+	// вебхука, подписанного на тип события, отмечает события разосланными и возвращает их число.
+	Fanout(ctx context.Context, limit int) (int, error)
+	// ClaimDeliveries возвращает до limit доставок в статусе PENDING, время попытки которых наступило,
+	// и откладывает их следующую попытку на lease, чтобы другой экземпляр не взял их одновременно.
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*Attempt, error)
+	// SaveAttempt сохраняет статус, число попыток и результат последней из них; следующая попытка -
+	// через retryAfter. Если next_attempt доставки уже не тот, что выдал ClaimDeliveries, аренда истекла
+	// и возвращается errLeaseExpired.
+	SaveAttempt(ctx context.Context, delivery *Delivery, retryAfter time.Duration) error
+	// PurgeDeliveries удаляет доставки разосланных событий outbox старше retention, если ни одна доставка
+	// события не в статусе pending, и возвращает их число.
+	PurgeDeliveries(ctx context.Context, retention time.Duration, pending string) (int64, error)
+}
@@ -0,0 +1,394 @@
+// Package webhooks отправляет события из outbox внешним системам (ERP, CRM) по подпискам, которые
+// заводит администратор. Запросы подписаны HMAC-SHA256; неудачные доставки повторяются с растущей паузой.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/shohinsherov/crud/pkg/config"
+	"github.com/shohinsherov/crud/pkg/events"
+	"github.com/shohinsherov/crud/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// ErrNotFound возвращается, когда вебхук не найден.
+var ErrNotFound = errors.New("webhook not found")
+
+// ErrInvalidWebhook возвращается, когда адрес, типы событий или секрет вебхука некорректны.
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// ErrInternal возвращается, когда произошла внутренняя ошибка.
+var ErrInternal = errors.New("internal error")
+
+// errLeaseExpired возвращается из SaveAttempt, когда доставку успел взять другой экземпляр
+// или её удалили вместе с вебхуком: результат попытки уже не нужен.
+var errLeaseExpired = errors.New("webhook delivery lease expired")
+
+// Статусы доставки.
+const (
+	StatusPending   = "PENDING"
+	StatusDelivered = "DELIVERED"
+	StatusFailed    = "FAILED"
+)
+
+// Заголовки запроса к подписчику.
+const (
+	// SignatureHeader - "sha256=" и HMAC-SHA256 секрета вебхука от "<TimestampHeader>.<тело запроса>" в hex.
+	SignatureHeader = "X-Webhook-Signature"
+	// TimestampHeader - время отправки в секундах Unix; подписчик может отклонять старые запросы.
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	// DeliveryHeader - номер доставки; при повторе он тот же, по нему подписчик отсеивает дубли.
+	DeliveryHeader = "X-Webhook-Delivery"
+)
+
+// MinSecretLength - наименьшая длина секрета, заданного администратором.
+const MinSecretLength = 16
+
+// batchSize - сколько событий и доставок обрабатывается за один проход.
+const batchSize = 100
+
+// DefaultDeliveriesLimit и MaxDeliveriesLimit - сколько доставок возвращает Deliveries по умолчанию и
+// наибольшее значение limit.
+const (
+	DefaultDeliveriesLimit = 50
+	MaxDeliveriesLimit     = 500
+)
+
+// maxErrorLength - сколько символов ошибки попытки сохраняется в журнале доставок.
+const maxErrorLength = 500
+
+// Webhook - подписка внешней системы на события. Секрет возвращается только при создании.
+type Webhook struct {
+	ID      int64     `json:"id"`
+	URL     string    `json:"url"`
+	Events  []string  `json:"events"`
+	Secret  string    `json:"secret,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// Delivery - доставка одного события одному вебхуку и результат последней попытки.
+type Delivery struct {
+	ID          int64     `json:"id"`
+	WebhookID   int64     `json:"webhook_id"`
+	MessageID   int64     `json:"message_id"`
+	Event       string    `json:"event"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	// ResponseStatus - HTTP-код ответа на последнюю попытку, 0 - ответа не было.
+	ResponseStatus int       `json:"response_status"`
+	Error          string    `json:"error"`
+	Created        time.Time `json:"created"`
+	Updated        time.Time `json:"updated"`
+}
+
+// Payload - тело запроса к подписчику; Data - событие из пакета events в формате версии Version
+// (events.SchemaVersion на момент записи события).
+type Payload struct {
+	ID      int64           `json:"id"`
+	Type    string          `json:"type"`
+	Version int             `json:"version"`
+	Created time.Time       `json:"created"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Attempt - доставка, время попытки которой наступило, вместе с адресом, секретом и событием.
+type Attempt struct {
+	Delivery *Delivery
+	URL      string
+	Secret   string
+	Message  *events.Message
+}
+
+// Service управляет вебхуками и доставляет события.
+type Service struct {
+	repo        Repository
+	client      *http.Client
+	logger      *zap.Logger
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	lease       time.Duration
+}
+
+// NewService создаёт сервис.
+func NewService(repo Repository, cfg *config.Webhooks, logger *zap.Logger) *Service {
+	return &Service{
+		repo:        repo,
+		client:      &http.Client{Timeout: cfg.Timeout.Duration()},
+		logger:      logger,
+		maxAttempts: cfg.MaxAttempts,
+		backoff:     cfg.Backoff.Duration(),
+		maxBackoff:  cfg.MaxBackoff.Duration(),
+		// Пока идёт попытка, доставку не должен взять другой экземпляр: попытка длится не дольше Timeout.
+		lease: 2 * cfg.Timeout.Duration(),
+	}
+}
+
+// log возвращает логгер с идентификатором запроса из ctx.
+func (s *Service) log(ctx context.Context) *zap.Logger {
+	return logging.For(ctx, s.logger)
+}
+
+// fail возвращает ErrNotFound как есть, а остальные ошибки логирует и заменяет на ErrInternal.
+func (s *Service) fail(ctx context.Context, op string, err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return err
+	}
+	s.log(ctx).Error(op+" failed", zap.Error(err))
+	return ErrInternal
+}
+
+// Create проверяет и сохраняет вебхук. Если секрет не задан, он генерируется; в ответе секрет есть
+// только здесь.
+func (s *Service) Create(ctx context.Context, item *Webhook) (*Webhook, error) {
+	err := validate(item)
+	if err != nil {
+		return nil, err
+	}
+	if item.Secret == "" {
+		secret := make([]byte, 32)
+		_, err = rand.Read(secret)
+		if err != nil {
+			return nil, s.fail(ctx, "create webhook", err)
+		}
+		item.Secret = hex.EncodeToString(secret)
+	}
+
+	item, err = s.repo.CreateWebhook(ctx, item)
+	if err != nil {
+		return nil, s.fail(ctx, "create webhook", err)
+	}
+	return item, nil
+}
+
+func validate(item *Webhook) error {
+	address, err := url.Parse(item.URL)
+	if err != nil || (address.Scheme != "http" && address.Scheme != "https") || address.Host == "" {
+		return ErrInvalidWebhook
+	}
+	if len(item.Events) == 0 {
+		return ErrInvalidWebhook
+	}
+	for _, event := range item.Events {
+		known := false
+		for _, typ := range events.Types {
+			known = known || event == typ
+		}
+		if !known {
+			return ErrInvalidWebhook
+		}
+	}
+	if item.Secret != "" && len(item.Secret) < MinSecretLength {
+		return ErrInvalidWebhook
+	}
+	return nil
+}
+
+// Webhooks возвращает вебхуки без секретов.
+func (s *Service) Webhooks(ctx context.Context) ([]*Webhook, error) {
+	items, err := s.repo.Webhooks(ctx)
+	if err != nil {
+		return nil, s.fail(ctx, "webhooks", err)
+	}
+	for _, item := range items {
+		item.Secret = ""
+	}
+	return items, nil
+}
+
+// WebhookByID возвращает вебхук без секрета или ErrNotFound.
+func (s *Service) WebhookByID(ctx context.Context, id int64) (*Webhook, error) {
+	item, err := s.repo.WebhookByID(ctx, id)
+	if err != nil {
+		return nil, s.fail(ctx, "webhook by id", err)
+	}
+	item.Secret = ""
+	return item, nil
+}
+
+// Remove удаляет вебхук вместе с журналом его доставок.
+func (s *Service) Remove(ctx context.Context, id int64) error {
+	err := s.repo.RemoveWebhook(ctx, id)
+	if err != nil {
+		return s.fail(ctx, "remove webhook", err)
+	}
+	return nil
+}
+
+// Deliveries возвращает последние limit доставок вебхука, начиная с новых. Ноль - DefaultDeliveriesLimit,
+// больше MaxDeliveriesLimit - MaxDeliveriesLimit.
+func (s *Service) Deliveries(ctx context.Context, webhookID int64, limit int) ([]*Delivery, error) {
+	if limit <= 0 {
+		limit = DefaultDeliveriesLimit
+	}
+	if limit > MaxDeliveriesLimit {
+		limit = MaxDeliveriesLimit
+	}
+	_, err := s.repo.WebhookByID(ctx, webhookID)
+	if err != nil {
+		return nil, s.fail(ctx, "webhook deliveries", err)
+	}
+	items, err := s.repo.Deliveries(ctx, webhookID, limit)
+	if err != nil {
+		return nil, s.fail(ctx, "webhook deliveries", err)
+	}
+	return items, nil
+}
+
+// Dispatch создаёт доставки новых событий из outbox и выполняет попытки, время которых наступило.
+// Возвращает число разосланных событий и выполненных попыток.
+func (s *Service) Dispatch(ctx context.Context) (messages int, attempts int, err error) {
+	messages, err = s.repo.Fanout(ctx, batchSize)
+	if err != nil {
+		return 0, 0, s.fail(ctx, "webhooks fanout", err)
+	}
+	// Доставки берутся по одной: аренда рассчитана на одну попытку, и пока идёт очередь,
+	// у следующих доставок она не истекает.
+	for attempts < batchSize {
+		due, err := s.repo.ClaimDeliveries(ctx, 1, s.lease)
+		if err != nil {
+			return messages, attempts, s.fail(ctx, "claim webhook deliveries", err)
+		}
+		if len(due) == 0 {
+			break
+		}
+		err = s.deliver(ctx, due[0])
+		if errors.Is(err, errLeaseExpired) {
+			s.log(ctx).Warn("webhook attempt discarded: lease expired", zap.Int64("delivery_id", due[0].Delivery.ID))
+		} else if err != nil {
+			return messages, attempts, s.fail(ctx, "save webhook attempt", err)
+		}
+		attempts++
+	}
+	return messages, attempts, nil
+}
+
+// deliver выполняет одну попытку и сохраняет её результат. Ответ 2xx - доставлено; иначе попытка
+// повторяется через retryDelay, пока их не станет maxAttempts.
+func (s *Service) deliver(ctx context.Context, attempt *Attempt) error {
+	delivery := attempt.Delivery
+	delivery.Attempts++
+	status, err := s.send(ctx, attempt)
+	delivery.ResponseStatus = status
+	delivery.Error = ""
+	if err == nil && (status < 200 || status > 299) {
+		err = fmt.Errorf("unexpected response status %d", status)
+	}
+
+	var retryAfter time.Duration
+	switch {
+	case err == nil:
+		delivery.Status = StatusDelivered
+	case delivery.Attempts >= s.maxAttempts:
+		delivery.Status = StatusFailed
+	default:
+		delivery.Status = StatusPending
+		retryAfter = s.retryDelay(delivery.Attempts)
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+		if len(delivery.Error) > maxErrorLength {
+			delivery.Error = delivery.Error[:maxErrorLength]
+		}
+		s.log(ctx).Warn("webhook delivery failed",
+			zap.Int64("webhook_id", delivery.WebhookID),
+			zap.Int64("delivery_id", delivery.ID),
+			zap.Int("attempts", delivery.Attempts),
+			zap.Error(err))
+	}
+	return s.repo.SaveAttempt(ctx, delivery, retryAfter)
+}
+
+// send отправляет событие подписчику и возвращает код ответа.
+func (s *Service) send(ctx context.Context, attempt *Attempt) (int, error) {
+	body, err := json.Marshal(&Payload{
+		ID:      attempt.Message.ID,
+		Type:    attempt.Message.Type,
+		Version: attempt.Message.Version,
+		Created: attempt.Message.Created,
+		Data:    attempt.Message.Payload,
+	})
+	if err != nil {
+		return 0, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, attempt.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, attempt.Message.Type)
+	request.Header.Set(DeliveryHeader, strconv.FormatInt(attempt.Delivery.ID, 10))
+	request.Header.Set(TimestampHeader, timestamp)
+	request.Header.Set(SignatureHeader, Sign(attempt.Secret, timestamp, body))
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	return response.StatusCode, nil
+}
+
+// retryDelay возвращает паузу после attempts неудачных попыток: backoff, 2*backoff, 4*backoff ... до maxBackoff.
+func (s *Service) retryDelay(attempts int) time.Duration {
+	delay := s.backoff
+	for i := 1; i < attempts && delay < s.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > s.maxBackoff {
+		delay = s.maxBackoff
+	}
+	return delay
+}
+
+// Sign возвращает значение заголовка SignatureHeader для тела body, отправленного в момент timestamp.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// PurgeDeliveries удаляет доставки событий старше retention, если все доставки события завершены:
+// пока на событие ссылается доставка, его нельзя удалить из outbox.
+func (s *Service) PurgeDeliveries(ctx context.Context, retention time.Duration) (int64, error) {
+	return s.repo.PurgeDeliveries(ctx, retention, StatusPending)
+}
+
+// RunDispatcher раз в interval рассылает новые события и повторяет доставки, пока не отменён ctx.
+func (s *Service) RunDispatcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		messages, attempts, err := s.Dispatch(ctx)
+		if err != nil {
+			s.log(ctx).Error("run webhooks dispatcher failed", zap.Error(err))
+		}
+		if messages > 0 || attempts > 0 {
+			s.log(ctx).Info("dispatched webhooks", zap.Int("messages", messages), zap.Int("attempts", attempts))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
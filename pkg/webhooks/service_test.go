@@ -0,0 +1,307 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shohinsherov/crud/pkg/config"
+	"github.com/shohinsherov/crud/pkg/events"
+	"github.com/shohinsherov/crud/pkg/memstore"
+	"github.com/shohinsherov/crud/pkg/outbox"
+	"go.uber.org/zap"
+)
+
+// receiver - подписчик, который проверяет подпись и отвечает кодами из statuses по очереди.
+type receiver struct {
+	t        *testing.T
+	secret   string
+	mu       sync.Mutex
+	statuses []int
+	payloads []*Payload
+}
+
+func (r *receiver) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		r.t.Errorf("read body: %v", err)
+		return
+	}
+	signature := Sign(r.secret, request.Header.Get(TimestampHeader), body)
+	if request.Header.Get(SignatureHeader) != signature {
+		r.t.Errorf("signature: got %q, want %q", request.Header.Get(SignatureHeader), signature)
+	}
+	payload := &Payload{}
+	err = json.Unmarshal(body, payload)
+	if err != nil {
+		r.t.Errorf("decode payload: %v", err)
+	}
+	if request.Header.Get(EventHeader) != payload.Type {
+		r.t.Errorf("event header: got %q, want %q", request.Header.Get(EventHeader), payload.Type)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.payloads = append(r.payloads, payload)
+	status := http.StatusOK
+	if len(r.statuses) != 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	writer.WriteHeader(status)
+}
+
+func newTestService(t *testing.T, maxAttempts int) (*Service, *memstore.Store, *time.Time) {
+	t.Helper()
+	store := memstore.New()
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	store.SetClock(func() time.Time { return now })
+	cfg := &config.Webhooks{
+		Timeout:     config.Duration(time.Second),
+		MaxAttempts: maxAttempts,
+		Backoff:     config.Duration(time.Minute),
+		MaxBackoff:  config.Duration(time.Hour),
+	}
+	return NewService(NewMemoryRepo(store), cfg, zap.NewNop()), store, &now
+}
+
+func addEvent(t *testing.T, store *memstore.Store, event events.Event) {
+	t.Helper()
+	err := store.Tx(func(d *memstore.Data) error {
+		return outbox.Add(d, event)
+	})
+	if err != nil {
+		t.Fatalf("add message: %v", err)
+	}
+}
+
+func dispatch(t *testing.T, svc *Service) (int, int) {
+	t.Helper()
+	messages, attempts, err := svc.Dispatch(context.Background())
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	return messages, attempts
+}
+
+func TestService_Create(t *testing.T) {
+	svc, _, _ := newTestService(t, 3)
+	ctx := context.Background()
+
+	invalid := []*Webhook{
+		{URL: "ftp://erp.example.com/hook", Events: []string{events.TypeSaleCreated}},
+		{URL: "https://", Events: []string{events.TypeSaleCreated}},
+		{URL: "https://erp.example.com/hook"},
+		{URL: "https://erp.example.com/hook", Events: []string{"sale.deleted"}},
+		{URL: "https://erp.example.com/hook", Events: []string{events.TypeSaleCreated}, Secret: "short"},
+	}
+	for _, item := range invalid {
+		_, err := svc.Create(ctx, item)
+		if !errors.Is(err, ErrInvalidWebhook) {
+			t.Errorf("create %+v: got %v, want %v", item, err, ErrInvalidWebhook)
+		}
+	}
+
+	created, err := svc.Create(ctx, &Webhook{URL: "https://erp.example.com/hook", Events: []string{events.TypeSaleCreated}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if created.ID == 0 || len(created.Secret) != 64 {
+		t.Errorf("create: unexpected webhook %+v", created)
+	}
+
+	found, err := svc.WebhookByID(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("by id: %v", err)
+	}
+	if found.Secret != "" || found.URL != created.URL {
+		t.Errorf("by id: unexpected webhook %+v", found)
+	}
+
+	err = svc.Remove(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	_, err = svc.WebhookByID(ctx, created.ID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("by removed id: got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestService_DispatchRetries(t *testing.T) {
+	svc, store, now := newTestService(t, 3)
+	ctx := context.Background()
+	handler := &receiver{t: t, secret: "0123456789abcdef", statuses: []int{http.StatusInternalServerError}}
+	subscriber := httptest.NewServer(handler)
+	defer subscriber.Close()
+
+	webhook, err := svc.Create(ctx, &Webhook{URL: subscriber.URL, Events: []string{events.TypeCustomerBlocked}, Secret: handler.secret})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	addEvent(t, store, &events.SaleCreated{ID: 1})
+	addEvent(t, store, &events.CustomerBlocked{ID: 2})
+
+	messages, attempts := dispatch(t, svc)
+	if messages != 2 || attempts != 1 {
+		t.Fatalf("first dispatch: got %d messages, %d attempts, want 2, 1", messages, attempts)
+	}
+	// Повтор ещё не наступил.
+	messages, attempts = dispatch(t, svc)
+	if messages != 0 || attempts != 0 {
+		t.Fatalf("second dispatch: got %d messages, %d attempts, want 0, 0", messages, attempts)
+	}
+
+	*now = now.Add(time.Minute)
+	_, attempts = dispatch(t, svc)
+	if attempts != 1 {
+		t.Fatalf("retry: got %d attempts, want 1", attempts)
+	}
+
+	if len(handler.payloads) != 2 {
+		t.Fatalf("got %d requests, want 2", len(handler.payloads))
+	}
+	if payload := handler.payloads[1]; payload.Type != events.TypeCustomerBlocked || payload.Version != events.SchemaVersion || string(payload.Data) != `{"id":2}` {
+		t.Errorf("unexpected payload: %+v", payload)
+	}
+
+	deliveries, err := svc.Deliveries(ctx, webhook.ID, 10)
+	if err != nil {
+		t.Fatalf("deliveries: %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(deliveries))
+	}
+	delivery := deliveries[0]
+	if delivery.Status != StatusDelivered || delivery.Attempts != 2 || delivery.ResponseStatus != http.StatusOK || delivery.Error != "" {
+		t.Errorf("unexpected delivery: %+v", delivery)
+	}
+}
+
+func TestService_DispatchFails(t *testing.T) {
+	svc, store, now := newTestService(t, 2)
+	ctx := context.Background()
+	handler := &receiver{t: t, secret: "0123456789abcdef", statuses: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusOK}}
+	subscriber := httptest.NewServer(handler)
+	defer subscriber.Close()
+
+	webhook, err := svc.Create(ctx, &Webhook{URL: subscriber.URL, Events: []string{events.TypeSaleCreated}, Secret: handler.secret})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	addEvent(t, store, &events.SaleCreated{ID: 1})
+
+	for i := 0; i < 3; i++ {
+		dispatch(t, svc)
+		*now = now.Add(time.Hour)
+	}
+	if len(handler.payloads) != 2 {
+		t.Fatalf("got %d requests, want 2", len(handler.payloads))
+	}
+
+	deliveries, err := svc.Deliveries(ctx, webhook.ID, 10)
+	if err != nil {
+		t.Fatalf("deliveries: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Status != StatusFailed || deliveries[0].ResponseStatus != http.StatusBadGateway {
+		t.Errorf("unexpected deliveries: %+v", deliveries)
+	}
+}
+
+func TestService_RetryDelay(t *testing.T) {
+	svc, _, _ := newTestService(t, 10)
+	want := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 16 * time.Minute, 32 * time.Minute, time.Hour, time.Hour}
+	for i, delay := range want {
+		got := svc.retryDelay(i + 1)
+		if got != delay {
+			t.Errorf("retry delay after %d attempts: got %v, want %v", i+1, got, delay)
+		}
+	}
+}
+
+func TestMemoryRepo_SaveAttemptAfterLease(t *testing.T) {
+	svc, store, now := newTestService(t, 3)
+	ctx := context.Background()
+	repo := NewMemoryRepo(store)
+
+	_, err := svc.Create(ctx, &Webhook{URL: "http://localhost/hook", Events: []string{events.TypeSaleCreated}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	addEvent(t, store, &events.SaleCreated{ID: 1})
+	_, err = repo.Fanout(ctx, batchSize)
+	if err != nil {
+		t.Fatalf("fanout: %v", err)
+	}
+
+	first, err := repo.ClaimDeliveries(ctx, 1, svc.lease)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("first claim: got %d, %v, want 1 delivery", len(first), err)
+	}
+	// Попытка затянулась, и доставку взял другой экземпляр.
+	*now = now.Add(svc.lease)
+	second, err := repo.ClaimDeliveries(ctx, 1, svc.lease)
+	if err != nil || len(second) != 1 {
+		t.Fatalf("second claim: got %d, %v, want 1 delivery", len(second), err)
+	}
+
+	first[0].Delivery.Status = StatusDelivered
+	err = repo.SaveAttempt(ctx, first[0].Delivery, 0)
+	if !errors.Is(err, errLeaseExpired) {
+		t.Fatalf("save stale attempt: got %v, want %v", err, errLeaseExpired)
+	}
+	second[0].Delivery.Status = StatusDelivered
+	err = repo.SaveAttempt(ctx, second[0].Delivery, 0)
+	if err != nil {
+		t.Fatalf("save attempt: %v", err)
+	}
+}
+
+func TestService_PurgeDeliveries(t *testing.T) {
+	svc, store, now := newTestService(t, 3)
+	ctx := context.Background()
+	repo := NewMemoryRepo(store)
+
+	webhook, err := svc.Create(ctx, &Webhook{URL: "http://localhost/hook", Events: []string{events.TypeSaleCreated}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	addEvent(t, store, &events.SaleCreated{ID: 1})
+	addEvent(t, store, &events.SaleCreated{ID: 2})
+	_, err = repo.Fanout(ctx, batchSize)
+	if err != nil {
+		t.Fatalf("fanout: %v", err)
+	}
+	// Доставка первого события завершена, второго ждёт повтора.
+	attempts, err := repo.ClaimDeliveries(ctx, 1, svc.lease)
+	if err != nil || len(attempts) != 1 {
+		t.Fatalf("claim: got %d, %v, want 1 delivery", len(attempts), err)
+	}
+	attempts[0].Delivery.Status = StatusDelivered
+	err = repo.SaveAttempt(ctx, attempts[0].Delivery, 0)
+	if err != nil {
+		t.Fatalf("save attempt: %v", err)
+	}
+
+	n, err := svc.PurgeDeliveries(ctx, 24*time.Hour)
+	if err != nil || n != 0 {
+		t.Fatalf("purge fresh deliveries: got %d, %v, want 0", n, err)
+	}
+	*now = now.Add(25 * time.Hour)
+	n, err = svc.PurgeDeliveries(ctx, 24*time.Hour)
+	if err != nil || n != 1 {
+		t.Fatalf("purge deliveries: got %d, %v, want 1", n, err)
+	}
+	deliveries, err := svc.Deliveries(ctx, webhook.ID, DefaultDeliveriesLimit)
+	if err != nil {
+		t.Fatalf("deliveries: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].MessageID == attempts[0].Delivery.MessageID || deliveries[0].Status != StatusPending {
+		t.Errorf("deliveries after purge: got %+v", deliveries)
+	}
+}
@@ -0,0 +1,71 @@
+// Package workers управляет фоновыми задачами приложения.
+package workers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Group запускает фоновые задачи с общим контекстом и дожидается их завершения при остановке.
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+// New создаёт группу фоновых задач.
+func New(logger *zap.Logger) *Group {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Group{ctx: ctx, cancel: cancel, logger: logger, running: make(map[string]bool)}
+}
+
+// Go запускает задачу fn; её контекст отменяется при вызове Stop.
+func (g *Group) Go(name string, fn func(ctx context.Context)) {
+	g.wg.Add(1)
+	g.setRunning(name, true)
+	go func() {
+		defer g.wg.Done()
+		g.logger.Info("worker started", zap.String("worker", name))
+		fn(g.ctx)
+		g.setRunning(name, false)
+		g.logger.Info("worker stopped", zap.String("worker", name))
+	}()
+}
+
+func (g *Group) setRunning(name string, running bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.running[name] = running
+}
+
+// Check возвращает ошибку, если какая-либо из запущенных задач завершилась.
+func (g *Group) Check(ctx context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	stopped := make([]string, 0)
+	for name, running := range g.running {
+		if !running {
+			stopped = append(stopped, name)
+		}
+	}
+	if len(stopped) == 0 {
+		return nil
+	}
+	sort.Strings(stopped)
+	return fmt.Errorf("workers stopped: %s", strings.Join(stopped, ", "))
+}
+
+// Stop отменяет контекст задач и ждёт, пока все они завершатся.
+func (g *Group) Stop() {
+	g.cancel()
+	g.wg.Wait()
+}
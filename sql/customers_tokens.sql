@@ -1,7 +0,0 @@
-CREATE TABLE customers_tokens 
-(
-    token TEXT NOT NULL UNIQUE,
-    customer_id BIGINT NOT NULL REFERENCES customers,
-    expire  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP + INTERVAL '1 hour',
-    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-);
\ No newline at end of file